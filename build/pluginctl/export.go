@@ -0,0 +1,84 @@
+// Copyright (c) 2019-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+const exportPerPage = 1000 // exportPerPage is the number of records to fetch per API call
+
+// exportNextCursorHeader contains the cursor of the next page of an export. It matches ExportNextCursorHeader in the
+// plugin.
+const exportNextCursorHeader = "X-Feedbackbot-Next-Cursor"
+
+// export downloads the survey responses and feedback stored by the plugin one page at a time and writes them to
+// outputPath, or to stdout if outputPath is empty.
+func export(ctx context.Context, client *model.Client4, pluginID, format, outputPath string) error {
+	var out io.Writer = os.Stdout
+	if outputPath != "" {
+		file, err := os.Create(outputPath)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", outputPath, err)
+		}
+		defer file.Close()
+
+		out = file
+	}
+
+	return exportPages(ctx, client, pluginID, format, out)
+}
+
+// exportPages fetches pages of exported records, passing the cursor returned with each page to get the next one,
+// until a page is received without one. Since CSV pages only contain a header on the first page, the pages can be
+// written one after another. Each page has its own timeout so that large exports aren't cut short.
+func exportPages(ctx context.Context, client *model.Client4, pluginID, format string, out io.Writer) error {
+	cursor := ""
+	for page := 0; ; page++ {
+		next, err := exportPage(ctx, client, pluginID, format, cursor, out)
+		if err != nil {
+			return fmt.Errorf("failed to export page %d: %w", page, err)
+		}
+
+		if next == "" {
+			return nil
+		}
+
+		cursor = next
+	}
+}
+
+// exportPage writes the page of exported records that starts at the given cursor to out, returning the cursor of the
+// next page or an empty string if it's the last one.
+func exportPage(ctx context.Context, client *model.Client4, pluginID, format, cursor string, out io.Writer) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, commandTimeout)
+	defer cancel()
+
+	query := url.Values{}
+	query.Set("format", format)
+	query.Set("per_page", strconv.Itoa(exportPerPage))
+	if cursor != "" {
+		query.Set("cursor", cursor)
+	}
+
+	resp, err := client.DoAPIRequest(ctx, http.MethodGet, fmt.Sprintf("%s/plugins/%s/api/v1/export?%s", client.URL, pluginID, query.Encode()), "", "")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if _, err := io.Copy(out, resp.Body); err != nil {
+		return "", err
+	}
+
+	return resp.Header.Get(exportNextCursorHeader), nil
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2019-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportPages(t *testing.T) {
+	var requestedCursors []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/plugins/com.mattermost.nps/api/v1/export", r.URL.Path)
+		assert.Equal(t, "csv", r.URL.Query().Get("format"))
+		assert.Equal(t, strconv.Itoa(exportPerPage), r.URL.Query().Get("per_page"))
+
+		cursor := r.URL.Query().Get("cursor")
+		requestedCursors = append(requestedCursors, cursor)
+
+		switch cursor {
+		case "":
+			w.Header().Set(exportNextCursorHeader, "first")
+			fmt.Fprint(w, "header\nrow\n")
+		case "first":
+			w.Header().Set(exportNextCursorHeader, "second")
+			fmt.Fprint(w, "\"multi\nline\"\n")
+		case "second":
+			// The last page can be full, but it has no cursor
+			fmt.Fprint(w, "last\n")
+		}
+	}))
+	defer server.Close()
+
+	var out bytes.Buffer
+	err := exportPages(context.Background(), model.NewAPIv4Client(server.URL), "com.mattermost.nps", "csv", &out)
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"", "first", "second"}, requestedCursors)
+	assert.Equal(t, "header\nrow\n\"multi\nline\"\nlast\n", out.String())
+}
@@ -24,6 +24,7 @@ Usage:
     pluginctl disable <plugin id>
     pluginctl enable <plugin id>
     pluginctl reset <plugin id>
+    pluginctl export <plugin id> <csv|ndjson> [output file]
 `
 
 func main() {
@@ -62,6 +63,15 @@ func pluginctl() error {
 		return resetPlugin(ctx, client, os.Args[2])
 	case "logs":
 		return logs(ctx, client, os.Args[2])
+	case "export":
+		if len(os.Args) < 4 {
+			return errors.New("invalid number of arguments")
+		}
+		outputPath := ""
+		if len(os.Args) > 4 {
+			outputPath = os.Args[4]
+		}
+		return export(context.WithoutCancel(ctx), client, os.Args[2], os.Args[3], outputPath) // Each page has its own timeout
 	case "logs-watch":
 		return watchLogs(context.WithoutCancel(ctx), client, os.Args[2]) // Keep watching forever
 	default:
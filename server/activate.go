@@ -13,8 +13,8 @@ import (
 func (p *Plugin) OnActivate() error {
 	p.API.LogDebug("Activating plugin")
 
-	if !p.canSendDiagnostics() {
-		errMsg := "Not activating plugin because diagnostics are disabled"
+	if !p.canRecordEvents() {
+		errMsg := "Not activating plugin because diagnostics are disabled and events are sent using Rudder"
 		p.API.LogError(errMsg)
 		return errors.New(errMsg)
 	}
@@ -27,7 +27,20 @@ func (p *Plugin) OnActivate() error {
 
 	p.serverVersion = getServerVersion(p.API.GetServerVersion())
 
-	if err := p.initializeTelemetryClient(); err != nil {
+	if err := p.loadTranslations(); err != nil {
+		// Messages will be sent in English instead
+		p.API.LogWarn("Failed to load translations", "err", err.Error())
+	}
+
+	if err := p.API.RegisterCommand(getCommand()); err != nil {
+		return errors.Wrap(err, "Failed to register command")
+	}
+
+	if err := p.API.RegisterCommand(getAdminCommand()); err != nil {
+		return errors.Wrap(err, "Failed to register admin command")
+	}
+
+	if err := p.updateTelemetryClient(); err != nil {
 		p.API.LogError("Failed to initialize Rudder client", "err", err.Error())
 		return err
 	}
@@ -53,16 +66,16 @@ func (p *Plugin) OnActivate() error {
 	// Set the WelcomeFeedbackMigration date if it does not exist.
 	p.setWelcomeFeedbackMigration(now)
 
+	p.startBackgroundJob()
+
 	return nil
 }
 
 func (p *Plugin) OnDeactivate() error {
-	if p.telemetryClient != nil {
-		err := p.telemetryClient.Close()
-		if err != nil {
-			p.API.LogWarn("OnDeactivate: Failed to close telemetryClient", "error", err.Error())
-		}
-	}
+	p.stopBackgroundJob()
+
+	p.closeTelemetryClient()
+
 	return nil
 }
 
@@ -36,6 +36,10 @@ func TestOnActivate(t *testing.T) {
 		api.On("GetUserByUsername", "feedbackbot").Return(&model.User{Id: botUserID}, nil)
 		api.On("GetBot", botUserID, true).Return(&model.Bot{UserId: botUserID}, nil)
 		api.On("GetServerVersion").Return(serverVersion)
+		api.On("GetBundlePath").Return("/foo/bar", nil)
+		api.On("RegisterCommand", getCommand()).Return(nil)
+		api.On("RegisterCommand", getAdminCommand()).Return(nil)
+		api.On("GetDiagnosticId").Return("diagnosticID")
 		api.On("KVList", 0, 100).Return([]string{}, nil)
 		api.On("KVGet", fmt.Sprintf(ServerUpgradeKey, serverVersion)).Return(mustMarshalJSON(&serverUpgrade{}), nil)
 		// Pretend it's in the future to avoid having to mock this whole process - the code is tested in welcome_test.go
@@ -46,6 +50,9 @@ func TestOnActivate(t *testing.T) {
 			now: func() time.Time {
 				return now
 			},
+			readFile: func(path string) ([]byte, error) {
+				return []byte("[]"), nil
+			},
 		}
 		p.SetAPI(api)
 
@@ -68,6 +75,10 @@ func TestOnActivate(t *testing.T) {
 		api.On("GetUserByUsername", "feedbackbot").Return(&model.User{Id: botUserID}, nil)
 		api.On("GetBot", botUserID, true).Return(&model.Bot{UserId: botUserID}, nil)
 		api.On("GetServerVersion").Return(serverVersion)
+		api.On("GetBundlePath").Return("/foo/bar", nil)
+		api.On("RegisterCommand", getCommand()).Return(nil)
+		api.On("RegisterCommand", getAdminCommand()).Return(nil)
+		api.On("GetDiagnosticId").Return("diagnosticID")
 		api.On("KVList", 0, 100).Return([]string{}, nil)
 		api.On("KVGet", fmt.Sprintf(ServerUpgradeKey, serverVersion)).Return(nil, &model.AppError{})
 		defer api.AssertExpectations(t)
@@ -76,6 +87,9 @@ func TestOnActivate(t *testing.T) {
 			now: func() time.Time {
 				return now
 			},
+			readFile: func(path string) ([]byte, error) {
+				return []byte("[]"), nil
+			},
 		}
 		p.SetAPI(api)
 
@@ -126,6 +140,40 @@ func TestOnActivate(t *testing.T) {
 
 		assert.NotNil(t, err)
 	})
+
+	t.Run("should activate without a Rudder client when events are kept on the server", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("GetConfig").Return(&model.Config{})
+		api.On("GetUserByUsername", "feedbackbot").Return(&model.User{Id: botUserID}, nil)
+		api.On("GetBot", botUserID, true).Return(&model.Bot{UserId: botUserID}, nil)
+		api.On("GetServerVersion").Return(serverVersion)
+		api.On("GetBundlePath").Return("/foo/bar", nil)
+		api.On("RegisterCommand", getCommand()).Return(nil)
+		api.On("RegisterCommand", getAdminCommand()).Return(nil)
+		api.On("GetDiagnosticId").Return("diagnosticID")
+		api.On("KVList", 0, 100).Return([]string{}, nil)
+		api.On("KVGet", fmt.Sprintf(ServerUpgradeKey, serverVersion)).Return(mustMarshalJSON(&serverUpgrade{}), nil)
+		api.On("KVGet", WelcomeFeedbackMigrationKey).Return(mustMarshalJSON(&welcomeFeedbackMigration{CreateAt: time.Now().AddDate(1, 0, 0)}), nil)
+		defer api.AssertExpectations(t)
+
+		p := &Plugin{
+			configuration: &configuration{
+				TelemetrySink: TelemetrySinkKV,
+			},
+			now: func() time.Time {
+				return now
+			},
+			readFile: func(path string) ([]byte, error) {
+				return []byte("[]"), nil
+			},
+		}
+		p.SetAPI(api)
+
+		err := p.OnActivate()
+
+		assert.Nil(t, err)
+		assert.Nil(t, p.telemetryClient)
+	})
 }
 
 func TestEnsureBotExists(t *testing.T) {
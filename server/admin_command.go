@@ -0,0 +1,507 @@
+// Copyright (c) 2019-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+const (
+	// AdminCommandTrigger is the slash command that System Admins can use to manage surveys.
+	AdminCommandTrigger = "nps"
+
+	adminCommandHelpText = "Available commands:\n" +
+		"* `/nps status` - Show the survey for the current cycle\n" +
+		"* `/nps schedule <YYYY-MM-DD>` - Schedule the survey for the current cycle to start on the given date\n" +
+		"* `/nps cancel` - End the survey for the current cycle now\n" +
+		"* `/nps send-now @user` - Send the current survey to a user right away\n" +
+		"* `/nps reset @user` - Clear a user's survey state\n" +
+		"* `/nps results` - Show the results of every survey\n" +
+		"* `/nps outbox [retry]` - Show events that are waiting to be sent, or retry the ones that failed\n" +
+		"* `/nps webhooks [rotate <URL>]` - Show the secrets of the outgoing webhooks, or replace the secret of one of them"
+	adminCommandPermissionText  = "Only System Admins can use `/nps`."
+	adminCommandUserText        = "Please specify a user, such as `/nps %s @username`."
+	adminCommandUnknownUserText = "Unable to find user `%s`."
+
+	adminCommandDateFormat         = "Jan 2, 2006"
+	adminCommandNoSurveyText       = "No survey is scheduled for the current cycle (`%s`)."
+	adminCommandScheduleDateText   = "Please specify the date on which the survey should start, such as `/nps schedule 2019-05-01`."
+	adminCommandScheduleLateText   = "The survey must start before the current cycle ends on %s."
+	adminCommandScheduledText      = "Survey `%s` will start on %s and end on %s."
+	adminCommandNoCancelText       = "There is no survey to cancel."
+	adminCommandCancelledText      = "Survey `%s` has ended. Users who haven't answered it will see that it has ended the next time that the background job runs."
+	adminCommandSurveySentText     = "Sent the current survey to @%s."
+	adminCommandSurveyBusyText     = "Feedbackbot is busy sending messages to @%s. Please try again in a moment."
+	adminCommandOptedOutText       = "@%s has opted out of surveys."
+	adminCommandAlreadySentText    = "@%s has already been sent the current survey."
+	adminCommandResetText          = "Cleared the survey state of @%s. They can be sent the current survey again."
+	adminCommandNoResultsText      = "No surveys have been scheduled yet."
+	adminCommandOutboxText         = "* Queued events: %d\n* Failed events: %d"
+	adminCommandOutboxRetryText    = "Queued %d failed events to be sent again."
+	adminCommandNoWebhooksText     = "No outgoing webhooks are configured."
+	adminCommandWebhookURLText     = "Please specify the URL of an outgoing webhook, such as `/nps webhooks rotate https://example.com/nps`."
+	adminCommandUnknownWebhookText = "Unable to find outgoing webhook `%s`."
+	adminCommandRotatedText        = "Replaced the secret of `%s`. Requests to it are now signed with `%s`."
+)
+
+// getAdminCommand returns the /nps command registered by the plugin. It's only suggested to System Admins.
+func getAdminCommand() *model.Command {
+	autocomplete := model.NewAutocompleteData(AdminCommandTrigger, "[command]", "Manage surveys")
+	autocomplete.RoleID = model.SystemAdminRoleId
+
+	autocomplete.AddCommand(model.NewAutocompleteData("status", "", "Show the survey for the current cycle"))
+
+	schedule := model.NewAutocompleteData("schedule", "<YYYY-MM-DD>", "Schedule the survey for the current cycle to start on the given date")
+	schedule.AddTextArgument("The date on which the survey starts", "<YYYY-MM-DD>", "")
+	autocomplete.AddCommand(schedule)
+
+	autocomplete.AddCommand(model.NewAutocompleteData("cancel", "", "End the survey for the current cycle now"))
+
+	sendNow := model.NewAutocompleteData("send-now", "@user", "Send the current survey to a user right away")
+	sendNow.AddTextArgument("The user to send the survey to", "@user", "")
+	autocomplete.AddCommand(sendNow)
+
+	reset := model.NewAutocompleteData("reset", "@user", "Clear a user's survey state")
+	reset.AddTextArgument("The user whose survey state is cleared", "@user", "")
+	autocomplete.AddCommand(reset)
+
+	autocomplete.AddCommand(model.NewAutocompleteData("results", "", "Show the results of every survey"))
+
+	outbox := model.NewAutocompleteData("outbox", "[retry]", "Show events that are waiting to be sent, or retry the ones that failed")
+	outbox.AddStaticListArgument("", false, []model.AutocompleteListItem{
+		{Item: "retry", HelpText: "Queue failed events to be sent again"},
+	})
+	autocomplete.AddCommand(outbox)
+
+	webhooks := model.NewAutocompleteData("webhooks", "[rotate <URL>]", "Show the secrets of the outgoing webhooks, or replace the secret of one of them")
+	webhooks.AddStaticListArgument("", false, []model.AutocompleteListItem{
+		{Item: "rotate", Hint: "<URL>", HelpText: "Replace the secret of an outgoing webhook"},
+	})
+	autocomplete.AddCommand(webhooks)
+
+	return &model.Command{
+		Trigger:          AdminCommandTrigger,
+		DisplayName:      "NPS",
+		Description:      "Manage surveys sent by Feedbackbot",
+		AutoComplete:     true,
+		AutoCompleteDesc: "Available commands: status, schedule, cancel, send-now, reset, results, outbox, webhooks",
+		AutoCompleteHint: "[command]",
+		AutocompleteData: autocomplete,
+	}
+}
+
+func (p *Plugin) executeAdminCommand(userID, subcommand, text string) (string, *model.AppError) {
+	if !p.API.HasPermissionTo(userID, model.PermissionManageSystem) {
+		return adminCommandPermissionText, nil
+	}
+
+	switch subcommand {
+	case "status":
+		return p.executeAdminStatusCommand()
+	case "schedule":
+		return p.executeAdminScheduleCommand(text)
+	case "cancel":
+		return p.executeAdminCancelCommand()
+	case "send-now":
+		return p.executeAdminSendNowCommand(text)
+	case "reset":
+		return p.executeAdminResetCommand(text)
+	case "results":
+		return p.executeAdminResultsCommand()
+	case "outbox":
+		return p.executeAdminOutboxCommand(text)
+	case "webhooks":
+		return p.executeAdminWebhooksCommand(text)
+	default:
+		return adminCommandHelpText, nil
+	}
+}
+
+// executeAdminStatusCommand describes the survey for the current cycle and how many users have received and
+// answered it.
+func (p *Plugin) executeAdminStatusCommand() (string, *model.AppError) {
+	now := p.now().UTC()
+	cycle := p.getSurveyCycle(now)
+
+	var survey *surveyState
+	if err := p.KVGet(fmt.Sprintf(SurveyKey, cycle.ID), &survey); err != nil {
+		return "", err
+	}
+
+	if survey == nil {
+		return fmt.Sprintf(adminCommandNoSurveyText, cycle.ID), nil
+	}
+
+	var sent int64
+	if err := p.KVGet(fmt.Sprintf(SurveySentCountKey, survey.getID()), &sent); err != nil {
+		return "", err
+	}
+
+	answered, err := p.countSurveyAnswers(survey.getID())
+	if err != nil {
+		return "", err
+	}
+
+	status := "Scheduled"
+	switch {
+	case !survey.ClosedAt.IsZero():
+		status = "Closed"
+	case survey.hasEnded(now):
+		status = "Ended"
+	case !now.Before(survey.StartAt):
+		status = "Running"
+	}
+
+	endAt := "Never"
+	if !survey.EndAt.IsZero() {
+		endAt = survey.EndAt.Format(adminCommandDateFormat)
+	}
+
+	lines := []string{
+		fmt.Sprintf("#### Survey `%s`", survey.getID()),
+		fmt.Sprintf("* Status: %s", status),
+		fmt.Sprintf("* Server version: %s", survey.ServerVersion),
+		fmt.Sprintf("* Starts: %s", survey.StartAt.Format(adminCommandDateFormat)),
+		fmt.Sprintf("* Ends: %s", endAt),
+		fmt.Sprintf("* Sent: %d", sent),
+		fmt.Sprintf("* Answered: %d", answered),
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// countSurveyAnswers returns the number of users who have answered at least one question of the given survey.
+func (p *Plugin) countSurveyAnswers(surveyID string) (int, *model.AppError) {
+	answered := 0
+
+	err := p.KVForEach(UserSurveyPrefix, func(key string) (bool, *model.AppError) {
+		var userSurvey *userSurveyState
+		if err := p.KVGet(key, &userSurvey); err != nil {
+			return false, err
+		}
+
+		if userSurvey != nil && userSurvey.getSurveyID() == surveyID && !userSurvey.AnsweredAt.IsZero() {
+			answered++
+		}
+
+		return true, nil
+	})
+
+	return answered, err
+}
+
+// executeAdminScheduleCommand schedules the survey for the current cycle to start on the given date, replacing the
+// start and end of the survey if it's already been scheduled. Admins aren't notified about surveys scheduled this way.
+func (p *Plugin) executeAdminScheduleCommand(text string) (string, *model.AppError) {
+	startAt, parseErr := time.Parse("2006-01-02", text)
+	if parseErr != nil {
+		return adminCommandScheduleDateText, nil
+	}
+
+	now := p.now().UTC()
+	cycle := p.getSurveyCycle(now)
+
+	if !cycle.EndAt.IsZero() && !startAt.Before(cycle.EndAt) {
+		return fmt.Sprintf(adminCommandScheduleLateText, cycle.EndAt.Format(adminCommandDateFormat)), nil
+	}
+
+	survey, err := p.updateCurrentSurvey(now, func(survey *surveyState) *surveyState {
+		if survey == nil {
+			survey = &surveyState{
+				ID:            cycle.ID,
+				ServerVersion: p.serverVersion,
+				CreateAt:      now,
+			}
+		}
+
+		survey.StartAt = startAt
+		survey.EndAt = cycle.getSurveyEndAt(startAt, p.getConfiguration().getSurveyDuration())
+		survey.ClosedAt = time.Time{}
+
+		return survey
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf(adminCommandScheduledText, survey.getID(), survey.StartAt.Format(adminCommandDateFormat), survey.EndAt.Format(adminCommandDateFormat)), nil
+}
+
+// executeAdminCancelCommand ends the survey for the current cycle so that it stops being sent to users. The background
+// job then closes it like any other survey that has ended.
+func (p *Plugin) executeAdminCancelCommand() (string, *model.AppError) {
+	now := p.now().UTC()
+
+	survey, err := p.updateCurrentSurvey(now, func(survey *surveyState) *surveyState {
+		if survey == nil || survey.hasEnded(now) {
+			return nil
+		}
+
+		survey.EndAt = now
+
+		return survey
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if survey == nil {
+		return adminCommandNoCancelText, nil
+	}
+
+	return fmt.Sprintf(adminCommandCancelledText, survey.getID()), nil
+}
+
+// updateCurrentSurvey changes the survey for the current cycle while holding the lock used to schedule surveys. The
+// update function receives the stored survey, which may be nil, and returns the survey to store or nil to leave it
+// unchanged.
+func (p *Plugin) updateCurrentSurvey(now time.Time, update func(survey *surveyState) *surveyState) (*surveyState, *model.AppError) {
+	locked, err := p.tryLock(LockKey, now)
+	if err != nil {
+		return nil, err
+	} else if !locked {
+		return nil, &model.AppError{Message: "Another thread is already scheduling a survey"}
+	}
+	defer func() {
+		_ = p.unlock(LockKey)
+	}()
+
+	cycle := p.getSurveyCycle(now)
+
+	var survey *surveyState
+	if err = p.KVGet(fmt.Sprintf(SurveyKey, cycle.ID), &survey); err != nil {
+		return nil, err
+	}
+
+	survey = update(survey)
+	if survey == nil {
+		return nil, nil
+	}
+
+	if err = p.KVSet(fmt.Sprintf(SurveyKey, cycle.ID), survey); err != nil {
+		return nil, err
+	}
+
+	return survey, nil
+}
+
+// executeAdminSendNowCommand sends the current survey to the given user right away.
+func (p *Plugin) executeAdminSendNowCommand(text string) (string, *model.AppError) {
+	if text == "" {
+		return fmt.Sprintf(adminCommandUserText, "send-now"), nil
+	}
+
+	user, message, err := p.getCommandUser(text)
+	if user == nil {
+		return message, err
+	}
+
+	result, err := p.sendSurveyNow(user.Id)
+	if err != nil {
+		return "", err
+	}
+
+	switch result {
+	case surveyNowDisabled:
+		return commandSurveyDisabledText, nil
+	case surveyNowNotRunning:
+		return commandNoSurveyText, nil
+	case surveyNowBusy:
+		return fmt.Sprintf(adminCommandSurveyBusyText, user.Username), nil
+	case surveyNowOptedOut:
+		return fmt.Sprintf(adminCommandOptedOutText, user.Username), nil
+	case surveyNowAlreadySent:
+		return fmt.Sprintf(adminCommandAlreadySentText, user.Username), nil
+	default:
+		return fmt.Sprintf(adminCommandSurveySentText, user.Username), nil
+	}
+}
+
+// executeAdminResetCommand clears the given user's survey state so that they're treated as if they had never been
+// sent a survey. Their preferences and whether they disabled surveys before preferences existed are kept.
+func (p *Plugin) executeAdminResetCommand(text string) (string, *model.AppError) {
+	if text == "" {
+		return fmt.Sprintf(adminCommandUserText, "reset"), nil
+	}
+
+	user, message, err := p.getCommandUser(text)
+	if user == nil {
+		return message, err
+	}
+
+	userLockKey := fmt.Sprintf(UserLockKey, user.Id)
+
+	locked, err := p.tryLock(userLockKey, p.now().UTC())
+	if err != nil {
+		return "", err
+	} else if !locked {
+		return fmt.Sprintf(adminCommandSurveyBusyText, user.Username), nil
+	}
+	defer func() {
+		_ = p.unlock(userLockKey)
+	}()
+
+	userSurveyKey := fmt.Sprintf(UserSurveyKey, user.Id)
+
+	var userSurvey *userSurveyState
+	if err = p.KVGet(userSurveyKey, &userSurvey); err != nil {
+		return "", err
+	}
+
+	if userSurvey != nil {
+		if err = p.KVSet(userSurveyKey, &userSurveyState{Disabled: userSurvey.Disabled}); err != nil {
+			return "", err
+		}
+
+		// The user will be counted again if they're sent the current survey again, so stop counting the first time
+		if surveyID := userSurvey.getSurveyID(); surveyID != "" && surveyID == p.getSurveyCycle(p.now().UTC()).ID {
+			if _, err = p.KVDecrement(fmt.Sprintf(SurveySentCountKey, surveyID)); err != nil {
+				p.API.LogWarn("Failed to uncount sent survey", "err", err)
+			}
+		}
+	}
+
+	return fmt.Sprintf(adminCommandResetText, user.Username), nil
+}
+
+// getCommandUser returns the user mentioned in a command. If the user can't be found, it returns nil with the message
+// to respond with instead.
+func (p *Plugin) getCommandUser(text string) (*model.User, string, *model.AppError) {
+	username := strings.TrimPrefix(strings.Fields(text)[0], "@")
+
+	user, err := p.API.GetUserByUsername(username)
+	if err != nil {
+		if err.StatusCode == http.StatusNotFound {
+			return nil, fmt.Sprintf(adminCommandUnknownUserText, username), nil
+		}
+
+		return nil, "", err
+	}
+
+	return user, "", nil
+}
+
+// executeAdminResultsCommand shows a table summarizing the results of every survey.
+func (p *Plugin) executeAdminResultsCommand() (string, *model.AppError) {
+	reports, err := p.getNPSReports()
+	if err != nil {
+		return "", err
+	}
+
+	if len(reports) == 0 {
+		return adminCommandNoResultsText, nil
+	}
+
+	lines := []string{
+		"| Survey | Sent | Responses | Response Rate | NPS | Promoters | Passives | Detractors |",
+		"|:-------|-----:|----------:|--------------:|----:|----------:|---------:|-----------:|",
+	}
+
+	for _, report := range reports {
+		lines = append(lines, fmt.Sprintf(
+			"| %s | %d | %d | %.0f%% | %.1f | %d | %d | %d |",
+			report.SurveyID,
+			report.Sent,
+			report.Responses,
+			report.ResponseRate*100,
+			report.NPS,
+			report.Promoters,
+			report.Passives,
+			report.Detractors,
+		))
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// executeAdminOutboxCommand shows how many events are waiting to be sent along with a table of the events that failed
+// to be sent, or queues the failed events to be sent again when given "retry".
+func (p *Plugin) executeAdminOutboxCommand(text string) (string, *model.AppError) {
+	if strings.TrimSpace(text) == "retry" {
+		retried, err := p.retryDeadLetters(p.now().UTC())
+		if err != nil {
+			return "", err
+		}
+
+		return fmt.Sprintf(adminCommandOutboxRetryText, retried), nil
+	}
+
+	status, err := p.getOutboxStatus()
+	if err != nil {
+		return "", err
+	}
+
+	lines := []string{
+		fmt.Sprintf(adminCommandOutboxText, status.Queued, len(status.DeadLettered)),
+	}
+
+	if len(status.DeadLettered) > 0 {
+		lines = append(lines,
+			"",
+			"| Event | Created | Attempts | Last Error |",
+			"|:------|:--------|---------:|:-----------|",
+		)
+
+		for _, event := range status.DeadLettered {
+			lines = append(lines, fmt.Sprintf(
+				"| %s | %s | %d | %s |",
+				event.Event,
+				event.CreateAt.Format(adminCommandDateFormat),
+				event.Attempts,
+				strings.ReplaceAll(event.LastError, "|", "\\|"),
+			))
+		}
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// executeAdminWebhooksCommand shows the secret of every outgoing webhook so that receivers can check the signatures of
+// requests, or replaces the secret of the given webhook when it's rotated.
+func (p *Plugin) executeAdminWebhooksCommand(text string) (string, *model.AppError) {
+	// Invalid webhooks are rejected by IsValid, so the error can be ignored here
+	webhooks, _ := p.getConfiguration().getOutgoingWebhooks()
+
+	if action, url := splitFirstWord(text); action == "rotate" {
+		if url == "" {
+			return adminCommandWebhookURLText, nil
+		}
+
+		if p.getConfiguration().getOutgoingWebhook(url) == nil {
+			return fmt.Sprintf(adminCommandUnknownWebhookText, url), nil
+		}
+
+		secret, err := p.rotateOutgoingWebhookSecret(url)
+		if err != nil {
+			return "", err
+		}
+
+		return fmt.Sprintf(adminCommandRotatedText, url, secret), nil
+	}
+
+	if len(webhooks) == 0 {
+		return adminCommandNoWebhooksText, nil
+	}
+
+	lines := []string{
+		"| URL | Secret |",
+		"|:----|:-------|",
+	}
+
+	for _, webhook := range webhooks {
+		secret, err := p.getOutgoingWebhookSecret(webhook.URL)
+		if err != nil {
+			return "", err
+		}
+
+		lines = append(lines, fmt.Sprintf("| %s | `%s` |", webhook.URL, secret))
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
@@ -0,0 +1,468 @@
+// Copyright (c) 2019-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteAdminCommand(t *testing.T) {
+	adminID := model.NewId()
+	botUserID := model.NewId()
+	now := toDate(2019, time.May, 10)
+	surveyID := "2019-Q2"
+	serverVersion := "5.12.0"
+
+	makeAdminAPIMock := func() *plugintest.API {
+		api := makeAPIMock()
+		api.On("HasPermissionTo", adminID, model.PermissionManageSystem).Return(true)
+		return api
+	}
+
+	makePlugin := func(api *plugintest.API) *Plugin {
+		p := &Plugin{
+			botUserID: botUserID,
+			configuration: &configuration{
+				EnableSurvey:   true,
+				SurveySchedule: SurveyScheduleQuarterly,
+			},
+			now: func() time.Time {
+				return now
+			},
+			serverVersion: serverVersion,
+		}
+		p.SetAPI(api)
+
+		return p
+	}
+
+	execute := func(p *Plugin, command string) string {
+		response, err := p.ExecuteCommand(nil, &model.CommandArgs{UserId: adminID, Command: command})
+		require.Nil(t, err)
+		assert.Equal(t, model.CommandResponseTypeEphemeral, response.ResponseType)
+
+		return response.Text
+	}
+
+	t.Run("should only be usable by System Admins", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("HasPermissionTo", adminID, model.PermissionManageSystem).Return(false)
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api)
+
+		assert.Equal(t, adminCommandPermissionText, execute(p, "/nps results"))
+	})
+
+	t.Run("should show help for an unknown command", func(t *testing.T) {
+		api := makeAdminAPIMock()
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api)
+
+		assert.Equal(t, adminCommandHelpText, execute(p, "/nps"))
+	})
+
+	t.Run("should show the status of the current survey", func(t *testing.T) {
+		api := makeAdminAPIMock()
+		api.On("KVGet", fmt.Sprintf(SurveyKey, surveyID)).Return(mustMarshalJSON(&surveyState{
+			ID:            surveyID,
+			ServerVersion: serverVersion,
+			StartAt:       toDate(2019, time.May, 1),
+			EndAt:         toDate(2019, time.May, 31),
+		}), nil)
+		api.On("KVList", 0, 100).Return([]string{
+			fmt.Sprintf(SurveyKey, surveyID),
+			fmt.Sprintf(UserSurveyKey, "user1"),
+			fmt.Sprintf(UserSurveyKey, "user2"),
+			fmt.Sprintf(UserSurveyKey, "user3"),
+		}, nil)
+		// Answers to surveys without an NPS question are counted as well
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, "user1")).Return(mustMarshalJSON(&userSurveyState{
+			SurveyID:   surveyID,
+			SentAt:     toDate(2019, time.May, 1),
+			AnsweredAt: toDate(2019, time.May, 2),
+		}), nil)
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, "user2")).Return(mustMarshalJSON(&userSurveyState{
+			SurveyID: surveyID,
+			SentAt:   toDate(2019, time.May, 1),
+		}), nil)
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, "user3")).Return(mustMarshalJSON(&userSurveyState{
+			SurveyID:   "2019-Q1",
+			SentAt:     toDate(2019, time.February, 1),
+			AnsweredAt: toDate(2019, time.February, 2),
+		}), nil)
+		api.On("KVGet", fmt.Sprintf(SurveySentCountKey, surveyID)).Return([]byte("3"), nil)
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api)
+
+		assert.Equal(t, "#### Survey `2019-Q2`\n"+
+			"* Status: Running\n"+
+			"* Server version: 5.12.0\n"+
+			"* Starts: May 1, 2019\n"+
+			"* Ends: May 31, 2019\n"+
+			"* Sent: 3\n"+
+			"* Answered: 1", execute(p, "/nps status"))
+	})
+
+	t.Run("should show when there's no current survey", func(t *testing.T) {
+		api := makeAdminAPIMock()
+		api.On("KVGet", fmt.Sprintf(SurveyKey, surveyID)).Return(nil, nil)
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api)
+
+		assert.Equal(t, fmt.Sprintf(adminCommandNoSurveyText, surveyID), execute(p, "/nps status"))
+	})
+
+	t.Run("should schedule the current survey", func(t *testing.T) {
+		api := makeAdminAPIMock()
+		api.On("KVCompareAndSet", LockKey, []byte(nil), mock.Anything).Return(true, nil)
+		api.On("KVDelete", LockKey).Return(nil)
+		api.On("KVGet", fmt.Sprintf(SurveyKey, surveyID)).Return(nil, nil)
+		api.On("KVSet", fmt.Sprintf(SurveyKey, surveyID), mustMarshalJSON(&surveyState{
+			ID:            surveyID,
+			ServerVersion: serverVersion,
+			CreateAt:      now,
+			StartAt:       toDate(2019, time.June, 15),
+			EndAt:         toDate(2019, time.July, 1),
+		})).Return(nil)
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api)
+
+		assert.Equal(t, "Survey `2019-Q2` will start on Jun 15, 2019 and end on Jul 1, 2019.", execute(p, "/nps schedule 2019-06-15"))
+	})
+
+	t.Run("should reschedule the current survey", func(t *testing.T) {
+		api := makeAdminAPIMock()
+		api.On("KVCompareAndSet", LockKey, []byte(nil), mock.Anything).Return(true, nil)
+		api.On("KVDelete", LockKey).Return(nil)
+		api.On("KVGet", fmt.Sprintf(SurveyKey, surveyID)).Return(mustMarshalJSON(&surveyState{
+			ID:            surveyID,
+			ServerVersion: "5.11.0",
+			CreateAt:      toDate(2019, time.April, 1),
+			StartAt:       toDate(2019, time.April, 1),
+			EndAt:         toDate(2019, time.May, 1),
+			ClosedAt:      toDate(2019, time.May, 1),
+		}), nil)
+		api.On("KVSet", fmt.Sprintf(SurveyKey, surveyID), mustMarshalJSON(&surveyState{
+			ID:            surveyID,
+			ServerVersion: "5.11.0",
+			CreateAt:      toDate(2019, time.April, 1),
+			StartAt:       toDate(2019, time.May, 12),
+			EndAt:         toDate(2019, time.June, 11),
+		})).Return(nil)
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api)
+
+		assert.Equal(t, "Survey `2019-Q2` will start on May 12, 2019 and end on Jun 11, 2019.", execute(p, "/nps schedule 2019-05-12"))
+	})
+
+	t.Run("should not schedule a survey after the current cycle", func(t *testing.T) {
+		api := makeAdminAPIMock()
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api)
+
+		assert.Equal(t, fmt.Sprintf(adminCommandScheduleLateText, "Jul 1, 2019"), execute(p, "/nps schedule 2019-07-01"))
+	})
+
+	t.Run("should not schedule a survey without a valid date", func(t *testing.T) {
+		api := makeAdminAPIMock()
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api)
+
+		assert.Equal(t, adminCommandScheduleDateText, execute(p, "/nps schedule tomorrow"))
+	})
+
+	t.Run("should cancel the current survey", func(t *testing.T) {
+		survey := &surveyState{
+			ID:            surveyID,
+			ServerVersion: serverVersion,
+			StartAt:       toDate(2019, time.May, 1),
+			EndAt:         toDate(2019, time.May, 31),
+		}
+
+		api := makeAdminAPIMock()
+		api.On("KVCompareAndSet", LockKey, []byte(nil), mock.Anything).Return(true, nil)
+		api.On("KVDelete", LockKey).Return(nil)
+		api.On("KVGet", fmt.Sprintf(SurveyKey, surveyID)).Return(mustMarshalJSON(survey), nil)
+		api.On("KVSet", fmt.Sprintf(SurveyKey, surveyID), mustMarshalJSON(&surveyState{
+			ID:            surveyID,
+			ServerVersion: serverVersion,
+			StartAt:       toDate(2019, time.May, 1),
+			EndAt:         now,
+		})).Return(nil)
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api)
+
+		assert.Equal(t, fmt.Sprintf(adminCommandCancelledText, surveyID), execute(p, "/nps cancel"))
+	})
+
+	t.Run("should not cancel a survey that has already ended", func(t *testing.T) {
+		api := makeAdminAPIMock()
+		api.On("KVCompareAndSet", LockKey, []byte(nil), mock.Anything).Return(true, nil)
+		api.On("KVDelete", LockKey).Return(nil)
+		api.On("KVGet", fmt.Sprintf(SurveyKey, surveyID)).Return(mustMarshalJSON(&surveyState{
+			ID:      surveyID,
+			StartAt: toDate(2019, time.April, 1),
+			EndAt:   toDate(2019, time.May, 1),
+		}), nil)
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api)
+
+		assert.Equal(t, adminCommandNoCancelText, execute(p, "/nps cancel"))
+	})
+
+	t.Run("should send the current survey to a user", func(t *testing.T) {
+		user := &model.User{Id: model.NewId(), Username: "user"}
+		postID := model.NewId()
+
+		api := makeAdminAPIMock()
+		api.On("GetUserByUsername", "user").Return(user, nil)
+		api.On("KVGet", fmt.Sprintf(SurveyKey, surveyID)).Return(mustMarshalJSON(&surveyState{
+			ID:            surveyID,
+			ServerVersion: serverVersion,
+			StartAt:       toDate(2019, time.May, 1),
+		}), nil)
+		api.On("KVCompareAndSet", fmt.Sprintf(UserLockKey, user.Id), []byte(nil), mock.Anything).Return(true, nil)
+		api.On("KVDelete", fmt.Sprintf(UserLockKey, user.Id)).Return(nil)
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, user.Id)).Return(nil, nil)
+		api.On("KVGet", fmt.Sprintf(UserPreferencesKey, user.Id)).Return(nil, nil)
+		api.On("GetUser", user.Id).Return(user, nil)
+		api.On("KVGet", SurveyDefinitionKey).Return(nil, nil)
+		api.On("GetDirectChannel", user.Id, botUserID).Return(&model.Channel{}, nil)
+		api.On("CreatePost", mock.Anything).Return(&model.Post{Id: postID}, nil)
+		api.On("KVSet", fmt.Sprintf(UserSurveyKey, user.Id), mustMarshalJSON(&userSurveyState{
+			SurveyID:        surveyID,
+			ScorePostID:     postID,
+			ServerVersion:   serverVersion,
+			SentAt:          now,
+			QuestionPostIDs: []string{postID},
+		})).Return(nil)
+		api.On("KVGet", fmt.Sprintf(SurveySentCountKey, surveyID)).Return(nil, nil)
+		api.On("KVCompareAndSet", fmt.Sprintf(SurveySentCountKey, surveyID), []byte(nil), []byte("1")).Return(true, nil)
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api)
+
+		assert.Equal(t, "Sent the current survey to @user.", execute(p, "/nps send-now @user"))
+	})
+
+	t.Run("should not send the current survey to an unknown user", func(t *testing.T) {
+		api := makeAdminAPIMock()
+		api.On("GetUserByUsername", "someone").Return(nil, &model.AppError{StatusCode: http.StatusNotFound})
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api)
+
+		assert.Equal(t, "Unable to find user `someone`.", execute(p, "/nps send-now @someone"))
+	})
+
+	t.Run("should require a user to send the survey to", func(t *testing.T) {
+		api := makeAdminAPIMock()
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api)
+
+		assert.Equal(t, "Please specify a user, such as `/nps send-now @username`.", execute(p, "/nps send-now"))
+	})
+
+	t.Run("should reset a user's survey state", func(t *testing.T) {
+		user := &model.User{Id: model.NewId(), Username: "user"}
+
+		api := makeAdminAPIMock()
+		api.On("GetUserByUsername", "user").Return(user, nil)
+		api.On("KVCompareAndSet", fmt.Sprintf(UserLockKey, user.Id), []byte(nil), mock.Anything).Return(true, nil)
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, user.Id)).Return(mustMarshalJSON(&userSurveyState{
+			SurveyID:        surveyID,
+			ServerVersion:   serverVersion,
+			SentAt:          toDate(2019, time.May, 1),
+			AnsweredAt:      toDate(2019, time.May, 2),
+			ScorePostID:     model.NewId(),
+			QuestionPostIDs: []string{model.NewId()},
+			ReminderSentAt:  toDate(2019, time.May, 2),
+		}), nil)
+		api.On("KVSet", fmt.Sprintf(UserSurveyKey, user.Id), mustMarshalJSON(&userSurveyState{})).Return(nil)
+		api.On("KVGet", fmt.Sprintf(SurveySentCountKey, surveyID)).Return([]byte("3"), nil)
+		api.On("KVCompareAndSet", fmt.Sprintf(SurveySentCountKey, surveyID), []byte("3"), []byte("2")).Return(true, nil)
+		api.On("KVDelete", fmt.Sprintf(UserLockKey, user.Id)).Return(nil)
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api)
+
+		assert.Equal(t, "Cleared the survey state of @user. They can be sent the current survey again.", execute(p, "/nps reset user"))
+	})
+
+	t.Run("should keep whether a user disabled surveys when resetting their survey state", func(t *testing.T) {
+		user := &model.User{Id: model.NewId(), Username: "user"}
+
+		api := makeAdminAPIMock()
+		api.On("GetUserByUsername", "user").Return(user, nil)
+		api.On("KVCompareAndSet", fmt.Sprintf(UserLockKey, user.Id), []byte(nil), mock.Anything).Return(true, nil)
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, user.Id)).Return(mustMarshalJSON(&userSurveyState{
+			SurveyID:    surveyID,
+			SentAt:      toDate(2019, time.May, 1),
+			ScorePostID: model.NewId(),
+			Disabled:    true,
+		}), nil)
+		api.On("KVSet", fmt.Sprintf(UserSurveyKey, user.Id), mustMarshalJSON(&userSurveyState{Disabled: true})).Return(nil)
+		api.On("KVGet", fmt.Sprintf(SurveySentCountKey, surveyID)).Return([]byte("3"), nil)
+		api.On("KVCompareAndSet", fmt.Sprintf(SurveySentCountKey, surveyID), []byte("3"), []byte("2")).Return(true, nil)
+		api.On("KVDelete", fmt.Sprintf(UserLockKey, user.Id)).Return(nil)
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api)
+
+		assert.Equal(t, "Cleared the survey state of @user. They can be sent the current survey again.", execute(p, "/nps reset user"))
+	})
+
+	t.Run("should keep counting a previous survey as sent when resetting a user's survey state", func(t *testing.T) {
+		user := &model.User{Id: model.NewId(), Username: "user"}
+
+		api := makeAdminAPIMock()
+		api.On("GetUserByUsername", "user").Return(user, nil)
+		api.On("KVCompareAndSet", fmt.Sprintf(UserLockKey, user.Id), []byte(nil), mock.Anything).Return(true, nil)
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, user.Id)).Return(mustMarshalJSON(&userSurveyState{
+			SurveyID: "2019-Q1",
+			SentAt:   toDate(2019, time.February, 1),
+		}), nil)
+		api.On("KVSet", fmt.Sprintf(UserSurveyKey, user.Id), mustMarshalJSON(&userSurveyState{})).Return(nil)
+		api.On("KVDelete", fmt.Sprintf(UserLockKey, user.Id)).Return(nil)
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api)
+
+		assert.Equal(t, "Cleared the survey state of @user. They can be sent the current survey again.", execute(p, "/nps reset user"))
+	})
+
+	t.Run("should show the results of every survey", func(t *testing.T) {
+		api := makeAdminAPIMock()
+		api.On("KVList", 0, 100).Return([]string{
+			fmt.Sprintf(SurveyKey, "2019-Q1"),
+			fmt.Sprintf(SurveyKey, surveyID),
+			fmt.Sprintf(ScoreResponseKey, "2019-Q1", "user1"),
+			fmt.Sprintf(ScoreResponseKey, "2019-Q1", "user2"),
+		}, nil)
+		api.On("KVGet", fmt.Sprintf(SurveyKey, "2019-Q1")).Return(mustMarshalJSON(&surveyState{ID: "2019-Q1"}), nil)
+		api.On("KVGet", fmt.Sprintf(SurveyKey, surveyID)).Return(mustMarshalJSON(&surveyState{ID: surveyID}), nil)
+		api.On("KVGet", fmt.Sprintf(ScoreResponseKey, "2019-Q1", "user1")).Return(mustMarshalJSON(&scoreResponse{SurveyID: "2019-Q1", Score: 10}), nil)
+		api.On("KVGet", fmt.Sprintf(ScoreResponseKey, "2019-Q1", "user2")).Return(mustMarshalJSON(&scoreResponse{SurveyID: "2019-Q1", Score: 8}), nil)
+		api.On("KVGet", fmt.Sprintf(SurveySentCountKey, "2019-Q1")).Return([]byte("4"), nil)
+		api.On("KVGet", fmt.Sprintf(SurveySentCountKey, surveyID)).Return(nil, nil)
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api)
+
+		assert.Equal(t, "| Survey | Sent | Responses | Response Rate | NPS | Promoters | Passives | Detractors |\n"+
+			"|:-------|-----:|----------:|--------------:|----:|----------:|---------:|-----------:|\n"+
+			"| 2019-Q1 | 4 | 2 | 50% | 50.0 | 1 | 1 | 0 |\n"+
+			"| 2019-Q2 | 0 | 0 | 0% | 0.0 | 0 | 0 | 0 |", execute(p, "/nps results"))
+	})
+
+	t.Run("should show the events that failed to be sent", func(t *testing.T) {
+		event := &outboxEvent{
+			ID:        model.NewId(),
+			Event:     NpsScore,
+			CreateAt:  toDate(2019, time.May, 1),
+			Attempts:  OutboxMaxAttempts,
+			LastError: "webhook responded with status 502",
+		}
+
+		api := makeAdminAPIMock()
+		api.On("KVList", 0, 100).Return([]string{
+			fmt.Sprintf(OutboxEventKey, model.NewId()),
+			fmt.Sprintf(DeadLetterEventKey, event.ID),
+		}, nil)
+		api.On("KVGet", fmt.Sprintf(DeadLetterEventKey, event.ID)).Return(mustMarshalJSON(event), nil)
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api)
+
+		assert.Equal(t, "* Queued events: 1\n* Failed events: 1\n\n"+
+			"| Event | Created | Attempts | Last Error |\n"+
+			"|:------|:--------|---------:|:-----------|\n"+
+			"| nps_score | May 1, 2019 | 8 | webhook responded with status 502 |", execute(p, "/nps outbox"))
+	})
+
+	t.Run("should retry the events that failed to be sent", func(t *testing.T) {
+		api := makeAdminAPIMock()
+		api.On("KVList", 0, 100).Return([]string{}, nil)
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api)
+
+		assert.Equal(t, "Queued 0 failed events to be sent again.", execute(p, "/nps outbox retry"))
+	})
+
+	t.Run("should show the secrets of the outgoing webhooks", func(t *testing.T) {
+		url := "https://example.com/nps"
+
+		api := makeAdminAPIMock()
+		api.On("KVGet", getOutgoingWebhookSecretKey(url)).Return(mustMarshalJSON("abc123"), nil)
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api)
+		p.configuration.OutgoingWebhooks = `[{"url": "https://example.com/nps"}]`
+
+		assert.Equal(t, "| URL | Secret |\n"+
+			"|:----|:-------|\n"+
+			"| https://example.com/nps | `abc123` |", execute(p, "/nps webhooks"))
+	})
+
+	t.Run("should say when no outgoing webhooks are configured", func(t *testing.T) {
+		api := makeAdminAPIMock()
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api)
+
+		assert.Equal(t, adminCommandNoWebhooksText, execute(p, "/nps webhooks"))
+	})
+
+	t.Run("should replace the secret of an outgoing webhook", func(t *testing.T) {
+		url := "https://example.com/nps"
+
+		var secret string
+
+		api := makeAdminAPIMock()
+		api.On("KVSet", getOutgoingWebhookSecretKey(url), mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+			require.NoError(t, json.Unmarshal(args.Get(1).([]byte), &secret))
+		})
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api)
+		p.configuration.OutgoingWebhooks = `[{"url": "https://example.com/nps"}]`
+
+		text := execute(p, "/nps webhooks rotate "+url)
+
+		assert.Len(t, secret, webhookSecretLength)
+		assert.Equal(t, fmt.Sprintf(adminCommandRotatedText, url, secret), text)
+	})
+
+	t.Run("should not replace the secret of an unknown outgoing webhook", func(t *testing.T) {
+		api := makeAdminAPIMock()
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api)
+
+		assert.Equal(t, adminCommandWebhookURLText, execute(p, "/nps webhooks rotate"))
+		assert.Equal(t, fmt.Sprintf(adminCommandUnknownWebhookText, "https://example.com/nps"), execute(p, "/nps webhooks rotate https://example.com/nps"))
+	})
+}
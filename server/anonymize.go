@@ -0,0 +1,222 @@
+// Copyright (c) 2019-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	// EventUserIDsKeep sends each user's ID with their events.
+	EventUserIDsKeep = "keep"
+
+	// EventUserIDsHash replaces each user's ID with a salted hash of it so that events from the same user can still be
+	// grouped together.
+	EventUserIDsHash = "hash"
+
+	// EventUserIDsDrop removes user IDs from events entirely.
+	EventUserIDsDrop = "drop"
+
+	// redactedText replaces anything removed from feedback by the redaction patterns.
+	redactedText = "[redacted]"
+
+	anonymizationSaltLength = 32
+)
+
+// defaultRedactionPatterns match email addresses, URLs, phone numbers and @mentions. Emails are matched before
+// mentions so that their domains aren't left behind.
+var defaultRedactionPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`),
+	regexp.MustCompile(`(?i)\b(?:https?://|www\.)\S+`),
+	regexp.MustCompile(`(?:\+?\d{1,3}[\s.\-]?)?\(?\d{3}\)?[\s.\-]?\d{3}[\s.\-]?\d{4}\b`),
+	regexp.MustCompile(`@[A-Za-z0-9._\-]+`),
+}
+
+// redactedProperties are the event properties containing free text written by users.
+var redactedProperties = []string{"feedback", "answer"}
+
+// getEventUserIDs returns the configured EventUserIDs, defaulting to EventUserIDsKeep.
+func (c *configuration) getEventUserIDs() string {
+	if c.EventUserIDs == "" {
+		return EventUserIDsKeep
+	}
+
+	return c.EventUserIDs
+}
+
+// getRedactionPatterns returns the patterns removed from feedback when RedactFeedback is enabled. That's the default
+// patterns followed by each line of FeedbackRedactionPatterns.
+func (c *configuration) getRedactionPatterns() ([]*regexp.Regexp, error) {
+	patterns := append([]*regexp.Regexp{}, defaultRedactionPatterns...)
+
+	for _, line := range strings.Split(c.FeedbackRedactionPatterns, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		pattern, err := regexp.Compile(line)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid FeedbackRedactionPatterns pattern %s", line)
+		}
+
+		patterns = append(patterns, pattern)
+	}
+
+	return patterns, nil
+}
+
+// redactText replaces every match of the given patterns in the text.
+func redactText(text string, patterns []*regexp.Regexp) string {
+	for _, pattern := range patterns {
+		text = pattern.ReplaceAllString(text, redactedText)
+	}
+
+	return text
+}
+
+// hashWithSalt returns the hex-encoded HMAC-SHA256 of the value using the salt as the key.
+func hashWithSalt(salt, value string) string {
+	mac := hmac.New(sha256.New, []byte(salt))
+	_, _ = mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// getAnonymizationSalt returns the secret used to hash user IDs, generating it the first time that it's needed. The
+// salt never leaves the server, so hashes can't be reversed by anyone receiving events.
+func (p *Plugin) getAnonymizationSalt() (string, *model.AppError) {
+	var salt string
+	if err := p.KVGet(AnonymizationSaltKey, &salt); err != nil {
+		return "", err
+	}
+
+	if salt != "" {
+		return salt, nil
+	}
+
+	data, _ := json.Marshal(model.NewRandomString(anonymizationSaltLength))
+
+	if _, err := p.API.KVCompareAndSet(AnonymizationSaltKey, nil, data); err != nil {
+		return "", err
+	}
+
+	// Read the salt back in case another instance of the plugin generated it first
+	if err := p.KVGet(AnonymizationSaltKey, &salt); err != nil {
+		return "", err
+	}
+
+	return salt, nil
+}
+
+// getAnonymousToken returns the token that identifies a user's responses to a survey when EnableAnonymousSurveys is
+// set. It's different for each survey so that responses can't be linked across surveys.
+func (p *Plugin) getAnonymousToken(surveyID, userID string) (string, *model.AppError) {
+	salt, err := p.getAnonymizationSalt()
+	if err != nil {
+		return "", err
+	}
+
+	return hashWithSalt(salt, surveyID+":"+userID), nil
+}
+
+// getResponseUserID returns the ID that a user's score or answer for the given survey is stored and sent under. That's
+// the user's ID unless EnableAnonymousSurveys is set.
+func (p *Plugin) getResponseUserID(surveyID, userID string) (string, *model.AppError) {
+	if !p.getConfiguration().EnableAnonymousSurveys {
+		return userID, nil
+	}
+
+	return p.getAnonymousToken(surveyID, userID)
+}
+
+// getResponseEventUserID returns the ID that a score or answer event is sent under. See getResponseUserID.
+func (p *Plugin) getResponseEventUserID(userID string, now time.Time) string {
+	if !p.getConfiguration().EnableAnonymousSurveys {
+		return userID
+	}
+
+	surveyID, _, err := p.getAnsweredSurvey(userID, now)
+	if err == nil {
+		var token string
+		if token, err = p.getAnonymousToken(surveyID, userID); err == nil {
+			return token
+		}
+	}
+
+	// Never fall back to the user's real ID
+	p.API.LogWarn("Failed to get anonymous token for event", "err", err)
+	return ""
+}
+
+// getResponseTime returns the time that a score or answer given at the given time is stored and sent with. Anonymous
+// responses only keep the day that they were given so that they can't be matched with the time that a user answered
+// a survey.
+func (p *Plugin) getResponseTime(now time.Time) time.Time {
+	if !p.getConfiguration().EnableAnonymousSurveys {
+		return now
+	}
+
+	return now.UTC().Truncate(day)
+}
+
+// getResponseEventProperties returns the properties of a score or answer event. Anonymous events don't include the
+// user's role or when their account was created since those could identify them.
+func (p *Plugin) getResponseEventProperties(userID string, timestamp int64, other map[string]interface{}) map[string]interface{} {
+	properties := p.getEventProperties(userID, timestamp, other)
+
+	if p.getConfiguration().EnableAnonymousSurveys {
+		delete(properties, "user_role")
+		delete(properties, "user_create_at")
+	}
+
+	return properties
+}
+
+// anonymizeEvent applies EventUserIDs and RedactFeedback to an event before it's sent. It returns the user ID that
+// the event should be sent with and modifies the properties in place.
+func (p *Plugin) anonymizeEvent(userID string, properties map[string]interface{}) (string, *model.AppError) {
+	config := p.getConfiguration()
+
+	if config.RedactFeedback {
+		// Invalid patterns are rejected by IsValid, so the error can be ignored here
+		patterns, _ := config.getRedactionPatterns()
+
+		for _, key := range redactedProperties {
+			if text, ok := properties[key].(string); ok {
+				properties[key] = redactText(text, patterns)
+			}
+		}
+
+		if _, ok := properties["email"]; ok {
+			properties["email"] = ""
+		}
+	}
+
+	switch config.getEventUserIDs() {
+	case EventUserIDsHash:
+		if userID == "" {
+			return "", nil
+		}
+
+		salt, err := p.getAnonymizationSalt()
+		if err != nil {
+			return "", err
+		}
+
+		return hashWithSalt(salt, userID), nil
+	case EventUserIDsDrop:
+		return "", nil
+	default:
+		return userID, nil
+	}
+}
@@ -0,0 +1,295 @@
+// Copyright (c) 2019-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedactText(t *testing.T) {
+	patterns, err := (&configuration{}).getRedactionPatterns()
+	require.Nil(t, err)
+
+	for _, test := range []struct {
+		Name     string
+		Text     string
+		Expected string
+	}{
+		{
+			Name:     "email",
+			Text:     "Email me at jane.doe@example.com please",
+			Expected: "Email me at [redacted] please",
+		},
+		{
+			Name:     "URL",
+			Text:     "See https://example.com/issues/123 and www.example.org",
+			Expected: "See [redacted] and [redacted]",
+		},
+		{
+			Name:     "phone number",
+			Text:     "Call +1 555-123-4567 or (555) 123 4567",
+			Expected: "Call [redacted] or [redacted]",
+		},
+		{
+			Name:     "mention",
+			Text:     "Ask @jane.doe about it",
+			Expected: "Ask [redacted] about it",
+		},
+		{
+			Name:     "nothing to redact",
+			Text:     "I'd give it a 9 out of 10",
+			Expected: "I'd give it a 9 out of 10",
+		},
+	} {
+		t.Run(test.Name, func(t *testing.T) {
+			assert.Equal(t, test.Expected, redactText(test.Text, patterns))
+		})
+	}
+
+	t.Run("custom patterns", func(t *testing.T) {
+		patterns, err := (&configuration{FeedbackRedactionPatterns: "ticket-\\d+\n\n  ACME  "}).getRedactionPatterns()
+		require.Nil(t, err)
+
+		assert.Equal(t, "[redacted] broke [redacted] for [redacted]", redactText("ticket-42 broke ACME for @team", patterns))
+	})
+}
+
+func TestGetAnonymizationSalt(t *testing.T) {
+	t.Run("should return the existing salt", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVGet", AnonymizationSaltKey).Return(mustMarshalJSON("abc123"), nil)
+		defer api.AssertExpectations(t)
+
+		p := &Plugin{}
+		p.SetAPI(api)
+
+		salt, err := p.getAnonymizationSalt()
+
+		assert.Nil(t, err)
+		assert.Equal(t, "abc123", salt)
+	})
+
+	t.Run("should generate the salt the first time that it's needed", func(t *testing.T) {
+		var generated []byte
+
+		api := makeAPIMock()
+		api.On("KVGet", AnonymizationSaltKey).Return(nil, nil).Once()
+		api.On("KVCompareAndSet", AnonymizationSaltKey, []byte(nil), mock.Anything).Return(true, nil).Run(func(args mock.Arguments) {
+			generated = args.Get(2).([]byte)
+		})
+		api.On("KVGet", AnonymizationSaltKey).Return(func(string) []byte { return generated }, nil).Once()
+		defer api.AssertExpectations(t)
+
+		p := &Plugin{}
+		p.SetAPI(api)
+
+		salt, err := p.getAnonymizationSalt()
+
+		assert.Nil(t, err)
+		assert.Len(t, salt, anonymizationSaltLength)
+	})
+}
+
+func TestAnonymizeEvent(t *testing.T) {
+	userID := model.NewId()
+	salt := "abc123"
+
+	makeProperties := func() map[string]interface{} {
+		return map[string]interface{}{
+			"feedback": "Email me at jane.doe@example.com",
+			"email":    "jane.doe@example.com",
+			"score":    10,
+		}
+	}
+
+	t.Run("should keep the user ID and feedback by default", func(t *testing.T) {
+		api := makeAPIMock()
+		defer api.AssertExpectations(t)
+
+		p := &Plugin{
+			configuration: &configuration{},
+		}
+		p.SetAPI(api)
+
+		properties := makeProperties()
+
+		eventUserID, err := p.anonymizeEvent(userID, properties)
+
+		assert.Nil(t, err)
+		assert.Equal(t, userID, eventUserID)
+		assert.Equal(t, makeProperties(), properties)
+	})
+
+	t.Run("should hash the user ID", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVGet", AnonymizationSaltKey).Return(mustMarshalJSON(salt), nil)
+		defer api.AssertExpectations(t)
+
+		p := &Plugin{
+			configuration: &configuration{EventUserIDs: EventUserIDsHash},
+		}
+		p.SetAPI(api)
+
+		eventUserID, err := p.anonymizeEvent(userID, makeProperties())
+
+		assert.Nil(t, err)
+		assert.Equal(t, hashWithSalt(salt, userID), eventUserID)
+		assert.NotEqual(t, userID, eventUserID)
+	})
+
+	t.Run("should return an error if unable to get the salt", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVGet", AnonymizationSaltKey).Return(nil, &model.AppError{})
+		defer api.AssertExpectations(t)
+
+		p := &Plugin{
+			configuration: &configuration{EventUserIDs: EventUserIDsHash},
+		}
+		p.SetAPI(api)
+
+		eventUserID, err := p.anonymizeEvent(userID, makeProperties())
+
+		assert.NotNil(t, err)
+		assert.Equal(t, "", eventUserID)
+	})
+
+	t.Run("should drop the user ID and redact feedback", func(t *testing.T) {
+		api := makeAPIMock()
+		defer api.AssertExpectations(t)
+
+		p := &Plugin{
+			configuration: &configuration{EventUserIDs: EventUserIDsDrop, RedactFeedback: true},
+		}
+		p.SetAPI(api)
+
+		properties := makeProperties()
+
+		eventUserID, err := p.anonymizeEvent(userID, properties)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "", eventUserID)
+		assert.Equal(t, map[string]interface{}{
+			"feedback": "Email me at [redacted]",
+			"email":    "",
+			"score":    10,
+		}, properties)
+	})
+}
+
+func TestGetResponseEventUserID(t *testing.T) {
+	userID := model.NewId()
+	now := toDate(2019, time.March, 11)
+
+	t.Run("should return the user ID when surveys aren't anonymous", func(t *testing.T) {
+		api := makeAPIMock()
+		defer api.AssertExpectations(t)
+
+		p := &Plugin{
+			configuration: &configuration{},
+		}
+		p.SetAPI(api)
+
+		assert.Equal(t, userID, p.getResponseEventUserID(userID, now))
+	})
+
+	t.Run("should return the user's anonymous token for the survey", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, userID)).Return(nil, nil)
+		api.On("KVGet", AnonymizationSaltKey).Return(mustMarshalJSON("abc123"), nil)
+		defer api.AssertExpectations(t)
+
+		p := &Plugin{
+			configuration: &configuration{EnableAnonymousSurveys: true},
+			serverVersion: "5.10.0",
+		}
+		p.SetAPI(api)
+
+		assert.Equal(t, hashWithSalt("abc123", "5.10.0:"+userID), p.getResponseEventUserID(userID, now))
+	})
+
+	t.Run("should never fall back to the user ID", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, userID)).Return(nil, &model.AppError{})
+		defer api.AssertExpectations(t)
+
+		p := &Plugin{
+			configuration: &configuration{EnableAnonymousSurveys: true},
+			serverVersion: "5.10.0",
+		}
+		p.SetAPI(api)
+
+		assert.Equal(t, "", p.getResponseEventUserID(userID, now))
+	})
+}
+
+func TestGetResponseTime(t *testing.T) {
+	now := time.Date(2019, time.March, 11, 13, 25, 0, 0, time.UTC)
+
+	t.Run("should keep the time when surveys aren't anonymous", func(t *testing.T) {
+		p := &Plugin{
+			configuration: &configuration{},
+		}
+
+		assert.Equal(t, now, p.getResponseTime(now))
+	})
+
+	t.Run("should only keep the day when surveys are anonymous", func(t *testing.T) {
+		p := &Plugin{
+			configuration: &configuration{EnableAnonymousSurveys: true},
+		}
+
+		assert.Equal(t, toDate(2019, time.March, 11), p.getResponseTime(now))
+	})
+}
+
+func TestGetResponseEventProperties(t *testing.T) {
+	userID := model.NewId()
+
+	makeAPI := func() *plugintest.API {
+		api := makeAPIMock()
+		api.On("GetSystemInstallDate").Return(int64(1497898133094), nil)
+		api.On("GetUser", userID).Return(&model.User{Id: userID, Roles: model.SystemAdminRoleId, CreateAt: 1551916800000}, nil)
+		api.On("GetLicense").Return(nil)
+		return api
+	}
+
+	t.Run("should include the user's role and creation time when surveys aren't anonymous", func(t *testing.T) {
+		api := makeAPI()
+		defer api.AssertExpectations(t)
+
+		p := &Plugin{
+			configuration: &configuration{},
+		}
+		p.SetAPI(api)
+
+		properties := p.getResponseEventProperties(userID, 1552310700000, map[string]interface{}{"score": 7})
+
+		assert.Equal(t, "system_admin", properties["user_role"])
+		assert.Equal(t, int64(1551916800000), properties["user_create_at"])
+		assert.Equal(t, 7, properties["score"])
+	})
+
+	t.Run("should leave out the user's role and creation time when surveys are anonymous", func(t *testing.T) {
+		api := makeAPI()
+
+		p := &Plugin{
+			configuration: &configuration{EnableAnonymousSurveys: true},
+		}
+		p.SetAPI(api)
+
+		properties := p.getResponseEventProperties(userID, 1552310700000, map[string]interface{}{"score": 7})
+
+		assert.NotContains(t, properties, "user_role")
+		assert.NotContains(t, properties, "user_create_at")
+		assert.Equal(t, 7, properties["score"])
+	})
+}
@@ -4,6 +4,7 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -34,16 +35,71 @@ func (p *Plugin) ServeHTTP(c *plugin.Context, w http.ResponseWriter, r *http.Req
 			Method:  http.MethodPost,
 			Handler: requiresUserID(p.submitScore),
 		},
+		{
+			Path:    "/api/v1/answer",
+			Method:  http.MethodPost,
+			Handler: requiresUserID(p.submitAnswer),
+		},
 		{
 			Path:    "/api/v1/disable_for_user",
 			Method:  http.MethodPost,
 			Handler: requiresUserID(p.disableForUser),
 		},
+		{
+			Path:    "/api/v1/opt_in",
+			Method:  http.MethodPost,
+			Handler: requiresUserID(p.optInForUser),
+		},
+		{
+			Path:    "/api/v1/preferences",
+			Method:  http.MethodGet,
+			Handler: requiresUserID(p.getPreferencesHandler),
+		},
+		{
+			Path:    "/api/v1/preferences",
+			Method:  http.MethodPut,
+			Handler: requiresUserID(p.updatePreferencesHandler),
+		},
 		{
 			Path:    "/api/v1/give_feedback",
 			Method:  http.MethodPost,
 			Handler: requiresUserID(p.userWantsToGiveFeedback),
 		},
+		{
+			Path:    "/api/v1/reports/nps",
+			Method:  http.MethodGet,
+			Handler: requiresUserID(p.requiresSystemAdmin(p.getNPSReport)),
+		},
+		{
+			Path:    "/api/v1/export",
+			Method:  http.MethodGet,
+			Handler: requiresUserID(p.requiresSystemAdmin(p.exportResponsesHandler)),
+		},
+		{
+			Path:    "/api/v1/outbox",
+			Method:  http.MethodGet,
+			Handler: requiresUserID(p.requiresSystemAdmin(p.getOutboxHandler)),
+		},
+		{
+			Path:    "/api/v1/outbox/retry",
+			Method:  http.MethodPost,
+			Handler: requiresUserID(p.requiresSystemAdmin(p.retryDeadLettersHandler)),
+		},
+		{
+			Path:    "/api/v1/survey_definition",
+			Method:  http.MethodGet,
+			Handler: requiresUserID(p.requiresSystemAdmin(p.getSurveyDefinitionHandler)),
+		},
+		{
+			Path:    "/api/v1/survey_definition",
+			Method:  http.MethodPut,
+			Handler: requiresUserID(p.requiresSystemAdmin(p.updateSurveyDefinitionHandler)),
+		},
+		{
+			Path:    "/api/v1/message_templates/preview",
+			Method:  http.MethodPost,
+			Handler: requiresUserID(p.requiresSystemAdmin(p.previewMessageTemplatesHandler)),
+		},
 	}
 
 	routeFound := false
@@ -65,19 +121,21 @@ func (p *Plugin) ServeHTTP(c *plugin.Context, w http.ResponseWriter, r *http.Req
 func (p *Plugin) disableForUser(w http.ResponseWriter, r *http.Request) {
 	userID := r.Header.Get("Mattermost-User-ID")
 
-	p.sendUserDisabledEvent(userID, p.now().UTC().UnixNano()/int64(time.Millisecond))
-
-	var userSurvey *userSurveyState
-	if err := p.KVGet(fmt.Sprintf(UserSurveyKey, userID), &userSurvey); err != nil {
-		p.API.LogError("Failed to get survey state", "user_id", userID, "err", err)
+	if err := p.setSurveysDisabledForUser(userID, true); err != nil {
+		p.API.LogError("Failed to set disabled survey state", "user_id", userID, "err", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	userSurvey.Disabled = true
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(`{}`))
+}
+
+func (p *Plugin) optInForUser(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
 
-	if err := p.KVSet(fmt.Sprintf(UserSurveyKey, userID), userSurvey); err != nil {
-		p.API.LogError("Failed to set disabled survey state", "user_id", userID, "err", err)
+	if err := p.setSurveysDisabledForUser(userID, false); err != nil {
+		p.API.LogError("Failed to set enabled survey state", "user_id", userID, "err", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -86,6 +144,52 @@ func (p *Plugin) disableForUser(w http.ResponseWriter, r *http.Request) {
 	_, _ = w.Write([]byte(`{}`))
 }
 
+func (p *Plugin) getPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+
+	preferences, appErr := p.getUserPreferences(userID)
+	if appErr != nil {
+		p.API.LogError("Failed to get user preferences", "user_id", userID, "err", appErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(preferences); err != nil {
+		p.API.LogWarn("Failed to write user preferences", "err", err)
+	}
+}
+
+// updatePreferencesHandler replaces all of the user's preferences with the ones in the request.
+func (p *Plugin) updatePreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+
+	var preferences *userPreferences
+	if err := json.NewDecoder(io.LimitReader(r.Body, 2048)).Decode(&preferences); err != nil || preferences == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := preferences.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	updated, appErr := p.updateUserPreferences(userID, func(stored *userPreferences) {
+		*stored = *preferences
+	})
+	if appErr != nil {
+		p.API.LogError("Failed to set user preferences", "user_id", userID, "err", appErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(updated); err != nil {
+		p.API.LogWarn("Failed to write user preferences", "err", err)
+	}
+}
+
 func (p *Plugin) userConnected(w http.ResponseWriter, r *http.Request) {
 	userID := r.Header.Get("Mattermost-User-ID")
 
@@ -103,8 +207,14 @@ func (p *Plugin) userConnected(w http.ResponseWriter, r *http.Request) {
 func (p *Plugin) userWantsToGiveFeedback(w http.ResponseWriter, r *http.Request) {
 	userID := r.Header.Get("Mattermost-User-ID")
 
+	// Fall back to the default locale if the user can't be found
+	locale := ""
+	if user, appErr := p.API.GetUser(userID); appErr == nil {
+		locale = user.Locale
+	}
+
 	post, err := p.CreateBotDMPost(userID, &model.Post{
-		Message: feedbackRequestBody,
+		Message: p.translate(locale, feedbackRequestBody),
 		Type:    "custom_nps_feedback",
 	})
 	if err != nil {
@@ -123,7 +233,7 @@ func (p *Plugin) userWantsToGiveFeedback(w http.ResponseWriter, r *http.Request)
 }
 
 func (p *Plugin) checkForDMs(userID string) *model.AppError {
-	if !p.canSendDiagnostics() {
+	if !p.canRecordEvents() {
 		return nil
 	}
 
@@ -144,19 +254,30 @@ func (p *Plugin) checkForDMs(userID string) *model.AppError {
 		return err
 	}
 
-	if _, err := p.checkForAdminNoticeDM(user); err != nil {
-		p.API.LogError("Failed to check for notice of scheduled survey for user", "err", err, "user_id", userID)
+	p.sendPendingDMs(user, now)
+
+	return nil
+}
+
+// sendPendingDMs sends any DMs that the user is due to receive. Errors are logged instead of returned so that a
+// failure to send one DM doesn't prevent the others from being sent. Any DM that fails to send will be retried the
+// next time that this is called. The caller is expected to hold the user's lock.
+func (p *Plugin) sendPendingDMs(user *model.User, now time.Time) {
+	if _, err := p.checkForAdminNoticeDM(user, now); err != nil {
+		p.API.LogError("Failed to check for notice of scheduled survey for user", "err", err, "user_id", user.Id)
 	}
 
 	if _, err := p.checkForWelcomeFeedback(user, now); err != nil {
-		p.API.LogError("Failed to check for welcome survey for user", "err", err, "user_id", userID)
+		p.API.LogError("Failed to check for welcome survey for user", "err", err, "user_id", user.Id)
 	}
 
 	if _, err := p.checkForSurveyDM(user, now); err != nil {
-		p.API.LogError("Failed to check for survey for user", "err", err, "user_id", userID)
+		p.API.LogError("Failed to check for survey for user", "err", err, "user_id", user.Id)
 	}
 
-	return nil
+	if _, err := p.checkForSurveyReminder(user, now); err != nil {
+		p.API.LogError("Failed to check for survey reminder for user", "err", err, "user_id", user.Id)
+	}
 }
 
 func (p *Plugin) submitScore(w http.ResponseWriter, r *http.Request) {
@@ -183,38 +304,83 @@ func (p *Plugin) submitScore(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Scored questions use their type as their ID. Surveys sent before other kinds existed don't include it.
+	questionType, _ := surveyResponse.Context["question_id"].(string)
+	if questionType == "" {
+		questionType = QuestionTypeNPS
+	}
+
+	kind := getSurveyKind(questionType)
+	if kind == nil {
+		p.API.LogError("Score response is for an unknown kind of survey")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
 	var score int
 	var i int64
 	var errScore error
-	if i, errScore = getScore(surveyResponse.Context["selected_option"].(string)); errScore != nil {
+	selectedOption, _ := surveyResponse.Context["selected_option"].(string)
+	if i, errScore = getScore(kind, selectedOption); errScore != nil {
 		p.API.LogError("Score response contains invalid score")
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 	score = int(i)
 
-	p.API.LogDebug(fmt.Sprintf("Received score of %d from %s", score, r.Header.Get("Mattermost-User-ID")))
+	if !p.getConfiguration().EnableAnonymousSurveys {
+		p.API.LogDebug(fmt.Sprintf("Received score of %d from %s", score, r.Header.Get("Mattermost-User-ID")))
+	}
 
 	now := p.now().UTC()
 
-	p.sendScore(score, userID, now.UnixNano()/int64(time.Millisecond))
+	// Accept the response if it's unknown whether or not the survey has ended
+	ended, appErr := p.hasAnsweredSurveyEnded(userID, now)
+	if appErr != nil {
+		p.API.LogWarn("Failed to check if survey has ended", "err", appErr)
+	}
+
+	if ended {
+		p.writeSurveyEndedResponse(w, user.Locale)
+		return
+	}
+
+	if appErr = p.storeScoreResponse(userID, questionType, score, now); appErr != nil {
+		p.API.LogWarn("Failed to store score", "err", appErr)
+	}
+
+	p.sendScore(kind, score, userID, now.UnixNano()/int64(time.Millisecond))
 
 	isFirstResponse, appErr := p.markSurveyAnswered(userID, now)
 	if appErr != nil {
 		p.API.LogWarn("Failed to mark survey as answered", "err", appErr)
 	}
 
-	// Thank the user for their feedback when they first answer the survey
-	if isFirstResponse {
-		_, err := p.CreateBotDMPost(userID, p.buildFeedbackRequestPost())
-		if err != nil {
-			p.API.LogError("Failed to response feedback user")
+	// Thank the user and ask them to explain their score when they first answer the survey
+	if isFirstResponse && p.wantsFeedbackPrompts(userID) {
+		if appErr = p.sendScoreFollowUp(user, questionType, score, now); appErr != nil {
+			p.API.LogError("Failed to send follow-up to user", "user_id", userID, "err", appErr)
 		}
 	}
 
 	// Send response to update score post
+	definition, appErr := p.getSurveyDefinition()
+	if appErr != nil {
+		p.API.LogWarn("Failed to get survey definition", "err", appErr)
+		definition = defaultSurveyDefinition()
+	}
+
+	question := definition.getQuestion(questionType)
+	if question == nil {
+		// The question was removed from the survey after this user received it
+		question = &surveyQuestion{
+			ID:   questionType,
+			Type: questionType,
+		}
+	}
+
 	response := model.PostActionIntegrationResponse{
-		Update: p.buildAnsweredSurveyPost(user, score),
+		Update: p.buildAnsweredQuestionPost(user, question, definition.isFirstQuestion(question), strconv.Itoa(score)),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -223,17 +389,304 @@ func (p *Plugin) submitScore(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func getScore(selectedOption string) (int64, error) {
-	score, err := strconv.ParseInt(selectedOption, 10, 0)
+func (p *Plugin) submitAnswer(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+
+	var request *model.PostActionIntegrationRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 2048)).Decode(&request); err != nil {
+		p.API.LogError("Failed to decode survey answer", "err", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if request.Context == nil {
+		p.API.LogError("Survey answer is missing Context")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	questionID, _ := request.Context["question_id"].(string)
+	answer, _ := request.Context["selected_option"].(string)
+
+	definition, appErr := p.getSurveyDefinition()
+	if appErr != nil {
+		p.API.LogError("Failed to get survey definition", "err", appErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	question := definition.getQuestion(questionID)
+	if question == nil {
+		p.API.LogWarn("Survey answer is for an unknown question", "question_id", questionID)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := question.validateAnswer(answer); err != nil {
+		p.API.LogWarn("Survey answer is invalid", "err", err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	user, appErr := p.API.GetUser(userID)
+	if appErr != nil {
+		p.API.LogError("Failed to get user", "user_id", userID, "err", appErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	now := p.now().UTC()
+
+	// Accept the response if it's unknown whether or not the survey has ended
+	ended, appErr := p.hasAnsweredSurveyEnded(userID, now)
+	if appErr != nil {
+		p.API.LogWarn("Failed to check if survey has ended", "err", appErr)
+	}
+
+	if ended {
+		p.writeSurveyEndedResponse(w, user.Locale)
+		return
+	}
+
+	isFirstAnswer, appErr := p.storeAnswerResponse(userID, question.ID, answer, now)
+	if appErr != nil {
+		p.API.LogWarn("Failed to store answer", "err", appErr)
+	}
+
+	p.sendAnswer(question, answer, userID, now.UnixMilli())
+
+	// Answering any question counts as answering the survey, even if it doesn't ask for a score
+	if _, appErr = p.markSurveyAnswered(userID, now); appErr != nil {
+		p.API.LogWarn("Failed to mark survey as answered", "err", appErr)
+	}
+
+	// Ask the user to explain their answer when they first answer the question
+	if isFirstAnswer && question.FollowUp != "" && p.wantsFeedbackPrompts(userID) {
+		if appErr = p.sendAnswerFollowUp(userID, question, now); appErr != nil {
+			p.API.LogWarn("Failed to send survey follow up", "err", appErr)
+		}
+	}
+
+	response := model.PostActionIntegrationResponse{
+		Update: p.buildAnsweredQuestionPost(user, question, definition.isFirstQuestion(question), answer),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		p.API.LogWarn("Failed to write the answer message", "err", err)
+	}
+}
+
+func (p *Plugin) getSurveyDefinitionHandler(w http.ResponseWriter, r *http.Request) {
+	definition, appErr := p.getSurveyDefinition()
+	if appErr != nil {
+		p.API.LogError("Failed to get survey definition", "err", appErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(definition); err != nil {
+		p.API.LogWarn("Failed to write survey definition", "err", err)
+	}
+}
+
+func (p *Plugin) updateSurveyDefinitionHandler(w http.ResponseWriter, r *http.Request) {
+	var definition *surveyDefinition
+	if err := json.NewDecoder(io.LimitReader(r.Body, 64*1024)).Decode(&definition); err != nil || definition == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if err := definition.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if appErr := p.saveSurveyDefinition(definition); appErr != nil {
+		p.API.LogError("Failed to save survey definition", "err", appErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(definition); err != nil {
+		p.API.LogWarn("Failed to write survey definition", "err", err)
+	}
+}
+
+// previewMessageTemplatesHandler renders the messages that a user would receive without sending them. Admins can
+// preview templates before saving them by including them in the request. Otherwise, the configured templates are used.
+// The user defaults to the admin making the request.
+func (p *Plugin) previewMessageTemplatesHandler(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		UserID    string            `json:"user_id"`
+		Templates *messageTemplates `json:"templates"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 64*1024)).Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if request.UserID == "" {
+		request.UserID = r.Header.Get("Mattermost-User-ID")
+	}
+
+	templates := request.Templates
+	if templates == nil {
+		templates = p.getConfiguration().getMessageTemplates()
+	}
+
+	if err := templates.IsValid(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, appErr := p.API.GetUser(request.UserID)
+	if appErr != nil {
+		http.Error(w, "user not found", http.StatusBadRequest)
+		return
+	}
+
+	preview, err := p.previewMessageTemplates(user, templates)
+	if err != nil {
+		p.API.LogError("Failed to preview message templates", "err", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(preview); err != nil {
+		p.API.LogWarn("Failed to write message template preview", "err", err)
+	}
+}
+
+func (p *Plugin) getNPSReport(w http.ResponseWriter, r *http.Request) {
+	reports, appErr := p.getNPSReports()
+	if appErr != nil {
+		p.API.LogError("Failed to get NPS reports", "err", appErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(reports); err != nil {
+		p.API.LogWarn("Failed to write NPS reports", "err", err)
+	}
+}
+
+func (p *Plugin) getOutboxHandler(w http.ResponseWriter, r *http.Request) {
+	status, appErr := p.getOutboxStatus()
+	if appErr != nil {
+		p.API.LogError("Failed to get telemetry outbox", "err", appErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		p.API.LogWarn("Failed to write telemetry outbox", "err", err)
+	}
+}
+
+// retryDeadLettersHandler moves every dead-lettered event back into the outbox and responds with how many were moved.
+func (p *Plugin) retryDeadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	retried, appErr := p.retryDeadLetters(p.now().UTC())
+	if appErr != nil {
+		p.API.LogError("Failed to retry dead-lettered events", "err", appErr)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]int{"retried": retried}); err != nil {
+		p.API.LogWarn("Failed to write retried events", "err", err)
+	}
+}
+
+func (p *Plugin) exportResponsesHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	format := query.Get("format")
+	if format == "" {
+		format = ExportFormatCSV
+	}
+
+	var contentType string
+	switch format {
+	case ExportFormatCSV:
+		contentType = "text/csv"
+	case ExportFormatNDJSON:
+		contentType = "application/x-ndjson"
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	recordType := query.Get("type")
+	if recordType != "" && recordType != ExportTypeScore && recordType != ExportTypeFeedback && recordType != ExportTypeAnswer {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	cursor, err := decodeExportCursor(query.Get("cursor"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	perPage, err := getIntQueryParam(query.Get("per_page"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"nps-responses.%s\"", format))
+
+	if perPage <= 0 {
+		if _, err = p.exportResponses(w, format, recordType, cursor, 0); err != nil {
+			// The status code has likely already been sent, so all we can do is log the error
+			p.API.LogError("Failed to export survey responses", "err", err.Error())
+		}
+		return
+	}
+
+	// A page is buffered so that the cursor to the next one can be sent in a header before it
+	var buf bytes.Buffer
+
+	next, err := p.exportResponses(&buf, format, recordType, cursor, perPage)
+	if err != nil {
+		p.API.LogError("Failed to export survey responses", "err", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if next != nil {
+		w.Header().Set(ExportNextCursorHeader, encodeExportCursor(next))
+	}
+
+	if _, err = w.Write(buf.Bytes()); err != nil {
+		p.API.LogWarn("Failed to write survey responses", "err", err.Error())
+	}
+}
+
+// getIntQueryParam parses an optional, non-negative integer query parameter, returning 0 if it's empty.
+func getIntQueryParam(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	i, err := strconv.Atoi(value)
 	if err != nil {
 		return 0, err
 	}
 
-	if score < 0 || score > 10 {
-		return 0, errors.New("score out of range")
+	if i < 0 {
+		return 0, errors.New("value must not be negative")
 	}
 
-	return score, nil
+	return i, nil
 }
 
 func requiresUserID(handler apiHandler) apiHandler {
@@ -246,3 +699,14 @@ func requiresUserID(handler apiHandler) apiHandler {
 		handler(w, r)
 	}
 }
+
+func (p *Plugin) requiresSystemAdmin(handler apiHandler) apiHandler {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !p.API.HasPermissionTo(r.Header.Get("Mattermost-User-ID"), model.PermissionManageSystem) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		handler(w, r)
+	}
+}
@@ -5,6 +5,7 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -18,6 +19,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 func TestCheckForDMs(t *testing.T) {
@@ -104,6 +106,8 @@ func TestSubmitScore(t *testing.T) {
 	}
 	licenseID := model.NewId()
 	skuShortName := model.NewId()
+	serverVersion := "5.10.0"
+	scoreResponseKey := fmt.Sprintf(ScoreResponseKey, serverVersion, userID)
 
 	now := toDate(2018, time.April, 1)
 
@@ -122,22 +126,52 @@ func TestSubmitScore(t *testing.T) {
 	}
 
 	t.Run("should send score to segment, respond for additional feedback, and update the score post", func(t *testing.T) {
+		followUpPostID := model.NewId()
+
 		api := makeAPIMock()
+		api.On("KVGet", SurveyDefinitionKey).Return(nil, nil)
 		api.On("GetUser", userID).Return(&model.User{
 			Id: userID,
 		}, nil)
-		api.On("KVGet", userSurveyKey).Return(mustMarshalJSON(&userSurveyState{}), nil)
+		api.On("KVGet", userSurveyKey).Return(mustMarshalJSON(&userSurveyState{
+			ServerVersion: serverVersion,
+		}), nil)
+		api.On("KVGet", fmt.Sprintf(SurveyKey, serverVersion)).Return(nil, nil)
+		api.On("KVSet", scoreResponseKey, mustMarshalJSON(&scoreResponse{
+			SurveyID:      serverVersion,
+			Kind:          QuestionTypeNPS,
+			ServerVersion: serverVersion,
+			UserID:        userID,
+			Score:         10,
+			CreateAt:      now,
+		})).Return(nil)
 		api.On("KVSet", userSurveyKey, mustMarshalJSON(&userSurveyState{
-			AnsweredAt: now,
+			ServerVersion: serverVersion,
+			AnsweredAt:    now,
 		})).Return(nil)
+		api.On("KVGet", fmt.Sprintf(UserPreferencesKey, userID)).Return(nil, nil)
 		api.On("GetDirectChannel", userID, botUserID).Return(&model.Channel{}, nil)
-		api.On("CreatePost", mock.Anything).Return(&model.Post{}, nil)
+		api.On("CreatePost", mock.MatchedBy(func(post *model.Post) bool {
+			return post.Message == promoterFeedbackRequestBody.Other
+		})).Return(&model.Post{Id: followUpPostID}, nil)
+		api.On("KVSet", userSurveyKey, mustMarshalJSON(&userSurveyState{
+			ServerVersion: serverVersion,
+			FollowUp: &scoreFollowUp{
+				SurveyID: serverVersion,
+				Kind:     QuestionTypeNPS,
+				Score:    10,
+				Segment:  NPSSegmentPromoter,
+				PostID:   followUpPostID,
+				SentAt:   now,
+			},
+		})).Return(nil)
 		api.On("GetSystemInstallDate").Return(systemInstallDate, nil)
 		api.On("GetTeamMembersForUser", userID, 0, 50).Return(teamMembers, nil)
 		api.On("GetLicense").Return(&model.License{
 			Id:           licenseID,
 			SkuShortName: skuShortName,
 		})
+		mockOutbox(api)
 		defer api.AssertExpectations(t)
 
 		p := Plugin{
@@ -166,20 +200,114 @@ func TestSubmitScore(t *testing.T) {
 		assert.IsType(t, &model.PostActionIntegrationResponse{}, mustUnmarshalJSON(body, &model.PostActionIntegrationResponse{}))
 	})
 
+	t.Run("should store a CSAT score under its own key", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVGet", SurveyDefinitionKey).Return(nil, nil)
+		api.On("GetUser", userID).Return(&model.User{
+			Id: userID,
+		}, nil)
+		api.On("KVGet", userSurveyKey).Return(mustMarshalJSON(&userSurveyState{
+			ServerVersion: serverVersion,
+			AnsweredAt:    now.Add(-time.Minute),
+		}), nil)
+		api.On("KVGet", fmt.Sprintf(SurveyKey, serverVersion)).Return(nil, nil)
+		api.On("KVSet", fmt.Sprintf(KindScoreResponseKey, serverVersion, QuestionTypeCSAT, userID), mustMarshalJSON(&scoreResponse{
+			SurveyID:      serverVersion,
+			Kind:          QuestionTypeCSAT,
+			ServerVersion: serverVersion,
+			UserID:        userID,
+			Score:         4,
+			CreateAt:      now,
+		})).Return(nil)
+		api.On("GetSystemInstallDate").Return(systemInstallDate, nil)
+		api.On("GetTeamMembersForUser", userID, 0, 50).Return(teamMembers, nil)
+		api.On("GetLicense").Return(&model.License{
+			Id:           licenseID,
+			SkuShortName: skuShortName,
+		})
+		mockOutbox(api)
+		defer api.AssertExpectations(t)
+
+		p := Plugin{
+			botUserID: botUserID,
+			now: func() time.Time {
+				return now
+			},
+			tracker: telemetry.NewTracker(nil, "", "", "", "", "", telemetry.TrackerConfig{}, nil),
+		}
+		p.SetAPI(api)
+
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, "/score", bytes.NewReader(mustMarshalJSON(&model.PostActionIntegrationRequest{
+			Context: map[string]interface{}{
+				"question_id":     QuestionTypeCSAT,
+				"selected_option": "4",
+			},
+		})))
+		request.Header.Set("Mattermost-User-ID", userID)
+
+		p.submitScore(recorder, request)
+
+		result := recorder.Result()
+		body, _ := io.ReadAll(result.Body)
+
+		assert.Equal(t, http.StatusOK, result.StatusCode)
+
+		response := mustUnmarshalJSON(body, &model.PostActionIntegrationResponse{}).(*model.PostActionIntegrationResponse)
+		require.NotNil(t, response.Update)
+		assert.Equal(t, "custom_csat_survey", response.Update.Type)
+		assert.Equal(t, "You selected 4 out of 5.", response.Update.Attachments()[0].Text)
+	})
+
+	t.Run("should reject a CSAT score out of its range", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("GetUser", userID).Return(&model.User{
+			Id: userID,
+		}, nil).Maybe()
+		api.On("LogError", "Score response contains invalid score")
+		defer api.AssertExpectations(t)
+
+		p := Plugin{
+			botUserID: botUserID,
+			now: func() time.Time {
+				return now
+			},
+		}
+		p.SetAPI(api)
+
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, "/score", bytes.NewReader(mustMarshalJSON(&model.PostActionIntegrationRequest{
+			Context: map[string]interface{}{
+				"question_id":     QuestionTypeCSAT,
+				"selected_option": "10",
+			},
+		})))
+		request.Header.Set("Mattermost-User-ID", userID)
+
+		p.submitScore(recorder, request)
+
+		assert.Equal(t, http.StatusBadRequest, recorder.Result().StatusCode)
+	})
+
 	t.Run("should not respond for feedback if the user changes their score", func(t *testing.T) {
 		api := makeAPIMock()
+		api.On("KVGet", SurveyDefinitionKey).Return(nil, nil)
 		api.On("GetUser", userID).Return(&model.User{
 			Id: userID,
 		}, nil)
 		api.On("KVGet", userSurveyKey).Return(mustMarshalJSON(&userSurveyState{
-			AnsweredAt: now.Add(-time.Minute),
+			ServerVersion: serverVersion,
+			AnsweredAt:    now.Add(-time.Minute),
 		}), nil)
+		api.On("KVGet", fmt.Sprintf(SurveyKey, serverVersion)).Return(nil, nil)
+		api.On("KVSet", scoreResponseKey, mock.Anything).Return(nil)
 		api.On("GetSystemInstallDate").Return(systemInstallDate, nil)
 		api.On("GetTeamMembersForUser", userID, 0, 50).Return(teamMembers, nil)
 		api.On("GetLicense").Return(&model.License{
 			Id:           licenseID,
 			SkuShortName: skuShortName,
 		})
+		mockOutbox(api)
 		defer api.AssertExpectations(t)
 
 		p := Plugin{
@@ -210,6 +338,7 @@ func TestSubmitScore(t *testing.T) {
 
 	t.Run("should only log warning if unable to mark survey answered", func(t *testing.T) {
 		api := makeAPIMock()
+		api.On("KVGet", SurveyDefinitionKey).Return(nil, nil)
 		api.On("GetUser", userID).Return(&model.User{
 			Id: userID,
 		}, nil)
@@ -221,6 +350,7 @@ func TestSubmitScore(t *testing.T) {
 			Id:           licenseID,
 			SkuShortName: skuShortName,
 		})
+		mockOutbox(api)
 		defer api.AssertExpectations(t)
 
 		p := Plugin{
@@ -357,62 +487,6 @@ func TestSubmitScore(t *testing.T) {
 	})
 }
 
-func TestGetScore(t *testing.T) {
-	for _, test := range []struct {
-		Name           string
-		SelectedOption string
-		ExpectedScore  int64
-		ExpectError    bool
-	}{
-		{
-			Name:           "a number",
-			SelectedOption: "7",
-			ExpectedScore:  7,
-		},
-		{
-			Name:           "zero",
-			SelectedOption: "0",
-			ExpectedScore:  0,
-		},
-		{
-			Name:           "ten",
-			SelectedOption: "10",
-			ExpectedScore:  10,
-		},
-		{
-			Name:           "too low",
-			SelectedOption: "-400",
-			ExpectError:    true,
-		},
-		{
-			Name:           "too high",
-			SelectedOption: "1000000",
-			ExpectError:    true,
-		},
-		{
-			Name:           "garbage",
-			SelectedOption: "garbage",
-			ExpectError:    true,
-		},
-		{
-			Name:           "empty",
-			SelectedOption: "",
-			ExpectError:    true,
-		},
-	} {
-		t.Run(test.Name, func(t *testing.T) {
-			score, err := getScore(test.SelectedOption)
-
-			assert.Equal(t, test.ExpectedScore, score)
-			if test.ExpectError {
-				assert.NotNil(t, err)
-			} else {
-				assert.Nil(t, err)
-			}
-		})
-	}
-}
-
 func TestRequiresUserId(t *testing.T) {
 	t.Run("should call handler when user ID is present", func(t *testing.T) {
 		called := false
@@ -449,7 +523,7 @@ func TestRequiresUserId(t *testing.T) {
 func TestDisableForUser(t *testing.T) {
 	botUserID := model.NewId()
 	userID := model.NewId()
-	userSurveyKey := fmt.Sprintf(UserSurveyKey, userID)
+	userPreferencesKey := fmt.Sprintf(UserPreferencesKey, userID)
 	systemInstallDate := int64(1497898133094)
 
 	licenseID := model.NewId()
@@ -473,9 +547,10 @@ func TestDisableForUser(t *testing.T) {
 
 	t.Run("should disable sending for user", func(t *testing.T) {
 		api := makeAPIMock()
-		api.On("KVGet", userSurveyKey).Return(mustMarshalJSON(&userSurveyState{}), nil)
-		api.On("KVSet", userSurveyKey, mustMarshalJSON(&userSurveyState{
-			Disabled: true,
+		api.On("KVGet", userPreferencesKey).Return(nil, nil)
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, userID)).Return(nil, nil)
+		api.On("KVSet", userPreferencesKey, mustMarshalJSON(&userPreferences{
+			DisableSurveys: true,
 		})).Return(nil)
 		api.On("GetSystemInstallDate").Return(systemInstallDate, nil)
 		api.On("GetUser", userID).Return(nil, &model.AppError{})
@@ -483,6 +558,7 @@ func TestDisableForUser(t *testing.T) {
 			Id:           licenseID,
 			SkuShortName: skuShortName,
 		})
+		mockOutbox(api)
 		defer api.AssertExpectations(t)
 
 		p := Plugin{
@@ -514,12 +590,20 @@ func TestUserWantsToGiveFeedback(t *testing.T) {
 	userID := model.NewId()
 
 	t.Run("should send a message to the user on behalf of the feedbackbot", func(t *testing.T) {
-		p := Plugin{botUserID: model.NewId()}
+		p := Plugin{
+			botUserID: model.NewId(),
+			translations: map[string]map[string]string{
+				"fr": {feedbackRequestBody.ID: "Comment pouvons-nous améliorer votre expérience ?"},
+			},
+		}
 
 		api := &plugintest.API{}
 		createdPost := &model.Post{Id: model.NewId()}
+		api.On("GetUser", userID).Return(&model.User{Id: userID, Locale: "fr"}, nil)
 		api.On("GetDirectChannel", userID, p.botUserID).Return(&model.Channel{}, nil)
-		api.On("CreatePost", mock.AnythingOfType("*model.Post")).Return(createdPost, nil)
+		api.On("CreatePost", mock.MatchedBy(func(post *model.Post) bool {
+			return post.Message == "Comment pouvons-nous améliorer votre expérience ?"
+		})).Return(createdPost, nil)
 		defer api.AssertExpectations(t)
 
 		p.SetAPI(api)
@@ -542,6 +626,7 @@ func TestUserWantsToGiveFeedback(t *testing.T) {
 		p := Plugin{botUserID: model.NewId()}
 
 		api := &plugintest.API{}
+		api.On("GetUser", userID).Return(nil, &model.AppError{})
 		api.On("GetDirectChannel", userID, p.botUserID).Return(nil, &model.AppError{})
 		api.On("LogError", mock.AnythingOfType("string"), "user_id", userID, "err", mock.AnythingOfType("*model.AppError")).Return(nil, model.AppError{})
 		defer api.AssertExpectations(t)
@@ -558,3 +643,487 @@ func TestUserWantsToGiveFeedback(t *testing.T) {
 		assert.Equal(t, http.StatusInternalServerError, result.StatusCode)
 	})
 }
+
+func TestGetNPSReport(t *testing.T) {
+	userID := model.NewId()
+
+	t.Run("should return the reports", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVList", 0, 100).Return([]string{fmt.Sprintf(ScoreResponseKey, "5.10.0", userID)}, nil)
+		api.On("KVGet", fmt.Sprintf(ScoreResponseKey, "5.10.0", userID)).Return(mustMarshalJSON(&scoreResponse{
+			ServerVersion: "5.10.0",
+			Score:         10,
+		}), nil)
+		api.On("KVGet", fmt.Sprintf(SurveySentCountKey, "5.10.0")).Return([]byte("4"), nil)
+		defer api.AssertExpectations(t)
+
+		p := Plugin{}
+		p.SetAPI(api)
+
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodGet, "/api/v1/reports/nps", nil)
+		request.Header.Set("Mattermost-User-ID", userID)
+
+		p.getNPSReport(recorder, request)
+
+		result := recorder.Result()
+		body, _ := io.ReadAll(result.Body)
+
+		assert.Equal(t, http.StatusOK, result.StatusCode)
+		assert.Equal(t, &[]*npsReport{
+			{
+				SurveyID:      "5.10.0",
+				ServerVersion: "5.10.0",
+				Promoters:     1,
+				Responses:     1,
+				Sent:          4,
+				NPS:           100,
+				ResponseRate:  0.25,
+			},
+		}, mustUnmarshalJSON(body, &[]*npsReport{}))
+	})
+
+	t.Run("should return an error if unable to compute the reports", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVList", 0, 100).Return(nil, &model.AppError{})
+		defer api.AssertExpectations(t)
+
+		p := Plugin{}
+		p.SetAPI(api)
+
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodGet, "/api/v1/reports/nps", nil)
+		request.Header.Set("Mattermost-User-ID", userID)
+
+		p.getNPSReport(recorder, request)
+
+		assert.Equal(t, http.StatusInternalServerError, recorder.Result().StatusCode)
+	})
+}
+
+func TestRequiresSystemAdmin(t *testing.T) {
+	userID := model.NewId()
+
+	t.Run("should call handler when the user is a system admin", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("HasPermissionTo", userID, model.PermissionManageSystem).Return(true)
+		defer api.AssertExpectations(t)
+
+		p := Plugin{}
+		p.SetAPI(api)
+
+		called := false
+		handler := func(w http.ResponseWriter, r *http.Request) {
+			called = true
+		}
+
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		request.Header.Set("Mattermost-User-ID", userID)
+
+		p.requiresSystemAdmin(handler)(recorder, request)
+
+		assert.Equal(t, http.StatusOK, recorder.Result().StatusCode)
+		assert.True(t, called)
+	})
+
+	t.Run("should return HTTP 403 when the user isn't a system admin", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("HasPermissionTo", userID, model.PermissionManageSystem).Return(false)
+		defer api.AssertExpectations(t)
+
+		p := Plugin{}
+		p.SetAPI(api)
+
+		called := false
+		handler := func(w http.ResponseWriter, r *http.Request) {
+			called = true
+		}
+
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		request.Header.Set("Mattermost-User-ID", userID)
+
+		p.requiresSystemAdmin(handler)(recorder, request)
+
+		assert.Equal(t, http.StatusForbidden, recorder.Result().StatusCode)
+		assert.False(t, called)
+	})
+}
+
+func TestSubmitAnswer(t *testing.T) {
+	botUserID := model.NewId()
+	userID := model.NewId()
+	serverVersion := "5.10.0"
+	now := toDate(2019, time.May, 10)
+
+	definition := &surveyDefinition{
+		Questions: []*surveyQuestion{
+			defaultNPSQuestion(),
+			{
+				ID:       "search",
+				Type:     QuestionTypeScale,
+				Text:     "How satisfied are you with search?",
+				Min:      1,
+				Max:      5,
+				FollowUp: "What could be better about search?",
+			},
+		},
+	}
+	answerKey := fmt.Sprintf(AnswerResponseKey, serverVersion, "search", userID)
+	followUpPostID := model.NewId()
+
+	makeRequest := func(context map[string]interface{}) *http.Request {
+		request := httptest.NewRequest(http.MethodPost, "/api/v1/answer", bytes.NewReader(mustMarshalJSON(&model.PostActionIntegrationRequest{
+			Context: context,
+		})))
+		request.Header.Set("Mattermost-User-ID", userID)
+
+		return request
+	}
+
+	makePlugin := func(api *plugintest.API) *Plugin {
+		p := &Plugin{
+			botUserID: botUserID,
+			now: func() time.Time {
+				return now
+			},
+			serverVersion: serverVersion,
+			tracker:       telemetry.NewTracker(nil, "", "", "", "", "", telemetry.TrackerConfig{}, nil),
+		}
+		p.SetAPI(api)
+
+		return p
+	}
+
+	mockTelemetry := func(api *plugintest.API) {
+		api.On("GetSystemInstallDate").Return(int64(0), nil)
+		api.On("GetTeamMembersForUser", userID, 0, 50).Return([]*model.TeamMember{}, nil)
+		api.On("GetLicense").Return(nil)
+		mockOutbox(api)
+	}
+
+	t.Run("should store the answer, ask the follow up, and update the question post", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVGet", SurveyDefinitionKey).Return(mustMarshalJSON(definition), nil)
+		api.On("GetUser", userID).Return(&model.User{Id: userID}, nil)
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, userID)).Return(mustMarshalJSON(&userSurveyState{
+			SurveyID:      serverVersion,
+			ServerVersion: serverVersion,
+		}), nil)
+		api.On("KVGet", fmt.Sprintf(SurveyKey, serverVersion)).Return(nil, nil)
+		api.On("KVGet", answerKey).Return(nil, nil)
+		api.On("KVSet", answerKey, mustMarshalJSON(&answerResponse{
+			SurveyID:      serverVersion,
+			ServerVersion: serverVersion,
+			UserID:        userID,
+			QuestionID:    "search",
+			Answer:        "4",
+			CreateAt:      now,
+		})).Return(nil)
+		mockTelemetry(api)
+		api.On("KVSet", fmt.Sprintf(UserSurveyKey, userID), mustMarshalJSON(&userSurveyState{
+			SurveyID:      serverVersion,
+			ServerVersion: serverVersion,
+			AnsweredAt:    now,
+		})).Return(nil)
+		api.On("KVGet", fmt.Sprintf(UserPreferencesKey, userID)).Return(nil, nil)
+		api.On("GetDirectChannel", userID, botUserID).Return(&model.Channel{}, nil)
+		api.On("CreatePost", mock.MatchedBy(func(post *model.Post) bool {
+			return post.Message == "What could be better about search?"
+		})).Return(&model.Post{Id: followUpPostID}, nil)
+		api.On("KVSet", fmt.Sprintf(UserSurveyKey, userID), mustMarshalJSON(&userSurveyState{
+			SurveyID:      serverVersion,
+			ServerVersion: serverVersion,
+			AnswerFollowUps: map[string]*answerFollowUp{
+				"search": {PostID: followUpPostID, SentAt: now},
+			},
+		})).Return(nil)
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api)
+
+		recorder := httptest.NewRecorder()
+		p.submitAnswer(recorder, makeRequest(map[string]interface{}{
+			"question_id":     "search",
+			"selected_option": "4",
+		}))
+
+		result := recorder.Result()
+		body, _ := io.ReadAll(result.Body)
+
+		require.Equal(t, http.StatusOK, result.StatusCode)
+
+		var response *model.PostActionIntegrationResponse
+		require.NoError(t, json.Unmarshal(body, &response))
+		assert.Equal(t, "4", response.Update.Attachments()[0].Actions[0].DefaultOption)
+	})
+
+	t.Run("should not ask the follow up again if the user changes their answer", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVGet", SurveyDefinitionKey).Return(mustMarshalJSON(definition), nil)
+		api.On("GetUser", userID).Return(&model.User{Id: userID}, nil)
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, userID)).Return(mustMarshalJSON(&userSurveyState{
+			SurveyID:      serverVersion,
+			ServerVersion: serverVersion,
+			AnsweredAt:    now,
+		}), nil)
+		api.On("KVGet", fmt.Sprintf(SurveyKey, serverVersion)).Return(nil, nil)
+		api.On("KVGet", answerKey).Return(mustMarshalJSON(&answerResponse{Answer: "4"}), nil)
+		api.On("KVSet", answerKey, mock.Anything).Return(nil)
+		mockTelemetry(api)
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api)
+
+		recorder := httptest.NewRecorder()
+		p.submitAnswer(recorder, makeRequest(map[string]interface{}{
+			"question_id":     "search",
+			"selected_option": "2",
+		}))
+
+		assert.Equal(t, http.StatusOK, recorder.Result().StatusCode)
+	})
+
+	t.Run("should reject an answer to a survey that has ended", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVGet", SurveyDefinitionKey).Return(mustMarshalJSON(definition), nil)
+		api.On("GetUser", userID).Return(&model.User{Id: userID}, nil)
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, userID)).Return(mustMarshalJSON(&userSurveyState{
+			SurveyID:      serverVersion,
+			ServerVersion: serverVersion,
+		}), nil)
+		api.On("KVGet", fmt.Sprintf(SurveyKey, serverVersion)).Return(mustMarshalJSON(&surveyState{
+			ServerVersion: serverVersion,
+			EndAt:         now.Add(-time.Hour),
+		}), nil)
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api)
+
+		recorder := httptest.NewRecorder()
+		p.submitAnswer(recorder, makeRequest(map[string]interface{}{
+			"question_id":     "search",
+			"selected_option": "4",
+		}))
+
+		result := recorder.Result()
+		body, _ := io.ReadAll(result.Body)
+
+		require.Equal(t, http.StatusOK, result.StatusCode)
+
+		var response *model.PostActionIntegrationResponse
+		require.NoError(t, json.Unmarshal(body, &response))
+		assert.Nil(t, response.Update)
+		assert.Equal(t, surveyExpiredBody.Other, response.EphemeralText)
+	})
+
+	t.Run("should return bad request for an unknown question", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVGet", SurveyDefinitionKey).Return(mustMarshalJSON(definition), nil)
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api)
+
+		recorder := httptest.NewRecorder()
+		p.submitAnswer(recorder, makeRequest(map[string]interface{}{
+			"question_id":     "performance",
+			"selected_option": "4",
+		}))
+
+		assert.Equal(t, http.StatusBadRequest, recorder.Result().StatusCode)
+	})
+
+	t.Run("should return bad request for an invalid answer", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVGet", SurveyDefinitionKey).Return(mustMarshalJSON(definition), nil)
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api)
+
+		recorder := httptest.NewRecorder()
+		p.submitAnswer(recorder, makeRequest(map[string]interface{}{
+			"question_id":     "search",
+			"selected_option": "10",
+		}))
+
+		assert.Equal(t, http.StatusBadRequest, recorder.Result().StatusCode)
+	})
+
+	t.Run("should return bad request if request context is missing", func(t *testing.T) {
+		api := makeAPIMock()
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api)
+
+		recorder := httptest.NewRecorder()
+		p.submitAnswer(recorder, makeRequest(nil))
+
+		assert.Equal(t, http.StatusBadRequest, recorder.Result().StatusCode)
+	})
+}
+
+func TestSurveyDefinitionHandlers(t *testing.T) {
+	userID := model.NewId()
+
+	definition := &surveyDefinition{
+		Questions: []*surveyQuestion{
+			defaultNPSQuestion(),
+			{
+				ID:      "feature",
+				Type:    QuestionTypeChoice,
+				Text:    "What's your favorite feature?",
+				Options: []string{"Search", "Threads"},
+			},
+		},
+	}
+
+	t.Run("should return the survey definition", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVGet", SurveyDefinitionKey).Return(nil, nil)
+		defer api.AssertExpectations(t)
+
+		p := Plugin{}
+		p.SetAPI(api)
+
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodGet, "/api/v1/survey_definition", nil)
+		request.Header.Set("Mattermost-User-ID", userID)
+
+		p.getSurveyDefinitionHandler(recorder, request)
+
+		result := recorder.Result()
+		body, _ := io.ReadAll(result.Body)
+
+		assert.Equal(t, http.StatusOK, result.StatusCode)
+		assert.Equal(t, defaultSurveyDefinition(), mustUnmarshalJSON(body, &surveyDefinition{}))
+	})
+
+	t.Run("should save a valid survey definition", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVSet", SurveyDefinitionKey, mustMarshalJSON(definition)).Return(nil)
+		defer api.AssertExpectations(t)
+
+		p := Plugin{}
+		p.SetAPI(api)
+
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPut, "/api/v1/survey_definition", bytes.NewReader(mustMarshalJSON(definition)))
+		request.Header.Set("Mattermost-User-ID", userID)
+
+		p.updateSurveyDefinitionHandler(recorder, request)
+
+		assert.Equal(t, http.StatusOK, recorder.Result().StatusCode)
+	})
+
+	t.Run("should reject an invalid survey definition", func(t *testing.T) {
+		api := makeAPIMock()
+		defer api.AssertExpectations(t)
+
+		p := Plugin{}
+		p.SetAPI(api)
+
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPut, "/api/v1/survey_definition", bytes.NewReader(mustMarshalJSON(&surveyDefinition{})))
+		request.Header.Set("Mattermost-User-ID", userID)
+
+		p.updateSurveyDefinitionHandler(recorder, request)
+
+		result := recorder.Result()
+		body, _ := io.ReadAll(result.Body)
+
+		assert.Equal(t, http.StatusBadRequest, result.StatusCode)
+		assert.Contains(t, string(body), "at least one question")
+	})
+}
+
+func TestPreferencesHandlers(t *testing.T) {
+	userID := model.NewId()
+	userPreferencesKey := fmt.Sprintf(UserPreferencesKey, userID)
+
+	t.Run("should return the default preferences", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVGet", userPreferencesKey).Return(nil, nil)
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, userID)).Return(nil, nil)
+		defer api.AssertExpectations(t)
+
+		p := Plugin{}
+		p.SetAPI(api)
+
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodGet, "/api/v1/preferences", nil)
+		request.Header.Set("Mattermost-User-ID", userID)
+
+		p.getPreferencesHandler(recorder, request)
+
+		result := recorder.Result()
+		body, _ := io.ReadAll(result.Body)
+
+		assert.Equal(t, http.StatusOK, result.StatusCode)
+		assert.Equal(t, &userPreferences{}, mustUnmarshalJSON(body, &userPreferences{}))
+	})
+
+	t.Run("should update the preferences", func(t *testing.T) {
+		preferences := &userPreferences{
+			DisableWelcomeFeedback: true,
+			DisableFeedbackPrompts: true,
+			PreferredChannel:       PreferredChannelEmail,
+		}
+
+		api := makeAPIMock()
+		api.On("KVGet", userPreferencesKey).Return(mustMarshalJSON(&userPreferences{DisableSurveys: true}), nil)
+		api.On("KVSet", userPreferencesKey, mustMarshalJSON(preferences)).Return(nil)
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, userID)).Return(nil, nil)
+		defer api.AssertExpectations(t)
+
+		p := Plugin{}
+		p.SetAPI(api)
+
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPut, "/api/v1/preferences", bytes.NewReader(mustMarshalJSON(preferences)))
+		request.Header.Set("Mattermost-User-ID", userID)
+
+		p.updatePreferencesHandler(recorder, request)
+
+		result := recorder.Result()
+		body, _ := io.ReadAll(result.Body)
+
+		assert.Equal(t, http.StatusOK, result.StatusCode)
+		assert.Equal(t, preferences, mustUnmarshalJSON(body, &userPreferences{}))
+	})
+
+	t.Run("should reject invalid preferences", func(t *testing.T) {
+		api := makeAPIMock()
+		defer api.AssertExpectations(t)
+
+		p := Plugin{}
+		p.SetAPI(api)
+
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPut, "/api/v1/preferences", bytes.NewReader(mustMarshalJSON(&userPreferences{PreferredChannel: "sms"})))
+		request.Header.Set("Mattermost-User-ID", userID)
+
+		p.updatePreferencesHandler(recorder, request)
+
+		assert.Equal(t, http.StatusBadRequest, recorder.Result().StatusCode)
+	})
+
+	t.Run("should opt the user back in to surveys", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVGet", userPreferencesKey).Return(mustMarshalJSON(&userPreferences{DisableSurveys: true}), nil)
+		api.On("KVSet", userPreferencesKey, mustMarshalJSON(&userPreferences{})).Return(nil)
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, userID)).Return(nil, nil)
+		defer api.AssertExpectations(t)
+
+		p := Plugin{}
+		p.SetAPI(api)
+
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, "/api/v1/opt_in", nil)
+		request.Header.Set("Mattermost-User-ID", userID)
+
+		p.optInForUser(recorder, request)
+
+		assert.Equal(t, http.StatusOK, recorder.Result().StatusCode)
+	})
+}
@@ -0,0 +1,384 @@
+// Copyright (c) 2019-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+)
+
+const (
+	// CommandTrigger is the slash command that users can use to send feedback and manage their surveys.
+	CommandTrigger = "feedback"
+
+	commandHelpText = "Available commands:\n" +
+		"* `/feedback send <text>` - Send feedback to Mattermost\n" +
+		"* `/feedback survey` - Take the current survey now\n" +
+		"* `/feedback optout` - Stop receiving surveys\n" +
+		"* `/feedback optin` - Start receiving surveys again\n" +
+		"* `/feedback status` - Show whether or not you receive surveys\n" +
+		"* `/feedback settings` - Show your settings\n" +
+		"* `/feedback settings <surveys|welcome|prompts> <on|off>` - Turn surveys, the welcome message or follow-up questions on or off\n" +
+		"* `/feedback settings channel <dm|email>` - Choose whether you're also emailed when you're sent a survey"
+	commandErrorText = "Something went wrong. Please try again later."
+
+	commandFeedbackEmptyText      = "Please include your feedback, such as `/feedback send I love the new search!`"
+	commandFeedbackSentText       = "Thanks! Your feedback has been sent to Feedbackbot."
+	commandSurveySentText         = "Feedbackbot has sent you the current survey."
+	commandSurveyDisabledText     = "Surveys are currently disabled."
+	commandNoSurveyText           = "There is no survey running right now."
+	commandSurveyAlreadySentText  = "You've already been sent the current survey."
+	commandSurveyOptedOutText     = "You've opted out of surveys. Use `/feedback optin` to receive them again."
+	commandSurveyBusyText         = "Feedbackbot is busy sending you messages. Please try again in a moment."
+	commandOptOutText             = "You will no longer receive surveys from Feedbackbot."
+	commandOptInText              = "You will receive surveys from Feedbackbot again."
+	commandStatusOptedOutText     = "You've opted out of surveys."
+	commandStatusOptedInText      = "You receive surveys from Feedbackbot."
+	commandStatusLastSentText     = "You were last sent a survey on %s."
+	commandStatusLastAnsweredText = "You last answered a survey on %s."
+	commandSettingsUsageText      = "Please specify a setting and its value, such as `/feedback settings welcome off` or `/feedback settings channel email`."
+	commandSettingsUpdatedText    = "Your settings have been saved."
+)
+
+// getCommand returns the /feedback command registered by the plugin.
+func getCommand() *model.Command {
+	autocomplete := model.NewAutocompleteData(CommandTrigger, "[command]", "Send feedback or manage your surveys")
+
+	send := model.NewAutocompleteData("send", "<text>", "Send feedback to Mattermost")
+	send.AddTextArgument("Your feedback", "<text>", "")
+	autocomplete.AddCommand(send)
+
+	autocomplete.AddCommand(model.NewAutocompleteData("survey", "", "Take the current survey now"))
+	autocomplete.AddCommand(model.NewAutocompleteData("optout", "", "Stop receiving surveys"))
+	autocomplete.AddCommand(model.NewAutocompleteData("optin", "", "Start receiving surveys again"))
+	autocomplete.AddCommand(model.NewAutocompleteData("status", "", "Show whether or not you receive surveys"))
+
+	settings := model.NewAutocompleteData("settings", "[setting] [value]", "Show or change your settings")
+	for _, name := range []string{"surveys", "welcome", "prompts"} {
+		setting := model.NewAutocompleteData(name, "<on|off>", fmt.Sprintf("Turn %s on or off", settingNames[name]))
+		setting.AddStaticListArgument("", true, []model.AutocompleteListItem{
+			{Item: "on", HelpText: "Turn it on"},
+			{Item: "off", HelpText: "Turn it off"},
+		})
+		settings.AddCommand(setting)
+	}
+	channel := model.NewAutocompleteData("channel", "<dm|email>", "Choose whether you're also emailed when you're sent a survey")
+	channel.AddStaticListArgument("", true, []model.AutocompleteListItem{
+		{Item: PreferredChannelDM, HelpText: "Only send surveys as direct messages"},
+		{Item: PreferredChannelEmail, HelpText: "Also email me when I'm sent a survey"},
+	})
+	settings.AddCommand(channel)
+	autocomplete.AddCommand(settings)
+
+	return &model.Command{
+		Trigger:          CommandTrigger,
+		DisplayName:      "Feedback",
+		Description:      "Send feedback or manage your surveys from Feedbackbot",
+		AutoComplete:     true,
+		AutoCompleteDesc: "Available commands: send, survey, optout, optin, status",
+		AutoCompleteHint: "[command]",
+		AutocompleteData: autocomplete,
+	}
+}
+
+func (p *Plugin) ExecuteCommand(c *plugin.Context, args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+	trigger, rest := splitFirstWord(args.Command)
+	subcommand, text := splitFirstWord(rest)
+
+	var message string
+	var err *model.AppError
+
+	if strings.TrimPrefix(trigger, "/") == AdminCommandTrigger {
+		message, err = p.executeAdminCommand(args.UserId, subcommand, text)
+	} else {
+		message, err = p.executeFeedbackCommand(args.UserId, subcommand, text)
+	}
+
+	if err != nil {
+		p.API.LogError("Failed to execute "+trigger+" "+subcommand, "user_id", args.UserId, "err", err)
+		message = commandErrorText
+	}
+
+	return &model.CommandResponse{
+		ResponseType: model.CommandResponseTypeEphemeral,
+		Text:         message,
+	}, nil
+}
+
+func (p *Plugin) executeFeedbackCommand(userID, subcommand, text string) (string, *model.AppError) {
+	switch subcommand {
+	case "send":
+		return p.executeSendCommand(userID, text)
+	case "survey":
+		return p.executeSurveyCommand(userID)
+	case "optout":
+		return p.executeOptOutCommand(userID, true)
+	case "optin":
+		return p.executeOptOutCommand(userID, false)
+	case "status":
+		return p.executeStatusCommand(userID)
+	case "settings":
+		return p.executeSettingsCommand(userID, text)
+	default:
+		return commandHelpText, nil
+	}
+}
+
+// splitFirstWord splits the first word off of the given text, returning it and the rest of the text with any leading
+// whitespace removed. Whitespace inside of the rest of the text is preserved so that feedback keeps its formatting.
+func splitFirstWord(text string) (string, string) {
+	text = strings.TrimLeftFunc(text, unicode.IsSpace)
+
+	i := strings.IndexFunc(text, unicode.IsSpace)
+	if i == -1 {
+		return text, ""
+	}
+
+	return text[:i], strings.TrimSpace(text[i:])
+}
+
+// executeSendCommand posts the feedback to the user's DM channel with Feedbackbot on their behalf so that it's
+// handled exactly like feedback sent there directly.
+func (p *Plugin) executeSendCommand(userID, text string) (string, *model.AppError) {
+	if text == "" {
+		return commandFeedbackEmptyText, nil
+	}
+
+	channel, err := p.API.GetDirectChannel(userID, p.botUserID)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err = p.API.CreatePost(&model.Post{
+		UserId:    userID,
+		ChannelId: channel.Id,
+		Message:   text,
+	}); err != nil {
+		return "", err
+	}
+
+	return commandFeedbackSentText, nil
+}
+
+// executeSurveyCommand sends the current survey to the user right away.
+func (p *Plugin) executeSurveyCommand(userID string) (string, *model.AppError) {
+	result, err := p.sendSurveyNow(userID)
+	if err != nil {
+		return "", err
+	}
+
+	switch result {
+	case surveyNowDisabled:
+		return commandSurveyDisabledText, nil
+	case surveyNowNotRunning:
+		return commandNoSurveyText, nil
+	case surveyNowBusy:
+		return commandSurveyBusyText, nil
+	case surveyNowOptedOut:
+		return commandSurveyOptedOutText, nil
+	case surveyNowAlreadySent:
+		return commandSurveyAlreadySentText, nil
+	default:
+		return commandSurveySentText, nil
+	}
+}
+
+// surveyNowResult is the outcome of sending the current survey to a user on demand.
+type surveyNowResult int
+
+const (
+	surveyNowSent surveyNowResult = iota
+	surveyNowDisabled
+	surveyNowNotRunning
+	surveyNowBusy
+	surveyNowOptedOut
+	surveyNowAlreadySent
+)
+
+// sendSurveyNow sends the current survey to the user right away, skipping the rules that otherwise decide when they
+// receive it. Users who opted out of surveys or who were already sent the current survey don't receive it again.
+func (p *Plugin) sendSurveyNow(userID string) (surveyNowResult, *model.AppError) {
+	if !p.getConfiguration().EnableSurvey {
+		return surveyNowDisabled, nil
+	}
+
+	now := p.now().UTC()
+
+	var survey *surveyState
+	if err := p.KVGet(fmt.Sprintf(SurveyKey, p.getSurveyCycle(now).ID), &survey); err != nil {
+		return 0, err
+	}
+
+	if survey == nil || now.Before(survey.StartAt) || survey.hasEnded(now) {
+		return surveyNowNotRunning, nil
+	}
+
+	userLockKey := fmt.Sprintf(UserLockKey, userID)
+
+	locked, err := p.tryLock(userLockKey, now)
+	if err != nil {
+		return 0, err
+	} else if !locked {
+		// Another thread is already sending DMs to the user, and it may be sending them this survey
+		return surveyNowBusy, nil
+	}
+	defer func() {
+		_ = p.unlock(userLockKey)
+	}()
+
+	var userSurvey *userSurveyState
+	if err = p.KVGet(fmt.Sprintf(UserSurveyKey, userID), &userSurvey); err != nil {
+		return 0, err
+	}
+
+	preferences, err := p.getUserPreferences(userID)
+	if err != nil {
+		return 0, err
+	}
+
+	if preferences.DisableSurveys || (userSurvey != nil && userSurvey.Disabled) {
+		return surveyNowOptedOut, nil
+	}
+
+	if userSurvey != nil && userSurvey.getSurveyID() == survey.getID() {
+		return surveyNowAlreadySent, nil
+	}
+
+	user, err := p.API.GetUser(userID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = p.sendSurveyDM(user, survey, preferences, now); err != nil {
+		return 0, err
+	}
+
+	return surveyNowSent, nil
+}
+
+// executeOptOutCommand stops or resumes sending surveys to the user.
+func (p *Plugin) executeOptOutCommand(userID string, disabled bool) (string, *model.AppError) {
+	if err := p.setSurveysDisabledForUser(userID, disabled); err != nil {
+		return "", err
+	}
+
+	if disabled {
+		return commandOptOutText, nil
+	}
+
+	return commandOptInText, nil
+}
+
+// executeStatusCommand describes whether or not the user receives surveys and when they last received and answered
+// one.
+func (p *Plugin) executeStatusCommand(userID string) (string, *model.AppError) {
+	var userSurvey *userSurveyState
+	if err := p.KVGet(fmt.Sprintf(UserSurveyKey, userID), &userSurvey); err != nil {
+		return "", err
+	}
+
+	preferences, err := p.getUserPreferences(userID)
+	if err != nil {
+		return "", err
+	}
+
+	lines := []string{commandStatusOptedInText}
+	if preferences.DisableSurveys || (userSurvey != nil && userSurvey.Disabled) {
+		lines[0] = commandStatusOptedOutText
+	}
+
+	if userSurvey == nil {
+		return lines[0], nil
+	}
+
+	if !userSurvey.SentAt.IsZero() {
+		lines = append(lines, fmt.Sprintf(commandStatusLastSentText, userSurvey.SentAt.Format("January 2, 2006")))
+	}
+
+	if !userSurvey.AnsweredAt.IsZero() {
+		lines = append(lines, fmt.Sprintf(commandStatusLastAnsweredText, userSurvey.AnsweredAt.Format("January 2, 2006")))
+	}
+
+	return strings.Join(lines, " "), nil
+}
+
+// settingNames describe the settings that can be turned on or off with /feedback settings.
+var settingNames = map[string]string{
+	"surveys": "surveys",
+	"welcome": "the welcome message",
+	"prompts": "follow-up questions about your answers",
+}
+
+// executeSettingsCommand shows the user's preferences or, when given a setting and its value like "welcome off",
+// changes one of them.
+func (p *Plugin) executeSettingsCommand(userID, text string) (string, *model.AppError) {
+	name, value := splitFirstWord(text)
+
+	if name == "" {
+		preferences, err := p.getUserPreferences(userID)
+		if err != nil {
+			return "", err
+		}
+
+		return formatPreferences(preferences), nil
+	}
+
+	var update func(preferences *userPreferences)
+
+	switch {
+	case name == "channel" && (value == PreferredChannelDM || value == PreferredChannelEmail):
+		update = func(preferences *userPreferences) {
+			preferences.PreferredChannel = value
+		}
+	case settingNames[name] != "" && (value == "on" || value == "off"):
+		disabled := value == "off"
+		update = func(preferences *userPreferences) {
+			switch name {
+			case "surveys":
+				preferences.DisableSurveys = disabled
+			case "welcome":
+				preferences.DisableWelcomeFeedback = disabled
+			case "prompts":
+				preferences.DisableFeedbackPrompts = disabled
+			}
+		}
+	default:
+		return commandSettingsUsageText, nil
+	}
+
+	preferences, err := p.updateUserPreferences(userID, update)
+	if err != nil {
+		return "", err
+	}
+
+	return commandSettingsUpdatedText + "\n" + formatPreferences(preferences), nil
+}
+
+// formatPreferences describes the user's preferences as a Markdown list.
+func formatPreferences(preferences *userPreferences) string {
+	onOff := func(disabled bool) string {
+		if disabled {
+			return "Off"
+		}
+
+		return "On"
+	}
+
+	channel := "Direct message"
+	if preferences.getPreferredChannel() == PreferredChannelEmail {
+		channel = "Direct message and email"
+	}
+
+	return strings.Join([]string{
+		"#### Feedbackbot settings",
+		"* Surveys: " + onOff(preferences.DisableSurveys),
+		"* Welcome message: " + onOff(preferences.DisableWelcomeFeedback),
+		"* Follow-up questions: " + onOff(preferences.DisableFeedbackPrompts),
+		"* Surveys are sent by: " + channel,
+	}, "\n")
+}
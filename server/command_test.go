@@ -0,0 +1,329 @@
+// Copyright (c) 2019-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/mattermost/mattermost/server/public/pluginapi/experimental/telemetry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitFirstWord(t *testing.T) {
+	for _, test := range []struct {
+		Text          string
+		ExpectedFirst string
+		ExpectedRest  string
+	}{
+		{Text: "", ExpectedFirst: "", ExpectedRest: ""},
+		{Text: "status", ExpectedFirst: "status", ExpectedRest: ""},
+		{Text: "  send   some feedback ", ExpectedFirst: "send", ExpectedRest: "some feedback"},
+		{Text: "send first line\n\nsecond  line", ExpectedFirst: "send", ExpectedRest: "first line\n\nsecond  line"},
+	} {
+		t.Run(test.Text, func(t *testing.T) {
+			first, rest := splitFirstWord(test.Text)
+
+			assert.Equal(t, test.ExpectedFirst, first)
+			assert.Equal(t, test.ExpectedRest, rest)
+		})
+	}
+}
+
+func TestExecuteCommand(t *testing.T) {
+	botUserID := model.NewId()
+	now := toDate(2019, time.March, 1)
+	serverVersion := "5.12.0"
+
+	makePlugin := func(api *plugintest.API) *Plugin {
+		p := &Plugin{
+			botUserID: botUserID,
+			configuration: &configuration{
+				EnableSurvey: true,
+			},
+			now: func() time.Time {
+				return now
+			},
+			serverVersion: serverVersion,
+			tracker:       telemetry.NewTracker(nil, "", "", "", "", "", telemetry.TrackerConfig{}, nil),
+		}
+		p.SetAPI(api)
+
+		return p
+	}
+
+	execute := func(p *Plugin, userID, command string) string {
+		response, err := p.ExecuteCommand(nil, &model.CommandArgs{UserId: userID, Command: command})
+		require.Nil(t, err)
+		assert.Equal(t, model.CommandResponseTypeEphemeral, response.ResponseType)
+
+		return response.Text
+	}
+
+	t.Run("should show help for an unknown command", func(t *testing.T) {
+		api := makeAPIMock()
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api)
+
+		assert.Equal(t, commandHelpText, execute(p, model.NewId(), "/feedback"))
+		assert.Equal(t, commandHelpText, execute(p, model.NewId(), "/feedback help"))
+	})
+
+	t.Run("should send feedback on behalf of the user", func(t *testing.T) {
+		userID := model.NewId()
+		channel := &model.Channel{Id: model.NewId()}
+
+		api := makeAPIMock()
+		api.On("GetDirectChannel", userID, botUserID).Return(channel, nil)
+		api.On("CreatePost", &model.Post{
+			UserId:    userID,
+			ChannelId: channel.Id,
+			Message:   "Search is great\n\nBut could be faster",
+		}).Return(&model.Post{}, nil)
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api)
+
+		assert.Equal(t, commandFeedbackSentText, execute(p, userID, "/feedback send Search is great\n\nBut could be faster"))
+	})
+
+	t.Run("should not send empty feedback", func(t *testing.T) {
+		api := makeAPIMock()
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api)
+
+		assert.Equal(t, commandFeedbackEmptyText, execute(p, model.NewId(), "/feedback send  "))
+	})
+
+	t.Run("should respond with an error if unable to send feedback", func(t *testing.T) {
+		userID := model.NewId()
+
+		api := makeAPIMock()
+		api.On("GetDirectChannel", userID, botUserID).Return(nil, &model.AppError{})
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api)
+
+		assert.Equal(t, commandErrorText, execute(p, userID, "/feedback send Hello"))
+	})
+
+	t.Run("should send the current survey", func(t *testing.T) {
+		user := &model.User{Id: model.NewId(), CreateAt: now.UnixMilli()}
+		postID := model.NewId()
+
+		api := makeAPIMock()
+		api.On("KVGet", fmt.Sprintf(SurveyKey, serverVersion)).Return(mustMarshalJSON(&surveyState{
+			ServerVersion: serverVersion,
+			StartAt:       now.Add(-1 * day),
+		}), nil)
+		api.On("KVCompareAndSet", fmt.Sprintf(UserLockKey, user.Id), []byte(nil), mock.Anything).Return(true, nil)
+		api.On("KVDelete", fmt.Sprintf(UserLockKey, user.Id)).Return(nil)
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, user.Id)).Return(nil, nil)
+		api.On("KVGet", fmt.Sprintf(UserPreferencesKey, user.Id)).Return(nil, nil)
+		api.On("GetUser", user.Id).Return(user, nil)
+		api.On("KVGet", SurveyDefinitionKey).Return(nil, nil)
+		api.On("GetDirectChannel", user.Id, botUserID).Return(&model.Channel{}, nil)
+		api.On("CreatePost", mock.Anything).Return(&model.Post{Id: postID}, nil)
+		api.On("KVSet", fmt.Sprintf(UserSurveyKey, user.Id), mustMarshalJSON(&userSurveyState{
+			SurveyID:        serverVersion,
+			ScorePostID:     postID,
+			ServerVersion:   serverVersion,
+			SentAt:          now,
+			QuestionPostIDs: []string{postID},
+		})).Return(nil)
+		api.On("KVGet", fmt.Sprintf(SurveySentCountKey, serverVersion)).Return(nil, nil)
+		api.On("KVCompareAndSet", fmt.Sprintf(SurveySentCountKey, serverVersion), []byte(nil), []byte("1")).Return(true, nil)
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api)
+
+		assert.Equal(t, commandSurveySentText, execute(p, user.Id, "/feedback survey"))
+	})
+
+	t.Run("should not send a survey when none is running", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVGet", fmt.Sprintf(SurveyKey, serverVersion)).Return(mustMarshalJSON(&surveyState{
+			ServerVersion: serverVersion,
+			StartAt:       now.Add(-1 * DefaultSurveyDuration),
+			EndAt:         now,
+		}), nil)
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api)
+
+		assert.Equal(t, commandNoSurveyText, execute(p, model.NewId(), "/feedback survey"))
+	})
+
+	for _, test := range []struct {
+		Name        string
+		UserSurvey  *userSurveyState
+		Preferences *userPreferences
+		Expected    string
+	}{
+		{
+			Name:        "the user opted out",
+			Preferences: &userPreferences{DisableSurveys: true},
+			Expected:    commandSurveyOptedOutText,
+		},
+		{
+			Name:       "the user opted out before preferences existed",
+			UserSurvey: &userSurveyState{Disabled: true},
+			Expected:   commandSurveyOptedOutText,
+		},
+		{
+			Name:       "the user was already sent it",
+			UserSurvey: &userSurveyState{SurveyID: serverVersion, SentAt: now.Add(-1 * day)},
+			Expected:   commandSurveyAlreadySentText,
+		},
+	} {
+		t.Run("should not send the current survey if "+test.Name, func(t *testing.T) {
+			userID := model.NewId()
+
+			api := makeAPIMock()
+			api.On("KVGet", fmt.Sprintf(SurveyKey, serverVersion)).Return(mustMarshalJSON(&surveyState{
+				ServerVersion: serverVersion,
+				StartAt:       now.Add(-1 * day),
+			}), nil)
+			api.On("KVCompareAndSet", fmt.Sprintf(UserLockKey, userID), []byte(nil), mock.Anything).Return(true, nil)
+			api.On("KVDelete", fmt.Sprintf(UserLockKey, userID)).Return(nil)
+			api.On("KVGet", fmt.Sprintf(UserSurveyKey, userID)).Return(mustMarshalJSON(test.UserSurvey), nil)
+			api.On("KVGet", fmt.Sprintf(UserPreferencesKey, userID)).Return(mustMarshalJSON(test.Preferences), nil)
+			defer api.AssertExpectations(t)
+
+			p := makePlugin(api)
+
+			assert.Equal(t, test.Expected, execute(p, userID, "/feedback survey"))
+		})
+	}
+
+	t.Run("should opt out a user without any preferences", func(t *testing.T) {
+		userID := model.NewId()
+
+		api := makeAPIMock()
+		api.On("GetConfig").Return(&model.Config{
+			LogSettings: model.LogSettings{
+				EnableDiagnostics: model.NewBool(false),
+			},
+		}).Maybe()
+		api.On("GetSystemInstallDate").Return(int64(1497898133094), nil)
+		api.On("GetUser", userID).Return(nil, &model.AppError{})
+		api.On("GetLicense").Return(nil)
+		api.On("KVGet", fmt.Sprintf(UserPreferencesKey, userID)).Return(nil, nil)
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, userID)).Return(nil, nil)
+		api.On("KVSet", fmt.Sprintf(UserPreferencesKey, userID), mustMarshalJSON(&userPreferences{DisableSurveys: true})).Return(nil)
+		mockOutbox(api)
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api)
+
+		assert.Equal(t, commandOptOutText, execute(p, userID, "/feedback optout"))
+	})
+
+	t.Run("should opt a user back in", func(t *testing.T) {
+		userID := model.NewId()
+		sentAt := now.Add(-30 * day)
+
+		api := makeAPIMock()
+		api.On("KVGet", fmt.Sprintf(UserPreferencesKey, userID)).Return(mustMarshalJSON(&userPreferences{DisableSurveys: true, PreferredChannel: PreferredChannelEmail}), nil)
+		api.On("KVSet", fmt.Sprintf(UserPreferencesKey, userID), mustMarshalJSON(&userPreferences{PreferredChannel: PreferredChannelEmail})).Return(nil)
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, userID)).Return(mustMarshalJSON(&userSurveyState{SurveyID: "5.11.0", SentAt: sentAt}), nil)
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api)
+
+		assert.Equal(t, commandOptInText, execute(p, userID, "/feedback optin"))
+	})
+
+	t.Run("should show the user's status", func(t *testing.T) {
+		userID := model.NewId()
+
+		api := makeAPIMock()
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, userID)).Return(mustMarshalJSON(&userSurveyState{
+			SentAt:     toDate(2019, time.January, 10),
+			AnsweredAt: toDate(2019, time.January, 11),
+		}), nil)
+		api.On("KVGet", fmt.Sprintf(UserPreferencesKey, userID)).Return(mustMarshalJSON(&userPreferences{DisableSurveys: true}), nil)
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api)
+
+		assert.Equal(t, "You've opted out of surveys. You were last sent a survey on January 10, 2019. You last answered a survey on January 11, 2019.", execute(p, userID, "/feedback status"))
+	})
+
+	t.Run("should show the status of a user who was never sent a survey", func(t *testing.T) {
+		userID := model.NewId()
+
+		api := makeAPIMock()
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, userID)).Return(nil, nil)
+		api.On("KVGet", fmt.Sprintf(UserPreferencesKey, userID)).Return(nil, nil)
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api)
+
+		assert.Equal(t, commandStatusOptedInText, execute(p, userID, "/feedback status"))
+	})
+
+	t.Run("should show the user's settings", func(t *testing.T) {
+		userID := model.NewId()
+
+		api := makeAPIMock()
+		api.On("KVGet", fmt.Sprintf(UserPreferencesKey, userID)).Return(nil, nil)
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, userID)).Return(nil, nil)
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api)
+
+		assert.Equal(t, "#### Feedbackbot settings\n"+
+			"* Surveys: On\n"+
+			"* Welcome message: On\n"+
+			"* Follow-up questions: On\n"+
+			"* Surveys are sent by: Direct message", execute(p, userID, "/feedback settings"))
+	})
+
+	for _, test := range []struct {
+		Command  string
+		Expected *userPreferences
+	}{
+		{Command: "/feedback settings welcome off", Expected: &userPreferences{PreferredChannel: PreferredChannelEmail, DisableWelcomeFeedback: true}},
+		{Command: "/feedback settings prompts off", Expected: &userPreferences{PreferredChannel: PreferredChannelEmail, DisableFeedbackPrompts: true}},
+		{Command: "/feedback settings channel dm", Expected: &userPreferences{PreferredChannel: PreferredChannelDM}},
+	} {
+		t.Run("should change the user's settings with "+test.Command, func(t *testing.T) {
+			userID := model.NewId()
+
+			api := makeAPIMock()
+			api.On("KVGet", fmt.Sprintf(UserPreferencesKey, userID)).Return(mustMarshalJSON(&userPreferences{PreferredChannel: PreferredChannelEmail}), nil)
+			api.On("KVSet", fmt.Sprintf(UserPreferencesKey, userID), mustMarshalJSON(test.Expected)).Return(nil)
+			api.On("KVGet", fmt.Sprintf(UserSurveyKey, userID)).Return(nil, nil)
+			defer api.AssertExpectations(t)
+
+			p := makePlugin(api)
+
+			assert.Contains(t, execute(p, userID, test.Command), commandSettingsUpdatedText)
+		})
+	}
+
+	for _, command := range []string{
+		"/feedback settings welcome",
+		"/feedback settings welcome maybe",
+		"/feedback settings channel carrier-pigeon",
+		"/feedback settings theme dark",
+	} {
+		t.Run("should explain how to use "+command, func(t *testing.T) {
+			api := makeAPIMock()
+			defer api.AssertExpectations(t)
+
+			p := makePlugin(api)
+
+			assert.Equal(t, commandSettingsUsageText, execute(p, model.NewId(), command))
+		})
+	}
+}
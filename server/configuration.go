@@ -4,8 +4,11 @@
 package main
 
 import (
+	"path/filepath"
 	"reflect"
+	"time"
 
+	"github.com/mattermost/mattermost/server/public/model"
 	"github.com/pkg/errors"
 )
 
@@ -22,6 +25,85 @@ import (
 // copy appropriate for your types.
 type configuration struct {
 	EnableSurvey bool
+
+	// DaysUntilSurvey, DaysBetweenUserSurveys, DaysBetweenSurveyEmails and DaysUntilWelcomeFeedback control the
+	// cadence of surveys and notifications. A value of 0 means that the default is used.
+	DaysUntilSurvey          int
+	DaysBetweenUserSurveys   int
+	DaysBetweenSurveyEmails  int
+	DaysUntilWelcomeFeedback int
+
+	// SurveySchedule is one of SurveyScheduleUpgrade, SurveyScheduleQuarterly or SurveyScheduleInterval, and
+	// SurveyIntervalDays is the number of days between surveys when using SurveyScheduleInterval.
+	SurveySchedule     string
+	SurveyIntervalDays int
+
+	// SurveyDurationDays is how long each survey is sent to users after it starts. A value of 0 means that the
+	// default is used when surveys are sent on a fixed schedule and that surveys scheduled on upgrade never end.
+	SurveyDurationDays int
+
+	// DaysUntilSurveyReminder is how long after a user is sent a survey that they're reminded about it if they haven't
+	// answered it, or 0 to never remind users.
+	DaysUntilSurveyReminder int
+
+	// The targeting settings limit which users receive surveys. Each is a comma-separated list of names. Users must
+	// match at least one entry of every non-empty Include list and no entries of any Exclude list.
+	SurveyIncludeTeams        string
+	SurveyExcludeTeams        string
+	SurveyIncludeRoles        string
+	SurveyExcludeRoles        string
+	SurveyIncludeGroups       string
+	SurveyExcludeGroups       string
+	SurveyIncludeAuthServices string
+	SurveyExcludeAuthServices string
+	SurveyExcludeGuests       bool
+
+	// SurveySamplePercentage is the percentage of eligible users who receive each survey. A value of 0 means that the
+	// default is used. SurveyMaxSentPerCycle is the most users who receive each survey, or 0 for no limit.
+	SurveySamplePercentage int
+	SurveyMaxSentPerCycle  int
+
+	// SurveyDeliveryStartHour and SurveyDeliveryEndHour limit the hours of the day, in each user's timezone, during
+	// which surveys are sent to them. The window is disabled when both are equal. SurveyDeliveryWeekdaysOnly also
+	// stops surveys from being sent on weekends.
+	SurveyDeliveryStartHour    int
+	SurveyDeliveryEndHour      int
+	SurveyDeliveryWeekdaysOnly bool
+
+	// The message templates replace the default text of messages sent by the plugin. See messageTemplates.
+	SurveyMessageTemplate   string
+	WelcomeFeedbackTemplate string
+	ThankYouTemplate        string
+	AdminEmailTemplate      string
+
+	// TelemetrySink is one of TelemetrySinkRudder, TelemetrySinkWebhook, TelemetrySinkFile or TelemetrySinkKV and
+	// controls where survey results and feedback are sent. TelemetryWebhookURL and TelemetryFilePath configure the
+	// webhook and file sinks respectively.
+	TelemetrySink       string
+	TelemetryWebhookURL string
+	TelemetryFilePath   string
+
+	// OutgoingWebhooks is a JSON array of outgoingWebhook objects that each survey response and piece of feedback is
+	// sent to in addition to the TelemetrySink.
+	OutgoingWebhooks string
+
+	// EventUserIDs is one of EventUserIDsKeep, EventUserIDsHash or EventUserIDsDrop and controls whether user IDs are
+	// included in events sent to the TelemetrySink and OutgoingWebhooks.
+	EventUserIDs string
+
+	// RedactFeedback removes email addresses, URLs, phone numbers and @mentions from the feedback and answers included
+	// in events, along with the email address that users can give with their feedback. FeedbackRedactionPatterns is a
+	// list of additional regular expressions to remove, one per line.
+	RedactFeedback            bool
+	FeedbackRedactionPatterns string
+
+	// EnableAnonymousSurveys stores and sends scores and answers under a token that is unique to each user and survey
+	// instead of under the user's ID.
+	EnableAnonymousSurveys bool
+
+	// EnablePrivateMode keeps survey results and feedback on the server. No events are sent to Rudder, neither the
+	// webhook sink nor OutgoingWebhooks can be used and the plugin runs even when diagnostics are disabled.
+	EnablePrivateMode bool
 }
 
 // Clone shallow copies the configuration. Your implementation may require a deep copy if
@@ -31,6 +113,166 @@ func (c *configuration) Clone() *configuration {
 	return &clone
 }
 
+// IsValid checks that the configuration contains usable values.
+func (c *configuration) IsValid() error {
+	for _, setting := range []struct {
+		Name string
+		Days int
+	}{
+		{Name: "DaysUntilSurvey", Days: c.DaysUntilSurvey},
+		{Name: "DaysBetweenUserSurveys", Days: c.DaysBetweenUserSurveys},
+		{Name: "DaysBetweenSurveyEmails", Days: c.DaysBetweenSurveyEmails},
+		{Name: "DaysUntilWelcomeFeedback", Days: c.DaysUntilWelcomeFeedback},
+		{Name: "SurveyDurationDays", Days: c.SurveyDurationDays},
+		{Name: "DaysUntilSurveyReminder", Days: c.DaysUntilSurveyReminder},
+	} {
+		if setting.Days < 0 {
+			return errors.Errorf("%s must not be negative", setting.Name)
+		}
+	}
+
+	if c.SurveySamplePercentage < 0 || c.SurveySamplePercentage > 100 {
+		return errors.New("SurveySamplePercentage must be between 0 and 100")
+	}
+
+	if c.SurveyMaxSentPerCycle < 0 {
+		return errors.New("SurveyMaxSentPerCycle must not be negative")
+	}
+
+	if c.SurveyDeliveryStartHour < 0 || c.SurveyDeliveryStartHour > 23 {
+		return errors.New("SurveyDeliveryStartHour must be between 0 and 23")
+	}
+
+	if c.SurveyDeliveryEndHour < 0 || c.SurveyDeliveryEndHour > 23 {
+		return errors.New("SurveyDeliveryEndHour must be between 0 and 23")
+	}
+
+	if err := c.getMessageTemplates().IsValid(); err != nil {
+		return err
+	}
+
+	switch c.getTelemetrySink() {
+	case TelemetrySinkRudder, TelemetrySinkKV:
+	case TelemetrySinkWebhook:
+		if c.EnablePrivateMode {
+			return errors.New("the webhook telemetry sink can't be used in private mode")
+		}
+
+		if !model.IsValidHTTPURL(c.TelemetryWebhookURL) {
+			return errors.New("TelemetryWebhookURL must be a valid URL when using the webhook telemetry sink")
+		}
+	case TelemetrySinkFile:
+		if !filepath.IsAbs(c.TelemetryFilePath) {
+			return errors.New("TelemetryFilePath must be an absolute path when using the file telemetry sink")
+		}
+	default:
+		return errors.Errorf("unknown TelemetrySink %s", c.TelemetrySink)
+	}
+
+	switch c.getEventUserIDs() {
+	case EventUserIDsKeep, EventUserIDsHash, EventUserIDsDrop:
+	default:
+		return errors.Errorf("unknown EventUserIDs %s", c.EventUserIDs)
+	}
+
+	if _, err := c.getRedactionPatterns(); err != nil {
+		return err
+	}
+
+	webhooks, err := c.getOutgoingWebhooks()
+	if err != nil {
+		return err
+	}
+
+	if len(webhooks) > 0 && c.EnablePrivateMode {
+		return errors.New("OutgoingWebhooks can't be used in private mode")
+	}
+
+	for _, webhook := range webhooks {
+		if err := webhook.IsValid(); err != nil {
+			return err
+		}
+	}
+
+	switch c.getSurveySchedule() {
+	case SurveyScheduleUpgrade:
+	case SurveyScheduleQuarterly:
+		if c.getTimeUntilSurvey() >= minQuarterLength {
+			return errors.New("DaysUntilSurvey must be shorter than a quarter when surveys are sent quarterly")
+		}
+	case SurveyScheduleInterval:
+		if c.SurveyIntervalDays < 0 {
+			return errors.New("SurveyIntervalDays must not be negative")
+		}
+
+		if c.getTimeUntilSurvey() >= c.getSurveyInterval() {
+			return errors.New("DaysUntilSurvey must be less than SurveyIntervalDays")
+		}
+	default:
+		return errors.Errorf("unknown SurveySchedule %s", c.SurveySchedule)
+	}
+
+	return nil
+}
+
+// getSurveySchedule returns when surveys are scheduled, defaulting to SurveyScheduleUpgrade.
+func (c *configuration) getSurveySchedule() string {
+	if c.SurveySchedule == "" {
+		return SurveyScheduleUpgrade
+	}
+
+	return c.SurveySchedule
+}
+
+// getSurveyInterval returns the time between surveys when using SurveyScheduleInterval.
+func (c *configuration) getSurveyInterval() time.Duration {
+	return daysOrDefault(c.SurveyIntervalDays, DefaultSurveyInterval)
+}
+
+// getTimeUntilSurvey returns how long after being scheduled that a survey starts being sent to users. This is also
+// how long a user must have existed for before they receive a survey.
+func (c *configuration) getTimeUntilSurvey() time.Duration {
+	return daysOrDefault(c.DaysUntilSurvey, DefaultTimeUntilSurvey)
+}
+
+// getSurveyDuration returns how long a survey is sent to users after it starts, or zero if it's sent until its cycle
+// ends. Surveys scheduled on upgrade don't end unless a duration is set.
+func (c *configuration) getSurveyDuration() time.Duration {
+	if c.SurveyDurationDays <= 0 && c.getSurveySchedule() == SurveyScheduleUpgrade {
+		return 0
+	}
+
+	return daysOrDefault(c.SurveyDurationDays, DefaultSurveyDuration)
+}
+
+// getDaysUntilSurvey returns getTimeUntilSurvey in days for use in notifications.
+func (c *configuration) getDaysUntilSurvey() int {
+	return int(c.getTimeUntilSurvey() / day)
+}
+
+// getMinTimeBetweenUserSurveys returns the minimum time before a user can be sent another survey.
+func (c *configuration) getMinTimeBetweenUserSurveys() time.Duration {
+	return daysOrDefault(c.DaysBetweenUserSurveys, DefaultMinTimeBetweenUserSurveys)
+}
+
+// getMinTimeBetweenSurveyEmails returns how often "survey scheduled" emails can be sent to admins.
+func (c *configuration) getMinTimeBetweenSurveyEmails() time.Duration {
+	return daysOrDefault(c.DaysBetweenSurveyEmails, DefaultMinTimeBetweenSurveyEmails)
+}
+
+// getTimeUntilWelcomeFeedback returns how long after creating their account that a user is asked for feedback.
+func (c *configuration) getTimeUntilWelcomeFeedback() time.Duration {
+	return daysOrDefault(c.DaysUntilWelcomeFeedback, DefaultTimeUntilWelcomeFeedback)
+}
+
+func daysOrDefault(days int, defaultDuration time.Duration) time.Duration {
+	if days <= 0 {
+		return defaultDuration
+	}
+
+	return time.Duration(days) * day
+}
+
 // getConfiguration retrieves the active configuration under lock, making it safe to use
 // concurrently. The active configuration may change underneath the client of this method, but
 // the struct returned by this API call is considered immutable.
@@ -83,6 +325,10 @@ func (p *Plugin) OnConfigurationChange() error {
 		return errors.Wrap(err, "failed to load plugin configuration")
 	}
 
+	if err := configuration.IsValid(); err != nil {
+		return errors.Wrap(err, "invalid plugin configuration")
+	}
+
 	p.setConfiguration(configuration)
 
 	if p.hasSurveyBeenEnabled(configuration, oldConfiguration) {
@@ -90,7 +336,14 @@ func (p *Plugin) OnConfigurationChange() error {
 		go p.checkForNextSurvey(p.now().UTC())
 	}
 
-	p.initTracker()
+	if p.isActivated() {
+		// The client is first created by OnActivate so that failing to create it stops the plugin from activating
+		if err := p.updateTelemetryClient(); err != nil {
+			p.API.LogError("Failed to update Rudder client", "err", err.Error())
+		}
+	} else {
+		p.initTracker()
+	}
 
 	return nil
 }
@@ -5,6 +5,7 @@ package main
 
 import (
 	"testing"
+	"time"
 
 	"github.com/mattermost/mattermost/server/public/model"
 	"github.com/mattermost/mattermost/server/public/plugin"
@@ -80,3 +81,282 @@ func TestOnConfigurationChanged(t *testing.T) {
 	require.NoError(t, err)
 	require.False(t, p.configuration.EnableSurvey)
 }
+
+func TestOnConfigurationChangedClosesRudderClient(t *testing.T) {
+	api := makeAPIMock()
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*main.configuration")).Run(func(args mock.Arguments) {
+		*args.Get(0).(*configuration) = configuration{
+			TelemetrySink: TelemetrySinkKV,
+		}
+	}).Return(nil)
+	api.On("GetConfig").Return(&model.Config{})
+	api.On("GetDiagnosticId").Return("diagnosticID")
+	api.On("GetServerVersion").Return("v7.6")
+	defer api.AssertExpectations(t)
+
+	p := &Plugin{
+		activated:       true,
+		configuration:   &configuration{},
+		telemetryClient: &testTelemetryClient{},
+		MattermostPlugin: plugin.MattermostPlugin{
+			API: api,
+		},
+	}
+
+	err := p.OnConfigurationChange()
+	require.NoError(t, err)
+	require.Nil(t, p.telemetryClient)
+}
+
+func TestOnConfigurationChangedWithInvalidConfiguration(t *testing.T) {
+	api := makeAPIMock()
+	api.On("LoadPluginConfiguration", mock.AnythingOfType("*main.configuration")).Run(func(args mock.Arguments) {
+		*args.Get(0).(*configuration) = configuration{
+			EnableSurvey:    true,
+			DaysUntilSurvey: -1,
+		}
+	}).Return(nil)
+	defer api.AssertExpectations(t)
+
+	p := &Plugin{
+		configuration: &configuration{
+			EnableSurvey: true,
+		},
+		MattermostPlugin: plugin.MattermostPlugin{
+			API: api,
+		},
+	}
+
+	err := p.OnConfigurationChange()
+	require.Error(t, err)
+	require.Equal(t, 0, p.configuration.DaysUntilSurvey)
+}
+
+func TestConfigurationIsValid(t *testing.T) {
+	for _, test := range []struct {
+		Name          string
+		Configuration *configuration
+		ExpectError   bool
+	}{
+		{
+			Name:          "defaults",
+			Configuration: &configuration{},
+		},
+		{
+			Name: "custom cadence",
+			Configuration: &configuration{
+				DaysUntilSurvey:          14,
+				DaysBetweenUserSurveys:   90,
+				DaysBetweenSurveyEmails:  1,
+				DaysUntilWelcomeFeedback: 3,
+			},
+		},
+		{
+			Name:          "sampling and quota",
+			Configuration: &configuration{SurveySamplePercentage: 25, SurveyMaxSentPerCycle: 5000},
+		},
+		{
+			Name:          "sample percentage over 100",
+			Configuration: &configuration{SurveySamplePercentage: 101},
+			ExpectError:   true,
+		},
+		{
+			Name:          "negative quota",
+			Configuration: &configuration{SurveyMaxSentPerCycle: -1},
+			ExpectError:   true,
+		},
+		{
+			Name:          "negative days until survey",
+			Configuration: &configuration{DaysUntilSurvey: -14},
+			ExpectError:   true,
+		},
+		{
+			Name:          "negative days between user surveys",
+			Configuration: &configuration{DaysBetweenUserSurveys: -1},
+			ExpectError:   true,
+		},
+		{
+			Name:          "negative days between survey emails",
+			Configuration: &configuration{DaysBetweenSurveyEmails: -1},
+			ExpectError:   true,
+		},
+		{
+			Name:          "negative days until welcome feedback",
+			Configuration: &configuration{DaysUntilWelcomeFeedback: -1},
+			ExpectError:   true,
+		},
+		{
+			Name:          "negative survey duration",
+			Configuration: &configuration{SurveyDurationDays: -1},
+			ExpectError:   true,
+		},
+		{
+			Name:          "negative days until survey reminder",
+			Configuration: &configuration{DaysUntilSurveyReminder: -1},
+			ExpectError:   true,
+		},
+		{
+			Name:          "delivery window",
+			Configuration: &configuration{SurveyDeliveryStartHour: 22, SurveyDeliveryEndHour: 6},
+		},
+		{
+			Name:          "invalid delivery start hour",
+			Configuration: &configuration{SurveyDeliveryStartHour: 24},
+			ExpectError:   true,
+		},
+		{
+			Name:          "invalid delivery end hour",
+			Configuration: &configuration{SurveyDeliveryEndHour: -1},
+			ExpectError:   true,
+		},
+		{
+			Name:          "invalid message template",
+			Configuration: &configuration{ThankYouTemplate: "Thanks {{.FirstName"},
+			ExpectError:   true,
+		},
+		{
+			Name:          "webhook telemetry sink",
+			Configuration: &configuration{TelemetrySink: TelemetrySinkWebhook, TelemetryWebhookURL: "https://example.com/events"},
+		},
+		{
+			Name:          "webhook telemetry sink without a URL",
+			Configuration: &configuration{TelemetrySink: TelemetrySinkWebhook},
+			ExpectError:   true,
+		},
+		{
+			Name:          "file telemetry sink",
+			Configuration: &configuration{TelemetrySink: TelemetrySinkFile, TelemetryFilePath: "/var/log/nps.ndjson"},
+		},
+		{
+			Name:          "file telemetry sink with a relative path",
+			Configuration: &configuration{TelemetrySink: TelemetrySinkFile, TelemetryFilePath: "nps.ndjson"},
+			ExpectError:   true,
+		},
+		{
+			Name:          "KV telemetry sink",
+			Configuration: &configuration{TelemetrySink: TelemetrySinkKV},
+		},
+		{
+			Name:          "private mode",
+			Configuration: &configuration{EnablePrivateMode: true},
+		},
+		{
+			Name:          "private mode with the webhook telemetry sink",
+			Configuration: &configuration{EnablePrivateMode: true, TelemetrySink: TelemetrySinkWebhook, TelemetryWebhookURL: "https://example.com/events"},
+			ExpectError:   true,
+		},
+		{
+			Name:          "outgoing webhooks",
+			Configuration: &configuration{OutgoingWebhooks: `[{"url": "https://example.com/nps", "events": ["nps_score", "nps_feedback"]}]`},
+		},
+		{
+			Name:          "outgoing webhooks that aren't valid JSON",
+			Configuration: &configuration{OutgoingWebhooks: `{"url": "https://example.com/nps"`},
+			ExpectError:   true,
+		},
+		{
+			Name:          "outgoing webhook with an invalid URL",
+			Configuration: &configuration{OutgoingWebhooks: `[{"url": "example.com/nps"}]`},
+			ExpectError:   true,
+		},
+		{
+			Name:          "outgoing webhooks in private mode",
+			Configuration: &configuration{EnablePrivateMode: true, OutgoingWebhooks: `[{"url": "https://example.com/nps"}]`},
+			ExpectError:   true,
+		},
+		{
+			Name:          "hashed user IDs with redaction",
+			Configuration: &configuration{EventUserIDs: EventUserIDsHash, RedactFeedback: true, FeedbackRedactionPatterns: "ticket-\\d+\nACME"},
+		},
+		{
+			Name:          "unknown event user IDs",
+			Configuration: &configuration{EventUserIDs: "encrypt"},
+			ExpectError:   true,
+		},
+		{
+			Name:          "invalid redaction pattern",
+			Configuration: &configuration{RedactFeedback: true, FeedbackRedactionPatterns: "ticket-(\\d+"},
+			ExpectError:   true,
+		},
+		{
+			Name:          "unknown telemetry sink",
+			Configuration: &configuration{TelemetrySink: "segment"},
+			ExpectError:   true,
+		},
+		{
+			Name:          "quarterly schedule",
+			Configuration: &configuration{SurveySchedule: SurveyScheduleQuarterly},
+		},
+		{
+			Name:          "quarterly schedule with survey starting after the quarter",
+			Configuration: &configuration{SurveySchedule: SurveyScheduleQuarterly, DaysUntilSurvey: 90},
+			ExpectError:   true,
+		},
+		{
+			Name:          "interval schedule",
+			Configuration: &configuration{SurveySchedule: SurveyScheduleInterval, SurveyIntervalDays: 30, DaysUntilSurvey: 14},
+		},
+		{
+			Name:          "interval schedule with survey starting after the interval",
+			Configuration: &configuration{SurveySchedule: SurveyScheduleInterval, SurveyIntervalDays: 30},
+			ExpectError:   true,
+		},
+		{
+			Name:          "negative survey interval",
+			Configuration: &configuration{SurveySchedule: SurveyScheduleInterval, SurveyIntervalDays: -1},
+			ExpectError:   true,
+		},
+		{
+			Name:          "unknown schedule",
+			Configuration: &configuration{SurveySchedule: "monthly"},
+			ExpectError:   true,
+		},
+	} {
+		t.Run(test.Name, func(t *testing.T) {
+			err := test.Configuration.IsValid()
+
+			if test.ExpectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestConfigurationCadence(t *testing.T) {
+	t.Run("should use the defaults when not set", func(t *testing.T) {
+		c := &configuration{}
+
+		assert.Equal(t, DefaultTimeUntilSurvey, c.getTimeUntilSurvey())
+		assert.Equal(t, 45, c.getDaysUntilSurvey())
+		assert.Equal(t, DefaultMinTimeBetweenUserSurveys, c.getMinTimeBetweenUserSurveys())
+		assert.Equal(t, DefaultMinTimeBetweenSurveyEmails, c.getMinTimeBetweenSurveyEmails())
+		assert.Equal(t, DefaultTimeUntilWelcomeFeedback, c.getTimeUntilWelcomeFeedback())
+		assert.Equal(t, time.Duration(0), c.getSurveyDuration())
+	})
+
+	t.Run("should only use the default survey duration for fixed schedules", func(t *testing.T) {
+		assert.Equal(t, DefaultSurveyDuration, (&configuration{SurveySchedule: SurveyScheduleQuarterly}).getSurveyDuration())
+		assert.Equal(t, DefaultSurveyDuration, (&configuration{SurveySchedule: SurveyScheduleInterval}).getSurveyDuration())
+		assert.Equal(t, time.Duration(0), (&configuration{SurveySchedule: SurveyScheduleUpgrade}).getSurveyDuration())
+		assert.Equal(t, 21*day, (&configuration{SurveySchedule: SurveyScheduleUpgrade, SurveyDurationDays: 21}).getSurveyDuration())
+	})
+
+	t.Run("should use the configured values", func(t *testing.T) {
+		c := &configuration{
+			DaysUntilSurvey:          14,
+			DaysBetweenUserSurveys:   90,
+			DaysBetweenSurveyEmails:  1,
+			DaysUntilWelcomeFeedback: 3,
+			SurveyDurationDays:       21,
+		}
+
+		assert.Equal(t, 14*day, c.getTimeUntilSurvey())
+		assert.Equal(t, 14, c.getDaysUntilSurvey())
+		assert.Equal(t, 90*day, c.getMinTimeBetweenUserSurveys())
+		assert.Equal(t, 1*day, c.getMinTimeBetweenSurveyEmails())
+		assert.Equal(t, 3*day, c.getTimeUntilWelcomeFeedback())
+		assert.Equal(t, 21*day, c.getSurveyDuration())
+	})
+}
@@ -0,0 +1,346 @@
+// Copyright (c) 2019-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	// QuestionTypeNPS is the 0-10 "How likely are you to recommend Mattermost?" question. It's rendered by the web
+	// app plugin and answered using the score endpoint.
+	QuestionTypeNPS = "nps"
+
+	// QuestionTypeScale asks the user to pick a number between Min and Max.
+	QuestionTypeScale = "scale"
+
+	// QuestionTypeChoice asks the user to pick one of the given Options.
+	QuestionTypeChoice = "choice"
+
+	// NPSQuestionID is the ID of the NPS question. Like the other scored questions, the NPS question can only be
+	// asked once per survey, so its ID is the same as its type.
+	NPSQuestionID = "nps"
+
+	// The most questions that can be asked by a single survey
+	maxSurveyQuestions = 10
+
+	// The most options that a scale or choice question can have. This keeps the dropdown a reasonable size.
+	maxQuestionOptions = 20
+)
+
+var questionIDPattern = regexp.MustCompile("^[a-z0-9_]{1,32}$")
+
+// surveyDefinition describes the questions asked by a survey. Each question is sent to users as a separate post.
+type surveyDefinition struct {
+	Questions []*surveyQuestion `json:"questions"`
+}
+
+type surveyQuestion struct {
+	// ID identifies the question in stored answers and telemetry. It must be made of lowercase letters, numbers and
+	// underscores.
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	Text string `json:"text"`
+
+	// Min and Max are the bounds of a QuestionTypeScale question. MinLabel and MaxLabel optionally describe them.
+	Min      int    `json:"min,omitempty"`
+	Max      int    `json:"max,omitempty"`
+	MinLabel string `json:"min_label,omitempty"`
+	MaxLabel string `json:"max_label,omitempty"`
+
+	// Options are the possible answers to a QuestionTypeChoice question.
+	Options []string `json:"options,omitempty"`
+
+	// FollowUp is an optional message sent after the user first answers the question to ask them to explain their
+	// answer. Their reply is stored as feedback. Scored questions always ask for feedback after the first one is
+	// answered, so this is ignored for them.
+	FollowUp string `json:"follow_up,omitempty"`
+}
+
+// defaultSurveyDefinition returns the survey that is sent when admins haven't defined one, which only asks the NPS
+// question.
+func defaultSurveyDefinition() *surveyDefinition {
+	return &surveyDefinition{
+		Questions: []*surveyQuestion{defaultNPSQuestion()},
+	}
+}
+
+func defaultNPSQuestion() *surveyQuestion {
+	return &surveyQuestion{
+		ID:   NPSQuestionID,
+		Type: QuestionTypeNPS,
+		Text: surveyDropdownTitle.Other,
+	}
+}
+
+// getText returns the question asked to users, falling back to the default text for scored questions.
+func (q *surveyQuestion) getText() string {
+	if kind := getSurveyKind(q.Type); kind != nil && q.Text == "" {
+		return kind.DefaultText.Other
+	}
+
+	return q.Text
+}
+
+// getLocalizedText returns the question asked to users in the given locale. Only the default text of scored questions
+// is translated since admins write the text of other questions in their own language.
+func (p *Plugin) getLocalizedText(question *surveyQuestion, locale string) string {
+	if kind := getSurveyKind(question.Type); kind != nil && question.getText() == kind.DefaultText.Other {
+		return p.translate(locale, kind.DefaultText)
+	}
+
+	return question.getText()
+}
+
+// IsValid returns an error if the survey can't be sent to users.
+func (d *surveyDefinition) IsValid() error {
+	if len(d.Questions) == 0 {
+		return errors.New("survey must have at least one question")
+	}
+
+	if len(d.Questions) > maxSurveyQuestions {
+		return errors.Errorf("survey must not have more than %d questions", maxSurveyQuestions)
+	}
+
+	ids := map[string]bool{}
+	for _, question := range d.Questions {
+		if question == nil {
+			return errors.New("survey must not contain empty questions")
+		}
+
+		if ids[question.ID] {
+			return errors.Errorf("question ID %s is used more than once", question.ID)
+		}
+		ids[question.ID] = true
+
+		if err := question.IsValid(); err != nil {
+			return errors.Wrapf(err, "question %s is invalid", question.ID)
+		}
+	}
+
+	return nil
+}
+
+// IsValid returns an error if the question can't be sent to users.
+func (q *surveyQuestion) IsValid() error {
+	if !questionIDPattern.MatchString(q.ID) {
+		return errors.New("ID must be 1 to 32 lowercase letters, numbers or underscores")
+	}
+
+	if q.getText() == "" {
+		return errors.New("text must not be empty")
+	}
+
+	switch q.Type {
+	case QuestionTypeNPS, QuestionTypeCSAT, QuestionTypeCES:
+		if q.ID != q.Type {
+			return errors.Errorf("the %s question must have the ID %s", q.Type, q.Type)
+		}
+	case QuestionTypeScale:
+		if q.Min >= q.Max {
+			return errors.New("min must be less than max")
+		}
+
+		if q.Max-q.Min+1 > maxQuestionOptions {
+			return errors.Errorf("scale must not have more than %d options", maxQuestionOptions)
+		}
+	case QuestionTypeChoice:
+		if len(q.Options) < 2 || len(q.Options) > maxQuestionOptions {
+			return errors.Errorf("must have between 2 and %d options", maxQuestionOptions)
+		}
+
+		for _, option := range q.Options {
+			if option == "" {
+				return errors.New("options must not be empty")
+			}
+		}
+	default:
+		return errors.Errorf("unknown type %s", q.Type)
+	}
+
+	return nil
+}
+
+// getQuestion returns the question with the given ID or nil if the survey doesn't contain it.
+func (d *surveyDefinition) getQuestion(id string) *surveyQuestion {
+	for _, question := range d.Questions {
+		if question.ID == id {
+			return question
+		}
+	}
+
+	return nil
+}
+
+// isFirstQuestion returns whether or not the given question is the first one sent to users.
+func (d *surveyDefinition) isFirstQuestion(question *surveyQuestion) bool {
+	return len(d.Questions) > 0 && d.Questions[0].ID == question.ID
+}
+
+// validateAnswer returns an error if the selected option isn't a valid answer to a scale or choice question.
+func (q *surveyQuestion) validateAnswer(answer string) error {
+	switch q.Type {
+	case QuestionTypeScale:
+		value, err := strconv.Atoi(answer)
+		if err != nil {
+			return err
+		}
+
+		if value < q.Min || value > q.Max {
+			return errors.New("answer out of range")
+		}
+
+		return nil
+	case QuestionTypeChoice:
+		for _, option := range q.Options {
+			if option == answer {
+				return nil
+			}
+		}
+
+		return errors.New("answer is not one of the options")
+	default:
+		return errors.Errorf("question type %s can't be answered with an option", q.Type)
+	}
+}
+
+// getSurveyDefinition returns the survey defined by admins or the default survey if they haven't defined one.
+func (p *Plugin) getSurveyDefinition() (*surveyDefinition, *model.AppError) {
+	var definition *surveyDefinition
+	if err := p.KVGet(SurveyDefinitionKey, &definition); err != nil {
+		return nil, err
+	}
+
+	if definition == nil {
+		return defaultSurveyDefinition(), nil
+	}
+
+	return definition, nil
+}
+
+func (p *Plugin) saveSurveyDefinition(definition *surveyDefinition) *model.AppError {
+	return p.KVSet(SurveyDefinitionKey, definition)
+}
+
+// buildQuestionPost builds the post asking the given question. The first question of a survey greets the user and
+// lets them disable surveys. Scored questions are rendered by the web app plugin, so they always include the action
+// to disable surveys since the web app expects it.
+func (p *Plugin) buildQuestionPost(user *model.User, question *surveyQuestion, first bool) *model.Post {
+	post := &model.Post{}
+	if first {
+		post.Message = p.buildSurveyMessage(user, p.getConfiguration().getMessageTemplates())
+	}
+
+	kind := getSurveyKind(question.Type)
+
+	actions := []*model.PostAction{p.buildQuestionPostAction(question, user.Locale)}
+	if first || kind != nil {
+		actions = append(actions, p.buildDisableAction())
+	}
+
+	if kind != nil {
+		post.Type = kind.PostType
+
+		// Used by the web app plugin to render the scale
+		post.AddProp("score_min", kind.Min)
+		post.AddProp("score_max", kind.Max)
+		post.AddProp("min_label", p.translate(user.Locale, kind.MinLabel))
+		post.AddProp("max_label", p.translate(user.Locale, kind.MaxLabel))
+	}
+
+	post.AddProp("attachments", []*model.SlackAttachment{
+		{
+			Title:   p.getLocalizedText(question, user.Locale),
+			Actions: actions,
+		},
+	})
+
+	return post
+}
+
+// buildSurveyMessage returns the greeting sent with the first question of a survey.
+func (p *Plugin) buildSurveyMessage(user *model.User, templates *messageTemplates) string {
+	return p.renderUserMessage(user, templates.SurveyMessage, surveyBody, user.Username)
+}
+
+// buildAnsweredQuestionPost builds the post asking the given question after the user has answered it. The answer isn't
+// shown when surveys are anonymous so that it isn't left in the user's direct message channel.
+func (p *Plugin) buildAnsweredQuestionPost(user *model.User, question *surveyQuestion, first bool, answer string) *model.Post {
+	post := p.buildQuestionPost(user, question, first)
+
+	attachment := post.Attachments()[0]
+
+	if p.getConfiguration().EnableAnonymousSurveys {
+		attachment.Text = p.translate(user.Locale, surveyAnsweredAnonymouslyBody)
+		return post
+	}
+
+	attachment.Actions[0].DefaultOption = answer
+
+	if kind := getSurveyKind(question.Type); kind != nil {
+		attachment.Text = p.translate(user.Locale, surveyAnsweredBody, answer, kind.Max)
+	} else {
+		attachment.Text = p.translate(user.Locale, surveyQuestionAnsweredBody, answer)
+	}
+
+	return post
+}
+
+func (p *Plugin) buildQuestionPostAction(question *surveyQuestion, locale string) *model.PostAction {
+	var options []*model.PostActionOptions
+	url := fmt.Sprintf("/plugins/%s/api/v1/answer", manifest.Id)
+
+	switch question.Type {
+	case QuestionTypeNPS, QuestionTypeCSAT, QuestionTypeCES:
+		kind := getSurveyKind(question.Type)
+		options = buildScaleOptions(kind.Min, kind.Max, p.translate(locale, kind.MinLabel), p.translate(locale, kind.MaxLabel))
+		url = fmt.Sprintf("/plugins/%s/api/v1/score", manifest.Id)
+	case QuestionTypeScale:
+		options = buildScaleOptions(question.Min, question.Max, question.MinLabel, question.MaxLabel)
+	case QuestionTypeChoice:
+		for _, option := range question.Options {
+			options = append(options, &model.PostActionOptions{
+				Text:  option,
+				Value: option,
+			})
+		}
+	}
+
+	return &model.PostAction{
+		Name:    "Select an option...",
+		Type:    model.PostActionTypeSelect,
+		Options: options,
+		Integration: &model.PostActionIntegration{
+			URL: url,
+			Context: map[string]interface{}{
+				"question_id": question.ID,
+			},
+		},
+	}
+}
+
+// buildScaleOptions returns the options from max down to min with the labels added to the ends of the scale.
+func buildScaleOptions(min, max int, minLabel, maxLabel string) []*model.PostActionOptions {
+	var options []*model.PostActionOptions
+	for i := max; i >= min; i-- {
+		text := strconv.Itoa(i)
+		if i == min && minLabel != "" {
+			text = fmt.Sprintf("%d (%s)", i, minLabel)
+		} else if i == max && maxLabel != "" {
+			text = fmt.Sprintf("%d (%s)", i, maxLabel)
+		}
+
+		options = append(options, &model.PostActionOptions{
+			Text:  text,
+			Value: strconv.Itoa(i),
+		})
+	}
+
+	return options
+}
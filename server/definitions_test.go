@@ -0,0 +1,291 @@
+// Copyright (c) 2019-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSurveyDefinitionIsValid(t *testing.T) {
+	searchQuestion := &surveyQuestion{
+		ID:       "search",
+		Type:     QuestionTypeScale,
+		Text:     "How satisfied are you with search?",
+		Min:      1,
+		Max:      5,
+		MinLabel: "Not Satisfied",
+		MaxLabel: "Very Satisfied",
+	}
+
+	for _, test := range []struct {
+		Name        string
+		Definition  *surveyDefinition
+		ExpectError bool
+	}{
+		{
+			Name:       "default",
+			Definition: defaultSurveyDefinition(),
+		},
+		{
+			Name: "additional questions",
+			Definition: &surveyDefinition{
+				Questions: []*surveyQuestion{
+					defaultNPSQuestion(),
+					searchQuestion,
+					{
+						ID:       "favorite_feature",
+						Type:     QuestionTypeChoice,
+						Text:     "What's your favorite feature?",
+						Options:  []string{"Search", "Threads", "Playbooks"},
+						FollowUp: "Why is that?",
+					},
+				},
+			},
+		},
+		{
+			Name:        "no questions",
+			Definition:  &surveyDefinition{},
+			ExpectError: true,
+		},
+		{
+			Name: "duplicate question IDs",
+			Definition: &surveyDefinition{
+				Questions: []*surveyQuestion{searchQuestion, searchQuestion},
+			},
+			ExpectError: true,
+		},
+		{
+			Name: "invalid question ID",
+			Definition: &surveyDefinition{
+				Questions: []*surveyQuestion{{ID: "Search-Quality", Type: QuestionTypeScale, Text: "Text", Min: 1, Max: 5}},
+			},
+			ExpectError: true,
+		},
+		{
+			Name: "missing text",
+			Definition: &surveyDefinition{
+				Questions: []*surveyQuestion{{ID: "search", Type: QuestionTypeScale, Min: 1, Max: 5}},
+			},
+			ExpectError: true,
+		},
+		{
+			Name: "NPS question with a different ID",
+			Definition: &surveyDefinition{
+				Questions: []*surveyQuestion{{ID: "recommend", Type: QuestionTypeNPS, Text: "Text"}},
+			},
+			ExpectError: true,
+		},
+		{
+			Name: "empty scale",
+			Definition: &surveyDefinition{
+				Questions: []*surveyQuestion{{ID: "search", Type: QuestionTypeScale, Text: "Text", Min: 5, Max: 5}},
+			},
+			ExpectError: true,
+		},
+		{
+			Name: "scale with too many options",
+			Definition: &surveyDefinition{
+				Questions: []*surveyQuestion{{ID: "search", Type: QuestionTypeScale, Text: "Text", Min: 0, Max: 100}},
+			},
+			ExpectError: true,
+		},
+		{
+			Name: "choice with one option",
+			Definition: &surveyDefinition{
+				Questions: []*surveyQuestion{{ID: "search", Type: QuestionTypeChoice, Text: "Text", Options: []string{"Yes"}}},
+			},
+			ExpectError: true,
+		},
+		{
+			Name: "choice with an empty option",
+			Definition: &surveyDefinition{
+				Questions: []*surveyQuestion{{ID: "search", Type: QuestionTypeChoice, Text: "Text", Options: []string{"Yes", ""}}},
+			},
+			ExpectError: true,
+		},
+		{
+			Name: "unknown type",
+			Definition: &surveyDefinition{
+				Questions: []*surveyQuestion{{ID: "search", Type: "text", Text: "Text"}},
+			},
+			ExpectError: true,
+		},
+	} {
+		t.Run(test.Name, func(t *testing.T) {
+			err := test.Definition.IsValid()
+
+			if test.ExpectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestSurveyQuestionValidateAnswer(t *testing.T) {
+	scale := &surveyQuestion{ID: "search", Type: QuestionTypeScale, Min: 1, Max: 5}
+	choice := &surveyQuestion{ID: "feature", Type: QuestionTypeChoice, Options: []string{"Search", "Threads"}}
+
+	assert.NoError(t, scale.validateAnswer("1"))
+	assert.NoError(t, scale.validateAnswer("5"))
+	assert.Error(t, scale.validateAnswer("0"))
+	assert.Error(t, scale.validateAnswer("6"))
+	assert.Error(t, scale.validateAnswer("five"))
+
+	assert.NoError(t, choice.validateAnswer("Threads"))
+	assert.Error(t, choice.validateAnswer("Boards"))
+
+	assert.Error(t, defaultNPSQuestion().validateAnswer("10"))
+}
+
+func TestGetSurveyDefinition(t *testing.T) {
+	t.Run("should return the default survey when none has been defined", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVGet", SurveyDefinitionKey).Return(nil, nil)
+		defer api.AssertExpectations(t)
+
+		p := Plugin{}
+		p.SetAPI(api)
+
+		definition, err := p.getSurveyDefinition()
+
+		assert.Nil(t, err)
+		assert.Equal(t, defaultSurveyDefinition(), definition)
+	})
+
+	t.Run("should return the stored survey", func(t *testing.T) {
+		stored := &surveyDefinition{
+			Questions: []*surveyQuestion{{ID: "search", Type: QuestionTypeScale, Text: "Text", Min: 1, Max: 5}},
+		}
+
+		api := makeAPIMock()
+		api.On("KVGet", SurveyDefinitionKey).Return(mustMarshalJSON(stored), nil)
+		defer api.AssertExpectations(t)
+
+		p := Plugin{}
+		p.SetAPI(api)
+
+		definition, err := p.getSurveyDefinition()
+
+		assert.Nil(t, err)
+		assert.Equal(t, stored, definition)
+	})
+
+	t.Run("should return an error if unable to get the survey", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVGet", SurveyDefinitionKey).Return(nil, &model.AppError{})
+		defer api.AssertExpectations(t)
+
+		p := Plugin{}
+		p.SetAPI(api)
+
+		definition, err := p.getSurveyDefinition()
+
+		assert.NotNil(t, err)
+		assert.Nil(t, definition)
+	})
+}
+
+func TestBuildQuestionPost(t *testing.T) {
+	user := &model.User{Username: "testuser"}
+	p := Plugin{}
+
+	t.Run("should build the NPS question for the web app", func(t *testing.T) {
+		post := p.buildQuestionPost(user, defaultNPSQuestion(), true)
+
+		assert.Equal(t, "custom_nps_survey", post.Type)
+		assert.Contains(t, post.Message, "@testuser")
+
+		attachments := post.Attachments()
+		require.Len(t, attachments, 1)
+		assert.Equal(t, surveyDropdownTitle.Other, attachments[0].Title)
+		require.Len(t, attachments[0].Actions, 2)
+
+		action := attachments[0].Actions[0]
+		require.Len(t, action.Options, 11)
+		assert.Equal(t, "10 (Very Likely)", action.Options[0].Text)
+		assert.Equal(t, "0 (Not Likely)", action.Options[10].Text)
+		assert.Equal(t, "/plugins/com.mattermost.nps/api/v1/score", action.Integration.URL)
+		assert.Equal(t, NPSQuestionID, action.Integration.Context["question_id"])
+	})
+
+	t.Run("should build a scale question as a regular post without the greeting when it isn't first", func(t *testing.T) {
+		post := p.buildQuestionPost(user, &surveyQuestion{
+			ID:       "search",
+			Type:     QuestionTypeScale,
+			Text:     "How satisfied are you with search?",
+			Min:      1,
+			Max:      5,
+			MaxLabel: "Very Satisfied",
+		}, false)
+
+		assert.Equal(t, "", post.Type)
+		assert.Equal(t, "", post.Message)
+
+		attachments := post.Attachments()
+		require.Len(t, attachments, 1)
+		require.Len(t, attachments[0].Actions, 1)
+
+		action := attachments[0].Actions[0]
+		require.Len(t, action.Options, 5)
+		assert.Equal(t, "5 (Very Satisfied)", action.Options[0].Text)
+		assert.Equal(t, "1", action.Options[4].Text)
+		assert.Equal(t, "/plugins/com.mattermost.nps/api/v1/answer", action.Integration.URL)
+		assert.Equal(t, "search", action.Integration.Context["question_id"])
+	})
+
+	t.Run("should include the disable action on the first question", func(t *testing.T) {
+		post := p.buildQuestionPost(user, &surveyQuestion{
+			ID:      "feature",
+			Type:    QuestionTypeChoice,
+			Text:    "What's your favorite feature?",
+			Options: []string{"Search", "Threads"},
+		}, true)
+
+		attachments := post.Attachments()
+		require.Len(t, attachments, 1)
+		require.Len(t, attachments[0].Actions, 2)
+		assert.Equal(t, []*model.PostActionOptions{
+			{Text: "Search", Value: "Search"},
+			{Text: "Threads", Value: "Threads"},
+		}, attachments[0].Actions[0].Options)
+		assert.Equal(t, "Disable", attachments[0].Actions[1].Name)
+	})
+
+	t.Run("should show the selected answer", func(t *testing.T) {
+		post := p.buildAnsweredQuestionPost(user, &surveyQuestion{
+			ID:      "feature",
+			Type:    QuestionTypeChoice,
+			Text:    "What's your favorite feature?",
+			Options: []string{"Search", "Threads"},
+		}, false, "Threads")
+
+		attachments := post.Attachments()
+		require.Len(t, attachments, 1)
+		assert.Equal(t, "You selected Threads.", attachments[0].Text)
+		assert.Equal(t, "Threads", attachments[0].Actions[0].DefaultOption)
+	})
+
+	t.Run("should not show the selected answer when surveys are anonymous", func(t *testing.T) {
+		p := Plugin{
+			configuration: &configuration{EnableAnonymousSurveys: true},
+		}
+
+		post := p.buildAnsweredQuestionPost(user, &surveyQuestion{
+			ID:   "nps",
+			Type: QuestionTypeNPS,
+		}, true, "7")
+
+		attachments := post.Attachments()
+		require.Len(t, attachments, 1)
+		assert.Equal(t, surveyAnsweredAnonymouslyBody.Other, attachments[0].Text)
+		assert.Empty(t, attachments[0].Actions[0].DefaultOption)
+		assert.NotContains(t, attachments[0].Text, "7")
+	})
+}
@@ -0,0 +1,36 @@
+// Copyright (c) 2019-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// isInDeliveryWindow returns whether or not surveys can be sent to the user at the given time, which is checked in the
+// user's own timezone. Users outside of the window receive their survey the next time that the background job or a
+// login finds them inside of it.
+func (c *configuration) isInDeliveryWindow(user *model.User, now time.Time) bool {
+	local := now.In(user.GetTimezoneLocation())
+
+	if c.SurveyDeliveryWeekdaysOnly && (local.Weekday() == time.Saturday || local.Weekday() == time.Sunday) {
+		return false
+	}
+
+	start := c.SurveyDeliveryStartHour
+	end := c.SurveyDeliveryEndHour
+	hour := local.Hour()
+
+	switch {
+	case start == end:
+		// Surveys can be sent at any time of day
+		return true
+	case start < end:
+		return hour >= start && hour < end
+	default:
+		// The window wraps around midnight, such as from 22:00 to 06:00
+		return hour >= start || hour < end
+	}
+}
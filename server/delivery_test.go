@@ -0,0 +1,114 @@
+// Copyright (c) 2019-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsInDeliveryWindow(t *testing.T) {
+	utcUser := &model.User{}
+	tokyoUser := &model.User{
+		Timezone: model.StringMap{"useAutomaticTimezone": "true", "automaticTimezone": "Asia/Tokyo"},
+	}
+
+	// Wednesday, May 15th 2019
+	wednesday := toDate(2019, time.May, 15)
+	// Saturday, May 18th 2019
+	saturday := toDate(2019, time.May, 18)
+
+	for _, test := range []struct {
+		Name          string
+		Configuration *configuration
+		User          *model.User
+		Now           time.Time
+		Expected      bool
+	}{
+		{
+			Name:          "no window",
+			Configuration: &configuration{},
+			User:          utcUser,
+			Now:           wednesday.Add(2 * time.Hour),
+			Expected:      true,
+		},
+		{
+			Name:          "inside window",
+			Configuration: &configuration{SurveyDeliveryStartHour: 10, SurveyDeliveryEndHour: 16},
+			User:          utcUser,
+			Now:           wednesday.Add(10 * time.Hour),
+			Expected:      true,
+		},
+		{
+			Name:          "before window",
+			Configuration: &configuration{SurveyDeliveryStartHour: 10, SurveyDeliveryEndHour: 16},
+			User:          utcUser,
+			Now:           wednesday.Add(9*time.Hour + 59*time.Minute),
+			Expected:      false,
+		},
+		{
+			Name:          "at end of window",
+			Configuration: &configuration{SurveyDeliveryStartHour: 10, SurveyDeliveryEndHour: 16},
+			User:          utcUser,
+			Now:           wednesday.Add(16 * time.Hour),
+			Expected:      false,
+		},
+		{
+			Name:          "inside window in user's timezone",
+			Configuration: &configuration{SurveyDeliveryStartHour: 10, SurveyDeliveryEndHour: 16},
+			User:          tokyoUser,
+			Now:           wednesday.Add(2 * time.Hour),
+			Expected:      true,
+		},
+		{
+			Name:          "outside window in user's timezone",
+			Configuration: &configuration{SurveyDeliveryStartHour: 10, SurveyDeliveryEndHour: 16},
+			User:          tokyoUser,
+			Now:           wednesday.Add(12 * time.Hour),
+			Expected:      false,
+		},
+		{
+			Name:          "inside window wrapping around midnight",
+			Configuration: &configuration{SurveyDeliveryStartHour: 22, SurveyDeliveryEndHour: 6},
+			User:          utcUser,
+			Now:           wednesday.Add(3 * time.Hour),
+			Expected:      true,
+		},
+		{
+			Name:          "outside window wrapping around midnight",
+			Configuration: &configuration{SurveyDeliveryStartHour: 22, SurveyDeliveryEndHour: 6},
+			User:          utcUser,
+			Now:           wednesday.Add(12 * time.Hour),
+			Expected:      false,
+		},
+		{
+			Name:          "weekday",
+			Configuration: &configuration{SurveyDeliveryWeekdaysOnly: true},
+			User:          utcUser,
+			Now:           wednesday.Add(12 * time.Hour),
+			Expected:      true,
+		},
+		{
+			Name:          "weekend",
+			Configuration: &configuration{SurveyDeliveryWeekdaysOnly: true},
+			User:          utcUser,
+			Now:           saturday.Add(12 * time.Hour),
+			Expected:      false,
+		},
+		{
+			Name:          "weekend in user's timezone",
+			Configuration: &configuration{SurveyDeliveryWeekdaysOnly: true},
+			User:          tokyoUser,
+			Now:           saturday.Add(-1 * time.Hour),
+			Expected:      false,
+		},
+	} {
+		t.Run(test.Name, func(t *testing.T) {
+			assert.Equal(t, test.Expected, test.Configuration.isInDeliveryWindow(test.User, test.Now))
+		})
+	}
+}
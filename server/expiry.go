@@ -0,0 +1,141 @@
+// Copyright (c) 2019-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// hasEnded returns whether or not the survey has stopped being sent to users. Surveys scheduled before surveys had an
+// end never end.
+func (s *surveyState) hasEnded(now time.Time) bool {
+	return !s.EndAt.IsZero() && !now.Before(s.EndAt)
+}
+
+// closeEndedSurveys closes every survey that has ended but hasn't been closed yet.
+func (p *Plugin) closeEndedSurveys(now time.Time) *model.AppError {
+	var ended []*surveyState
+	if err := p.KVForEach(fmt.Sprintf(SurveyKey, ""), func(key string) (bool, *model.AppError) {
+		var survey *surveyState
+		if err := p.KVGet(key, &survey); err != nil {
+			return false, err
+		}
+
+		if survey != nil && survey.hasEnded(now) && survey.ClosedAt.IsZero() {
+			ended = append(ended, survey)
+		}
+
+		return true, nil
+	}); err != nil {
+		return err
+	}
+
+	for _, survey := range ended {
+		if err := p.closeSurvey(survey, now); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// closeSurvey updates the question posts of every user who was sent the survey but didn't answer it to show that the
+// survey has ended, and then marks the survey as closed so that this only happens once.
+func (p *Plugin) closeSurvey(survey *surveyState, now time.Time) *model.AppError {
+	p.API.LogInfo("Closing survey", "survey_id", survey.getID())
+
+	if err := p.KVForEach(fmt.Sprintf(UserSurveyKey, ""), func(key string) (bool, *model.AppError) {
+		var userSurvey *userSurveyState
+		if err := p.KVGet(key, &userSurvey); err != nil {
+			return false, err
+		}
+
+		if userSurvey == nil || userSurvey.getSurveyID() != survey.getID() {
+			// The user wasn't sent this survey or has since been sent a newer one
+			return true, nil
+		}
+
+		if !userSurvey.AnsweredAt.IsZero() {
+			return true, nil
+		}
+
+		// Fall back to the default locale if the user can't be found
+		locale := ""
+		if user, err := p.API.GetUser(strings.TrimPrefix(key, fmt.Sprintf(UserSurveyKey, ""))); err == nil {
+			locale = user.Locale
+		}
+
+		for _, postID := range userSurvey.getQuestionPostIDs() {
+			if err := p.expireSurveyPost(postID, locale); err != nil {
+				p.API.LogWarn("Failed to expire survey post", "err", err)
+			}
+		}
+
+		return true, nil
+	}); err != nil {
+		return err
+	}
+
+	survey.ClosedAt = now
+
+	return p.KVSet(fmt.Sprintf(SurveyKey, survey.getID()), survey)
+}
+
+// hasAnsweredSurveyEnded returns whether or not the survey that the user's answers are attributed to has ended, in
+// which case it can no longer be answered. See getAnsweredSurvey.
+func (p *Plugin) hasAnsweredSurveyEnded(userID string, now time.Time) (bool, *model.AppError) {
+	surveyID, _, err := p.getAnsweredSurvey(userID, now)
+	if err != nil {
+		return false, err
+	}
+
+	var survey *surveyState
+	if err = p.KVGet(fmt.Sprintf(SurveyKey, surveyID), &survey); err != nil {
+		return false, err
+	}
+
+	return survey != nil && survey.hasEnded(now), nil
+}
+
+// writeSurveyEndedResponse responds to an answer to a survey that has ended by telling the user that it can no longer
+// be answered.
+func (p *Plugin) writeSurveyEndedResponse(w http.ResponseWriter, locale string) {
+	response := model.PostActionIntegrationResponse{
+		EphemeralText: p.translate(locale, surveyExpiredBody),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		p.API.LogWarn("Failed to write the survey ended message", "err", err)
+	}
+}
+
+// expireSurveyPost removes the options from an unanswered survey post and replaces them with a message saying that
+// the survey has ended in the given locale.
+func (p *Plugin) expireSurveyPost(postID, locale string) *model.AppError {
+	post, err := p.API.GetPost(postID)
+	if err != nil {
+		return err
+	}
+
+	attachments := post.Attachments()
+	for _, attachment := range attachments {
+		attachment.Actions = nil
+		attachment.Text = p.translate(locale, surveyExpiredBody)
+	}
+
+	post.AddProp("attachments", attachments)
+
+	// Used by the web app plugin to hide the scores
+	post.AddProp("survey_expired", true)
+
+	_, err = p.API.UpdatePost(post)
+	return err
+}
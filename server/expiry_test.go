@@ -0,0 +1,222 @@
+// Copyright (c) 2019-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestSurveyHasEnded(t *testing.T) {
+	now := toDate(2019, time.May, 10)
+
+	for _, test := range []struct {
+		Name     string
+		EndAt    time.Time
+		Expected bool
+	}{
+		{Name: "without an end", EndAt: time.Time{}, Expected: false},
+		{Name: "before the end", EndAt: now.Add(time.Millisecond), Expected: false},
+		{Name: "at the end", EndAt: now, Expected: true},
+		{Name: "after the end", EndAt: now.Add(-1 * time.Millisecond), Expected: true},
+	} {
+		t.Run(test.Name, func(t *testing.T) {
+			survey := &surveyState{EndAt: test.EndAt}
+
+			assert.Equal(t, test.Expected, survey.hasEnded(now))
+		})
+	}
+}
+
+func TestCloseEndedSurveys(t *testing.T) {
+	now := toDate(2019, time.July, 1)
+
+	ended := &surveyState{
+		ID:      "2019-Q2",
+		StartAt: toDate(2019, time.April, 15),
+		EndAt:   toDate(2019, time.May, 15),
+	}
+	closed := &surveyState{
+		ID:       "2019-Q1",
+		StartAt:  toDate(2019, time.January, 15),
+		EndAt:    toDate(2019, time.February, 15),
+		ClosedAt: toDate(2019, time.February, 15),
+	}
+	ongoing := &surveyState{
+		ID:      "2019-Q3",
+		StartAt: now,
+		EndAt:   now.Add(DefaultSurveyDuration),
+	}
+
+	unansweredUserID := model.NewId()
+	answeredUserID := model.NewId()
+	oldUserID := model.NewId()
+	unansweredPostID := model.NewId()
+
+	keys := []string{
+		fmt.Sprintf(SurveyKey, ended.ID),
+		fmt.Sprintf(SurveyKey, closed.ID),
+		fmt.Sprintf(SurveyKey, ongoing.ID),
+		fmt.Sprintf(UserSurveyKey, unansweredUserID),
+		fmt.Sprintf(UserSurveyKey, answeredUserID),
+		fmt.Sprintf(UserSurveyKey, oldUserID),
+	}
+
+	t.Run("should expire unanswered survey posts and close the survey", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVList", 0, 100).Return(keys, nil)
+		api.On("KVGet", fmt.Sprintf(SurveyKey, ended.ID)).Return(mustMarshalJSON(ended), nil)
+		api.On("KVGet", fmt.Sprintf(SurveyKey, closed.ID)).Return(mustMarshalJSON(closed), nil)
+		api.On("KVGet", fmt.Sprintf(SurveyKey, ongoing.ID)).Return(mustMarshalJSON(ongoing), nil)
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, unansweredUserID)).Return(mustMarshalJSON(&userSurveyState{
+			SurveyID:    ended.ID,
+			ScorePostID: unansweredPostID,
+		}), nil)
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, answeredUserID)).Return(mustMarshalJSON(&userSurveyState{
+			SurveyID:    ended.ID,
+			ScorePostID: model.NewId(),
+			AnsweredAt:  toDate(2019, time.May, 1),
+		}), nil)
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, oldUserID)).Return(mustMarshalJSON(&userSurveyState{
+			SurveyID:    closed.ID,
+			ScorePostID: model.NewId(),
+		}), nil)
+		api.On("GetPost", unansweredPostID).Return(&model.Post{
+			Id: unansweredPostID,
+			Props: model.StringInterface{
+				"attachments": []*model.SlackAttachment{{
+					Title:   "How likely are you to recommend Mattermost?",
+					Actions: []*model.PostAction{{Name: "0"}},
+				}},
+			},
+		}, nil)
+		api.On("UpdatePost", mock.MatchedBy(func(post *model.Post) bool {
+			attachments := post.Attachments()
+
+			return post.Id == unansweredPostID &&
+				post.GetProp("survey_expired") == true &&
+				len(attachments) == 1 &&
+				len(attachments[0].Actions) == 0 &&
+				attachments[0].Text == "Cette enquête est terminée."
+		})).Return(nil, nil)
+		api.On("KVSet", fmt.Sprintf(SurveyKey, ended.ID), mustMarshalJSON(&surveyState{
+			ID:       ended.ID,
+			StartAt:  ended.StartAt,
+			EndAt:    ended.EndAt,
+			ClosedAt: now,
+		})).Return(nil)
+		api.On("GetUser", unansweredUserID).Return(&model.User{Id: unansweredUserID, Locale: "fr"}, nil)
+		defer api.AssertExpectations(t)
+
+		p := Plugin{
+			translations: map[string]map[string]string{
+				"fr": {surveyExpiredBody.ID: "Cette enquête est terminée."},
+			},
+		}
+		p.SetAPI(api)
+
+		err := p.closeEndedSurveys(now)
+
+		assert.Nil(t, err)
+	})
+
+	t.Run("should expire every question post of a survey without an NPS question", func(t *testing.T) {
+		questionPostIDs := []string{model.NewId(), model.NewId()}
+
+		api := makeAPIMock()
+		api.On("KVList", 0, 100).Return([]string{fmt.Sprintf(UserSurveyKey, unansweredUserID)}, nil)
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, unansweredUserID)).Return(mustMarshalJSON(&userSurveyState{
+			SurveyID:        ended.ID,
+			QuestionPostIDs: questionPostIDs,
+		}), nil)
+		api.On("GetUser", unansweredUserID).Return(nil, &model.AppError{})
+		for _, postID := range questionPostIDs {
+			api.On("GetPost", postID).Return(&model.Post{Id: postID}, nil)
+			api.On("UpdatePost", mock.MatchedBy(func(post *model.Post) bool {
+				return post.GetProp("survey_expired") == true
+			})).Return(nil, nil).Once()
+		}
+		api.On("KVSet", fmt.Sprintf(SurveyKey, ended.ID), mock.Anything).Return(nil)
+		defer api.AssertExpectations(t)
+
+		p := Plugin{}
+		p.SetAPI(api)
+
+		err := p.closeSurvey(&surveyState{ID: ended.ID}, now)
+
+		assert.Nil(t, err)
+	})
+
+	t.Run("should still close the survey if a post can't be expired", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVList", 0, 100).Return([]string{fmt.Sprintf(UserSurveyKey, unansweredUserID)}, nil)
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, unansweredUserID)).Return(mustMarshalJSON(&userSurveyState{
+			SurveyID:    ended.ID,
+			ScorePostID: unansweredPostID,
+		}), nil)
+		api.On("GetUser", unansweredUserID).Return(&model.User{Id: unansweredUserID}, nil)
+		api.On("GetPost", unansweredPostID).Return(nil, &model.AppError{})
+		api.On("KVSet", fmt.Sprintf(SurveyKey, ended.ID), mock.Anything).Return(nil)
+		defer api.AssertExpectations(t)
+
+		p := Plugin{}
+		p.SetAPI(api)
+
+		err := p.closeSurvey(&surveyState{ID: ended.ID}, now)
+
+		assert.Nil(t, err)
+	})
+
+	t.Run("should return error if unable to list surveys", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVList", 0, 100).Return(nil, &model.AppError{})
+		defer api.AssertExpectations(t)
+
+		p := Plugin{}
+		p.SetAPI(api)
+
+		err := p.closeEndedSurveys(now)
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestHasAnsweredSurveyEnded(t *testing.T) {
+	userID := model.NewId()
+	now := toDate(2019, time.May, 10)
+
+	for _, test := range []struct {
+		Name     string
+		Survey   *surveyState
+		Expected bool
+	}{
+		{Name: "unknown survey", Survey: nil, Expected: false},
+		{Name: "ongoing survey", Survey: &surveyState{ID: "2019-Q2", EndAt: now.Add(day)}, Expected: false},
+		{Name: "ended survey", Survey: &surveyState{ID: "2019-Q2", EndAt: now.Add(-day)}, Expected: true},
+	} {
+		t.Run(test.Name, func(t *testing.T) {
+			api := makeAPIMock()
+			api.On("KVGet", fmt.Sprintf(UserSurveyKey, userID)).Return(mustMarshalJSON(&userSurveyState{SurveyID: "2019-Q2"}), nil)
+			if test.Survey == nil {
+				api.On("KVGet", fmt.Sprintf(SurveyKey, "2019-Q2")).Return(nil, nil)
+			} else {
+				api.On("KVGet", fmt.Sprintf(SurveyKey, "2019-Q2")).Return(mustMarshalJSON(test.Survey), nil)
+			}
+			defer api.AssertExpectations(t)
+
+			p := Plugin{}
+			p.SetAPI(api)
+
+			ended, err := p.hasAnsweredSurveyEnded(userID, now)
+
+			assert.Nil(t, err)
+			assert.Equal(t, test.Expected, ended)
+		})
+	}
+}
@@ -0,0 +1,356 @@
+// Copyright (c) 2019-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	ExportFormatCSV    = "csv"
+	ExportFormatNDJSON = "ndjson"
+
+	ExportTypeScore    = "score"
+	ExportTypeFeedback = "feedback"
+	ExportTypeAnswer   = "answer"
+
+	// ExportNextCursorHeader contains the cursor that a paged export continues from. It's missing from the last page.
+	ExportNextCursorHeader = "X-Feedbackbot-Next-Cursor"
+
+	// exportKVPerPage is the number of keys that exportResponses lists at once.
+	exportKVPerPage = 100
+)
+
+// exportRecord is a single score, piece of feedback or answer as written by exportResponses, along with the properties that
+// are also sent with the matching telemetry event.
+type exportRecord struct {
+	Type              string `json:"type"`
+	SurveyID          string `json:"survey_id"`
+	ServerVersion     string `json:"server_version"`
+	UserID            string `json:"user_id"`
+	Score             *int   `json:"score,omitempty"`
+	Segment           string `json:"segment,omitempty"`
+	Feedback          string `json:"feedback,omitempty"`
+	Source            string `json:"source,omitempty"`
+	Email             string `json:"email,omitempty"`
+	PostID            string `json:"post_id,omitempty"`
+	RootID            string `json:"root_id,omitempty"`
+	QuestionID        string `json:"question_id,omitempty"`
+	Answer            string `json:"answer,omitempty"`
+	Timestamp         int64  `json:"timestamp"`
+	ServerInstallDate int64  `json:"server_install_date"`
+	UserRole          string `json:"user_role"`
+	UserCreateAt      int64  `json:"user_create_at"`
+	LicenseID         string `json:"license_id"`
+	LicenseSKU        string `json:"license_sku"`
+}
+
+var exportCSVHeader = []string{
+	"type",
+	"survey_id",
+	"server_version",
+	"user_id",
+	"score",
+	"segment",
+	"feedback",
+	"source",
+	"email",
+	"post_id",
+	"root_id",
+	"question_id",
+	"answer",
+	"timestamp",
+	"server_install_date",
+	"user_role",
+	"user_create_at",
+	"license_id",
+	"license_sku",
+}
+
+func (r *exportRecord) csvRow() []string {
+	score := ""
+	if r.Score != nil {
+		score = strconv.Itoa(*r.Score)
+	}
+
+	return []string{
+		r.Type,
+		r.SurveyID,
+		r.ServerVersion,
+		r.UserID,
+		score,
+		r.Segment,
+		r.Feedback,
+		r.Source,
+		r.Email,
+		r.PostID,
+		r.RootID,
+		r.QuestionID,
+		r.Answer,
+		strconv.FormatInt(r.Timestamp, 10),
+		strconv.FormatInt(r.ServerInstallDate, 10),
+		r.UserRole,
+		strconv.FormatInt(r.UserCreateAt, 10),
+		r.LicenseID,
+		r.LicenseSKU,
+	}
+}
+
+// addEventProperties fills in the properties of the record which are computed by getEventProperties.
+func (p *Plugin) addEventProperties(record *exportRecord) {
+	properties := p.getEventProperties(record.UserID, record.Timestamp, nil)
+
+	record.ServerInstallDate, _ = properties["server_install_date"].(int64)
+	record.UserRole, _ = properties["user_role"].(string)
+	record.UserCreateAt, _ = properties["user_create_at"].(int64)
+	record.LicenseID, _ = properties["license_id"].(string)
+	record.LicenseSKU, _ = properties["license_sku"].(string)
+}
+
+// exportCursor is where a paged export continues from. It's given to the client as an opaque string by
+// encodeExportCursor.
+type exportCursor struct {
+	// Page is the page of KVList that the next record was found on.
+	Page int `json:"page"`
+
+	// Key is the key of the last record that was written.
+	Key string `json:"key"`
+}
+
+// encodeExportCursor returns the cursor as the opaque string sent to the client.
+func encodeExportCursor(cursor *exportCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeExportCursor parses a cursor returned by encodeExportCursor. An empty string is the start of the export and
+// returns nil.
+func decodeExportCursor(value string) (*exportCursor, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode export cursor")
+	}
+
+	var cursor *exportCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor == nil || cursor.Page < 0 {
+		return nil, errors.New("invalid export cursor")
+	}
+
+	return cursor, nil
+}
+
+// exportSource is a kind of record that is exported along with the prefix of the keys that it's stored under.
+type exportSource struct {
+	Type   string
+	Prefix string
+	Read   func(p *Plugin, key string) (*exportRecord, *model.AppError)
+}
+
+var exportSources = []*exportSource{
+	{ExportTypeScore, ScoreResponsePrefix, (*Plugin).getScoreExportRecord},
+	{ExportTypeFeedback, FeedbackResponsePrefix, (*Plugin).getFeedbackExportRecord},
+	{ExportTypeAnswer, AnswerResponsePrefix, (*Plugin).getAnswerExportRecord},
+}
+
+// getExportSource returns the source of the record stored under the given key, or nil if it isn't a record.
+func getExportSource(key string) *exportSource {
+	for _, source := range exportSources {
+		if strings.HasPrefix(key, source.Prefix) {
+			return source
+		}
+	}
+
+	return nil
+}
+
+// exportResponses writes the stored scores, feedback and answers to w in the given format. Records are
+// written as they're read from the KV store so that the whole export never needs to be held in memory. If recordType
+// is not empty, only records of that type are written.
+//
+// If perPage is greater than zero, at most that many records are written, and the cursor to continue from is returned
+// if there are more. Exports start from a nil cursor, and a CSV header is only written then so that pages can be
+// concatenated. Each page only reads the keys after the cursor, so the whole export reads every key once.
+func (p *Plugin) exportResponses(w io.Writer, format, recordType string, cursor *exportCursor, perPage int) (*exportCursor, error) {
+	var write func(record *exportRecord) error
+	var flush func() error
+
+	switch format {
+	case ExportFormatCSV:
+		csvWriter := csv.NewWriter(w)
+		if cursor == nil {
+			if err := csvWriter.Write(exportCSVHeader); err != nil {
+				return nil, err
+			}
+		}
+
+		write = func(record *exportRecord) error {
+			return csvWriter.Write(record.csvRow())
+		}
+		flush = func() error {
+			csvWriter.Flush()
+			return csvWriter.Error()
+		}
+	case ExportFormatNDJSON:
+		encoder := json.NewEncoder(w)
+
+		write = func(record *exportRecord) error {
+			return encoder.Encode(record)
+		}
+		flush = func() error {
+			return nil
+		}
+	default:
+		return nil, errors.Errorf("unknown export format %s", format)
+	}
+
+	page := 0
+	lastKey := ""
+	if cursor != nil {
+		// KVList returns keys in order, so keys up to the last one written have already been exported. Start from the
+		// page before the cursor in case keys before it were deleted and moved the rest back.
+		page = cursor.Page - 1
+		if page < 0 {
+			page = 0
+		}
+		lastKey = cursor.Key
+	}
+
+	written := 0
+
+	for {
+		keys, appErr := p.API.KVList(page, exportKVPerPage)
+		if appErr != nil {
+			return nil, appErr
+		}
+
+		for _, key := range keys {
+			if key <= lastKey {
+				continue
+			}
+
+			source := getExportSource(key)
+			if source == nil || (recordType != "" && recordType != source.Type) {
+				continue
+			}
+
+			if perPage > 0 && written >= perPage {
+				// There's at least one more record, so the client needs to ask for another page
+				return &exportCursor{Page: page, Key: lastKey}, flush()
+			}
+
+			record, appErr := source.Read(p, key)
+			if appErr != nil {
+				return nil, appErr
+			}
+
+			if record == nil {
+				// The record was deleted after the keys were listed
+				continue
+			}
+
+			p.addEventProperties(record)
+
+			if err := write(record); err != nil {
+				return nil, err
+			}
+
+			written++
+			lastKey = key
+		}
+
+		if len(keys) < exportKVPerPage {
+			break
+		}
+
+		page++
+	}
+
+	return nil, flush()
+}
+
+// getScoreExportRecord returns the score stored under the given key as an exportRecord, or nil if there isn't one.
+func (p *Plugin) getScoreExportRecord(key string) (*exportRecord, *model.AppError) {
+	response, appErr := p.getScoreResponse(key)
+	if appErr != nil || response == nil {
+		return nil, appErr
+	}
+
+	score := response.Score
+
+	return &exportRecord{
+		Type:          ExportTypeScore,
+		SurveyID:      response.SurveyID,
+		ServerVersion: response.ServerVersion,
+		UserID:        response.UserID,
+		QuestionID:    response.Kind,
+		Score:         &score,
+		Segment:       getFollowUpSegment(response.Kind, response.Score),
+		Timestamp:     response.CreateAt.UnixMilli(),
+	}, nil
+}
+
+// getFeedbackExportRecord returns the feedback stored under the given key as an exportRecord, or nil if there isn't
+// any.
+func (p *Plugin) getFeedbackExportRecord(key string) (*exportRecord, *model.AppError) {
+	response, appErr := p.getFeedbackResponse(key)
+	if appErr != nil || response == nil {
+		return nil, appErr
+	}
+
+	record := &exportRecord{
+		Type:          ExportTypeFeedback,
+		SurveyID:      response.SurveyID,
+		ServerVersion: response.ServerVersion,
+		UserID:        response.UserID,
+		Feedback:      response.Message,
+		Email:         response.Email,
+		PostID:        response.PostID,
+		Timestamp:     response.CreateAt.UnixMilli(),
+	}
+
+	// Feedback includes what prompted it, including the score given to the survey that it replied to
+	if context := response.Context; context != nil {
+		record.Source = context.Source
+		record.RootID = context.RootID
+		record.Score = context.Score
+		record.Segment = context.Segment
+		record.QuestionID = context.Kind
+
+		if context.QuestionID != "" {
+			record.QuestionID = context.QuestionID
+		}
+	}
+
+	return record, nil
+}
+
+// getAnswerExportRecord returns the answer stored under the given key as an exportRecord, or nil if there isn't one.
+func (p *Plugin) getAnswerExportRecord(key string) (*exportRecord, *model.AppError) {
+	response, appErr := p.getAnswerResponse(key)
+	if appErr != nil || response == nil {
+		return nil, appErr
+	}
+
+	return &exportRecord{
+		Type:          ExportTypeAnswer,
+		SurveyID:      response.SurveyID,
+		ServerVersion: response.ServerVersion,
+		UserID:        response.UserID,
+		QuestionID:    response.QuestionID,
+		Answer:        response.Answer,
+		Timestamp:     response.CreateAt.UnixMilli(),
+	}, nil
+}
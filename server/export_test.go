@@ -0,0 +1,248 @@
+// Copyright (c) 2019-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportResponses(t *testing.T) {
+	userID := model.NewId()
+	postID := model.NewId()
+	rootID := model.NewId()
+	scoreKey := fmt.Sprintf(ScoreResponseKey, "5.10.0", userID)
+	feedbackKey := fmt.Sprintf(FeedbackResponseKey, "5.10.0", userID, postID)
+	createAt := toDate(2019, time.May, 10)
+
+	makeStoreMock := func() *plugintest.API {
+		api := makeAPIMock()
+		api.On("KVList", 0, 100).Return([]string{feedbackKey, scoreKey}, nil)
+		api.On("KVGet", scoreKey).Return(mustMarshalJSON(&scoreResponse{
+			ServerVersion: "5.10.0",
+			UserID:        userID,
+			Score:         9,
+			CreateAt:      createAt,
+		}), nil).Maybe()
+		api.On("KVGet", feedbackKey).Return(mustMarshalJSON(&feedbackResponse{
+			ServerVersion: "5.10.0",
+			UserID:        userID,
+			PostID:        postID,
+			Message:       "Needs more \"cowbell\"",
+			CreateAt:      createAt,
+			Context: &feedbackContext{
+				Source:   FeedbackSourceNPS,
+				RootID:   rootID,
+				SurveyID: "5.10.0",
+				Kind:     QuestionTypeNPS,
+				Score:    model.NewInt(9),
+				Segment:  NPSSegmentPromoter,
+			},
+		}), nil).Maybe()
+		api.On("GetSystemInstallDate").Return(int64(1000), nil).Maybe()
+		api.On("GetUser", userID).Return(nil, &model.AppError{}).Maybe()
+		api.On("GetLicense").Return(&model.License{Id: "license", SkuShortName: "e20"}).Maybe()
+
+		return api
+	}
+
+	t.Run("should write all records as CSV", func(t *testing.T) {
+		api := makeStoreMock()
+		defer api.AssertExpectations(t)
+
+		p := Plugin{}
+		p.SetAPI(api)
+
+		var buf bytes.Buffer
+		next, err := p.exportResponses(&buf, ExportFormatCSV, "", nil, 0)
+
+		require.NoError(t, err)
+		assert.Nil(t, next)
+		assert.Equal(t, strings.Join([]string{
+			"type,survey_id,server_version,user_id,score,segment,feedback,source,email,post_id,root_id,question_id,answer,timestamp,server_install_date,user_role,user_create_at,license_id,license_sku",
+			fmt.Sprintf("feedback,5.10.0,5.10.0,%s,9,promoter,\"Needs more \"\"cowbell\"\"\",nps,,%s,%s,nps,,%d,1000,,0,license,e20", userID, postID, rootID, createAt.UnixMilli()),
+			fmt.Sprintf("score,5.10.0,5.10.0,%s,9,promoter,,,,,,nps,,%d,1000,,0,license,e20", userID, createAt.UnixMilli()),
+			"",
+		}, "\n"), buf.String())
+	})
+
+	t.Run("should write a page of records as NDJSON and return the cursor to the next one", func(t *testing.T) {
+		api := makeStoreMock()
+		defer api.AssertExpectations(t)
+
+		p := Plugin{}
+		p.SetAPI(api)
+
+		var buf bytes.Buffer
+		next, err := p.exportResponses(&buf, ExportFormatNDJSON, "", nil, 1)
+
+		require.NoError(t, err)
+		api.AssertNotCalled(t, "KVGet", scoreKey)
+		assert.Equal(t, &exportCursor{Page: 0, Key: feedbackKey}, next)
+		assert.Equal(t, string(mustMarshalJSON(&exportRecord{
+			Type:              ExportTypeFeedback,
+			SurveyID:          "5.10.0",
+			ServerVersion:     "5.10.0",
+			UserID:            userID,
+			Score:             model.NewInt(9),
+			Segment:           NPSSegmentPromoter,
+			Feedback:          "Needs more \"cowbell\"",
+			Source:            FeedbackSourceNPS,
+			PostID:            postID,
+			RootID:            rootID,
+			QuestionID:        QuestionTypeNPS,
+			Timestamp:         createAt.UnixMilli(),
+			ServerInstallDate: 1000,
+			LicenseID:         "license",
+			LicenseSKU:        "e20",
+		}))+"\n", buf.String())
+	})
+
+	t.Run("should continue from the cursor without a header", func(t *testing.T) {
+		api := makeStoreMock()
+		defer api.AssertExpectations(t)
+
+		p := Plugin{}
+		p.SetAPI(api)
+
+		// The cursor's page may have moved back since the cursor was returned, so the page before it is read first
+		var buf bytes.Buffer
+		next, err := p.exportResponses(&buf, ExportFormatCSV, "", &exportCursor{Page: 1, Key: feedbackKey}, 1)
+
+		require.NoError(t, err)
+		api.AssertNotCalled(t, "KVGet", feedbackKey)
+		assert.Nil(t, next)
+		assert.Equal(t, fmt.Sprintf("score,5.10.0,5.10.0,%s,9,promoter,,,,,,nps,,%d,1000,,0,license,e20\n", userID, createAt.UnixMilli()), buf.String())
+	})
+
+	t.Run("should only write records of the requested type", func(t *testing.T) {
+		api := makeStoreMock()
+		defer api.AssertExpectations(t)
+
+		p := Plugin{}
+		p.SetAPI(api)
+
+		var buf bytes.Buffer
+		next, err := p.exportResponses(&buf, ExportFormatCSV, ExportTypeScore, &exportCursor{Key: feedbackKey}, 10)
+
+		require.NoError(t, err)
+		assert.Nil(t, next)
+		assert.True(t, strings.HasPrefix(buf.String(), "score,"))
+		assert.Equal(t, 1, strings.Count(buf.String(), "\n"))
+	})
+
+	t.Run("should return an error for an unknown format", func(t *testing.T) {
+		p := Plugin{}
+
+		var buf bytes.Buffer
+		_, err := p.exportResponses(&buf, "xml", "", nil, 0)
+
+		assert.Error(t, err)
+	})
+}
+
+func TestExportCursor(t *testing.T) {
+	t.Run("should decode an encoded cursor", func(t *testing.T) {
+		cursor := &exportCursor{Page: 3, Key: "Score-5.10.0-user"}
+
+		decoded, err := decodeExportCursor(encodeExportCursor(cursor))
+
+		require.NoError(t, err)
+		assert.Equal(t, cursor, decoded)
+	})
+
+	t.Run("should start from the beginning without a cursor", func(t *testing.T) {
+		decoded, err := decodeExportCursor("")
+
+		require.NoError(t, err)
+		assert.Nil(t, decoded)
+	})
+
+	t.Run("should return an error for an invalid cursor", func(t *testing.T) {
+		_, err := decodeExportCursor("not a cursor")
+		assert.Error(t, err)
+
+		_, err = decodeExportCursor(encodeExportCursor(&exportCursor{Page: -1}))
+		assert.Error(t, err)
+	})
+}
+
+func TestExportResponsesHandler(t *testing.T) {
+	for _, query := range []string{
+		"format=xml",
+		"type=unknown",
+		"cursor=invalid",
+		"per_page=many",
+	} {
+		t.Run("should return bad request for "+query, func(t *testing.T) {
+			p := Plugin{}
+
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodGet, "/api/v1/export?"+query, nil)
+
+			p.exportResponsesHandler(recorder, request)
+
+			assert.Equal(t, http.StatusBadRequest, recorder.Result().StatusCode)
+		})
+	}
+
+	t.Run("should stream the export", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVList", 0, 100).Return([]string{}, nil)
+		defer api.AssertExpectations(t)
+
+		p := Plugin{}
+		p.SetAPI(api)
+
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodGet, "/api/v1/export?format=ndjson&type=score", nil)
+
+		p.exportResponsesHandler(recorder, request)
+
+		result := recorder.Result()
+		assert.Equal(t, http.StatusOK, result.StatusCode)
+		assert.Equal(t, "application/x-ndjson", result.Header.Get("Content-Type"))
+		assert.Empty(t, result.Header.Get(ExportNextCursorHeader))
+	})
+
+	t.Run("should return the cursor to the next page", func(t *testing.T) {
+		scoreKeys := []string{
+			fmt.Sprintf(ScoreResponseKey, "5.10.0", model.NewId()),
+			fmt.Sprintf(ScoreResponseKey, "5.10.0", model.NewId()),
+		}
+		sort.Strings(scoreKeys)
+
+		api := makeAPIMock()
+		api.On("KVList", 0, 100).Return(scoreKeys, nil)
+		api.On("KVGet", scoreKeys[0]).Return(mustMarshalJSON(&scoreResponse{ServerVersion: "5.10.0", Score: 9}), nil)
+		api.On("GetSystemInstallDate").Return(int64(1000), nil)
+		api.On("GetUser", "").Return(nil, &model.AppError{})
+		api.On("GetLicense").Return(nil)
+		defer api.AssertExpectations(t)
+
+		p := Plugin{}
+		p.SetAPI(api)
+
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodGet, "/api/v1/export?format=ndjson&per_page=1", nil)
+
+		p.exportResponsesHandler(recorder, request)
+
+		result := recorder.Result()
+		assert.Equal(t, http.StatusOK, result.StatusCode)
+		assert.Equal(t, encodeExportCursor(&exportCursor{Key: scoreKeys[0]}), result.Header.Get(ExportNextCursorHeader))
+		assert.Equal(t, 1, strings.Count(recorder.Body.String(), "\n"))
+	})
+}
@@ -0,0 +1,149 @@
+// Copyright (c) 2019-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+const (
+	// FeedbackSourceWelcome, FeedbackSourceNPS and FeedbackSourceUnsolicited describe what prompted a user to send
+	// feedback: the welcome message, a survey or its follow-up question, or nothing at all.
+	FeedbackSourceWelcome     = "welcome"
+	FeedbackSourceNPS         = "nps"
+	FeedbackSourceUnsolicited = "unsolicited"
+)
+
+// feedbackContext describes what prompted a piece of feedback so that comments can be correlated with scores. It's
+// stored with the feedback and sent with its telemetry event.
+type feedbackContext struct {
+	Source string `json:"source"`
+
+	// RootID is the post that the feedback was sent in reply to, if any.
+	RootID string `json:"root_id,omitempty"`
+
+	// SurveyID, ServerVersion and ScorePostID identify the survey that the feedback replies to when Source is
+	// FeedbackSourceNPS.
+	SurveyID      string `json:"survey_id,omitempty"`
+	ServerVersion string `json:"server_version,omitempty"`
+	ScorePostID   string `json:"score_post_id,omitempty"`
+
+	// Kind, Score and Segment describe the score that the user gave to that survey if they've answered it.
+	Kind    string `json:"kind,omitempty"`
+	Score   *int   `json:"score,omitempty"`
+	Segment string `json:"segment,omitempty"`
+
+	// QuestionID is the question that the feedback explains when it replies to the follow-up of a question that isn't
+	// scored.
+	QuestionID string `json:"question_id,omitempty"`
+}
+
+// welcomeFeedbackPost is the welcome message sent to a new user asking for their feedback.
+type welcomeFeedbackPost struct {
+	PostID string    `json:"post_id"`
+	SentAt time.Time `json:"sent_at"`
+}
+
+// isReplyToPrompt returns whether or not the given feedback post replies to a post from Feedbackbot asking for
+// feedback. Replies made in the prompt's thread always count, as do new posts sent within FollowUpReplyWindow of it.
+func isReplyToPrompt(post *model.Post, promptPostID string, sentAt time.Time) bool {
+	if post.RootId != "" {
+		return post.RootId == promptPostID
+	}
+
+	createAt := time.UnixMilli(post.CreateAt)
+	return !createAt.Before(sentAt) && createAt.Sub(sentAt) < FollowUpReplyWindow
+}
+
+// getFeedbackContext works out what prompted the given feedback post. Replies to a survey's follow-up questions or to
+// the survey itself are attributed to the survey, replies to the welcome message are attributed to it, and anything
+// else is unsolicited.
+func (p *Plugin) getFeedbackContext(post *model.Post) (*feedbackContext, *model.AppError) {
+	context := &feedbackContext{
+		Source: FeedbackSourceUnsolicited,
+		RootID: post.RootId,
+	}
+
+	var userSurvey *userSurveyState
+	if err := p.KVGet(fmt.Sprintf(UserSurveyKey, post.UserId), &userSurvey); err != nil {
+		return nil, err
+	}
+
+	if userSurvey != nil {
+		scoreFollowUp := userSurvey.FollowUp
+		if scoreFollowUp != nil && !scoreFollowUp.isRepliedToBy(post) {
+			scoreFollowUp = nil
+		}
+
+		// Attribute feedback that could reply to either kind of follow-up to the one that was sent last
+		questionID, answerFollowUp := userSurvey.getAnswerFollowUpRepliedToBy(post)
+		if answerFollowUp != nil && (scoreFollowUp == nil || answerFollowUp.SentAt.After(scoreFollowUp.SentAt)) {
+			context.Source = FeedbackSourceNPS
+			context.SurveyID = userSurvey.getSurveyID()
+			context.ServerVersion = userSurvey.ServerVersion
+			context.ScorePostID = userSurvey.ScorePostID
+			context.QuestionID = questionID
+
+			return context, nil
+		}
+
+		if scoreFollowUp != nil {
+			context.Source = FeedbackSourceNPS
+			context.SurveyID = scoreFollowUp.SurveyID
+			context.ServerVersion = userSurvey.ServerVersion
+			context.ScorePostID = userSurvey.ScorePostID
+
+			if !scoreFollowUp.Anonymous {
+				score := scoreFollowUp.Score
+
+				context.Kind = scoreFollowUp.Kind
+				context.Score = &score
+				context.Segment = scoreFollowUp.Segment
+			}
+
+			return context, nil
+		}
+
+		if post.RootId != "" && post.RootId == userSurvey.ScorePostID {
+			context.Source = FeedbackSourceNPS
+			context.SurveyID = userSurvey.getSurveyID()
+			context.ServerVersion = userSurvey.ServerVersion
+			context.ScorePostID = userSurvey.ScorePostID
+
+			if p.getConfiguration().EnableAnonymousSurveys {
+				// Anonymous scores can't be attached to feedback without linking them to the user
+				return context, nil
+			}
+
+			var response *scoreResponse
+			if err := p.KVGet(getScoreResponseKey(QuestionTypeNPS, context.SurveyID, post.UserId), &response); err != nil {
+				return nil, err
+			}
+
+			if response != nil {
+				score := response.Score
+
+				context.Kind = QuestionTypeNPS
+				context.Score = &score
+				context.Segment = getNPSSegment(score)
+			}
+
+			return context, nil
+		}
+	}
+
+	var welcome *welcomeFeedbackPost
+	if err := p.KVGet(fmt.Sprintf(WelcomeFeedbackPostKey, post.UserId), &welcome); err != nil {
+		return nil, err
+	}
+
+	if welcome != nil && isReplyToPrompt(post, welcome.PostID, welcome.SentAt) {
+		context.Source = FeedbackSourceWelcome
+	}
+
+	return context, nil
+}
@@ -0,0 +1,212 @@
+// Copyright (c) 2019-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetFeedbackContext(t *testing.T) {
+	userID := model.NewId()
+	scorePostID := model.NewId()
+	welcomePostID := model.NewId()
+	sentAt := toDate(2019, time.May, 10)
+
+	t.Run("should attribute a reply in the survey's thread to the survey and its score", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, userID)).Return(mustMarshalJSON(&userSurveyState{
+			SurveyID:      "2019-Q2",
+			ServerVersion: "5.10.0",
+			ScorePostID:   scorePostID,
+		}), nil)
+		api.On("KVGet", fmt.Sprintf(ScoreResponseKey, "2019-Q2", userID)).Return(mustMarshalJSON(&scoreResponse{
+			SurveyID: "2019-Q2",
+			Kind:     QuestionTypeNPS,
+			Score:    7,
+		}), nil)
+		defer api.AssertExpectations(t)
+
+		p := Plugin{}
+		p.SetAPI(api)
+
+		context, err := p.getFeedbackContext(&model.Post{
+			UserId:   userID,
+			RootId:   scorePostID,
+			CreateAt: sentAt.Add(48 * time.Hour).UnixMilli(),
+		})
+
+		assert.Nil(t, err)
+		assert.Equal(t, &feedbackContext{
+			Source:        FeedbackSourceNPS,
+			RootID:        scorePostID,
+			SurveyID:      "2019-Q2",
+			ServerVersion: "5.10.0",
+			ScorePostID:   scorePostID,
+			Kind:          QuestionTypeNPS,
+			Score:         model.NewInt(7),
+			Segment:       NPSSegmentPassive,
+		}, context)
+	})
+
+	t.Run("should attribute a reply in the survey's thread to the survey before it's scored", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, userID)).Return(mustMarshalJSON(&userSurveyState{
+			ServerVersion: "5.10.0",
+			ScorePostID:   scorePostID,
+		}), nil)
+		api.On("KVGet", fmt.Sprintf(ScoreResponseKey, "5.10.0", userID)).Return(nil, nil)
+		defer api.AssertExpectations(t)
+
+		p := Plugin{}
+		p.SetAPI(api)
+
+		context, err := p.getFeedbackContext(&model.Post{
+			UserId: userID,
+			RootId: scorePostID,
+		})
+
+		assert.Nil(t, err)
+		assert.Equal(t, &feedbackContext{
+			Source:        FeedbackSourceNPS,
+			RootID:        scorePostID,
+			SurveyID:      "5.10.0",
+			ServerVersion: "5.10.0",
+			ScorePostID:   scorePostID,
+		}, context)
+	})
+
+	t.Run("should attribute a reply to a question's follow-up to the question", func(t *testing.T) {
+		followUpPostID := model.NewId()
+
+		api := makeAPIMock()
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, userID)).Return(mustMarshalJSON(&userSurveyState{
+			SurveyID:      "2019-Q2",
+			ServerVersion: "5.10.0",
+			AnsweredAt:    sentAt,
+			AnswerFollowUps: map[string]*answerFollowUp{
+				"search": {PostID: followUpPostID, SentAt: sentAt},
+			},
+		}), nil)
+		defer api.AssertExpectations(t)
+
+		p := Plugin{}
+		p.SetAPI(api)
+
+		context, err := p.getFeedbackContext(&model.Post{
+			UserId:   userID,
+			RootId:   followUpPostID,
+			CreateAt: sentAt.Add(48 * time.Hour).UnixMilli(),
+		})
+
+		assert.Nil(t, err)
+		assert.Equal(t, &feedbackContext{
+			Source:        FeedbackSourceNPS,
+			RootID:        followUpPostID,
+			SurveyID:      "2019-Q2",
+			ServerVersion: "5.10.0",
+			QuestionID:    "search",
+		}, context)
+	})
+
+	t.Run("should not attach the score to feedback for anonymous surveys", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, userID)).Return(mustMarshalJSON(&userSurveyState{
+			SurveyID:      "2019-Q2",
+			ServerVersion: "5.10.0",
+			ScorePostID:   scorePostID,
+		}), nil)
+		defer api.AssertExpectations(t)
+
+		p := Plugin{
+			configuration: &configuration{
+				EnableAnonymousSurveys: true,
+			},
+		}
+		p.SetAPI(api)
+
+		context, err := p.getFeedbackContext(&model.Post{
+			UserId: userID,
+			RootId: scorePostID,
+		})
+
+		assert.Nil(t, err)
+		assert.Equal(t, &feedbackContext{
+			Source:        FeedbackSourceNPS,
+			RootID:        scorePostID,
+			SurveyID:      "2019-Q2",
+			ServerVersion: "5.10.0",
+			ScorePostID:   scorePostID,
+		}, context)
+	})
+
+	t.Run("should attribute a message sent soon after the welcome message to it", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, userID)).Return(nil, nil)
+		api.On("KVGet", fmt.Sprintf(WelcomeFeedbackPostKey, userID)).Return(mustMarshalJSON(&welcomeFeedbackPost{
+			PostID: welcomePostID,
+			SentAt: sentAt,
+		}), nil)
+		defer api.AssertExpectations(t)
+
+		p := Plugin{}
+		p.SetAPI(api)
+
+		context, err := p.getFeedbackContext(&model.Post{
+			UserId:   userID,
+			CreateAt: sentAt.Add(time.Hour).UnixMilli(),
+		})
+
+		assert.Nil(t, err)
+		assert.Equal(t, &feedbackContext{
+			Source: FeedbackSourceWelcome,
+		}, context)
+	})
+
+	t.Run("should treat anything else as unsolicited", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, userID)).Return(mustMarshalJSON(&userSurveyState{
+			ServerVersion: "5.10.0",
+			ScorePostID:   scorePostID,
+		}), nil)
+		api.On("KVGet", fmt.Sprintf(WelcomeFeedbackPostKey, userID)).Return(mustMarshalJSON(&welcomeFeedbackPost{
+			PostID: welcomePostID,
+			SentAt: sentAt,
+		}), nil)
+		defer api.AssertExpectations(t)
+
+		p := Plugin{}
+		p.SetAPI(api)
+
+		context, err := p.getFeedbackContext(&model.Post{
+			UserId:   userID,
+			CreateAt: sentAt.Add(FollowUpReplyWindow + time.Hour).UnixMilli(),
+		})
+
+		assert.Nil(t, err)
+		assert.Equal(t, &feedbackContext{
+			Source: FeedbackSourceUnsolicited,
+		}, context)
+	})
+
+	t.Run("should return an error if unable to get the user's survey state", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, userID)).Return(nil, &model.AppError{})
+		defer api.AssertExpectations(t)
+
+		p := Plugin{}
+		p.SetAPI(api)
+
+		context, err := p.getFeedbackContext(&model.Post{
+			UserId: userID,
+		})
+
+		assert.NotNil(t, err)
+		assert.Nil(t, context)
+	})
+}
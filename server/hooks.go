@@ -22,7 +22,7 @@ func (p *Plugin) ChannelHasBeenCreated(c *plugin.Context, channel *model.Channel
 }
 
 func (p *Plugin) MessageHasBeenPosted(c *plugin.Context, post *model.Post) {
-	if !p.canSendDiagnostics() {
+	if !p.canRecordEvents() {
 		return
 	}
 
@@ -65,8 +65,17 @@ func (p *Plugin) MessageHasBeenPosted(c *plugin.Context, post *model.Post) {
 			emailStr = emailVal
 		}
 	}
+	context, appErr := p.getFeedbackContext(post)
+	if appErr != nil {
+		p.API.LogWarn("Failed to get context for feedback", "err", appErr)
+	}
+
+	if appErr = p.storeFeedbackResponse(post, emailStr, context); appErr != nil {
+		p.API.LogWarn("Failed to store feedback", "err", appErr)
+	}
+
 	// Send the feedback to Segment
-	p.sendFeedback(post.Message, emailStr, post.UserId, post.CreateAt)
+	p.sendFeedback(post.Id, post.Message, emailStr, context, post.UserId, post.CreateAt)
 
 	rootID := post.RootId
 	// if it is a new post in the channel, update response RootId
@@ -75,16 +84,21 @@ func (p *Plugin) MessageHasBeenPosted(c *plugin.Context, post *model.Post) {
 	}
 
 	// Respond to the feedback which is a previous comment
-	_, appErr = p.CreateBotDMPost(post.UserId, &model.Post{
-		Message: feedbackResponseBody,
-		Type:    "custom_nps_thanks",
-		RootId:  rootID,
-	})
+	_, appErr = p.CreateBotDMPost(post.UserId, p.buildThanksPost(user, rootID, p.getConfiguration().getMessageTemplates()))
 	if appErr != nil {
 		p.API.LogError("Failed to respond to Feedbackbot feedback")
 	}
 }
 
+// buildThanksPost builds the reply thanking a user for their feedback.
+func (p *Plugin) buildThanksPost(user *model.User, rootID string, templates *messageTemplates) *model.Post {
+	return &model.Post{
+		Message: p.renderUserMessage(user, templates.ThankYou, feedbackResponseBody),
+		Type:    "custom_nps_thanks",
+		RootId:  rootID,
+	}
+}
+
 func (p *Plugin) UserHasLoggedIn(c *plugin.Context, user *model.User) {
 	if err := p.checkForDMs(user.Id); err != nil {
 		p.API.LogError("Failed to check for user notifications on login", "user_id", user.Id, "err", err)
@@ -6,6 +6,7 @@ package main
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/mattermost/mattermost/server/public/model"
 	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
@@ -57,6 +58,8 @@ func TestMessageHasBeenPosted(t *testing.T) {
 	}
 	licenseID := model.NewId()
 	skuShortName := model.NewId()
+	serverVersion := "5.10.0"
+	now := toDate(2019, time.March, 11)
 
 	t.Run("should send feedback to segment and respond to user's post on existing post", func(t *testing.T) {
 		api := &plugintest.API{}
@@ -70,6 +73,19 @@ func TestMessageHasBeenPosted(t *testing.T) {
 			Name: fmt.Sprintf("%s__%s", botUserID, userID),
 		}, nil)
 		api.On("GetUser", userID).Return(&model.User{Id: userID}, nil)
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, userID)).Return(nil, nil)
+		api.On("KVGet", fmt.Sprintf(WelcomeFeedbackPostKey, userID)).Return(nil, nil)
+		api.On("KVSet", fmt.Sprintf(FeedbackResponseKey, serverVersion, userID, ""), mustMarshalJSON(&feedbackResponse{
+			SurveyID:      serverVersion,
+			ServerVersion: serverVersion,
+			UserID:        userID,
+			Message:       "feedback",
+			CreateAt:      time.UnixMilli(0).UTC(),
+			Context: &feedbackContext{
+				Source: FeedbackSourceUnsolicited,
+				RootID: rootID,
+			},
+		})).Return(nil)
 		api.On("GetDirectChannel", userID, botUserID).Return(&model.Channel{
 			Id: botChannelID,
 		}, nil)
@@ -82,11 +98,16 @@ func TestMessageHasBeenPosted(t *testing.T) {
 			Id:           licenseID,
 			SkuShortName: skuShortName,
 		})
+		mockOutbox(api)
 		defer api.AssertExpectations(t)
 
 		p := &Plugin{
 			botUserID: botUserID,
-			tracker:   telemetry.NewTracker(nil, "", "", "", "", "", telemetry.TrackerConfig{}, nil),
+			now: func() time.Time {
+				return now
+			},
+			serverVersion: serverVersion,
+			tracker:       telemetry.NewTracker(nil, "", "", "", "", "", telemetry.TrackerConfig{}, nil),
 		}
 		p.SetAPI(api)
 
@@ -94,6 +115,7 @@ func TestMessageHasBeenPosted(t *testing.T) {
 			ChannelId: botChannelID,
 			UserId:    userID,
 			RootId:    rootID,
+			Message:   "feedback",
 		})
 	})
 
@@ -111,6 +133,9 @@ func TestMessageHasBeenPosted(t *testing.T) {
 			Name: fmt.Sprintf("%s__%s", botUserID, userID),
 		}, nil)
 		api.On("GetUser", userID).Return(&model.User{Id: userID}, nil)
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, userID)).Return(nil, nil)
+		api.On("KVGet", fmt.Sprintf(WelcomeFeedbackPostKey, userID)).Return(nil, nil)
+		api.On("KVSet", fmt.Sprintf(FeedbackResponseKey, serverVersion, userID, postID), mock.Anything).Return(nil)
 		api.On("GetDirectChannel", userID, botUserID).Return(&model.Channel{
 			Id: botChannelID,
 		}, nil)
@@ -123,11 +148,87 @@ func TestMessageHasBeenPosted(t *testing.T) {
 			Id:           licenseID,
 			SkuShortName: skuShortName,
 		})
+		mockOutbox(api)
 		defer api.AssertExpectations(t)
 
 		p := &Plugin{
 			botUserID: botUserID,
-			tracker:   telemetry.NewTracker(nil, "", "", "", "", "", telemetry.TrackerConfig{}, nil),
+			now: func() time.Time {
+				return now
+			},
+			serverVersion: serverVersion,
+			tracker:       telemetry.NewTracker(nil, "", "", "", "", "", telemetry.TrackerConfig{}, nil),
+		}
+		p.SetAPI(api)
+
+		p.MessageHasBeenPosted(nil, &model.Post{
+			Id:        postID,
+			ChannelId: botChannelID,
+			UserId:    userID,
+		})
+	})
+
+	t.Run("should link feedback to the follow-up that it replies to", func(t *testing.T) {
+		followUp := &scoreFollowUp{
+			SurveyID: serverVersion,
+			Kind:     QuestionTypeNPS,
+			Score:    3,
+			Segment:  NPSSegmentDetractor,
+			PostID:   rootID,
+			SentAt:   time.UnixMilli(0).UTC(),
+		}
+
+		api := &plugintest.API{}
+		api.On("GetConfig").Return(&model.Config{
+			LogSettings: model.LogSettings{
+				EnableDiagnostics: model.NewBool(true),
+			},
+		})
+		api.On("GetChannel", botChannelID).Return(&model.Channel{
+			Type: model.ChannelTypeDirect,
+			Name: fmt.Sprintf("%s__%s", botUserID, userID),
+		}, nil)
+		api.On("GetUser", userID).Return(&model.User{Id: userID}, nil)
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, userID)).Return(mustMarshalJSON(&userSurveyState{
+			ServerVersion: serverVersion,
+			FollowUp:      followUp,
+		}), nil)
+		api.On("KVSet", fmt.Sprintf(FeedbackResponseKey, serverVersion, userID, postID), mustMarshalJSON(&feedbackResponse{
+			SurveyID:      serverVersion,
+			ServerVersion: serverVersion,
+			UserID:        userID,
+			PostID:        postID,
+			Message:       "Search is slow",
+			CreateAt:      time.UnixMilli(1000).UTC(),
+			Context: &feedbackContext{
+				Source:        FeedbackSourceNPS,
+				SurveyID:      serverVersion,
+				ServerVersion: serverVersion,
+				Kind:          QuestionTypeNPS,
+				Score:         model.NewInt(3),
+				Segment:       NPSSegmentDetractor,
+			},
+		})).Return(nil)
+		api.On("GetDirectChannel", userID, botUserID).Return(&model.Channel{
+			Id: botChannelID,
+		}, nil)
+		api.On("CreatePost", mock.Anything).Return(nil, nil)
+		api.On("GetSystemInstallDate").Return(systemInstallDate, nil)
+		api.On("GetTeamMembersForUser", userID, 0, 50).Return(teamMembers, nil)
+		api.On("GetLicense").Return(&model.License{
+			Id:           licenseID,
+			SkuShortName: skuShortName,
+		})
+		mockOutbox(api)
+		defer api.AssertExpectations(t)
+
+		p := &Plugin{
+			botUserID: botUserID,
+			now: func() time.Time {
+				return now
+			},
+			serverVersion: serverVersion,
+			tracker:       telemetry.NewTracker(nil, "", "", "", "", "", telemetry.TrackerConfig{}, nil),
 		}
 		p.SetAPI(api)
 
@@ -135,6 +236,8 @@ func TestMessageHasBeenPosted(t *testing.T) {
 			Id:        postID,
 			ChannelId: botChannelID,
 			UserId:    userID,
+			Message:   "Search is slow",
+			CreateAt:  1000,
 		})
 	})
 
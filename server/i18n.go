@@ -0,0 +1,116 @@
+// Copyright (c) 2019-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultLocale is the locale of the text compiled into the plugin. It's used when no translation is available for
+// the recipient's locale.
+const DefaultLocale = "en"
+
+// SupportedLocales are the locales that translation bundles are shipped for in assets/i18n, in addition to
+// DefaultLocale.
+var SupportedLocales = []string{"de", "es", "fr"}
+
+// i18nMessage is text sent to users that is translated into their language when possible. Other is the English text
+// used when no translation is available, and it may contain fmt verbs that translations must also contain.
+type i18nMessage struct {
+	ID    string
+	Other string
+}
+
+// translation is a single entry of a translation bundle. Bundles use the same format as the Mattermost server.
+type translation struct {
+	ID          string `json:"id"`
+	Translation string `json:"translation"`
+}
+
+// loadTranslations reads the translation bundle of every supported locale from the plugin bundle. Missing or invalid
+// bundles are skipped so that users of those locales receive English text instead.
+func (p *Plugin) loadTranslations() error {
+	bundlePath, err := p.API.GetBundlePath()
+	if err != nil {
+		return errors.Wrap(err, "failed to get bundle path")
+	}
+
+	translations := map[string]map[string]string{}
+	for _, locale := range SupportedLocales {
+		data, err := p.readFile(filepath.Join(bundlePath, "assets", "i18n", locale+".json"))
+		if err != nil {
+			p.API.LogWarn("Failed to read translations", "locale", locale, "err", err.Error())
+			continue
+		}
+
+		var entries []*translation
+		if err := json.Unmarshal(data, &entries); err != nil {
+			p.API.LogWarn("Failed to parse translations", "locale", locale, "err", err.Error())
+			continue
+		}
+
+		translations[locale] = make(map[string]string, len(entries))
+		for _, entry := range entries {
+			if entry.Translation != "" {
+				translations[locale][entry.ID] = entry.Translation
+			}
+		}
+	}
+
+	p.translations = translations
+
+	return nil
+}
+
+// getTranslations returns the translations for the given locale, falling back to those for its language when there
+// aren't any for its region, such as from "pt-BR" to "pt". Returns nil when the locale isn't supported.
+func (p *Plugin) getTranslations(locale string) map[string]string {
+	locale = strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+
+	if translations, ok := p.translations[locale]; ok {
+		return translations
+	}
+
+	if i := strings.Index(locale, "-"); i != -1 {
+		return p.translations[locale[:i]]
+	}
+
+	return nil
+}
+
+// translate returns the message in the given locale, formatted with the given arguments.
+func (p *Plugin) translate(locale string, message *i18nMessage, args ...interface{}) string {
+	text := message.Other
+	if translated, ok := p.getTranslations(locale)[message.ID]; ok {
+		text = translated
+	}
+
+	if len(args) == 0 {
+		return text
+	}
+
+	return fmt.Sprintf(text, args...)
+}
+
+// formatDate returns the date in the given locale, such as "January 2, 2006" in English.
+func (p *Plugin) formatDate(locale string, date time.Time) string {
+	return p.translate(locale, dateFormat, p.translate(locale, monthNames[date.Month()-1]), date.Day(), date.Year())
+}
+
+// getServerLocale returns the default locale of the server, which is used for messages that aren't sent to a single
+// user, such as emails.
+func (p *Plugin) getServerLocale() string {
+	config := p.API.GetConfig()
+	if config.LocalizationSettings.DefaultServerLocale == nil {
+		return DefaultLocale
+	}
+
+	return *config.LocalizationSettings.DefaultServerLocale
+}
@@ -0,0 +1,207 @@
+// Copyright (c) 2019-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// translatedMessages are all of the messages that translation bundles may contain.
+var translatedMessages = append([]*i18nMessage{
+	adminEmailSubject,
+	adminEmailTitle,
+	adminEmailIntro,
+	adminEmailDisable,
+	adminEmailOrganization,
+	adminDMBody,
+	surveyBody,
+	surveyDropdownTitle,
+	npsMinLabel,
+	npsMaxLabel,
+	csatQuestionText,
+	csatMinLabel,
+	csatMaxLabel,
+	cesQuestionText,
+	cesMinLabel,
+	cesMaxLabel,
+	surveyAnsweredBody,
+	surveyQuestionAnsweredBody,
+	surveyAnsweredAnonymouslyBody,
+	surveyReminderBody,
+	welcomeFeedbackRequestBody,
+	feedbackResponseBody,
+	feedbackRequestBody,
+	thanksFeedbackRequestBody,
+	detractorFeedbackRequestBody,
+	passiveFeedbackRequestBody,
+	promoterFeedbackRequestBody,
+	surveyExpiredBody,
+	dateFormat,
+	surveyEmailSubject,
+	surveyEmailBody,
+}, monthNames...)
+
+func TestTranslationBundles(t *testing.T) {
+	api := makeAPIMock()
+	api.On("GetBundlePath").Return("..", nil)
+	defer api.AssertExpectations(t)
+
+	p := &Plugin{readFile: os.ReadFile}
+	p.SetAPI(api)
+
+	require.NoError(t, p.loadTranslations())
+
+	verbs := regexp.MustCompile(`%[a-z]`)
+
+	for _, locale := range SupportedLocales {
+		t.Run(locale, func(t *testing.T) {
+			translations := p.translations[locale]
+			require.NotNil(t, translations)
+
+			for _, message := range translatedMessages {
+				translated, ok := translations[message.ID]
+				if assert.True(t, ok, "missing translation for %s", message.ID) {
+					assert.Equal(t, verbs.FindAllString(message.Other, -1), verbs.FindAllString(translated, -1), "arguments of %s don't match", message.ID)
+				}
+			}
+
+			assert.Len(t, translations, len(translatedMessages), "bundle contains unknown messages")
+		})
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	message := &i18nMessage{ID: "greeting", Other: "Hello @%s!"}
+
+	p := &Plugin{
+		translations: map[string]map[string]string{
+			"de":    {"greeting": "Hallo @%s!"},
+			"pt":    {"greeting": "Olá @%s!"},
+			"pt-br": {},
+		},
+	}
+
+	for _, test := range []struct {
+		Locale   string
+		Expected string
+	}{
+		{Locale: "de", Expected: "Hallo @user!"},
+		{Locale: "en", Expected: "Hello @user!"},
+		{Locale: "", Expected: "Hello @user!"},
+		{Locale: "ja", Expected: "Hello @user!"},
+		{Locale: "pt-PT", Expected: "Olá @user!"},
+		{Locale: "pt_PT", Expected: "Olá @user!"},
+		{Locale: "pt-BR", Expected: "Hello @user!"},
+	} {
+		t.Run(test.Locale, func(t *testing.T) {
+			assert.Equal(t, test.Expected, p.translate(test.Locale, message, "user"))
+		})
+	}
+
+	t.Run("should not format messages without arguments", func(t *testing.T) {
+		assert.Equal(t, "100%", p.translate("en", &i18nMessage{ID: "percent", Other: "100%"}))
+	})
+}
+
+func TestFormatDate(t *testing.T) {
+	date := time.Date(2019, time.March, 5, 0, 0, 0, 0, time.UTC)
+
+	p := &Plugin{
+		translations: map[string]map[string]string{
+			"de": {dateFormat.ID: "%[2]d. %[1]s %[3]d", "date.month.march": "März"},
+		},
+	}
+
+	assert.Equal(t, "March 5, 2019", p.formatDate("en", date))
+	assert.Equal(t, "5. März 2019", p.formatDate("de", date))
+}
+
+func TestLoadTranslations(t *testing.T) {
+	t.Run("should skip bundles that can't be loaded", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("GetBundlePath").Return("/foo/bar", nil)
+		api.On("LogWarn", "Failed to read translations", "locale", "de", "err", mock.Anything)
+		api.On("LogWarn", "Failed to parse translations", "locale", "es", "err", mock.Anything)
+		defer api.AssertExpectations(t)
+
+		p := &Plugin{
+			readFile: func(path string) ([]byte, error) {
+				switch path {
+				case filepath.Join("/foo/bar", "assets", "i18n", "de.json"):
+					return nil, os.ErrNotExist
+				case filepath.Join("/foo/bar", "assets", "i18n", "es.json"):
+					return []byte("{"), nil
+				default:
+					return []byte(`[{"id": "survey.body", "translation": "Bonjour"}, {"id": "survey.reminder", "translation": ""}]`), nil
+				}
+			},
+		}
+		p.SetAPI(api)
+
+		err := p.loadTranslations()
+
+		require.NoError(t, err)
+		assert.Equal(t, map[string]map[string]string{
+			"fr": {"survey.body": "Bonjour"},
+		}, p.translations)
+	})
+
+	t.Run("should return an error if unable to find the bundle", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("GetBundlePath").Return("", errors.New("not found"))
+		defer api.AssertExpectations(t)
+
+		p := &Plugin{}
+		p.SetAPI(api)
+
+		err := p.loadTranslations()
+
+		assert.Error(t, err)
+	})
+}
+
+func TestBuildQuestionPostTranslated(t *testing.T) {
+	p := &Plugin{
+		translations: map[string]map[string]string{
+			"fr": {
+				"survey.body":           "Bonjour @%s !",
+				"survey.nps.question":   "Recommanderiez-vous Mattermost ?",
+				"survey.nps.min_label":  "Peu probable",
+				"survey.nps.max_label":  "Très probable",
+				"survey.csat.question":  "Êtes-vous satisfait ?",
+				"survey.csat.min_label": "Très insatisfait",
+			},
+		},
+	}
+	user := &model.User{Id: model.NewId(), Username: "user", Locale: "fr"}
+
+	t.Run("should translate the default question", func(t *testing.T) {
+		post := p.buildQuestionPost(user, defaultNPSQuestion(), true)
+
+		assert.Equal(t, "Bonjour @user !", post.Message)
+		assert.Equal(t, "Peu probable", post.GetProp("min_label"))
+		assert.Equal(t, "Très probable", post.GetProp("max_label"))
+
+		attachments := post.Attachments()
+		assert.Equal(t, "Recommanderiez-vous Mattermost ?", attachments[0].Title)
+		assert.Equal(t, "10 (Très probable)", attachments[0].Actions[0].Options[0].Text)
+	})
+
+	t.Run("should not translate questions written by admins", func(t *testing.T) {
+		post := p.buildQuestionPost(user, &surveyQuestion{ID: "csat", Type: QuestionTypeCSAT, Text: "How satisfied are you with search?"}, false)
+
+		assert.Equal(t, "How satisfied are you with search?", post.Attachments()[0].Title)
+		assert.Equal(t, "Très insatisfait", post.GetProp("min_label"))
+	})
+}
@@ -0,0 +1,198 @@
+// Copyright (c) 2019-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+const (
+	// JobInterval is the minimum time between two runs of the background job across all instances of the plugin.
+	JobInterval = time.Hour
+
+	// JobCheckInterval is how often each instance of the plugin checks whether the background job is due to run.
+	JobCheckInterval = 5 * time.Minute
+
+	// JobUsersPerPage is the number of users that the background job loads at once.
+	JobUsersPerPage = 100
+
+	// OutboxWorkerQueueSize is the number of newly queued events that can wait to be sent by the outbox worker. Events
+	// queued while it's full are sent by processOutbox instead.
+	OutboxWorkerQueueSize = 100
+)
+
+// startBackgroundJob periodically runs the background job and retries queued events until stopBackgroundJob is called.
+// Every instance of the plugin starts the job, but runBackgroundJob and processOutbox ensure that only one of them does
+// each at a time. It also starts the worker that makes the first attempt to send each event queued on this instance.
+func (p *Plugin) startBackgroundJob() {
+	stop := make(chan struct{})
+	p.backgroundJobStop = stop
+
+	events := make(chan *outboxEvent, OutboxWorkerQueueSize)
+	p.outboxEvents = events
+
+	go func() {
+		for {
+			select {
+			case event := <-events:
+				if err := p.deliverOutboxEvent(event, p.now().UTC()); err != nil {
+					p.API.LogError("Failed to send telemetry event", "event_id", event.ID, "err", err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	go func() {
+		ticker := time.NewTicker(JobCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				now := p.now().UTC()
+
+				p.runBackgroundJob(now)
+
+				if err := p.processOutbox(now); err != nil {
+					p.API.LogError("Failed to process telemetry outbox", "err", err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+func (p *Plugin) stopBackgroundJob() {
+	if p.backgroundJobStop != nil {
+		close(p.backgroundJobStop)
+		p.backgroundJobStop = nil
+	}
+}
+
+// runBackgroundJob schedules surveys that are due and sends any pending DMs to users who are currently online. This
+// covers users who stay logged in for a long time and would otherwise only receive DMs when they next log in. Returns
+// whether or not the job ran.
+func (p *Plugin) runBackgroundJob(now time.Time) bool {
+	if !p.canRecordEvents() {
+		return false
+	}
+
+	locked, err := p.tryLock(JobLockKey, now)
+	if err != nil {
+		p.API.LogError("Failed to lock background job", "err", err)
+		return false
+	}
+	if !locked {
+		// Another instance of the plugin is already running the job
+		return false
+	}
+	defer func() {
+		_ = p.unlock(JobLockKey)
+	}()
+
+	var lastRunAt *time.Time
+	if err = p.KVGet(LastJobRunKey, &lastRunAt); err != nil {
+		p.API.LogError("Failed to get last background job run", "err", err)
+		return false
+	}
+
+	if lastRunAt != nil && now.Sub(*lastRunAt) < JobInterval {
+		// Another instance of the plugin ran the job recently
+		return false
+	}
+
+	// Store the run before doing any work so that a failure part way through doesn't cause the job to be retried
+	// immediately by another instance
+	if err = p.KVSet(LastJobRunKey, now); err != nil {
+		p.API.LogError("Failed to save background job run", "err", err)
+		return false
+	}
+
+	p.API.LogDebug("Running background job")
+
+	p.checkForScheduledSurvey(now)
+
+	if err = p.closeEndedSurveys(now); err != nil {
+		p.API.LogError("Failed to close ended surveys", "err", err)
+	}
+
+	if err = p.sendPendingDMsToOnlineUsers(now, JobUsersPerPage); err != nil {
+		p.API.LogError("Failed to send pending DMs to online users", "err", err)
+	}
+
+	return true
+}
+
+// sendPendingDMsToOnlineUsers calls sendPendingDMs for every active user who isn't offline. Users who are offline
+// will instead receive their DMs when they next log in.
+func (p *Plugin) sendPendingDMsToOnlineUsers(now time.Time, perPage int) *model.AppError {
+	for page := 0; ; page++ {
+		users, err := p.API.GetUsers(&model.UserGetOptions{
+			Active:  true,
+			Page:    page,
+			PerPage: perPage,
+		})
+		if err != nil {
+			return err
+		}
+
+		usersByID := make(map[string]*model.User, len(users))
+		userIDs := make([]string, 0, len(users))
+		for _, user := range users {
+			if user.IsBot {
+				continue
+			}
+
+			usersByID[user.Id] = user
+			userIDs = append(userIDs, user.Id)
+		}
+
+		if len(userIDs) > 0 {
+			statuses, appErr := p.API.GetUserStatusesByIds(userIDs)
+			if appErr != nil {
+				return appErr
+			}
+
+			for _, status := range statuses {
+				user, ok := usersByID[status.UserId]
+				if !ok || status.Status == model.StatusOffline {
+					continue
+				}
+
+				p.sendPendingDMsWithLock(user, now)
+			}
+		}
+
+		if len(users) < perPage {
+			return nil
+		}
+	}
+}
+
+// sendPendingDMsWithLock calls sendPendingDMs while holding the user's lock so that the user doesn't receive
+// duplicate DMs if they log in while the background job is running.
+func (p *Plugin) sendPendingDMsWithLock(user *model.User, now time.Time) {
+	userLockKey := fmt.Sprintf(UserLockKey, user.Id)
+
+	locked, err := p.tryLock(userLockKey, now)
+	if err != nil {
+		p.API.LogError("Failed to lock user", "user_id", user.Id, "err", err)
+		return
+	}
+	if !locked {
+		// The user's DMs are already being checked elsewhere
+		return
+	}
+	defer func() {
+		_ = p.unlock(userLockKey)
+	}()
+
+	p.sendPendingDMs(user, now)
+}
@@ -0,0 +1,189 @@
+// Copyright (c) 2019-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestRunBackgroundJob(t *testing.T) {
+	now := toDate(2019, time.May, 10)
+
+	makeAPIMockWithDiagnostics := func(enableDiagnostics bool) *plugintest.API {
+		api := makeAPIMock()
+		api.On("GetConfig").Return(&model.Config{
+			LogSettings: model.LogSettings{
+				EnableDiagnostics: model.NewBool(enableDiagnostics),
+			},
+		})
+
+		return api
+	}
+
+	t.Run("should do nothing when diagnostics are disabled", func(t *testing.T) {
+		api := makeAPIMockWithDiagnostics(false)
+		defer api.AssertExpectations(t)
+
+		p := &Plugin{}
+		p.SetAPI(api)
+
+		result := p.runBackgroundJob(now)
+
+		assert.False(t, result)
+	})
+
+	t.Run("should do nothing when another instance is running the job", func(t *testing.T) {
+		api := makeAPIMockWithDiagnostics(true)
+		api.On("KVCompareAndSet", JobLockKey, []byte(nil), mustMarshalJSON(now)).Return(false, nil)
+		defer api.AssertExpectations(t)
+
+		p := &Plugin{}
+		p.SetAPI(api)
+
+		result := p.runBackgroundJob(now)
+
+		assert.False(t, result)
+	})
+
+	t.Run("should do nothing when the job ran recently", func(t *testing.T) {
+		api := makeAPIMockWithDiagnostics(true)
+		api.On("KVCompareAndSet", JobLockKey, []byte(nil), mustMarshalJSON(now)).Return(true, nil)
+		api.On("KVGet", LastJobRunKey).Return(mustMarshalJSON(now.Add(-30*time.Minute)), nil)
+		api.On("KVDelete", JobLockKey).Return(nil)
+		defer api.AssertExpectations(t)
+
+		p := &Plugin{}
+		p.SetAPI(api)
+
+		result := p.runBackgroundJob(now)
+
+		assert.False(t, result)
+	})
+
+	t.Run("should send pending DMs to online users", func(t *testing.T) {
+		onlineUserID := model.NewId()
+		offlineUserID := model.NewId()
+		botUserID := model.NewId()
+
+		api := makeAPIMockWithDiagnostics(true)
+		api.On("KVCompareAndSet", JobLockKey, []byte(nil), mustMarshalJSON(now)).Return(true, nil)
+		api.On("KVGet", LastJobRunKey).Return(mustMarshalJSON(now.Add(-2*time.Hour)), nil)
+		api.On("KVSet", LastJobRunKey, mustMarshalJSON(now)).Return(nil)
+		api.On("LogDebug", "Running background job")
+		api.On("KVList", 0, 100).Return([]string{}, nil)
+		api.On("GetUsers", &model.UserGetOptions{Active: true, Page: 0, PerPage: JobUsersPerPage}).Return([]*model.User{
+			{Id: onlineUserID},
+			{Id: offlineUserID},
+			{Id: botUserID, IsBot: true},
+		}, nil)
+		api.On("GetUserStatusesByIds", []string{onlineUserID, offlineUserID}).Return([]*model.Status{
+			{UserId: onlineUserID, Status: model.StatusAway},
+			{UserId: offlineUserID, Status: model.StatusOffline},
+		}, nil)
+		api.On("KVCompareAndSet", fmt.Sprintf(UserLockKey, onlineUserID), []byte(nil), mustMarshalJSON(now)).Return(true, nil)
+		api.On("KVDelete", fmt.Sprintf(UserLockKey, onlineUserID)).Return(nil)
+		api.On("KVDelete", JobLockKey).Return(nil)
+		defer api.AssertExpectations(t)
+
+		p := &Plugin{
+			configuration: &configuration{
+				EnableSurvey: false,
+			},
+		}
+		p.SetAPI(api)
+
+		result := p.runBackgroundJob(now)
+
+		assert.True(t, result)
+	})
+
+	t.Run("should run the job for the first time", func(t *testing.T) {
+		api := makeAPIMockWithDiagnostics(true)
+		api.On("KVCompareAndSet", JobLockKey, []byte(nil), mustMarshalJSON(now)).Return(true, nil)
+		api.On("KVGet", LastJobRunKey).Return(nil, nil)
+		api.On("KVSet", LastJobRunKey, mustMarshalJSON(now)).Return(nil)
+		api.On("LogDebug", "Running background job")
+		api.On("KVList", 0, 100).Return([]string{}, nil)
+		api.On("GetUsers", mock.Anything).Return([]*model.User{}, nil)
+		api.On("KVDelete", JobLockKey).Return(nil)
+		defer api.AssertExpectations(t)
+
+		p := &Plugin{}
+		p.SetAPI(api)
+
+		result := p.runBackgroundJob(now)
+
+		assert.True(t, result)
+	})
+}
+
+func TestSendPendingDMsToOnlineUsers(t *testing.T) {
+	now := toDate(2019, time.May, 10)
+
+	t.Run("should load every page of users", func(t *testing.T) {
+		userIDs := []string{model.NewId(), model.NewId(), model.NewId()}
+
+		api := makeAPIMock()
+		api.On("GetUsers", &model.UserGetOptions{Active: true, Page: 0, PerPage: 2}).Return([]*model.User{
+			{Id: userIDs[0]},
+			{Id: userIDs[1]},
+		}, nil)
+		api.On("GetUsers", &model.UserGetOptions{Active: true, Page: 1, PerPage: 2}).Return([]*model.User{
+			{Id: userIDs[2]},
+		}, nil)
+		api.On("GetUserStatusesByIds", userIDs[:2]).Return([]*model.Status{}, nil)
+		api.On("GetUserStatusesByIds", userIDs[2:]).Return([]*model.Status{
+			{UserId: userIDs[2], Status: model.StatusOnline},
+		}, nil)
+		api.On("KVCompareAndSet", fmt.Sprintf(UserLockKey, userIDs[2]), []byte(nil), mustMarshalJSON(now)).Return(true, nil)
+		api.On("KVDelete", fmt.Sprintf(UserLockKey, userIDs[2])).Return(nil)
+		defer api.AssertExpectations(t)
+
+		p := &Plugin{}
+		p.SetAPI(api)
+
+		err := p.sendPendingDMsToOnlineUsers(now, 2)
+
+		assert.Nil(t, err)
+	})
+
+	t.Run("should skip users whose DMs are already being checked", func(t *testing.T) {
+		userID := model.NewId()
+
+		api := makeAPIMock()
+		api.On("GetUsers", mock.Anything).Return([]*model.User{{Id: userID}}, nil)
+		api.On("GetUserStatusesByIds", []string{userID}).Return([]*model.Status{
+			{UserId: userID, Status: model.StatusDnd},
+		}, nil)
+		api.On("KVCompareAndSet", fmt.Sprintf(UserLockKey, userID), []byte(nil), mustMarshalJSON(now)).Return(false, nil)
+		defer api.AssertExpectations(t)
+
+		p := &Plugin{}
+		p.SetAPI(api)
+
+		err := p.sendPendingDMsToOnlineUsers(now, 2)
+
+		assert.Nil(t, err)
+	})
+
+	t.Run("should return an error if unable to get users", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("GetUsers", mock.Anything).Return(nil, &model.AppError{})
+		defer api.AssertExpectations(t)
+
+		p := &Plugin{}
+		p.SetAPI(api)
+
+		err := p.sendPendingDMsToOnlineUsers(now, 2)
+
+		assert.NotNil(t, err)
+	})
+}
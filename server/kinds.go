@@ -0,0 +1,143 @@
+// Copyright (c) 2019-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// QuestionTypeCSAT is the 1-5 Customer Satisfaction question.
+	QuestionTypeCSAT = "csat"
+
+	// QuestionTypeCES is the 1-7 Customer Effort Score question.
+	QuestionTypeCES = "ces"
+
+	// CSATQuestionID and CESQuestionID are the IDs of the CSAT and CES questions.
+	CSATQuestionID = "csat"
+	CESQuestionID  = "ces"
+
+	// The lowest CSAT score that counts as a satisfied user
+	csatSatisfiedScore = 4
+)
+
+// surveyKind describes a scored question like NPS, CSAT or CES. Scored questions are rendered by the web app plugin,
+// answered using the score endpoint, and stored as a scoreResponse.
+type surveyKind struct {
+	// PostType is the type of the post asking the question, which the web app plugin uses to render it.
+	PostType string
+
+	// EventName is the name of the telemetry event sent when the question is answered.
+	EventName string
+
+	// Min and Max are the range of valid scores. MinLabel and MaxLabel describe them.
+	Min      int
+	Max      int
+	MinLabel *i18nMessage
+	MaxLabel *i18nMessage
+
+	// DefaultText is the question asked when the survey definition doesn't specify one.
+	DefaultText *i18nMessage
+
+	// Aggregate computes the overall score shown in reports from the scores given to a survey. The NPS is computed
+	// separately by npsReport since it also breaks down promoters, passives and detractors.
+	Aggregate func(summary *scoreSummary) float64
+}
+
+var surveyKinds = map[string]*surveyKind{
+	QuestionTypeNPS: {
+		PostType:    "custom_nps_survey",
+		EventName:   NpsScore,
+		Min:         0,
+		Max:         10,
+		MinLabel:    npsMinLabel,
+		MaxLabel:    npsMaxLabel,
+		DefaultText: surveyDropdownTitle,
+	},
+	QuestionTypeCSAT: {
+		PostType:    "custom_csat_survey",
+		EventName:   CsatScore,
+		Min:         1,
+		Max:         5,
+		MinLabel:    csatMinLabel,
+		MaxLabel:    csatMaxLabel,
+		DefaultText: csatQuestionText,
+		Aggregate: func(summary *scoreSummary) float64 {
+			// The percentage of users who are satisfied
+			return float64(summary.satisfied) * 100 / float64(summary.Responses)
+		},
+	},
+	QuestionTypeCES: {
+		PostType:    "custom_ces_survey",
+		EventName:   CesScore,
+		Min:         1,
+		Max:         7,
+		MinLabel:    cesMinLabel,
+		MaxLabel:    cesMaxLabel,
+		DefaultText: cesQuestionText,
+		Aggregate: func(summary *scoreSummary) float64 {
+			// The average score
+			return float64(summary.sum) / float64(summary.Responses)
+		},
+	},
+}
+
+// getSurveyKind returns the kind of a scored question or nil if the question isn't scored.
+func getSurveyKind(questionType string) *surveyKind {
+	return surveyKinds[questionType]
+}
+
+// getScore parses the score selected by a user and returns an error if it's not in the range allowed by the kind.
+func getScore(kind *surveyKind, selectedOption string) (int64, error) {
+	score, err := strconv.ParseInt(selectedOption, 10, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	if score < int64(kind.Min) || score > int64(kind.Max) {
+		return 0, errors.New("score out of range")
+	}
+
+	return score, nil
+}
+
+// scoreSummary summarizes the scores given to a CSAT or CES question during a single survey.
+type scoreSummary struct {
+	Responses int `json:"responses"`
+
+	// Score is the result of the kind's Aggregate function, such as the percentage of satisfied users for CSAT or the
+	// average score for CES.
+	Score float64 `json:"score"`
+
+	sum       int
+	satisfied int
+}
+
+func (s *scoreSummary) addScore(score int) {
+	s.Responses++
+	s.sum += score
+
+	if score >= csatSatisfiedScore {
+		s.satisfied++
+	}
+}
+
+func (s *scoreSummary) computeTotals(kind *surveyKind) {
+	if s.Responses > 0 && kind.Aggregate != nil {
+		s.Score = kind.Aggregate(s)
+	}
+}
+
+// getScoreResponseKey returns the key used to store a user's score for the given kind of question. NPS scores don't
+// include the kind in their key since they were stored before other kinds existed.
+func getScoreResponseKey(questionType, surveyID, userID string) string {
+	if questionType == QuestionTypeNPS {
+		return fmt.Sprintf(ScoreResponseKey, surveyID, userID)
+	}
+
+	return fmt.Sprintf(KindScoreResponseKey, surveyID, questionType, userID)
+}
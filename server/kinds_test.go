@@ -0,0 +1,148 @@
+// Copyright (c) 2019-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetScore(t *testing.T) {
+	for _, test := range []struct {
+		Name           string
+		Kind           string
+		SelectedOption string
+		ExpectedScore  int64
+		ExpectError    bool
+	}{
+		{
+			Name:           "a number",
+			Kind:           QuestionTypeNPS,
+			SelectedOption: "7",
+			ExpectedScore:  7,
+		},
+		{
+			Name:           "zero",
+			Kind:           QuestionTypeNPS,
+			SelectedOption: "0",
+			ExpectedScore:  0,
+		},
+		{
+			Name:           "ten",
+			Kind:           QuestionTypeNPS,
+			SelectedOption: "10",
+			ExpectedScore:  10,
+		},
+		{
+			Name:           "too low",
+			Kind:           QuestionTypeNPS,
+			SelectedOption: "-400",
+			ExpectError:    true,
+		},
+		{
+			Name:           "too high",
+			Kind:           QuestionTypeNPS,
+			SelectedOption: "1000000",
+			ExpectError:    true,
+		},
+		{
+			Name:           "garbage",
+			Kind:           QuestionTypeNPS,
+			SelectedOption: "garbage",
+			ExpectError:    true,
+		},
+		{
+			Name:           "empty",
+			Kind:           QuestionTypeNPS,
+			SelectedOption: "",
+			ExpectError:    true,
+		},
+		{
+			Name:           "CSAT",
+			Kind:           QuestionTypeCSAT,
+			SelectedOption: "5",
+			ExpectedScore:  5,
+		},
+		{
+			Name:           "CSAT zero",
+			Kind:           QuestionTypeCSAT,
+			SelectedOption: "0",
+			ExpectError:    true,
+		},
+		{
+			Name:           "CSAT too high",
+			Kind:           QuestionTypeCSAT,
+			SelectedOption: "6",
+			ExpectError:    true,
+		},
+		{
+			Name:           "CES",
+			Kind:           QuestionTypeCES,
+			SelectedOption: "7",
+			ExpectedScore:  7,
+		},
+		{
+			Name:           "CES too high",
+			Kind:           QuestionTypeCES,
+			SelectedOption: "8",
+			ExpectError:    true,
+		},
+	} {
+		t.Run(test.Name, func(t *testing.T) {
+			score, err := getScore(getSurveyKind(test.Kind), test.SelectedOption)
+
+			assert.Equal(t, test.ExpectedScore, score)
+			if test.ExpectError {
+				assert.NotNil(t, err)
+			} else {
+				assert.Nil(t, err)
+			}
+		})
+	}
+}
+
+func TestGetScoreResponseKey(t *testing.T) {
+	assert.Equal(t, "Score-2019-Q2-user1", getScoreResponseKey(QuestionTypeNPS, "2019-Q2", "user1"))
+	assert.Equal(t, "Score-2019-Q2-csat-user1", getScoreResponseKey(QuestionTypeCSAT, "2019-Q2", "user1"))
+	assert.Equal(t, "Score-2019-Q2-ces-user1", getScoreResponseKey(QuestionTypeCES, "2019-Q2", "user1"))
+}
+
+func TestBuildKindQuestionPost(t *testing.T) {
+	user := &model.User{Username: "testuser"}
+	p := Plugin{}
+
+	for _, test := range []struct {
+		Kind             string
+		ExpectedPostType string
+		ExpectedOptions  int
+	}{
+		{Kind: QuestionTypeCSAT, ExpectedPostType: "custom_csat_survey", ExpectedOptions: 5},
+		{Kind: QuestionTypeCES, ExpectedPostType: "custom_ces_survey", ExpectedOptions: 7},
+	} {
+		t.Run(test.Kind, func(t *testing.T) {
+			kind := getSurveyKind(test.Kind)
+
+			post := p.buildQuestionPost(user, &surveyQuestion{ID: test.Kind, Type: test.Kind}, false)
+
+			assert.Equal(t, test.ExpectedPostType, post.Type)
+			assert.Equal(t, kind.Min, post.GetProp("score_min"))
+			assert.Equal(t, kind.Max, post.GetProp("score_max"))
+
+			attachments := post.Attachments()
+			require.Len(t, attachments, 1)
+			assert.Equal(t, kind.DefaultText.Other, attachments[0].Title)
+			require.Len(t, attachments[0].Actions, 2)
+
+			action := attachments[0].Actions[0]
+			require.Len(t, action.Options, test.ExpectedOptions)
+			assert.Equal(t, fmt.Sprintf("%d (%s)", kind.Max, kind.MaxLabel.Other), action.Options[0].Text)
+			assert.Equal(t, "/plugins/com.mattermost.nps/api/v1/score", action.Integration.URL)
+			assert.Equal(t, test.Kind, action.Integration.Context["question_id"])
+		})
+	}
+}
@@ -15,6 +15,12 @@ const (
 	// LockKey is used to prevent multiple instances of the plugin from scheduling surveys in parallel.
 	LockKey = "Lock"
 
+	// JobLockKey is used to prevent multiple instances of the plugin from running the background job in parallel.
+	JobLockKey = "JobLock"
+
+	// OutboxLockKey is used to prevent multiple instances of the plugin from retrying queued events in parallel.
+	OutboxLockKey = "OutboxLock"
+
 	// UserLockKey is used to prevent multiple instances of the plugin from responding to a single user's requests
 	// in parallel.
 	UserLockKey = "UserLock-%s"
@@ -52,7 +58,7 @@ func (p *Plugin) clearStaleLocks(now time.Time) *model.AppError {
 		}
 
 		for _, key := range keys {
-			if key != LockKey && !userLockPattern.MatchString(key) {
+			if key != LockKey && key != JobLockKey && key != OutboxLockKey && !userLockPattern.MatchString(key) {
 				continue
 			}
 
@@ -55,6 +55,7 @@ func TestClearStaleLocks(t *testing.T) {
 		api.On("KVList", 0, 100).Return([]string{
 			fmt.Sprintf(AdminDmNoticeKey, userID, serverVersion),
 			LastAdminNoticeKey,
+			LastJobRunKey,
 			fmt.Sprintf(ServerUpgradeKey, serverVersion),
 			fmt.Sprintf(SurveyKey, serverVersion),
 			fmt.Sprintf(UserSurveyKey, userID),
@@ -93,15 +94,19 @@ func TestClearStaleLocks(t *testing.T) {
 
 	t.Run("should clear locks that were acquired too long ago", func(t *testing.T) {
 		lockValue := mustMarshalJSON(now.Add(-1 * time.Hour))
+		jobLockValue := mustMarshalJSON(now.Add(-2 * time.Hour))
 		userLockValue := mustMarshalJSON(now.Add(-5 * time.Hour))
 
 		api := &plugintest.API{}
 		api.On("KVList", 0, 100).Return([]string{
 			LockKey,
+			JobLockKey,
 			userLockKey,
 		}, nil)
 		api.On("KVGet", LockKey).Return(lockValue, nil)
 		api.On("KVCompareAndDelete", LockKey, lockValue).Return(true, nil)
+		api.On("KVGet", JobLockKey).Return(jobLockValue, nil)
+		api.On("KVCompareAndDelete", JobLockKey, jobLockValue).Return(true, nil)
 		api.On("KVGet", userLockKey).Return(userLockValue, nil)
 		api.On("KVCompareAndDelete", userLockKey, userLockValue).Return(true, nil)
 		api.On("LogInfo", mock.Anything, mock.Anything, mock.Anything).Return(nil)
@@ -0,0 +1,166 @@
+// Copyright (c) 2019-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"bytes"
+	htmltemplate "html/template"
+	"text/template"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+)
+
+// messageTemplates are the Go templates that admins can use to replace the default text of messages sent by the
+// plugin. An empty template means that the default, translated text is used instead.
+type messageTemplates struct {
+	SurveyMessage   string `json:"survey_message"`
+	WelcomeFeedback string `json:"welcome_feedback"`
+	ThankYou        string `json:"thank_you"`
+
+	// AdminEmail replaces the body of the email sent to System Admins when a survey is scheduled. It's rendered as
+	// HTML, so any variables used in it are escaped.
+	AdminEmail string `json:"admin_email"`
+}
+
+// messageTemplateData is the data available to message templates. Fields that don't apply to a message, such as the
+// user's name in the admin email, are empty.
+type messageTemplateData struct {
+	Username        string
+	FirstName       string
+	LastName        string
+	SiteName        string
+	SiteURL         string
+	DaysUntilSurvey int
+}
+
+// getMessageTemplates returns the message templates set in the plugin configuration.
+func (c *configuration) getMessageTemplates() *messageTemplates {
+	return &messageTemplates{
+		SurveyMessage:   c.SurveyMessageTemplate,
+		WelcomeFeedback: c.WelcomeFeedbackTemplate,
+		ThankYou:        c.ThankYouTemplate,
+		AdminEmail:      c.AdminEmailTemplate,
+	}
+}
+
+// IsValid returns an error if any of the templates can't be parsed.
+func (t *messageTemplates) IsValid() error {
+	for name, text := range map[string]string{
+		"SurveyMessageTemplate":   t.SurveyMessage,
+		"WelcomeFeedbackTemplate": t.WelcomeFeedback,
+		"ThankYouTemplate":        t.ThankYou,
+	} {
+		if _, err := template.New(name).Parse(text); err != nil {
+			return errors.Wrapf(err, "invalid %s", name)
+		}
+	}
+
+	if _, err := htmltemplate.New("AdminEmailTemplate").Parse(t.AdminEmail); err != nil {
+		return errors.Wrap(err, "invalid AdminEmailTemplate")
+	}
+
+	return nil
+}
+
+// getMessageTemplateData returns the data used to render a message sent to the given user, or to System Admins when
+// the user is nil.
+func (p *Plugin) getMessageTemplateData(user *model.User) *messageTemplateData {
+	config := p.API.GetConfig()
+
+	data := &messageTemplateData{
+		DaysUntilSurvey: p.getConfiguration().getDaysUntilSurvey(),
+	}
+	if config.TeamSettings.SiteName != nil {
+		data.SiteName = *config.TeamSettings.SiteName
+	}
+	if config.ServiceSettings.SiteURL != nil {
+		data.SiteURL = *config.ServiceSettings.SiteURL
+	}
+
+	if user != nil {
+		data.Username = user.Username
+		data.FirstName = user.FirstName
+		data.LastName = user.LastName
+	}
+
+	return data
+}
+
+// renderUserMessage renders a message sent to the given user from an admin's template, falling back to the
+// translated default message if the template is empty or can't be rendered.
+func (p *Plugin) renderUserMessage(user *model.User, text string, message *i18nMessage, args ...interface{}) string {
+	if text == "" {
+		return p.translate(user.Locale, message, args...)
+	}
+
+	var buf bytes.Buffer
+	tmpl, err := template.New(message.ID).Parse(text)
+	if err == nil {
+		err = tmpl.Execute(&buf, p.getMessageTemplateData(user))
+	}
+
+	if err != nil {
+		p.API.LogWarn("Failed to render message template. Using the default message instead.", "err", err.Error())
+		return p.translate(user.Locale, message, args...)
+	}
+
+	return buf.String()
+}
+
+// renderAdminEmailBody renders the body of the admin email from an admin's template. Returns false if the template is
+// empty or can't be rendered, in which case the default body should be used.
+func (p *Plugin) renderAdminEmailBody(text string) (htmltemplate.HTML, bool) {
+	if text == "" {
+		return "", false
+	}
+
+	var buf bytes.Buffer
+	tmpl, err := htmltemplate.New("AdminEmailTemplate").Parse(text)
+	if err == nil {
+		err = tmpl.Execute(&buf, p.getMessageTemplateData(nil))
+	}
+
+	if err != nil {
+		p.API.LogWarn("Failed to render admin email template. Using the default email instead.", "err", err.Error())
+		return "", false
+	}
+
+	// The template escapes its data, so its output is safe to include as is
+	return htmltemplate.HTML(buf.String()), true //nolint:gosec
+}
+
+// messageTemplatePreview shows the messages that would be sent using a set of message templates.
+type messageTemplatePreview struct {
+	SurveyPost          *model.Post `json:"survey_post"`
+	WelcomeFeedbackPost *model.Post `json:"welcome_feedback_post"`
+	ThanksPost          *model.Post `json:"thanks_post"`
+	AdminEmailSubject   string      `json:"admin_email_subject"`
+	AdminEmailBody      string      `json:"admin_email_body"`
+}
+
+// previewMessageTemplates renders the messages that the given user would receive using the given templates without
+// sending them.
+func (p *Plugin) previewMessageTemplates(user *model.User, templates *messageTemplates) (*messageTemplatePreview, error) {
+	definition, appErr := p.getSurveyDefinition()
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	surveyPost := p.buildQuestionPost(user, definition.Questions[0], true)
+	surveyPost.Message = p.buildSurveyMessage(user, templates)
+
+	subject, body, err := p.buildAdminNoticeEmail(templates)
+	if err != nil {
+		return nil, err
+	}
+
+	return &messageTemplatePreview{
+		SurveyPost:          surveyPost,
+		WelcomeFeedbackPost: p.buildWelcomeFeedbackPost(user, templates),
+		ThanksPost:          p.buildThanksPost(user, "", templates),
+		AdminEmailSubject:   subject,
+		AdminEmailBody:      body,
+	}, nil
+}
@@ -0,0 +1,221 @@
+// Copyright (c) 2019-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestMessageTemplatesIsValid(t *testing.T) {
+	for _, test := range []struct {
+		Name        string
+		Templates   *messageTemplates
+		ExpectError bool
+	}{
+		{
+			Name:      "no templates",
+			Templates: &messageTemplates{},
+		},
+		{
+			Name: "valid templates",
+			Templates: &messageTemplates{
+				SurveyMessage:   "Hi {{.FirstName}}! How are we doing?",
+				WelcomeFeedback: "Welcome to {{.SiteName}}, @{{.Username}}!",
+				ThankYou:        "Thanks!",
+				AdminEmail:      "<p>Surveys start in {{.DaysUntilSurvey}} days.</p>",
+			},
+		},
+		{
+			Name:        "invalid survey message",
+			Templates:   &messageTemplates{SurveyMessage: "Hi {{.FirstName"},
+			ExpectError: true,
+		},
+		{
+			Name:        "invalid admin email",
+			Templates:   &messageTemplates{AdminEmail: "{{if .SiteURL}}"},
+			ExpectError: true,
+		},
+	} {
+		t.Run(test.Name, func(t *testing.T) {
+			err := test.Templates.IsValid()
+
+			if test.ExpectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestRenderUserMessage(t *testing.T) {
+	user := &model.User{Username: "user", FirstName: "First", Locale: "en"}
+
+	makeConfigMock := func() *Plugin {
+		api := makeAPIMock()
+		api.On("GetConfig").Return(&model.Config{
+			ServiceSettings: model.ServiceSettings{SiteURL: model.NewString("https://mattermost.example.com")},
+			TeamSettings:    model.TeamSettings{SiteName: model.NewString("Example")},
+		})
+
+		p := &Plugin{configuration: &configuration{}}
+		p.SetAPI(api)
+
+		return p
+	}
+
+	t.Run("should use the default message without a template", func(t *testing.T) {
+		p := &Plugin{}
+
+		assert.Equal(t, p.translate("en", welcomeFeedbackRequestBody, "user"), p.renderUserMessage(user, "", welcomeFeedbackRequestBody, "user"))
+	})
+
+	t.Run("should render the template", func(t *testing.T) {
+		p := makeConfigMock()
+
+		message := p.renderUserMessage(user, "Hi {{.FirstName}} (@{{.Username}}), welcome to {{.SiteName}} at {{.SiteURL}}! Surveys start after {{.DaysUntilSurvey}} days.", welcomeFeedbackRequestBody, "user")
+
+		assert.Equal(t, "Hi First (@user), welcome to Example at https://mattermost.example.com! Surveys start after 45 days.", message)
+	})
+
+	t.Run("should use the default message if the template can't be rendered", func(t *testing.T) {
+		p := makeConfigMock()
+
+		message := p.renderUserMessage(user, "Hi {{.Nickname}}!", welcomeFeedbackRequestBody, "user")
+
+		assert.Equal(t, p.translate("en", welcomeFeedbackRequestBody, "user"), message)
+	})
+}
+
+func TestRenderAdminEmailBody(t *testing.T) {
+	api := makeAPIMock()
+	api.On("GetConfig").Return(&model.Config{
+		TeamSettings: model.TeamSettings{SiteName: model.NewString("<Example>")},
+	})
+
+	p := &Plugin{configuration: &configuration{}}
+	p.SetAPI(api)
+
+	t.Run("should escape variables", func(t *testing.T) {
+		body, ok := p.renderAdminEmailBody("<p>Surveys are coming to {{.SiteName}}.</p>")
+
+		assert.True(t, ok)
+		assert.Equal(t, "<p>Surveys are coming to &lt;Example&gt;.</p>", string(body))
+	})
+
+	t.Run("should not render an empty template", func(t *testing.T) {
+		_, ok := p.renderAdminEmailBody("")
+
+		assert.False(t, ok)
+	})
+}
+
+func TestPreviewMessageTemplatesHandler(t *testing.T) {
+	adminID := model.NewId()
+	userID := model.NewId()
+
+	makeMock := func() *Plugin {
+		api := makeAPIMock()
+		api.On("GetConfig").Return(&model.Config{
+			ServiceSettings: model.ServiceSettings{SiteURL: model.NewString("https://mattermost.example.com")},
+			TeamSettings:    model.TeamSettings{SiteName: model.NewString("Example")},
+		})
+		api.On("GetUser", userID).Return(&model.User{Id: userID, Username: "user", FirstName: "First"}, nil).Maybe()
+		api.On("GetUser", mock.Anything).Return(nil, &model.AppError{}).Maybe()
+		api.On("KVGet", SurveyDefinitionKey).Return(nil, nil).Maybe()
+
+		p := &Plugin{
+			configuration: &configuration{
+				ThankYouTemplate: "Thanks, {{.FirstName}}!",
+			},
+		}
+		p.SetAPI(api)
+
+		return p
+	}
+
+	t.Run("should render the given templates", func(t *testing.T) {
+		p := makeMock()
+
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, "/api/v1/message_templates/preview", bytes.NewReader(mustMarshalJSON(map[string]interface{}{
+			"user_id": userID,
+			"templates": &messageTemplates{
+				SurveyMessage: "Hey {{.FirstName}}, got a minute?",
+				AdminEmail:    "<p>Heads up: surveys start in {{.DaysUntilSurvey}} days.</p>",
+			},
+		})))
+		request.Header.Set("Mattermost-User-ID", adminID)
+
+		p.previewMessageTemplatesHandler(recorder, request)
+
+		result := recorder.Result()
+		body, _ := io.ReadAll(result.Body)
+
+		assert.Equal(t, http.StatusOK, result.StatusCode)
+
+		preview := mustUnmarshalJSON(body, &messageTemplatePreview{}).(*messageTemplatePreview)
+		assert.Equal(t, "Hey First, got a minute?", preview.SurveyPost.Message)
+		assert.Equal(t, surveyDropdownTitle.Other, preview.SurveyPost.Attachments()[0].Title)
+		assert.Equal(t, p.translate("en", welcomeFeedbackRequestBody, "user"), preview.WelcomeFeedbackPost.Message)
+		assert.Equal(t, feedbackResponseBody.Other, preview.ThanksPost.Message)
+		assert.Equal(t, "[Example] User Satisfaction Survey scheduled in 45 days", preview.AdminEmailSubject)
+		assert.Contains(t, preview.AdminEmailBody, "<p>Heads up: surveys start in 45 days.</p>")
+	})
+
+	t.Run("should render the configured templates", func(t *testing.T) {
+		p := makeMock()
+
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, "/api/v1/message_templates/preview", bytes.NewReader(mustMarshalJSON(map[string]interface{}{
+			"user_id": userID,
+		})))
+		request.Header.Set("Mattermost-User-ID", adminID)
+
+		p.previewMessageTemplatesHandler(recorder, request)
+
+		result := recorder.Result()
+		body, _ := io.ReadAll(result.Body)
+
+		assert.Equal(t, http.StatusOK, result.StatusCode)
+
+		preview := mustUnmarshalJSON(body, &messageTemplatePreview{}).(*messageTemplatePreview)
+		assert.Equal(t, "Thanks, First!", preview.ThanksPost.Message)
+		assert.Contains(t, preview.AdminEmailBody, "Surveys will be received by users in <strong>45 days</strong>.")
+	})
+
+	t.Run("should reject invalid templates", func(t *testing.T) {
+		p := makeMock()
+
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, "/api/v1/message_templates/preview", bytes.NewReader(mustMarshalJSON(map[string]interface{}{
+			"templates": &messageTemplates{ThankYou: "{{"},
+		})))
+		request.Header.Set("Mattermost-User-ID", adminID)
+
+		p.previewMessageTemplatesHandler(recorder, request)
+
+		assert.Equal(t, http.StatusBadRequest, recorder.Result().StatusCode)
+	})
+
+	t.Run("should reject an unknown user", func(t *testing.T) {
+		p := makeMock()
+
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, "/api/v1/message_templates/preview", bytes.NewReader([]byte("{}")))
+		request.Header.Set("Mattermost-User-ID", adminID)
+
+		p.previewMessageTemplatesHandler(recorder, request)
+
+		assert.Equal(t, http.StatusBadRequest, recorder.Result().StatusCode)
+	})
+}
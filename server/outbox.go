@@ -0,0 +1,298 @@
+// Copyright (c) 2019-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+const (
+	// OutboxMaxAttempts is how many times an event is sent before it's moved to the dead letters.
+	OutboxMaxAttempts = 8
+
+	// OutboxInitialBackoff is how long to wait before retrying an event the first time. The wait doubles after every
+	// failed attempt up to OutboxMaxBackoff.
+	OutboxInitialBackoff = 5 * time.Minute
+	OutboxMaxBackoff     = 12 * time.Hour
+)
+
+// outboxEvent is an event that has been recorded in the KV store so that it isn't lost if it can't be sent right away.
+type outboxEvent struct {
+	ID            string                 `json:"id"`
+	Event         string                 `json:"event"`
+	UserID        string                 `json:"user_id"`
+	Properties    map[string]interface{} `json:"properties"`
+	CreateAt      time.Time              `json:"create_at"`
+	Attempts      int                    `json:"attempts"`
+	NextAttemptAt time.Time              `json:"next_attempt_at"`
+	LastError     string                 `json:"last_error,omitempty"`
+
+	// WebhookURL is the URL of the outgoing webhook that the event is sent to, or empty if it's sent to the
+	// configured eventSink.
+	WebhookURL string `json:"webhook_url,omitempty"`
+}
+
+// outboxStatus describes the events that are waiting to be sent and the ones that have been given up on.
+type outboxStatus struct {
+	Queued       int            `json:"queued"`
+	DeadLettered []*outboxEvent `json:"dead_lettered"`
+}
+
+// getOutboxBackoff returns how long to wait before retrying an event that has failed the given number of times.
+func getOutboxBackoff(attempts int) time.Duration {
+	backoff := OutboxInitialBackoff
+	for i := 1; i < attempts && backoff < OutboxMaxBackoff; i++ {
+		backoff *= 2
+	}
+
+	if backoff > OutboxMaxBackoff {
+		return OutboxMaxBackoff
+	}
+
+	return backoff
+}
+
+// trackUserEvent anonymizes an event and records it in the outbox to be sent to the configured eventSink and to every
+// outgoing webhook that wants it. Events are sent by processOutbox so that the requests that record them don't wait
+// on the sink. The source identifies the record that the event describes, such as a feedback post, and each event is
+// sent with an event_id property derived from it so that the receiver can discard duplicates. The createAt is when
+// the event happened, which is sent to outgoing webhooks.
+func (p *Plugin) trackUserEvent(event string, source string, userID string, createAt time.Time, properties map[string]interface{}) {
+	now := p.now().UTC()
+
+	userID, appErr := p.anonymizeEvent(userID, properties)
+	if appErr != nil {
+		// Send the event without a user ID rather than risk sending one that should've been hashed
+		p.API.LogError("Failed to anonymize telemetry event", "event", event, "err", appErr)
+		userID = ""
+	}
+
+	eventID, appErr := p.getOutboxEventID(event, source)
+	if appErr != nil {
+		// Still send the event, but it can't be deduplicated
+		p.API.LogError("Failed to get telemetry event ID", "event", event, "err", appErr)
+		eventID = model.NewId()
+	}
+
+	properties["event_id"] = eventID
+
+	// The first attempt is made right away by the outbox worker, so processOutbox only sends the event if that attempt
+	// never happens
+	queued := &outboxEvent{
+		ID:            eventID,
+		Event:         event,
+		UserID:        userID,
+		Properties:    properties,
+		CreateAt:      createAt,
+		NextAttemptAt: now.Add(OutboxInitialBackoff),
+	}
+
+	p.queueOutgoingWebhooks(queued)
+
+	p.queueOutboxEvent(queued)
+}
+
+// getOutboxEventID returns the ID of the event recorded for the given source. Recording an event for the same source
+// again results in the same ID, so it's only queued once. The source may contain user IDs, so it's hashed with the
+// anonymization salt.
+func (p *Plugin) getOutboxEventID(event string, source string) (string, *model.AppError) {
+	salt, appErr := p.getAnonymizationSalt()
+	if appErr != nil {
+		return "", appErr
+	}
+
+	return hashWithSalt(salt, event+":"+source), nil
+}
+
+// queueOutboxEvent records the event in the outbox and hands it to the outbox worker to be sent without waiting for
+// the next run of processOutbox, which retries it if that fails. Events that are already queued are skipped.
+func (p *Plugin) queueOutboxEvent(queued *outboxEvent) {
+	stored, appErr := p.enqueueOutboxEvent(queued)
+	if appErr != nil {
+		p.API.LogError("Failed to record telemetry event in the outbox", "event", queued.Event, "err", appErr)
+		return
+	}
+
+	if !stored {
+		p.API.LogDebug("Telemetry event is already queued", "event_id", queued.ID)
+		return
+	}
+
+	select {
+	case p.outboxEvents <- queued:
+	default:
+		// The worker isn't running or is busy, so the event is left for processOutbox
+	}
+}
+
+// enqueueOutboxEvent stores the event in the outbox unless an event with the same ID is already queued. Returns
+// whether or not the event was stored.
+func (p *Plugin) enqueueOutboxEvent(event *outboxEvent) (bool, *model.AppError) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return false, &model.AppError{Message: err.Error()}
+	}
+
+	return p.API.KVCompareAndSet(fmt.Sprintf(OutboxEventKey, event.ID), nil, data)
+}
+
+// sendOutboxEvent sends the event to its outgoing webhook or, if it doesn't have one, to the configured eventSink.
+func (p *Plugin) sendOutboxEvent(event *outboxEvent) error {
+	if event.WebhookURL != "" {
+		return p.sendToOutgoingWebhook(event)
+	}
+
+	return p.getEventSink().TrackUserEvent(event.Event, event.UserID, event.Properties)
+}
+
+// deliverOutboxEvent sends the event using sendOutboxEvent. Delivered events are removed from the outbox, while
+// failed ones are either scheduled to be retried with exponential backoff or moved to the dead letters once they've
+// been attempted OutboxMaxAttempts times.
+func (p *Plugin) deliverOutboxEvent(event *outboxEvent, now time.Time) *model.AppError {
+	err := p.sendOutboxEvent(event)
+	if err == nil {
+		return p.API.KVDelete(fmt.Sprintf(OutboxEventKey, event.ID))
+	}
+
+	event.Attempts++
+	event.LastError = err.Error()
+
+	if event.Attempts >= OutboxMaxAttempts {
+		p.API.LogWarn("Giving up on sending telemetry event", "event_id", event.ID)
+
+		if appErr := p.KVSet(fmt.Sprintf(DeadLetterEventKey, event.ID), event); appErr != nil {
+			return appErr
+		}
+
+		return p.API.KVDelete(fmt.Sprintf(OutboxEventKey, event.ID))
+	}
+
+	p.API.LogWarn("Failed to send telemetry event", "err", err.Error())
+
+	event.NextAttemptAt = now.Add(getOutboxBackoff(event.Attempts))
+
+	return p.KVSet(fmt.Sprintf(OutboxEventKey, event.ID), event)
+}
+
+// processOutbox retries every queued event that is due to be sent. Only one instance of the plugin processes the
+// outbox at a time so that events aren't sent twice.
+func (p *Plugin) processOutbox(now time.Time) *model.AppError {
+	locked, appErr := p.tryLock(OutboxLockKey, now)
+	if appErr != nil {
+		return appErr
+	}
+	if !locked {
+		// Another instance of the plugin is already processing the outbox
+		return nil
+	}
+	defer func() {
+		_ = p.unlock(OutboxLockKey)
+	}()
+
+	// Collect the keys first since delivered events are deleted, which would otherwise cause keys to be skipped
+	var keys []string
+	if appErr = p.KVForEach(OutboxEventPrefix, func(key string) (bool, *model.AppError) {
+		keys = append(keys, key)
+		return true, nil
+	}); appErr != nil {
+		return appErr
+	}
+
+	for _, key := range keys {
+		var event *outboxEvent
+		if appErr = p.KVGet(key, &event); appErr != nil {
+			return appErr
+		}
+
+		if event == nil || now.Before(event.NextAttemptAt) {
+			continue
+		}
+
+		if appErr = p.deliverOutboxEvent(event, now); appErr != nil {
+			return appErr
+		}
+	}
+
+	return nil
+}
+
+// getOutboxStatus returns the number of queued events along with every dead-lettered event, oldest first.
+func (p *Plugin) getOutboxStatus() (*outboxStatus, *model.AppError) {
+	status := &outboxStatus{
+		DeadLettered: []*outboxEvent{},
+	}
+
+	if appErr := p.KVForEach(OutboxEventPrefix, func(key string) (bool, *model.AppError) {
+		status.Queued++
+		return true, nil
+	}); appErr != nil {
+		return nil, appErr
+	}
+
+	if appErr := p.KVForEach(DeadLetterEventPrefix, func(key string) (bool, *model.AppError) {
+		var event *outboxEvent
+		if appErr := p.KVGet(key, &event); appErr != nil {
+			return false, appErr
+		}
+
+		if event != nil {
+			status.DeadLettered = append(status.DeadLettered, event)
+		}
+
+		return true, nil
+	}); appErr != nil {
+		return nil, appErr
+	}
+
+	sort.Slice(status.DeadLettered, func(i, j int) bool {
+		return status.DeadLettered[i].CreateAt.Before(status.DeadLettered[j].CreateAt)
+	})
+
+	return status, nil
+}
+
+// retryDeadLetters moves every dead-lettered event back into the outbox so that it's sent the next time that the
+// outbox is processed. Returns the number of events that were moved.
+func (p *Plugin) retryDeadLetters(now time.Time) (int, *model.AppError) {
+	var keys []string
+	if appErr := p.KVForEach(DeadLetterEventPrefix, func(key string) (bool, *model.AppError) {
+		keys = append(keys, key)
+		return true, nil
+	}); appErr != nil {
+		return 0, appErr
+	}
+
+	retried := 0
+	for _, key := range keys {
+		var event *outboxEvent
+		if appErr := p.KVGet(key, &event); appErr != nil {
+			return retried, appErr
+		}
+
+		if event == nil {
+			continue
+		}
+
+		event.Attempts = 0
+		event.NextAttemptAt = now
+
+		// The event may already be queued if a previous retry failed part way through
+		if _, appErr := p.enqueueOutboxEvent(event); appErr != nil {
+			return retried, appErr
+		}
+
+		if appErr := p.API.KVDelete(key); appErr != nil {
+			return retried, appErr
+		}
+
+		retried++
+	}
+
+	return retried, nil
+}
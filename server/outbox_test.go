@@ -0,0 +1,295 @@
+// Copyright (c) 2019-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetOutboxBackoff(t *testing.T) {
+	assert.Equal(t, 5*time.Minute, getOutboxBackoff(1))
+	assert.Equal(t, 10*time.Minute, getOutboxBackoff(2))
+	assert.Equal(t, 20*time.Minute, getOutboxBackoff(3))
+	assert.Equal(t, 320*time.Minute, getOutboxBackoff(7))
+	assert.Equal(t, OutboxMaxBackoff, getOutboxBackoff(20))
+}
+
+func TestTrackUserEvent(t *testing.T) {
+	userID := model.NewId()
+	now := toDate(2019, time.March, 11)
+
+	makePlugin := func(api *plugintest.API, config *configuration) *Plugin {
+		p := &Plugin{
+			configuration: config,
+			now: func() time.Time {
+				return now
+			},
+		}
+		p.SetAPI(api)
+
+		return p
+	}
+
+	t.Run("should record the event to be sent by the outbox", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVGet", AnonymizationSaltKey).Return(mustMarshalJSON("abc123"), nil)
+		api.On("KVCompareAndSet", mock.AnythingOfType("string"), []byte(nil), mock.Anything).Return(true, nil).Run(func(args mock.Arguments) {
+			var event *outboxEvent
+			mustUnmarshalJSON(args.Get(2).([]byte), &event)
+
+			assert.Equal(t, fmt.Sprintf(OutboxEventKey, event.ID), args.String(0))
+			assert.Equal(t, hashWithSalt("abc123", NpsScore+":source"), event.ID)
+			assert.Equal(t, NpsScore, event.Event)
+			assert.Equal(t, userID, event.UserID)
+			assert.Equal(t, event.ID, event.Properties["event_id"])
+			assert.Equal(t, now, event.CreateAt)
+			assert.Equal(t, now.Add(OutboxInitialBackoff), event.NextAttemptAt)
+		})
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api, &configuration{EnablePrivateMode: true})
+
+		p.trackUserEvent(NpsScore, "source", userID, now, map[string]interface{}{"score": 10})
+
+		api.AssertNotCalled(t, "KVDelete", mock.Anything)
+	})
+
+	t.Run("should hand the event to the outbox worker to be sent right away", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVGet", AnonymizationSaltKey).Return(mustMarshalJSON("abc123"), nil)
+		api.On("KVCompareAndSet", mock.AnythingOfType("string"), []byte(nil), mock.Anything).Return(true, nil)
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api, &configuration{})
+		p.outboxEvents = make(chan *outboxEvent, 1)
+
+		p.trackUserEvent(NpsScore, "source", userID, now, map[string]interface{}{"score": 10})
+
+		require.Len(t, p.outboxEvents, 1)
+		event := <-p.outboxEvents
+		assert.Equal(t, hashWithSalt("abc123", NpsScore+":source"), event.ID)
+	})
+
+	t.Run("should leave the event for processOutbox when the outbox worker is busy", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVGet", AnonymizationSaltKey).Return(mustMarshalJSON("abc123"), nil)
+		api.On("KVCompareAndSet", mock.AnythingOfType("string"), []byte(nil), mock.Anything).Return(true, nil)
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api, &configuration{})
+		p.outboxEvents = make(chan *outboxEvent, 1)
+		p.outboxEvents <- &outboxEvent{}
+
+		p.trackUserEvent(NpsScore, "source", userID, now, map[string]interface{}{"score": 10})
+
+		assert.Len(t, p.outboxEvents, 1)
+	})
+
+	t.Run("should only queue an event once for the same source", func(t *testing.T) {
+		var keys []string
+
+		api := makeAPIMock()
+		api.On("KVGet", AnonymizationSaltKey).Return(mustMarshalJSON("abc123"), nil)
+		api.On("KVCompareAndSet", mock.AnythingOfType("string"), []byte(nil), mock.Anything).Return(true, nil).Once().Run(func(args mock.Arguments) {
+			keys = append(keys, args.String(0))
+		})
+		api.On("KVCompareAndSet", mock.AnythingOfType("string"), []byte(nil), mock.Anything).Return(false, nil).Once().Run(func(args mock.Arguments) {
+			keys = append(keys, args.String(0))
+		})
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api, &configuration{})
+
+		p.trackUserEvent(NpsScore, "source", userID, now, map[string]interface{}{"score": 10})
+		p.trackUserEvent(NpsScore, "source", userID, now, map[string]interface{}{"score": 10})
+
+		require.Len(t, keys, 2)
+		assert.Equal(t, keys[0], keys[1])
+	})
+}
+
+func TestDeliverOutboxEvent(t *testing.T) {
+	now := toDate(2019, time.March, 11)
+
+	t.Run("should remove the event once it's sent", func(t *testing.T) {
+		event := &outboxEvent{ID: model.NewId(), Event: NpsScore}
+
+		api := makeAPIMock()
+		api.On("KVDelete", fmt.Sprintf(OutboxEventKey, event.ID)).Return(nil)
+		defer api.AssertExpectations(t)
+
+		p := &Plugin{
+			configuration: &configuration{EnablePrivateMode: true},
+		}
+		p.SetAPI(api)
+
+		err := p.deliverOutboxEvent(event, now)
+
+		assert.Nil(t, err)
+	})
+
+	t.Run("should schedule the event to be retried when it can't be sent", func(t *testing.T) {
+		event := &outboxEvent{ID: model.NewId(), Event: NpsScore}
+
+		api := makeAPIMock()
+		api.On("KVSet", fmt.Sprintf(OutboxEventKey, event.ID), mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+			var event *outboxEvent
+			mustUnmarshalJSON(args.Get(1).([]byte), &event)
+
+			assert.Equal(t, 1, event.Attempts)
+			assert.NotEmpty(t, event.LastError)
+			assert.Equal(t, now.Add(OutboxInitialBackoff), event.NextAttemptAt)
+		})
+		defer api.AssertExpectations(t)
+
+		p := &Plugin{
+			configuration: &configuration{
+				TelemetrySink:     TelemetrySinkFile,
+				TelemetryFilePath: filepath.Join(t.TempDir(), "missing", "events.ndjson"),
+			},
+			now: func() time.Time {
+				return now
+			},
+		}
+		p.SetAPI(api)
+
+		err := p.deliverOutboxEvent(event, now)
+
+		assert.Nil(t, err)
+	})
+
+	t.Run("should move the event to the dead letters after the last attempt", func(t *testing.T) {
+		event := &outboxEvent{
+			ID:       model.NewId(),
+			Event:    NpsScore,
+			Attempts: OutboxMaxAttempts - 1,
+		}
+
+		api := makeAPIMock()
+		api.On("KVSet", fmt.Sprintf(DeadLetterEventKey, event.ID), mock.Anything).Return(nil)
+		api.On("KVDelete", fmt.Sprintf(OutboxEventKey, event.ID)).Return(nil)
+		defer api.AssertExpectations(t)
+
+		p := &Plugin{
+			configuration: &configuration{
+				TelemetrySink:     TelemetrySinkFile,
+				TelemetryFilePath: filepath.Join(t.TempDir(), "missing", "events.ndjson"),
+			},
+			now: func() time.Time {
+				return now
+			},
+		}
+		p.SetAPI(api)
+
+		err := p.deliverOutboxEvent(event, now)
+
+		assert.Nil(t, err)
+		assert.Equal(t, OutboxMaxAttempts, event.Attempts)
+	})
+}
+
+func TestProcessOutbox(t *testing.T) {
+	now := toDate(2019, time.March, 11)
+
+	t.Run("should send events that are due and skip the rest", func(t *testing.T) {
+		due := &outboxEvent{ID: model.NewId(), Event: NpsScore, Attempts: 1, NextAttemptAt: now.Add(-time.Minute)}
+		notDue := &outboxEvent{ID: model.NewId(), Event: NpsScore, Attempts: 1, NextAttemptAt: now.Add(time.Minute)}
+
+		api := makeAPIMock()
+		api.On("KVCompareAndSet", OutboxLockKey, []byte(nil), mock.Anything).Return(true, nil)
+		api.On("KVDelete", OutboxLockKey).Return(nil)
+		api.On("KVList", 0, 100).Return([]string{
+			fmt.Sprintf(OutboxEventKey, due.ID),
+			fmt.Sprintf(OutboxEventKey, notDue.ID),
+			LastJobRunKey,
+		}, nil)
+		api.On("KVGet", fmt.Sprintf(OutboxEventKey, due.ID)).Return(mustMarshalJSON(due), nil)
+		api.On("KVGet", fmt.Sprintf(OutboxEventKey, notDue.ID)).Return(mustMarshalJSON(notDue), nil)
+		api.On("KVDelete", fmt.Sprintf(OutboxEventKey, due.ID)).Return(nil)
+		defer api.AssertExpectations(t)
+
+		p := &Plugin{
+			configuration: &configuration{EnablePrivateMode: true},
+		}
+		p.SetAPI(api)
+
+		err := p.processOutbox(now)
+
+		assert.Nil(t, err)
+	})
+
+	t.Run("should do nothing when another instance is processing the outbox", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVCompareAndSet", OutboxLockKey, []byte(nil), mock.Anything).Return(false, nil)
+		defer api.AssertExpectations(t)
+
+		p := &Plugin{}
+		p.SetAPI(api)
+
+		err := p.processOutbox(now)
+
+		assert.Nil(t, err)
+	})
+}
+
+func TestGetOutboxStatus(t *testing.T) {
+	older := &outboxEvent{ID: model.NewId(), Event: NpsScore, CreateAt: toDate(2019, time.March, 1), Attempts: OutboxMaxAttempts}
+	newer := &outboxEvent{ID: model.NewId(), Event: NpsFeedback, CreateAt: toDate(2019, time.March, 2), Attempts: OutboxMaxAttempts}
+
+	api := makeAPIMock()
+	api.On("KVList", 0, 100).Return([]string{
+		fmt.Sprintf(OutboxEventKey, model.NewId()),
+		fmt.Sprintf(OutboxEventKey, model.NewId()),
+		fmt.Sprintf(DeadLetterEventKey, newer.ID),
+		fmt.Sprintf(DeadLetterEventKey, older.ID),
+	}, nil)
+	api.On("KVGet", fmt.Sprintf(DeadLetterEventKey, newer.ID)).Return(mustMarshalJSON(newer), nil)
+	api.On("KVGet", fmt.Sprintf(DeadLetterEventKey, older.ID)).Return(mustMarshalJSON(older), nil)
+	defer api.AssertExpectations(t)
+
+	p := &Plugin{}
+	p.SetAPI(api)
+
+	status, err := p.getOutboxStatus()
+
+	require.Nil(t, err)
+	assert.Equal(t, 2, status.Queued)
+	require.Len(t, status.DeadLettered, 2)
+	assert.Equal(t, older.ID, status.DeadLettered[0].ID)
+	assert.Equal(t, newer.ID, status.DeadLettered[1].ID)
+}
+
+func TestRetryDeadLetters(t *testing.T) {
+	now := toDate(2019, time.March, 11)
+	event := &outboxEvent{ID: model.NewId(), Event: NpsScore, Attempts: OutboxMaxAttempts, LastError: "failed"}
+
+	api := makeAPIMock()
+	api.On("KVList", 0, 100).Return([]string{fmt.Sprintf(DeadLetterEventKey, event.ID)}, nil)
+	api.On("KVGet", fmt.Sprintf(DeadLetterEventKey, event.ID)).Return(mustMarshalJSON(event), nil)
+	api.On("KVCompareAndSet", fmt.Sprintf(OutboxEventKey, event.ID), []byte(nil), mustMarshalJSON(&outboxEvent{
+		ID:            event.ID,
+		Event:         NpsScore,
+		NextAttemptAt: now,
+		LastError:     "failed",
+	})).Return(true, nil)
+	api.On("KVDelete", fmt.Sprintf(DeadLetterEventKey, event.ID)).Return(nil)
+	defer api.AssertExpectations(t)
+
+	p := &Plugin{}
+	p.SetAPI(api)
+
+	retried, err := p.retryDeadLetters(now)
+
+	assert.Nil(t, err)
+	assert.Equal(t, 1, retried)
+}
@@ -14,7 +14,7 @@ import (
 
 const (
 	// AdminDmNoticeKey is used to store whether or not a DM notifying an admin about a scheduled survey has been
-	// sent. It should contain the user's ID and server version like "AdminDM-abc123-5.10.0".
+	// sent. It should contain the user's ID and survey ID like "AdminDM-abc123-5.10.0".
 	AdminDmNoticeKey = "AdminDM-%s-%s"
 
 	// LastAdminNoticeKey is used to store the last time.Time that notifications were sent to admins to inform them
@@ -29,18 +29,91 @@ const (
 	// occurred. It should contain the server version like "ServerUpgrade-5.10.0".
 	ServerUpgradeKey = "ServerUpgrade-%s"
 
-	// SurveyKey is used to store the surveyState containing when an NPS survey starts and ends on a given version
-	// of Mattermost. It should contain the server version like "Survey-5.10.0".
+	// SurveyKey is used to store the surveyState containing when an NPS survey starts and ends during a given survey
+	// cycle. It should contain the survey ID, which is the server version when surveys are scheduled on upgrade, like
+	// "Survey-5.10.0" or "Survey-2019-Q2".
 	SurveyKey = "Survey-%s"
 
 	// UserSurveyKey is used to store the userSurveyState tracking a user's progress through an NPS survey on the
 	// given version of Mattermost. It should contain the user's ID like "UserSurvey-abc123".
 	UserSurveyKey = "UserSurvey-%s"
 
+	// UserSurveyPrefix is the prefix shared by all keys containing userSurveyState objects.
+	UserSurveyPrefix = "UserSurvey-"
+
+	// UserPreferencesKey is used to store the userPreferences that a user has set for what Feedbackbot sends them. It
+	// should contain the user's ID like "UserPreferences-abc123".
+	UserPreferencesKey = "UserPreferences-%s"
+
 	// UserSurveyStateKey is used to know if we sent the welcome feedback post to new users.
 	// Format is 'UserWelcomeFeedback-{user_id}'
 	UserWelcomeFeedbackKey = "UserWelcomeFeedback-%s"
 
+	// WelcomeFeedbackPostKey is used to store the welcomeFeedbackPost sent to a new user so that their reply can be
+	// attributed to it. It should contain the user's ID like "WelcomeFeedbackPost-abc123".
+	WelcomeFeedbackPostKey = "WelcomeFeedbackPost-%s"
+
+	// ScoreResponseKey is used to store the scoreResponse containing the score that a user gave to a given NPS survey.
+	// It should contain the survey ID and the user's ID like "Score-5.10.0-abc123".
+	ScoreResponseKey = "Score-%s-%s"
+
+	// KindScoreResponseKey is used to store the scoreResponse containing the score that a user gave to a CSAT or CES
+	// question. It should contain the survey ID, the question type and the user's ID like "Score-5.10.0-csat-abc123".
+	KindScoreResponseKey = "Score-%s-%s-%s"
+
+	// FeedbackResponseKey is used to store a feedbackResponse containing a message that a user sent to Feedbackbot. It
+	// should contain the ID of the survey cycle in which it was sent, the user's ID and the post's ID like
+	// "Feedback-5.10.0-abc123-def456".
+	FeedbackResponseKey = "Feedback-%s-%s-%s"
+
+	// AnswerResponseKey is used to store the answerResponse containing a user's answer to a question other than the
+	// NPS question. It should contain the survey ID, the question ID and the user's ID like
+	// "Answer-5.10.0-search-abc123".
+	AnswerResponseKey = "Answer-%s-%s-%s"
+
+	// ScoreResponsePrefix, FeedbackResponsePrefix and AnswerResponsePrefix are the prefixes shared by all keys
+	// containing scoreResponse, feedbackResponse and answerResponse objects respectively.
+	ScoreResponsePrefix    = "Score-"
+	FeedbackResponsePrefix = "Feedback-"
+	AnswerResponsePrefix   = "Answer-"
+
+	// SurveySentCountKey is used to store the number of users that have been sent a given NPS survey. It should
+	// contain the survey ID like "SurveySentCount-5.10.0".
+	SurveySentCountKey = "SurveySentCount-%s"
+
+	// SurveyDefinitionKey is used to store the surveyDefinition describing the questions that are asked by surveys.
+	SurveyDefinitionKey = "SurveyDefinition"
+
+	// TelemetryEventKey is used to store a telemetryEvent recorded by the KV telemetry sink. It should contain the
+	// time that the event was recorded in milliseconds and a unique ID like "TelemetryEvent-1552331717000-abc123".
+	TelemetryEventKey = "TelemetryEvent-%d-%s"
+
+	// TelemetryEventPrefix is the prefix shared by all keys containing telemetryEvent objects.
+	TelemetryEventPrefix = "TelemetryEvent-"
+
+	// AnonymizationSaltKey is used to store the secret salt used to hash user IDs. See getAnonymizationSalt.
+	AnonymizationSaltKey = "AnonymizationSalt"
+
+	// OutgoingWebhookSecretKey is used to store the secret that requests to an outgoing webhook are signed with. It
+	// should contain the hash of the webhook's URL. See getOutgoingWebhookSecret.
+	OutgoingWebhookSecretKey = "OutgoingWebhookSecret-%s"
+
+	// OutboxEventKey is used to store an outboxEvent that is waiting to be sent to the configured telemetry sink. It
+	// should contain the event's ID like "OutboxEvent-abc123".
+	OutboxEventKey = "OutboxEvent-%s"
+
+	// DeadLetterEventKey is used to store an outboxEvent that couldn't be sent after OutboxMaxAttempts. It should
+	// contain the event's ID like "DeadLetterEvent-abc123".
+	DeadLetterEventKey = "DeadLetterEvent-%s"
+
+	// OutboxEventPrefix and DeadLetterEventPrefix are the prefixes shared by all keys containing queued and
+	// dead-lettered outboxEvent objects respectively.
+	OutboxEventPrefix     = "OutboxEvent-"
+	DeadLetterEventPrefix = "DeadLetterEvent-"
+
+	// LastJobRunKey is used to store the last time.Time that any instance of the plugin ran the background job.
+	LastJobRunKey = "LastJobRun"
+
 	FeedbackbotDescription = "Feedbackbot collects user feedback to improve Mattermost. [Learn more](https://mattermost.com/pl/default-nps)."
 )
 
@@ -60,17 +133,34 @@ type Plugin struct {
 	// activated is used to track whether or not OnActivate has initialized the plugin state.
 	activated bool
 
-	// welcomeFeedbackAfter is the date after which new users can get the welcome feedback post.
-	welcomeFeedbackAfter time.Time
+	// welcomeFeedbackEnabledAt is when the welcome feedback was first enabled on this server. See
+	// getWelcomeFeedbackAfter.
+	welcomeFeedbackEnabledAt time.Time
 
 	botUserID string
 
+	// translations maps each supported locale to the translated text of each message. See loadTranslations.
+	translations map[string]map[string]string
+
+	// telemetryLock synchronizes access to the telemetryClient and tracker, which are replaced when the configuration
+	// changes while the background job may be sending events with them.
+	telemetryLock   sync.RWMutex
 	telemetryClient telemetry.Client
 	tracker         telemetry.Tracker
 
+	// telemetryFileLock synchronizes writes to the file used by the file telemetry sink.
+	telemetryFileLock sync.Mutex
+
 	// now provides access to time.Now in a way that is mockable for unit testing.
 	now func() time.Time
 
+	// backgroundJobStop is closed to stop the background job started by startBackgroundJob.
+	backgroundJobStop chan struct{}
+
+	// outboxEvents receives newly queued events so that the worker started by startBackgroundJob sends them right
+	// away. It's nil until the background job has been started.
+	outboxEvents chan *outboxEvent
+
 	// readFile provides access to os.ReadFile in a way that is mockable for unit testing.
 	readFile func(path string) ([]byte, error)
 }
@@ -0,0 +1,154 @@
+// Copyright (c) 2019-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"fmt"
+	"html/template"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	// PreferredChannelDM and PreferredChannelEmail are how a user can choose to be told about new surveys. Surveys are
+	// always sent as DMs since they can only be answered in Mattermost, but users who prefer email are also emailed
+	// when they're sent one.
+	PreferredChannelDM    = "dm"
+	PreferredChannelEmail = "email"
+)
+
+// userPreferences are the choices that a user has made about what Feedbackbot sends them. The zero value is the
+// default, which sends everything.
+type userPreferences struct {
+	DisableSurveys         bool `json:"disable_surveys"`
+	DisableWelcomeFeedback bool `json:"disable_welcome_feedback"`
+
+	// DisableFeedbackPrompts stops Feedbackbot from asking the user to explain their answers after they answer a
+	// survey.
+	DisableFeedbackPrompts bool `json:"disable_feedback_prompts"`
+
+	PreferredChannel string `json:"preferred_channel"`
+}
+
+// IsValid returns an error if the preferences can't be stored.
+func (p *userPreferences) IsValid() error {
+	switch p.PreferredChannel {
+	case "", PreferredChannelDM, PreferredChannelEmail:
+		return nil
+	default:
+		return errors.Errorf("invalid preferred channel %q", p.PreferredChannel)
+	}
+}
+
+// getPreferredChannel returns how the user wants to be told about new surveys.
+func (p *userPreferences) getPreferredChannel() string {
+	if p.PreferredChannel == "" {
+		return PreferredChannelDM
+	}
+
+	return p.PreferredChannel
+}
+
+// getUserPreferences returns the user's preferences, or the default preferences if they've never set any. Users who
+// opted out of surveys before preferences existed have it stored in their survey state instead, so surveys are
+// disabled for them until they're enabled again.
+func (p *Plugin) getUserPreferences(userID string) (*userPreferences, *model.AppError) {
+	var preferences *userPreferences
+	if err := p.KVGet(fmt.Sprintf(UserPreferencesKey, userID), &preferences); err != nil {
+		return nil, err
+	}
+
+	if preferences == nil {
+		preferences = &userPreferences{}
+	}
+
+	var userSurvey *userSurveyState
+	if err := p.KVGet(fmt.Sprintf(UserSurveyKey, userID), &userSurvey); err != nil {
+		return nil, err
+	}
+
+	if userSurvey != nil && userSurvey.Disabled {
+		preferences.DisableSurveys = true
+	}
+
+	return preferences, nil
+}
+
+// wantsFeedbackPrompts returns whether or not the user should be asked to explain their answers to a survey. Users
+// are asked if their preferences can't be loaded.
+func (p *Plugin) wantsFeedbackPrompts(userID string) bool {
+	preferences, err := p.getUserPreferences(userID)
+	if err != nil {
+		p.API.LogWarn("Failed to get user preferences", "err", err)
+		return true
+	}
+
+	return !preferences.DisableFeedbackPrompts
+}
+
+// updateUserPreferences changes the user's preferences using the given function and stores the result. Users who
+// opted out of surveys before preferences existed have it stored in their survey state instead, so that's cleared
+// when the user enables surveys again.
+func (p *Plugin) updateUserPreferences(userID string, update func(preferences *userPreferences)) (*userPreferences, *model.AppError) {
+	preferences, err := p.getUserPreferences(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	wasDisabled := preferences.DisableSurveys
+
+	update(preferences)
+
+	if err = p.KVSet(fmt.Sprintf(UserPreferencesKey, userID), preferences); err != nil {
+		return nil, err
+	}
+
+	if preferences.DisableSurveys {
+		if !wasDisabled {
+			p.sendUserDisabledEvent(userID, p.now().UTC().UnixMilli())
+		}
+
+		return preferences, nil
+	}
+
+	if !wasDisabled {
+		return preferences, nil
+	}
+
+	var userSurvey *userSurveyState
+	if err = p.KVGet(fmt.Sprintf(UserSurveyKey, userID), &userSurvey); err != nil {
+		return nil, err
+	}
+
+	if userSurvey != nil && userSurvey.Disabled {
+		userSurvey.Disabled = false
+
+		if err = p.KVSet(fmt.Sprintf(UserSurveyKey, userID), userSurvey); err != nil {
+			return nil, err
+		}
+	}
+
+	return preferences, nil
+}
+
+// setSurveysDisabledForUser stores whether or not the user has opted out of surveys.
+func (p *Plugin) setSurveysDisabledForUser(userID string, disabled bool) *model.AppError {
+	_, err := p.updateUserPreferences(userID, func(preferences *userPreferences) {
+		preferences.DisableSurveys = disabled
+	})
+
+	return err
+}
+
+// sendSurveyEmail tells a user who prefers email that they've been sent a survey. The email is written in the user's
+// locale.
+func (p *Plugin) sendSurveyEmail(user *model.User) *model.AppError {
+	data := p.getMessageTemplateData(user)
+
+	subject := p.translate(user.Locale, surveyEmailSubject, data.SiteName)
+	body := p.translate(user.Locale, surveyEmailBody, template.HTMLEscapeString(data.SiteURL))
+
+	return p.API.SendMail(user.Email, subject, body)
+}
@@ -0,0 +1,196 @@
+// Copyright (c) 2019-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserPreferencesIsValid(t *testing.T) {
+	assert.NoError(t, (&userPreferences{}).IsValid())
+	assert.NoError(t, (&userPreferences{PreferredChannel: PreferredChannelDM}).IsValid())
+	assert.NoError(t, (&userPreferences{PreferredChannel: PreferredChannelEmail}).IsValid())
+	assert.Error(t, (&userPreferences{PreferredChannel: "sms"}).IsValid())
+}
+
+func TestGetUserPreferences(t *testing.T) {
+	userID := model.NewId()
+
+	t.Run("should return the defaults for a user without any preferences", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVGet", fmt.Sprintf(UserPreferencesKey, userID)).Return(nil, nil)
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, userID)).Return(nil, nil)
+		defer api.AssertExpectations(t)
+
+		p := &Plugin{}
+		p.SetAPI(api)
+
+		preferences, err := p.getUserPreferences(userID)
+
+		require.Nil(t, err)
+		assert.Equal(t, &userPreferences{}, preferences)
+	})
+
+	t.Run("should disable surveys for a user who opted out before preferences existed", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVGet", fmt.Sprintf(UserPreferencesKey, userID)).Return(mustMarshalJSON(&userPreferences{PreferredChannel: PreferredChannelEmail}), nil)
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, userID)).Return(mustMarshalJSON(&userSurveyState{SurveyID: "5.10.0", Disabled: true}), nil)
+		defer api.AssertExpectations(t)
+
+		p := &Plugin{}
+		p.SetAPI(api)
+
+		preferences, err := p.getUserPreferences(userID)
+
+		require.Nil(t, err)
+		assert.Equal(t, &userPreferences{DisableSurveys: true, PreferredChannel: PreferredChannelEmail}, preferences)
+	})
+}
+
+func TestUpdateUserPreferences(t *testing.T) {
+	userID := model.NewId()
+	now := toDate(2019, time.May, 10)
+
+	t.Run("should store the defaults for a user without any preferences", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVGet", fmt.Sprintf(UserPreferencesKey, userID)).Return(nil, nil)
+		api.On("KVSet", fmt.Sprintf(UserPreferencesKey, userID), mustMarshalJSON(&userPreferences{DisableWelcomeFeedback: true})).Return(nil)
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, userID)).Return(nil, nil)
+		defer api.AssertExpectations(t)
+
+		p := &Plugin{}
+		p.SetAPI(api)
+
+		preferences, err := p.updateUserPreferences(userID, func(preferences *userPreferences) {
+			preferences.DisableWelcomeFeedback = true
+		})
+
+		require.Nil(t, err)
+		assert.Equal(t, &userPreferences{DisableWelcomeFeedback: true}, preferences)
+	})
+
+	t.Run("should clear an opt-out stored before preferences existed", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVGet", fmt.Sprintf(UserPreferencesKey, userID)).Return(nil, nil)
+		api.On("KVSet", fmt.Sprintf(UserPreferencesKey, userID), mustMarshalJSON(&userPreferences{})).Return(nil)
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, userID)).Return(mustMarshalJSON(&userSurveyState{SurveyID: "5.10.0", SentAt: now, Disabled: true}), nil)
+		api.On("KVSet", fmt.Sprintf(UserSurveyKey, userID), mustMarshalJSON(&userSurveyState{SurveyID: "5.10.0", SentAt: now})).Return(nil)
+		defer api.AssertExpectations(t)
+
+		p := &Plugin{}
+		p.SetAPI(api)
+
+		err := p.setSurveysDisabledForUser(userID, false)
+
+		assert.Nil(t, err)
+	})
+
+	t.Run("should keep surveys disabled when a user who opted out before preferences existed changes another setting", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVGet", fmt.Sprintf(UserPreferencesKey, userID)).Return(nil, nil)
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, userID)).Return(mustMarshalJSON(&userSurveyState{SurveyID: "5.10.0", SentAt: now, Disabled: true}), nil)
+		api.On("KVSet", fmt.Sprintf(UserPreferencesKey, userID), mustMarshalJSON(&userPreferences{
+			DisableSurveys:         true,
+			DisableWelcomeFeedback: true,
+		})).Return(nil)
+		defer api.AssertExpectations(t)
+
+		p := &Plugin{}
+		p.SetAPI(api)
+
+		preferences, err := p.updateUserPreferences(userID, func(preferences *userPreferences) {
+			preferences.DisableWelcomeFeedback = true
+		})
+
+		require.Nil(t, err)
+		assert.Equal(t, &userPreferences{DisableSurveys: true, DisableWelcomeFeedback: true}, preferences)
+		api.AssertNotCalled(t, "KVSet", fmt.Sprintf(UserSurveyKey, userID), mock.Anything)
+	})
+
+	t.Run("should not report an opt-out twice", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVGet", fmt.Sprintf(UserPreferencesKey, userID)).Return(mustMarshalJSON(&userPreferences{DisableSurveys: true}), nil)
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, userID)).Return(nil, nil)
+		api.On("KVSet", fmt.Sprintf(UserPreferencesKey, userID), mustMarshalJSON(&userPreferences{DisableSurveys: true})).Return(nil)
+		defer api.AssertExpectations(t)
+
+		p := &Plugin{}
+		p.SetAPI(api)
+
+		err := p.setSurveysDisabledForUser(userID, true)
+
+		assert.Nil(t, err)
+	})
+
+	t.Run("should return an error if unable to store the preferences", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVGet", fmt.Sprintf(UserPreferencesKey, userID)).Return(nil, nil)
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, userID)).Return(nil, nil)
+		api.On("KVSet", fmt.Sprintf(UserPreferencesKey, userID), mustMarshalJSON(&userPreferences{PreferredChannel: PreferredChannelEmail})).Return(&model.AppError{})
+		defer api.AssertExpectations(t)
+
+		p := &Plugin{}
+		p.SetAPI(api)
+
+		_, err := p.updateUserPreferences(userID, func(preferences *userPreferences) {
+			preferences.PreferredChannel = PreferredChannelEmail
+		})
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestSendSurveyEmail(t *testing.T) {
+	makeAPIMock := func() *plugintest.API {
+		api := makeAPIMock()
+		api.On("GetConfig").Return(&model.Config{
+			ServiceSettings: model.ServiceSettings{SiteURL: model.NewString("https://mattermost.example.com")},
+			TeamSettings:    model.TeamSettings{SiteName: model.NewString("Example")},
+		})
+
+		return api
+	}
+
+	t.Run("should email the user in English by default", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("SendMail", "user@example.com", "[Example] Feedbackbot sent you a survey", fmt.Sprintf(surveyEmailBody.Other, "https://mattermost.example.com")).Return(nil)
+		defer api.AssertExpectations(t)
+
+		p := &Plugin{configuration: &configuration{}}
+		p.SetAPI(api)
+
+		err := p.sendSurveyEmail(&model.User{Id: model.NewId(), Email: "user@example.com"})
+
+		assert.Nil(t, err)
+	})
+
+	t.Run("should email the user in their locale", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("SendMail", "user@example.com", "[Example] Feedbackbot vous a envoyé une enquête", "Ouvrez https://mattermost.example.com").Return(nil)
+		defer api.AssertExpectations(t)
+
+		p := &Plugin{
+			configuration: &configuration{},
+			translations: map[string]map[string]string{
+				"fr": {
+					surveyEmailSubject.ID: "[%s] Feedbackbot vous a envoyé une enquête",
+					surveyEmailBody.ID:    "Ouvrez %[1]s",
+				},
+			},
+		}
+		p.SetAPI(api)
+
+		err := p.sendSurveyEmail(&model.User{Id: model.NewId(), Email: "user@example.com", Locale: "fr"})
+
+		assert.Nil(t, err)
+	})
+}
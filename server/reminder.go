@@ -0,0 +1,108 @@
+// Copyright (c) 2019-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// getTimeUntilSurveyReminder returns how long after a user is sent a survey that they're reminded about it, or 0 if
+// users are never reminded.
+func (c *configuration) getTimeUntilSurveyReminder() time.Duration {
+	if c.DaysUntilSurveyReminder <= 0 {
+		return 0
+	}
+
+	return time.Duration(c.DaysUntilSurveyReminder) * day
+}
+
+// checkForSurveyReminder reminds the user to answer the last survey that they were sent if they haven't answered it
+// after the configured number of days. Each user is only ever reminded once about each survey.
+func (p *Plugin) checkForSurveyReminder(user *model.User, now time.Time) (bool, *model.AppError) {
+	config := p.getConfiguration()
+	if !config.EnableSurvey {
+		// Surveys are disabled
+		return false, nil
+	}
+
+	timeUntilReminder := config.getTimeUntilSurveyReminder()
+	if timeUntilReminder == 0 {
+		// Reminders are disabled
+		return false, nil
+	}
+
+	var userSurvey *userSurveyState
+	if err := p.KVGet(fmt.Sprintf(UserSurveyKey, user.Id), &userSurvey); err != nil {
+		return false, err
+	}
+
+	if userSurvey == nil || len(userSurvey.getQuestionPostIDs()) == 0 {
+		// The user hasn't been sent a survey to answer
+		return false, nil
+	}
+
+	if userSurvey.Disabled {
+		// The user explicitly disabled surveys before preferences existed
+		return false, nil
+	}
+
+	if !userSurvey.AnsweredAt.IsZero() || !userSurvey.ReminderSentAt.IsZero() {
+		// The user has already answered the survey or been reminded about it
+		return false, nil
+	}
+
+	if now.Sub(userSurvey.SentAt) < timeUntilReminder {
+		// Not enough time has passed since the user was sent the survey
+		return false, nil
+	}
+
+	preferences, err := p.getUserPreferences(user.Id)
+	if err != nil {
+		return false, err
+	}
+
+	if preferences.DisableSurveys {
+		// The user opted out of surveys
+		return false, nil
+	}
+
+	if !config.isInDeliveryWindow(user, now) {
+		// It's outside of the hours when the user can receive surveys, so try again later
+		return false, nil
+	}
+
+	var survey *surveyState
+	if err := p.KVGet(fmt.Sprintf(SurveyKey, userSurvey.getSurveyID()), &survey); err != nil {
+		return false, err
+	}
+
+	if survey != nil && survey.hasEnded(now) {
+		// The survey can no longer be answered
+		return false, nil
+	}
+
+	return true, p.sendSurveyReminder(user, userSurvey, now)
+}
+
+// sendSurveyReminder replies to the first question post of the user's survey to remind them to answer it. The
+// reminder is recorded before it's sent so that a failure to store it can never cause the user to be reminded twice.
+func (p *Plugin) sendSurveyReminder(user *model.User, userSurvey *userSurveyState, now time.Time) *model.AppError {
+	p.API.LogDebug("Sending survey reminder", "user_id", user.Id)
+
+	userSurvey.ReminderSentAt = now
+
+	if err := p.KVSet(fmt.Sprintf(UserSurveyKey, user.Id), userSurvey); err != nil {
+		return err
+	}
+
+	_, err := p.CreateBotDMPost(user.Id, &model.Post{
+		RootId:  userSurvey.getQuestionPostIDs()[0],
+		Message: p.translate(user.Locale, surveyReminderBody),
+	})
+
+	return err
+}
@@ -0,0 +1,251 @@
+// Copyright (c) 2019-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCheckForSurveyReminder(t *testing.T) {
+	botUserID := model.NewId()
+	now := toDate(2019, time.May, 10)
+	sentAt := now.Add(-7 * day)
+	surveyID := "2019-Q2"
+
+	makePlugin := func(api *plugintest.API) *Plugin {
+		p := &Plugin{
+			botUserID: botUserID,
+			configuration: &configuration{
+				EnableSurvey:            true,
+				DaysUntilSurveyReminder: 7,
+			},
+		}
+		p.SetAPI(api)
+
+		return p
+	}
+
+	t.Run("should reply to the survey post", func(t *testing.T) {
+		user := &model.User{Id: model.NewId()}
+		scorePostID := model.NewId()
+		channel := &model.Channel{Id: model.NewId()}
+
+		api := makeAPIMock()
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, user.Id)).Return(mustMarshalJSON(&userSurveyState{
+			SurveyID:    surveyID,
+			SentAt:      sentAt,
+			ScorePostID: scorePostID,
+		}), nil)
+		api.On("KVGet", fmt.Sprintf(UserPreferencesKey, user.Id)).Return(nil, nil)
+		api.On("KVGet", fmt.Sprintf(SurveyKey, surveyID)).Return(mustMarshalJSON(&surveyState{
+			ID:      surveyID,
+			StartAt: sentAt,
+			EndAt:   now.Add(day),
+		}), nil)
+		api.On("KVSet", fmt.Sprintf(UserSurveyKey, user.Id), mustMarshalJSON(&userSurveyState{
+			SurveyID:       surveyID,
+			SentAt:         sentAt,
+			ScorePostID:    scorePostID,
+			ReminderSentAt: now,
+		})).Return(nil)
+		api.On("GetDirectChannel", user.Id, botUserID).Return(channel, nil)
+		api.On("CreatePost", &model.Post{
+			UserId:    botUserID,
+			ChannelId: channel.Id,
+			RootId:    scorePostID,
+			Message:   surveyReminderBody.Other,
+		}).Return(&model.Post{}, nil)
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api)
+		sent, err := p.checkForSurveyReminder(user, now)
+
+		assert.True(t, sent)
+		assert.Nil(t, err)
+	})
+
+	t.Run("should reply to the first question post of a survey without an NPS question", func(t *testing.T) {
+		user := &model.User{Id: model.NewId()}
+		questionPostIDs := []string{model.NewId(), model.NewId()}
+		channel := &model.Channel{Id: model.NewId()}
+
+		api := makeAPIMock()
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, user.Id)).Return(mustMarshalJSON(&userSurveyState{
+			SurveyID:        surveyID,
+			SentAt:          sentAt,
+			QuestionPostIDs: questionPostIDs,
+		}), nil)
+		api.On("KVGet", fmt.Sprintf(UserPreferencesKey, user.Id)).Return(nil, nil)
+		api.On("KVGet", fmt.Sprintf(SurveyKey, surveyID)).Return(mustMarshalJSON(&surveyState{
+			ID:      surveyID,
+			StartAt: sentAt,
+			EndAt:   now.Add(day),
+		}), nil)
+		api.On("KVSet", fmt.Sprintf(UserSurveyKey, user.Id), mustMarshalJSON(&userSurveyState{
+			SurveyID:        surveyID,
+			SentAt:          sentAt,
+			QuestionPostIDs: questionPostIDs,
+			ReminderSentAt:  now,
+		})).Return(nil)
+		api.On("GetDirectChannel", user.Id, botUserID).Return(channel, nil)
+		api.On("CreatePost", &model.Post{
+			UserId:    botUserID,
+			ChannelId: channel.Id,
+			RootId:    questionPostIDs[0],
+			Message:   surveyReminderBody.Other,
+		}).Return(&model.Post{}, nil)
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api)
+		sent, err := p.checkForSurveyReminder(user, now)
+
+		assert.True(t, sent)
+		assert.Nil(t, err)
+	})
+
+	t.Run("should not remind users when reminders are disabled", func(t *testing.T) {
+		api := makeAPIMock()
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api)
+		p.configuration.DaysUntilSurveyReminder = 0
+
+		sent, err := p.checkForSurveyReminder(&model.User{Id: model.NewId()}, now)
+
+		assert.False(t, sent)
+		assert.Nil(t, err)
+	})
+
+	for _, test := range []struct {
+		Name       string
+		UserSurvey *userSurveyState
+	}{
+		{
+			Name:       "the user was never sent a survey",
+			UserSurvey: nil,
+		},
+		{
+			Name:       "the user disabled surveys",
+			UserSurvey: &userSurveyState{SurveyID: surveyID, SentAt: sentAt, ScorePostID: model.NewId(), Disabled: true},
+		},
+		{
+			Name:       "the user answered the survey",
+			UserSurvey: &userSurveyState{SurveyID: surveyID, SentAt: sentAt, ScorePostID: model.NewId(), AnsweredAt: now},
+		},
+		{
+			Name:       "the user was already reminded",
+			UserSurvey: &userSurveyState{SurveyID: surveyID, SentAt: sentAt, ScorePostID: model.NewId(), ReminderSentAt: now.Add(-1 * day)},
+		},
+		{
+			Name:       "the survey was sent recently",
+			UserSurvey: &userSurveyState{SurveyID: surveyID, SentAt: now.Add(-6 * day), ScorePostID: model.NewId()},
+		},
+	} {
+		t.Run("should not remind the user if "+test.Name, func(t *testing.T) {
+			user := &model.User{Id: model.NewId()}
+
+			api := makeAPIMock()
+			api.On("KVGet", fmt.Sprintf(UserSurveyKey, user.Id)).Return(mustMarshalJSON(test.UserSurvey), nil)
+			defer api.AssertExpectations(t)
+
+			p := makePlugin(api)
+			sent, err := p.checkForSurveyReminder(user, now)
+
+			assert.False(t, sent)
+			assert.Nil(t, err)
+		})
+	}
+
+	t.Run("should not remind the user if the survey has ended", func(t *testing.T) {
+		user := &model.User{Id: model.NewId()}
+
+		api := makeAPIMock()
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, user.Id)).Return(mustMarshalJSON(&userSurveyState{
+			SurveyID:    surveyID,
+			SentAt:      sentAt,
+			ScorePostID: model.NewId(),
+		}), nil)
+		api.On("KVGet", fmt.Sprintf(UserPreferencesKey, user.Id)).Return(nil, nil)
+		api.On("KVGet", fmt.Sprintf(SurveyKey, surveyID)).Return(mustMarshalJSON(&surveyState{
+			ID:      surveyID,
+			StartAt: sentAt,
+			EndAt:   now,
+		}), nil)
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api)
+		sent, err := p.checkForSurveyReminder(user, now)
+
+		assert.False(t, sent)
+		assert.Nil(t, err)
+	})
+
+	t.Run("should not remind the user if they opted out in their preferences", func(t *testing.T) {
+		user := &model.User{Id: model.NewId()}
+
+		api := makeAPIMock()
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, user.Id)).Return(mustMarshalJSON(&userSurveyState{
+			SurveyID:    surveyID,
+			SentAt:      sentAt,
+			ScorePostID: model.NewId(),
+		}), nil)
+		api.On("KVGet", fmt.Sprintf(UserPreferencesKey, user.Id)).Return(mustMarshalJSON(&userPreferences{DisableSurveys: true}), nil)
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api)
+		sent, err := p.checkForSurveyReminder(user, now)
+
+		assert.False(t, sent)
+		assert.Nil(t, err)
+	})
+
+	t.Run("should not remind the user outside of the delivery window", func(t *testing.T) {
+		user := &model.User{Id: model.NewId()}
+
+		api := makeAPIMock()
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, user.Id)).Return(mustMarshalJSON(&userSurveyState{
+			SurveyID:    surveyID,
+			SentAt:      sentAt,
+			ScorePostID: model.NewId(),
+		}), nil)
+		api.On("KVGet", fmt.Sprintf(UserPreferencesKey, user.Id)).Return(nil, nil)
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api)
+		p.configuration.SurveyDeliveryStartHour = 10
+		p.configuration.SurveyDeliveryEndHour = 16
+
+		sent, err := p.checkForSurveyReminder(user, now)
+
+		assert.False(t, sent)
+		assert.Nil(t, err)
+	})
+
+	t.Run("should not send the reminder if unable to record it", func(t *testing.T) {
+		user := &model.User{Id: model.NewId()}
+
+		api := makeAPIMock()
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, user.Id)).Return(mustMarshalJSON(&userSurveyState{
+			SurveyID:    surveyID,
+			SentAt:      sentAt,
+			ScorePostID: model.NewId(),
+		}), nil)
+		api.On("KVGet", fmt.Sprintf(UserPreferencesKey, user.Id)).Return(nil, nil)
+		api.On("KVGet", fmt.Sprintf(SurveyKey, surveyID)).Return(nil, nil)
+		api.On("KVSet", fmt.Sprintf(UserSurveyKey, user.Id), mock.Anything).Return(&model.AppError{})
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api)
+		_, err := p.checkForSurveyReminder(user, now)
+
+		assert.NotNil(t, err)
+	})
+}
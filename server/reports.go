@@ -0,0 +1,173 @@
+// Copyright (c) 2019-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// npsReport summarizes the scores given to a single survey. Despite its name, it also includes the results of the
+// CSAT and CES questions if they were asked.
+type npsReport struct {
+	SurveyID      string `json:"survey_id"`
+	ServerVersion string `json:"server_version"`
+
+	// Promoters, Passives and Detractors are the number of users who gave a score of 9-10, 7-8 and 0-6 respectively.
+	Promoters  int `json:"promoters"`
+	Passives   int `json:"passives"`
+	Detractors int `json:"detractors"`
+
+	// Responses is the number of users who answered the survey, and Sent is the number of users who received it.
+	Responses int   `json:"responses"`
+	Sent      int64 `json:"sent"`
+
+	// NPS is the percentage of promoters minus the percentage of detractors, ranging from -100 to 100.
+	NPS float64 `json:"nps"`
+
+	// ResponseRate is the fraction of users who received the survey that answered it, ranging from 0 to 1.
+	ResponseRate float64 `json:"response_rate"`
+
+	// CSAT and CES summarize the scores given to the CSAT and CES questions if the survey asked them.
+	CSAT *scoreSummary `json:"csat,omitempty"`
+	CES  *scoreSummary `json:"ces,omitempty"`
+}
+
+func (r *npsReport) addScore(score int) {
+	switch getNPSSegment(score) {
+	case NPSSegmentPromoter:
+		r.Promoters++
+	case NPSSegmentPassive:
+		r.Passives++
+	default:
+		r.Detractors++
+	}
+
+	r.Responses++
+}
+
+func (r *npsReport) computeTotals() {
+	if r.Responses > 0 {
+		r.NPS = float64(r.Promoters-r.Detractors) * 100 / float64(r.Responses)
+	}
+
+	if r.Sent > 0 {
+		r.ResponseRate = float64(r.Responses) / float64(r.Sent)
+	}
+
+	if r.CSAT != nil {
+		r.CSAT.computeTotals(getSurveyKind(QuestionTypeCSAT))
+	}
+
+	if r.CES != nil {
+		r.CES.computeTotals(getSurveyKind(QuestionTypeCES))
+	}
+}
+
+// getSummary returns the summary of the scores given to a CSAT or CES question, creating it if necessary.
+func (r *npsReport) getSummary(kind string) *scoreSummary {
+	summary := &r.CSAT
+	if kind == QuestionTypeCES {
+		summary = &r.CES
+	}
+
+	if *summary == nil {
+		*summary = &scoreSummary{}
+	}
+
+	return *summary
+}
+
+// getNPSReports aggregates every stored score into one report for each survey that has been scheduled or answered.
+// The reports are sorted by survey ID, which orders them chronologically within each survey schedule.
+func (p *Plugin) getNPSReports() ([]*npsReport, *model.AppError) {
+	reportsBySurvey := map[string]*npsReport{}
+	getReport := func(surveyID, serverVersion string) *npsReport {
+		report, ok := reportsBySurvey[surveyID]
+		if !ok {
+			report = &npsReport{SurveyID: surveyID}
+			reportsBySurvey[surveyID] = report
+		}
+
+		if report.ServerVersion == "" {
+			report.ServerVersion = serverVersion
+		}
+
+		return report
+	}
+
+	// Include surveys that haven't received any responses yet
+	if err := p.KVForEach(fmt.Sprintf(SurveyKey, ""), func(key string) (bool, *model.AppError) {
+		var survey *surveyState
+		if err := p.KVGet(key, &survey); err != nil {
+			return false, err
+		}
+
+		if survey != nil {
+			getReport(survey.getID(), survey.ServerVersion)
+		}
+
+		return true, nil
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := p.forEachScoreResponse(func(response *scoreResponse) (bool, *model.AppError) {
+		report := getReport(response.SurveyID, response.ServerVersion)
+
+		switch response.Kind {
+		case QuestionTypeNPS:
+			report.addScore(response.Score)
+		case QuestionTypeCSAT, QuestionTypeCES:
+			report.getSummary(response.Kind).addScore(response.Score)
+		}
+
+		return true, nil
+	}); err != nil {
+		return nil, err
+	}
+
+	reports := make([]*npsReport, 0, len(reportsBySurvey))
+	for _, report := range reportsBySurvey {
+		if err := p.KVGet(fmt.Sprintf(SurveySentCountKey, report.SurveyID), &report.Sent); err != nil {
+			return nil, err
+		}
+
+		report.computeTotals()
+
+		reports = append(reports, report)
+	}
+
+	sort.Slice(reports, func(i, j int) bool {
+		return compareVersions(reports[i].SurveyID, reports[j].SurveyID) < 0
+	})
+
+	return reports, nil
+}
+
+// compareVersions compares two dotted version strings numerically, returning a negative number if a comes before b,
+// a positive number if a comes after b, and zero if they're equal. Non-numeric parts are compared as strings.
+func compareVersions(a, b string) int {
+	aParts := strings.Split(a, ".")
+	bParts := strings.Split(b, ".")
+
+	for i := 0; i < len(aParts) && i < len(bParts); i++ {
+		aNum, aErr := strconv.Atoi(aParts[i])
+		bNum, bErr := strconv.Atoi(bParts[i])
+
+		if aErr == nil && bErr == nil {
+			if aNum != bNum {
+				return aNum - bNum
+			}
+		} else if c := strings.Compare(aParts[i], bParts[i]); c != 0 {
+			return c
+		}
+	}
+
+	return len(aParts) - len(bParts)
+}
@@ -0,0 +1,198 @@
+// Copyright (c) 2019-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetNPSReports(t *testing.T) {
+	t.Run("should aggregate scores by survey", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVList", 0, 100).Return([]string{
+			fmt.Sprintf(SurveyKey, "5.9.0"),
+			fmt.Sprintf(SurveyKey, "5.10.0"),
+			fmt.Sprintf(SurveyKey, "5.11.0"),
+			fmt.Sprintf(ScoreResponseKey, "5.10.0", "user1"),
+			fmt.Sprintf(ScoreResponseKey, "5.10.0", "user2"),
+			fmt.Sprintf(ScoreResponseKey, "5.10.0", "user3"),
+			fmt.Sprintf(ScoreResponseKey, "5.10.0", "user4"),
+			fmt.Sprintf(ScoreResponseKey, "5.9.0", "user1"),
+			fmt.Sprintf(UserSurveyKey, "user1"),
+		}, nil)
+		api.On("KVGet", fmt.Sprintf(ScoreResponseKey, "5.10.0", "user1")).Return(mustMarshalJSON(&scoreResponse{SurveyID: "5.10.0", ServerVersion: "5.10.0", Score: 10}), nil)
+		api.On("KVGet", fmt.Sprintf(ScoreResponseKey, "5.10.0", "user2")).Return(mustMarshalJSON(&scoreResponse{SurveyID: "5.10.0", ServerVersion: "5.10.0", Score: 9}), nil)
+		api.On("KVGet", fmt.Sprintf(ScoreResponseKey, "5.10.0", "user3")).Return(mustMarshalJSON(&scoreResponse{SurveyID: "5.10.0", ServerVersion: "5.10.0", Score: 7}), nil)
+		api.On("KVGet", fmt.Sprintf(ScoreResponseKey, "5.10.0", "user4")).Return(mustMarshalJSON(&scoreResponse{SurveyID: "5.10.0", ServerVersion: "5.10.0", Score: 2}), nil)
+		api.On("KVGet", fmt.Sprintf(ScoreResponseKey, "5.9.0", "user1")).Return(mustMarshalJSON(&scoreResponse{ServerVersion: "5.9.0", Score: 0}), nil)
+		api.On("KVGet", fmt.Sprintf(SurveyKey, "5.9.0")).Return(mustMarshalJSON(&surveyState{ServerVersion: "5.9.0"}), nil)
+		api.On("KVGet", fmt.Sprintf(SurveyKey, "5.10.0")).Return(mustMarshalJSON(&surveyState{ID: "5.10.0", ServerVersion: "5.10.0"}), nil)
+		api.On("KVGet", fmt.Sprintf(SurveyKey, "5.11.0")).Return(mustMarshalJSON(&surveyState{ID: "5.11.0", ServerVersion: "5.11.0"}), nil)
+		api.On("KVGet", fmt.Sprintf(SurveySentCountKey, "5.9.0")).Return([]byte("2"), nil)
+		api.On("KVGet", fmt.Sprintf(SurveySentCountKey, "5.10.0")).Return([]byte("8"), nil)
+		api.On("KVGet", fmt.Sprintf(SurveySentCountKey, "5.11.0")).Return(nil, nil)
+		defer api.AssertExpectations(t)
+
+		p := Plugin{}
+		p.SetAPI(api)
+
+		reports, err := p.getNPSReports()
+
+		require.Nil(t, err)
+		assert.Equal(t, []*npsReport{
+			{
+				SurveyID:      "5.9.0",
+				ServerVersion: "5.9.0",
+				Detractors:    1,
+				Responses:     1,
+				Sent:          2,
+				NPS:           -100,
+				ResponseRate:  0.5,
+			},
+			{
+				SurveyID:      "5.10.0",
+				ServerVersion: "5.10.0",
+				Promoters:     2,
+				Passives:      1,
+				Detractors:    1,
+				Responses:     4,
+				Sent:          8,
+				NPS:           25,
+				ResponseRate:  0.5,
+			},
+			{
+				SurveyID:      "5.11.0",
+				ServerVersion: "5.11.0",
+			},
+		}, reports)
+	})
+
+	t.Run("should aggregate scores by quarter", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVList", 0, 100).Return([]string{
+			fmt.Sprintf(SurveyKey, "2019-Q2"),
+			fmt.Sprintf(ScoreResponseKey, "2019-Q1", "user1"),
+			fmt.Sprintf(ScoreResponseKey, "2019-Q2", "user1"),
+			fmt.Sprintf(ScoreResponseKey, "2019-Q2", "user2"),
+		}, nil)
+		api.On("KVGet", fmt.Sprintf(SurveyKey, "2019-Q2")).Return(mustMarshalJSON(&surveyState{ID: "2019-Q2", ServerVersion: "5.11.0"}), nil)
+		api.On("KVGet", fmt.Sprintf(ScoreResponseKey, "2019-Q1", "user1")).Return(mustMarshalJSON(&scoreResponse{SurveyID: "2019-Q1", ServerVersion: "5.10.0", Score: 9}), nil)
+		api.On("KVGet", fmt.Sprintf(ScoreResponseKey, "2019-Q2", "user1")).Return(mustMarshalJSON(&scoreResponse{SurveyID: "2019-Q2", ServerVersion: "5.11.0", Score: 10}), nil)
+		api.On("KVGet", fmt.Sprintf(ScoreResponseKey, "2019-Q2", "user2")).Return(mustMarshalJSON(&scoreResponse{SurveyID: "2019-Q2", ServerVersion: "5.11.0", Score: 4}), nil)
+		api.On("KVGet", fmt.Sprintf(SurveySentCountKey, "2019-Q1")).Return([]byte("1"), nil)
+		api.On("KVGet", fmt.Sprintf(SurveySentCountKey, "2019-Q2")).Return([]byte("4"), nil)
+		defer api.AssertExpectations(t)
+
+		p := Plugin{}
+		p.SetAPI(api)
+
+		reports, err := p.getNPSReports()
+
+		require.Nil(t, err)
+		assert.Equal(t, []*npsReport{
+			{
+				SurveyID:      "2019-Q1",
+				ServerVersion: "5.10.0",
+				Promoters:     1,
+				Responses:     1,
+				Sent:          1,
+				NPS:           100,
+				ResponseRate:  1,
+			},
+			{
+				SurveyID:      "2019-Q2",
+				ServerVersion: "5.11.0",
+				Promoters:     1,
+				Detractors:    1,
+				Responses:     2,
+				Sent:          4,
+				NPS:           0,
+				ResponseRate:  0.5,
+			},
+		}, reports)
+	})
+
+	t.Run("should summarize CSAT and CES scores separately from NPS", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVList", 0, 100).Return([]string{
+			fmt.Sprintf(ScoreResponseKey, "2019-Q2", "user1"),
+			fmt.Sprintf(KindScoreResponseKey, "2019-Q2", QuestionTypeCSAT, "user1"),
+			fmt.Sprintf(KindScoreResponseKey, "2019-Q2", QuestionTypeCSAT, "user2"),
+			fmt.Sprintf(KindScoreResponseKey, "2019-Q2", QuestionTypeCES, "user1"),
+			fmt.Sprintf(KindScoreResponseKey, "2019-Q2", QuestionTypeCES, "user2"),
+		}, nil)
+		api.On("KVGet", fmt.Sprintf(ScoreResponseKey, "2019-Q2", "user1")).Return(mustMarshalJSON(&scoreResponse{SurveyID: "2019-Q2", ServerVersion: "5.11.0", Score: 10}), nil)
+		api.On("KVGet", fmt.Sprintf(KindScoreResponseKey, "2019-Q2", QuestionTypeCSAT, "user1")).Return(mustMarshalJSON(&scoreResponse{SurveyID: "2019-Q2", Kind: QuestionTypeCSAT, ServerVersion: "5.11.0", Score: 5}), nil)
+		api.On("KVGet", fmt.Sprintf(KindScoreResponseKey, "2019-Q2", QuestionTypeCSAT, "user2")).Return(mustMarshalJSON(&scoreResponse{SurveyID: "2019-Q2", Kind: QuestionTypeCSAT, ServerVersion: "5.11.0", Score: 2}), nil)
+		api.On("KVGet", fmt.Sprintf(KindScoreResponseKey, "2019-Q2", QuestionTypeCES, "user1")).Return(mustMarshalJSON(&scoreResponse{SurveyID: "2019-Q2", Kind: QuestionTypeCES, ServerVersion: "5.11.0", Score: 6}), nil)
+		api.On("KVGet", fmt.Sprintf(KindScoreResponseKey, "2019-Q2", QuestionTypeCES, "user2")).Return(mustMarshalJSON(&scoreResponse{SurveyID: "2019-Q2", Kind: QuestionTypeCES, ServerVersion: "5.11.0", Score: 3}), nil)
+		api.On("KVGet", fmt.Sprintf(SurveySentCountKey, "2019-Q2")).Return([]byte("2"), nil)
+		defer api.AssertExpectations(t)
+
+		p := Plugin{}
+		p.SetAPI(api)
+
+		reports, err := p.getNPSReports()
+
+		require.Nil(t, err)
+		require.Len(t, reports, 1)
+		assert.Equal(t, 1, reports[0].Responses)
+		assert.Equal(t, 1, reports[0].Promoters)
+		assert.Equal(t, float64(100), reports[0].NPS)
+
+		require.NotNil(t, reports[0].CSAT)
+		assert.Equal(t, 2, reports[0].CSAT.Responses)
+		assert.Equal(t, float64(50), reports[0].CSAT.Score)
+
+		require.NotNil(t, reports[0].CES)
+		assert.Equal(t, 2, reports[0].CES.Responses)
+		assert.Equal(t, 4.5, reports[0].CES.Score)
+	})
+
+	t.Run("should return an error if unable to list keys", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVList", 0, 100).Return(nil, &model.AppError{})
+		defer api.AssertExpectations(t)
+
+		p := Plugin{}
+		p.SetAPI(api)
+
+		reports, err := p.getNPSReports()
+
+		assert.NotNil(t, err)
+		assert.Nil(t, reports)
+	})
+}
+
+func TestCompareVersions(t *testing.T) {
+	for _, test := range []struct {
+		A        string
+		B        string
+		Expected int
+	}{
+		{A: "5.10.0", B: "5.10.0", Expected: 0},
+		{A: "5.9.0", B: "5.10.0", Expected: -1},
+		{A: "5.10.0", B: "5.9.0", Expected: 1},
+		{A: "10.0.0", B: "9.11.0", Expected: 1},
+		{A: "5.10", B: "5.10.0", Expected: -1},
+	} {
+		t.Run(fmt.Sprintf("%s vs %s", test.A, test.B), func(t *testing.T) {
+			result := compareVersions(test.A, test.B)
+
+			switch {
+			case test.Expected < 0:
+				assert.Less(t, result, 0)
+			case test.Expected > 0:
+				assert.Greater(t, result, 0)
+			default:
+				assert.Equal(t, 0, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,240 @@
+// Copyright (c) 2019-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// scoreResponse is a score given by a user to a scored question like NPS, CSAT or CES. Only the most recent score
+// given by a user to each question of a survey is kept. Kind is the type of the question.
+type scoreResponse struct {
+	SurveyID      string    `json:"survey_id"`
+	Kind          string    `json:"kind"`
+	ServerVersion string    `json:"server_version"`
+	UserID        string    `json:"user_id"`
+	Score         int       `json:"score"`
+	CreateAt      time.Time `json:"create_at"`
+}
+
+// feedbackResponse is a message sent by a user to Feedbackbot. SurveyID is the survey cycle during which it was sent.
+// Context describes what prompted the message, such as the survey and score that it replies to.
+type feedbackResponse struct {
+	SurveyID      string           `json:"survey_id"`
+	ServerVersion string           `json:"server_version"`
+	UserID        string           `json:"user_id"`
+	PostID        string           `json:"post_id"`
+	Message       string           `json:"message"`
+	Email         string           `json:"email"`
+	CreateAt      time.Time        `json:"create_at"`
+	Context       *feedbackContext `json:"context,omitempty"`
+}
+
+// answerResponse is a user's answer to a question other than the NPS question. Only the most recent answer given by a
+// user to each question of a survey is kept.
+type answerResponse struct {
+	SurveyID      string    `json:"survey_id"`
+	ServerVersion string    `json:"server_version"`
+	UserID        string    `json:"user_id"`
+	QuestionID    string    `json:"question_id"`
+	Answer        string    `json:"answer"`
+	CreateAt      time.Time `json:"create_at"`
+}
+
+// getAnsweredSurvey returns the ID and server version of the survey that a user's answers are attributed to. That's
+// the survey that the user was last sent, falling back to the current survey cycle if they never received one.
+func (p *Plugin) getAnsweredSurvey(userID string, now time.Time) (string, string, *model.AppError) {
+	var userSurvey *userSurveyState
+	if err := p.KVGet(fmt.Sprintf(UserSurveyKey, userID), &userSurvey); err != nil {
+		return "", "", err
+	}
+
+	if userSurvey != nil && userSurvey.getSurveyID() != "" {
+		return userSurvey.getSurveyID(), userSurvey.ServerVersion, nil
+	}
+
+	return p.getSurveyCycle(now).ID, p.serverVersion, nil
+}
+
+// storeScoreResponse saves a user's score in the KV store so that survey results are available on this server
+// regardless of whether or not they reach telemetry. Anonymous scores are stored under the user's anonymous token
+// and only keep the day that they were given.
+func (p *Plugin) storeScoreResponse(userID, kind string, score int, now time.Time) *model.AppError {
+	surveyID, serverVersion, err := p.getAnsweredSurvey(userID, now)
+	if err != nil {
+		return err
+	}
+
+	if userID, err = p.getResponseUserID(surveyID, userID); err != nil {
+		return err
+	}
+
+	return p.KVSet(getScoreResponseKey(kind, surveyID, userID), &scoreResponse{
+		SurveyID:      surveyID,
+		Kind:          kind,
+		ServerVersion: serverVersion,
+		UserID:        userID,
+		Score:         score,
+		CreateAt:      p.getResponseTime(now),
+	})
+}
+
+// storeAnswerResponse saves a user's answer to a question in the KV store. Returns whether or not this is the first
+// time that the user has answered the question during this survey. Anonymous answers are stored under the user's
+// anonymous token and only keep the day that they were given.
+func (p *Plugin) storeAnswerResponse(userID, questionID, answer string, now time.Time) (bool, *model.AppError) {
+	surveyID, serverVersion, err := p.getAnsweredSurvey(userID, now)
+	if err != nil {
+		return false, err
+	}
+
+	if userID, err = p.getResponseUserID(surveyID, userID); err != nil {
+		return false, err
+	}
+
+	key := fmt.Sprintf(AnswerResponseKey, surveyID, questionID, userID)
+
+	var previous *answerResponse
+	if err = p.KVGet(key, &previous); err != nil {
+		return false, err
+	}
+
+	if err = p.KVSet(key, &answerResponse{
+		SurveyID:      surveyID,
+		ServerVersion: serverVersion,
+		UserID:        userID,
+		QuestionID:    questionID,
+		Answer:        answer,
+		CreateAt:      p.getResponseTime(now),
+	}); err != nil {
+		return false, err
+	}
+
+	return previous == nil, nil
+}
+
+// storeFeedbackResponse saves a message sent to Feedbackbot in the KV store.
+func (p *Plugin) storeFeedbackResponse(post *model.Post, email string, context *feedbackContext) *model.AppError {
+	createAt := time.UnixMilli(post.CreateAt).UTC()
+	surveyID := p.getSurveyCycle(createAt).ID
+
+	return p.KVSet(fmt.Sprintf(FeedbackResponseKey, surveyID, post.UserId, post.Id), &feedbackResponse{
+		SurveyID:      surveyID,
+		ServerVersion: p.serverVersion,
+		UserID:        post.UserId,
+		PostID:        post.Id,
+		Message:       post.Message,
+		Email:         email,
+		CreateAt:      createAt,
+		Context:       context,
+	})
+}
+
+// forEachScoreResponse calls f with every score stored in the KV store until f returns false or an error.
+func (p *Plugin) forEachScoreResponse(f func(response *scoreResponse) (bool, *model.AppError)) *model.AppError {
+	return p.KVForEach(ScoreResponsePrefix, func(key string) (bool, *model.AppError) {
+		response, err := p.getScoreResponse(key)
+		if err != nil {
+			return false, err
+		}
+
+		if response == nil {
+			// The score was deleted after the keys were listed
+			return true, nil
+		}
+
+		return f(response)
+	})
+}
+
+// getScoreResponse returns the score stored under the given key, or nil if there isn't one.
+func (p *Plugin) getScoreResponse(key string) (*scoreResponse, *model.AppError) {
+	var response *scoreResponse
+	if err := p.KVGet(key, &response); err != nil {
+		return nil, err
+	}
+
+	if response == nil {
+		return nil, nil
+	}
+
+	if response.SurveyID == "" {
+		// Responses stored before surveys had IDs belong to the survey for their server version
+		response.SurveyID = response.ServerVersion
+	}
+
+	if response.Kind == "" {
+		// Scores stored before other kinds of surveys existed are for the NPS question
+		response.Kind = QuestionTypeNPS
+	}
+
+	return response, nil
+}
+
+// forEachFeedbackResponse calls f with every piece of feedback stored in the KV store until f returns false or an
+// error.
+func (p *Plugin) forEachFeedbackResponse(f func(response *feedbackResponse) (bool, *model.AppError)) *model.AppError {
+	return p.KVForEach(FeedbackResponsePrefix, func(key string) (bool, *model.AppError) {
+		response, err := p.getFeedbackResponse(key)
+		if err != nil {
+			return false, err
+		}
+
+		if response == nil {
+			// The feedback was deleted after the keys were listed
+			return true, nil
+		}
+
+		return f(response)
+	})
+}
+
+// getFeedbackResponse returns the feedback stored under the given key, or nil if there isn't any.
+func (p *Plugin) getFeedbackResponse(key string) (*feedbackResponse, *model.AppError) {
+	var response *feedbackResponse
+	if err := p.KVGet(key, &response); err != nil {
+		return nil, err
+	}
+
+	if response == nil {
+		return nil, nil
+	}
+
+	if response.SurveyID == "" {
+		// Responses stored before surveys had IDs belong to the survey for their server version
+		response.SurveyID = response.ServerVersion
+	}
+
+	return response, nil
+}
+
+// forEachAnswerResponse calls f with every answer stored in the KV store until f returns false or an error.
+func (p *Plugin) forEachAnswerResponse(f func(response *answerResponse) (bool, *model.AppError)) *model.AppError {
+	return p.KVForEach(AnswerResponsePrefix, func(key string) (bool, *model.AppError) {
+		response, err := p.getAnswerResponse(key)
+		if err != nil {
+			return false, err
+		}
+
+		if response == nil {
+			// The answer was deleted after the keys were listed
+			return true, nil
+		}
+
+		return f(response)
+	})
+}
+
+// getAnswerResponse returns the answer stored under the given key, or nil if there isn't one.
+func (p *Plugin) getAnswerResponse(key string) (*answerResponse, *model.AppError) {
+	var response *answerResponse
+	if err := p.KVGet(key, &response); err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
@@ -0,0 +1,297 @@
+// Copyright (c) 2019-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestStoreScoreResponse(t *testing.T) {
+	userID := model.NewId()
+	now := toDate(2019, time.May, 10)
+
+	t.Run("should store the score for the survey that the user was sent", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, userID)).Return(mustMarshalJSON(&userSurveyState{
+			ServerVersion: "5.9.0",
+		}), nil)
+		api.On("KVSet", fmt.Sprintf(ScoreResponseKey, "5.9.0", userID), mustMarshalJSON(&scoreResponse{
+			SurveyID:      "5.9.0",
+			Kind:          QuestionTypeNPS,
+			ServerVersion: "5.9.0",
+			UserID:        userID,
+			Score:         8,
+			CreateAt:      now,
+		})).Return(nil)
+		defer api.AssertExpectations(t)
+
+		p := Plugin{
+			serverVersion: "5.10.0",
+		}
+		p.SetAPI(api)
+
+		err := p.storeScoreResponse(userID, QuestionTypeNPS, 8, now)
+
+		assert.Nil(t, err)
+	})
+
+	t.Run("should store the score for the current version if the user was never sent a survey", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, userID)).Return(nil, nil)
+		api.On("KVSet", fmt.Sprintf(ScoreResponseKey, "5.10.0", userID), mustMarshalJSON(&scoreResponse{
+			SurveyID:      "5.10.0",
+			Kind:          QuestionTypeNPS,
+			ServerVersion: "5.10.0",
+			UserID:        userID,
+			Score:         3,
+			CreateAt:      now,
+		})).Return(nil)
+		defer api.AssertExpectations(t)
+
+		p := Plugin{
+			serverVersion: "5.10.0",
+		}
+		p.SetAPI(api)
+
+		err := p.storeScoreResponse(userID, QuestionTypeNPS, 3, now)
+
+		assert.Nil(t, err)
+	})
+
+	t.Run("should store the score for the current quarter if the user was never sent a survey", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, userID)).Return(nil, nil)
+		api.On("KVSet", fmt.Sprintf(ScoreResponseKey, "2019-Q2", userID), mustMarshalJSON(&scoreResponse{
+			SurveyID:      "2019-Q2",
+			Kind:          QuestionTypeNPS,
+			ServerVersion: "5.10.0",
+			UserID:        userID,
+			Score:         3,
+			CreateAt:      now,
+		})).Return(nil)
+		defer api.AssertExpectations(t)
+
+		p := Plugin{
+			configuration: &configuration{
+				SurveySchedule: SurveyScheduleQuarterly,
+			},
+			serverVersion: "5.10.0",
+		}
+		p.SetAPI(api)
+
+		err := p.storeScoreResponse(userID, QuestionTypeNPS, 3, now)
+
+		assert.Nil(t, err)
+	})
+
+	t.Run("should store the score under an anonymous token for anonymous surveys", func(t *testing.T) {
+		salt := "abc123"
+		token := hashWithSalt(salt, "5.10.0:"+userID)
+
+		api := makeAPIMock()
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, userID)).Return(nil, nil)
+		api.On("KVGet", AnonymizationSaltKey).Return(mustMarshalJSON(salt), nil)
+		api.On("KVSet", fmt.Sprintf(ScoreResponseKey, "5.10.0", token), mustMarshalJSON(&scoreResponse{
+			SurveyID:      "5.10.0",
+			Kind:          QuestionTypeNPS,
+			ServerVersion: "5.10.0",
+			UserID:        token,
+			Score:         3,
+			CreateAt:      now,
+		})).Return(nil)
+		defer api.AssertExpectations(t)
+
+		p := Plugin{
+			configuration: &configuration{
+				EnableAnonymousSurveys: true,
+			},
+			serverVersion: "5.10.0",
+		}
+		p.SetAPI(api)
+
+		err := p.storeScoreResponse(userID, QuestionTypeNPS, 3, now.Add(13*time.Hour+25*time.Minute))
+
+		assert.Nil(t, err)
+	})
+
+	t.Run("should return an error if unable to get the user's survey state", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, userID)).Return(nil, &model.AppError{})
+		defer api.AssertExpectations(t)
+
+		p := Plugin{
+			serverVersion: "5.10.0",
+		}
+		p.SetAPI(api)
+
+		err := p.storeScoreResponse(userID, QuestionTypeNPS, 3, now)
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestStoreFeedbackResponse(t *testing.T) {
+	userID := model.NewId()
+	postID := model.NewId()
+	createAt := toDate(2019, time.May, 10)
+
+	t.Run("should store the feedback", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVSet", fmt.Sprintf(FeedbackResponseKey, "5.10.0", userID, postID), mustMarshalJSON(&feedbackResponse{
+			SurveyID:      "5.10.0",
+			ServerVersion: "5.10.0",
+			UserID:        userID,
+			PostID:        postID,
+			Message:       "It's great",
+			Email:         "user@example.com",
+			CreateAt:      createAt,
+		})).Return(nil)
+		defer api.AssertExpectations(t)
+
+		p := Plugin{
+			serverVersion: "5.10.0",
+		}
+		p.SetAPI(api)
+
+		err := p.storeFeedbackResponse(&model.Post{
+			Id:       postID,
+			UserId:   userID,
+			Message:  "It's great",
+			CreateAt: createAt.UnixMilli(),
+		}, "user@example.com", nil)
+
+		assert.Nil(t, err)
+	})
+
+	t.Run("should store the feedback for the quarter that it was sent in", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVSet", fmt.Sprintf(FeedbackResponseKey, "2019-Q2", userID, postID), mustMarshalJSON(&feedbackResponse{
+			SurveyID:      "2019-Q2",
+			ServerVersion: "5.10.0",
+			UserID:        userID,
+			PostID:        postID,
+			CreateAt:      createAt,
+		})).Return(nil)
+		defer api.AssertExpectations(t)
+
+		p := Plugin{
+			configuration: &configuration{
+				SurveySchedule: SurveyScheduleQuarterly,
+			},
+			serverVersion: "5.10.0",
+		}
+		p.SetAPI(api)
+
+		err := p.storeFeedbackResponse(&model.Post{
+			Id:       postID,
+			UserId:   userID,
+			CreateAt: createAt.UnixMilli(),
+		}, "", nil)
+
+		assert.Nil(t, err)
+	})
+
+	t.Run("should return an error if unable to save the feedback", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVSet", fmt.Sprintf(FeedbackResponseKey, "5.10.0", userID, postID), mustMarshalJSON(&feedbackResponse{
+			SurveyID:      "5.10.0",
+			ServerVersion: "5.10.0",
+			UserID:        userID,
+			PostID:        postID,
+			CreateAt:      createAt,
+		})).Return(&model.AppError{})
+		defer api.AssertExpectations(t)
+
+		p := Plugin{
+			serverVersion: "5.10.0",
+		}
+		p.SetAPI(api)
+
+		err := p.storeFeedbackResponse(&model.Post{
+			Id:       postID,
+			UserId:   userID,
+			CreateAt: createAt.UnixMilli(),
+		}, "", nil)
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestStoreAnswerResponse(t *testing.T) {
+	userID := model.NewId()
+	now := toDate(2019, time.May, 10)
+	answerKey := fmt.Sprintf(AnswerResponseKey, "5.9.0", "search", userID)
+
+	t.Run("should store the first answer for the survey that the user was sent", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, userID)).Return(mustMarshalJSON(&userSurveyState{
+			ServerVersion: "5.9.0",
+		}), nil)
+		api.On("KVGet", answerKey).Return(nil, nil)
+		api.On("KVSet", answerKey, mustMarshalJSON(&answerResponse{
+			SurveyID:      "5.9.0",
+			ServerVersion: "5.9.0",
+			UserID:        userID,
+			QuestionID:    "search",
+			Answer:        "4",
+			CreateAt:      now,
+		})).Return(nil)
+		defer api.AssertExpectations(t)
+
+		p := Plugin{
+			serverVersion: "5.10.0",
+		}
+		p.SetAPI(api)
+
+		isFirstAnswer, err := p.storeAnswerResponse(userID, "search", "4", now)
+
+		assert.Nil(t, err)
+		assert.True(t, isFirstAnswer)
+	})
+
+	t.Run("should replace a previous answer", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, userID)).Return(mustMarshalJSON(&userSurveyState{
+			ServerVersion: "5.9.0",
+		}), nil)
+		api.On("KVGet", answerKey).Return(mustMarshalJSON(&answerResponse{Answer: "2"}), nil)
+		api.On("KVSet", answerKey, mock.Anything).Return(nil)
+		defer api.AssertExpectations(t)
+
+		p := Plugin{
+			serverVersion: "5.10.0",
+		}
+		p.SetAPI(api)
+
+		isFirstAnswer, err := p.storeAnswerResponse(userID, "search", "4", now)
+
+		assert.Nil(t, err)
+		assert.False(t, isFirstAnswer)
+	})
+
+	t.Run("should return an error if unable to save the answer", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, userID)).Return(mustMarshalJSON(&userSurveyState{
+			ServerVersion: "5.9.0",
+		}), nil)
+		api.On("KVGet", answerKey).Return(nil, nil)
+		api.On("KVSet", answerKey, mock.Anything).Return(&model.AppError{})
+		defer api.AssertExpectations(t)
+
+		p := Plugin{
+			serverVersion: "5.10.0",
+		}
+		p.SetAPI(api)
+
+		_, err := p.storeAnswerResponse(userID, "search", "4", now)
+
+		assert.NotNil(t, err)
+	})
+}
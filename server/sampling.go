@@ -0,0 +1,54 @@
+// Copyright (c) 2019-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// DefaultSurveySamplePercentage is the percentage of eligible users who receive each survey by default.
+const DefaultSurveySamplePercentage = 100
+
+// getSurveySamplePercentage returns the percentage of eligible users who receive each survey.
+func (c *configuration) getSurveySamplePercentage() int {
+	if c.SurveySamplePercentage <= 0 {
+		return DefaultSurveySamplePercentage
+	}
+
+	return c.SurveySamplePercentage
+}
+
+// isUserSampled returns whether or not the user is part of the sample of users who receive the given survey. The
+// result is derived from a hash of the user and survey IDs, so it stays the same no matter how often it's checked or
+// which instance of the plugin checks it, but a different sample of users is chosen for each survey.
+func isUserSampled(userID, surveyID string, percentage int) bool {
+	if percentage >= 100 {
+		return true
+	}
+
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(userID + "-" + surveyID))
+
+	return int(hash.Sum32()%100) < percentage
+}
+
+// isSurveyQuotaReached returns whether or not the given survey has already been sent to the maximum number of users
+// allowed per cycle. The quota isn't enforced atomically, so it may be exceeded slightly if many users are sent the
+// survey at the same time.
+func (p *Plugin) isSurveyQuotaReached(surveyID string) (bool, *model.AppError) {
+	maxSent := p.getConfiguration().SurveyMaxSentPerCycle
+	if maxSent <= 0 {
+		return false, nil
+	}
+
+	var sent int64
+	if err := p.KVGet(fmt.Sprintf(SurveySentCountKey, surveyID), &sent); err != nil {
+		return false, err
+	}
+
+	return sent >= int64(maxSent), nil
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2019-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsUserSampled(t *testing.T) {
+	t.Run("should include everyone at 100 percent", func(t *testing.T) {
+		for i := 0; i < 100; i++ {
+			assert.True(t, isUserSampled(model.NewId(), "2019-Q2", 100))
+		}
+	})
+
+	t.Run("should give the same result every time for a user and survey", func(t *testing.T) {
+		userID := model.NewId()
+
+		expected := isUserSampled(userID, "2019-Q2", 50)
+		for i := 0; i < 10; i++ {
+			assert.Equal(t, expected, isUserSampled(userID, "2019-Q2", 50))
+		}
+	})
+
+	t.Run("should include roughly the given percentage of users", func(t *testing.T) {
+		sampled := 0
+		for i := 0; i < 10000; i++ {
+			if isUserSampled(fmt.Sprintf("user%d", i), "2019-Q2", 20) {
+				sampled++
+			}
+		}
+
+		assert.InDelta(t, 2000, sampled, 200)
+	})
+
+	t.Run("should choose a different sample for each survey", func(t *testing.T) {
+		different := 0
+		for i := 0; i < 1000; i++ {
+			userID := fmt.Sprintf("user%d", i)
+			if isUserSampled(userID, "2019-Q2", 50) != isUserSampled(userID, "2019-Q3", 50) {
+				different++
+			}
+		}
+
+		assert.Greater(t, different, 0)
+	})
+}
+
+func TestIsSurveyQuotaReached(t *testing.T) {
+	t.Run("should never be reached without a quota", func(t *testing.T) {
+		p := Plugin{
+			configuration: &configuration{},
+		}
+
+		reached, err := p.isSurveyQuotaReached("2019-Q2")
+
+		assert.Nil(t, err)
+		assert.False(t, reached)
+	})
+
+	for _, test := range []struct {
+		Name     string
+		Sent     []byte
+		Expected bool
+	}{
+		{Name: "never sent", Sent: nil, Expected: false},
+		{Name: "below the quota", Sent: []byte("99"), Expected: false},
+		{Name: "at the quota", Sent: []byte("100"), Expected: true},
+	} {
+		t.Run(test.Name, func(t *testing.T) {
+			api := makeAPIMock()
+			api.On("KVGet", fmt.Sprintf(SurveySentCountKey, "2019-Q2")).Return(test.Sent, nil)
+			defer api.AssertExpectations(t)
+
+			p := Plugin{
+				configuration: &configuration{SurveyMaxSentPerCycle: 100},
+			}
+			p.SetAPI(api)
+
+			reached, err := p.isSurveyQuotaReached("2019-Q2")
+
+			assert.Nil(t, err)
+			assert.Equal(t, test.Expected, reached)
+		})
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2019-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// SurveyScheduleUpgrade schedules a survey whenever a new major or minor server version is detected.
+	SurveyScheduleUpgrade = "upgrade"
+
+	// SurveyScheduleQuarterly schedules a survey at the start of every calendar quarter.
+	SurveyScheduleQuarterly = "quarterly"
+
+	// SurveyScheduleInterval schedules a survey every SurveyIntervalDays days.
+	SurveyScheduleInterval = "interval"
+
+	// The time between surveys when using SurveyScheduleInterval if SurveyIntervalDays isn't set
+	DefaultSurveyInterval = 90 * day
+
+	// The shortest calendar quarter is 90 days long
+	minQuarterLength = 90 * day
+)
+
+// surveyCycle is the period of time during which a single survey can be sent. When surveys are scheduled on upgrade,
+// the cycle lasts until the next upgrade and has no end.
+type surveyCycle struct {
+	// ID identifies the survey sent during this cycle. It's the server version when surveys are scheduled on upgrade,
+	// the quarter like "2019-Q2" when they're scheduled quarterly, or the start date of the cycle like "2019-04-01"
+	// when they're scheduled on an interval.
+	ID      string
+	StartAt time.Time
+	EndAt   time.Time
+}
+
+// getSurveyCycle returns the survey cycle that contains the given time.
+func (p *Plugin) getSurveyCycle(now time.Time) *surveyCycle {
+	config := p.getConfiguration()
+
+	switch config.getSurveySchedule() {
+	case SurveyScheduleQuarterly:
+		startAt := time.Date(now.Year(), ((now.Month()-1)/3)*3+1, 1, 0, 0, 0, 0, time.UTC)
+
+		return &surveyCycle{
+			ID:      fmt.Sprintf("%d-Q%d", startAt.Year(), (startAt.Month()-1)/3+1),
+			StartAt: startAt,
+			EndAt:   startAt.AddDate(0, 3, 0),
+		}
+	case SurveyScheduleInterval:
+		// Cycles are counted from the Unix epoch so that they don't depend on when the plugin was installed
+		interval := config.getSurveyInterval()
+		epoch := time.Unix(0, 0).UTC()
+		startAt := epoch.Add(now.Sub(epoch) / interval * interval)
+
+		return &surveyCycle{
+			ID:      startAt.Format("2006-01-02"),
+			StartAt: startAt,
+			EndAt:   startAt.Add(interval),
+		}
+	default:
+		return &surveyCycle{
+			ID: p.serverVersion,
+		}
+	}
+}
+
+// getSurveyEndAt returns when a survey starting at the given time during the cycle ends, which is after the given
+// duration or at the end of the cycle, whichever comes first. A duration of zero means that the survey ends with the
+// cycle, so surveys scheduled on upgrade never end.
+func (c *surveyCycle) getSurveyEndAt(startAt time.Time, duration time.Duration) time.Time {
+	if duration == 0 {
+		return c.EndAt
+	}
+
+	endAt := startAt.Add(duration)
+	if !c.EndAt.IsZero() && c.EndAt.Before(endAt) {
+		endAt = c.EndAt
+	}
+
+	return endAt
+}
+
+// checkForScheduledSurvey schedules the survey for the current cycle if surveys are sent on a fixed schedule. It's
+// called periodically by the background job. Since checkForNextSurvey only schedules a survey once per cycle, this is
+// safe to call repeatedly.
+func (p *Plugin) checkForScheduledSurvey(now time.Time) bool {
+	if p.getConfiguration().getSurveySchedule() == SurveyScheduleUpgrade {
+		// Surveys are scheduled by OnActivate when an upgrade is detected
+		return false
+	}
+
+	return p.checkForNextSurvey(now)
+}
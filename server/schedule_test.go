@@ -0,0 +1,224 @@
+// Copyright (c) 2019-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetSurveyCycle(t *testing.T) {
+	for _, test := range []struct {
+		Name          string
+		Configuration *configuration
+		Now           time.Time
+		Expected      *surveyCycle
+	}{
+		{
+			Name:          "should use the server version when scheduling on upgrade",
+			Configuration: &configuration{},
+			Now:           toDate(2019, time.May, 10),
+			Expected: &surveyCycle{
+				ID: "5.10.0",
+			},
+		},
+		{
+			Name:          "should use the calendar quarter when scheduling quarterly",
+			Configuration: &configuration{SurveySchedule: SurveyScheduleQuarterly},
+			Now:           toDate(2019, time.May, 10),
+			Expected: &surveyCycle{
+				ID:      "2019-Q2",
+				StartAt: toDate(2019, time.April, 1),
+				EndAt:   toDate(2019, time.July, 1),
+			},
+		},
+		{
+			Name:          "should include the first day of the quarter",
+			Configuration: &configuration{SurveySchedule: SurveyScheduleQuarterly},
+			Now:           toDate(2019, time.January, 1),
+			Expected: &surveyCycle{
+				ID:      "2019-Q1",
+				StartAt: toDate(2019, time.January, 1),
+				EndAt:   toDate(2019, time.April, 1),
+			},
+		},
+		{
+			Name:          "should end the fourth quarter at the start of the next year",
+			Configuration: &configuration{SurveySchedule: SurveyScheduleQuarterly},
+			Now:           toDate(2019, time.December, 31),
+			Expected: &surveyCycle{
+				ID:      "2019-Q4",
+				StartAt: toDate(2019, time.October, 1),
+				EndAt:   toDate(2020, time.January, 1),
+			},
+		},
+		{
+			Name:          "should count intervals from the Unix epoch",
+			Configuration: &configuration{SurveySchedule: SurveyScheduleInterval, SurveyIntervalDays: 30},
+			Now:           toDate(1970, time.February, 15),
+			Expected: &surveyCycle{
+				ID:      "1970-01-31",
+				StartAt: toDate(1970, time.January, 31),
+				EndAt:   toDate(1970, time.March, 2),
+			},
+		},
+		{
+			Name:          "should use the default interval",
+			Configuration: &configuration{SurveySchedule: SurveyScheduleInterval},
+			Now:           toDate(1970, time.April, 1),
+			Expected: &surveyCycle{
+				ID:      "1970-04-01",
+				StartAt: toDate(1970, time.April, 1),
+				EndAt:   toDate(1970, time.June, 30),
+			},
+		},
+	} {
+		t.Run(test.Name, func(t *testing.T) {
+			p := &Plugin{
+				configuration: test.Configuration,
+				serverVersion: "5.10.0",
+			}
+
+			assert.Equal(t, test.Expected, p.getSurveyCycle(test.Now))
+		})
+	}
+}
+
+func TestCheckForScheduledSurvey(t *testing.T) {
+	now := toDate(2019, time.May, 10)
+
+	t.Run("should do nothing when scheduling on upgrade", func(t *testing.T) {
+		api := makeAPIMock()
+		defer api.AssertExpectations(t)
+
+		p := &Plugin{
+			configuration: &configuration{
+				EnableSurvey: true,
+			},
+			serverVersion: "5.10.0",
+		}
+		p.SetAPI(api)
+
+		result := p.checkForScheduledSurvey(now)
+
+		assert.False(t, result)
+	})
+
+	t.Run("should schedule the survey for the current quarter", func(t *testing.T) {
+		surveyKey := fmt.Sprintf(SurveyKey, "2019-Q2")
+
+		api := makeAPIMock()
+		api.On("KVCompareAndSet", LockKey, []byte(nil), mustMarshalJSON(now)).Return(true, nil)
+		api.On("KVGet", surveyKey).Return(nil, nil)
+		api.On("KVSet", surveyKey, mustMarshalJSON(&surveyState{
+			ID:            "2019-Q2",
+			ServerVersion: "5.10.0",
+			CreateAt:      now,
+			StartAt:       now.Add(14 * day),
+			EndAt:         now.Add(14 * day).Add(DefaultSurveyDuration),
+		})).Return(nil)
+		api.On("KVGet", LastAdminNoticeKey).Return(mustMarshalJSON(now.Add(-2*day)), nil)
+		api.On("KVDelete", LockKey).Return(nil)
+		defer api.AssertExpectations(t)
+
+		p := &Plugin{
+			configuration: &configuration{
+				EnableSurvey:    true,
+				SurveySchedule:  SurveyScheduleQuarterly,
+				DaysUntilSurvey: 14,
+			},
+			now:           func() time.Time { return now },
+			serverVersion: "5.10.0",
+		}
+		p.SetAPI(api)
+
+		result := p.checkForScheduledSurvey(now)
+
+		assert.True(t, result)
+	})
+
+	t.Run("should end the survey when the quarter ends", func(t *testing.T) {
+		surveyKey := fmt.Sprintf(SurveyKey, "2019-Q2")
+
+		api := makeAPIMock()
+		api.On("KVCompareAndSet", LockKey, []byte(nil), mustMarshalJSON(now)).Return(true, nil)
+		api.On("KVGet", surveyKey).Return(nil, nil)
+		api.On("KVSet", surveyKey, mustMarshalJSON(&surveyState{
+			ID:            "2019-Q2",
+			ServerVersion: "5.10.0",
+			CreateAt:      now,
+			StartAt:       now.Add(14 * day),
+			EndAt:         toDate(2019, time.July, 1),
+		})).Return(nil)
+		api.On("KVGet", LastAdminNoticeKey).Return(mustMarshalJSON(now.Add(-2*day)), nil)
+		api.On("KVDelete", LockKey).Return(nil)
+		defer api.AssertExpectations(t)
+
+		p := &Plugin{
+			configuration: &configuration{
+				EnableSurvey:       true,
+				SurveySchedule:     SurveyScheduleQuarterly,
+				DaysUntilSurvey:    14,
+				SurveyDurationDays: 60,
+			},
+			now:           func() time.Time { return now },
+			serverVersion: "5.10.0",
+		}
+		p.SetAPI(api)
+
+		result := p.checkForScheduledSurvey(now)
+
+		assert.True(t, result)
+	})
+
+	t.Run("should not schedule a survey that has already been scheduled for the current quarter", func(t *testing.T) {
+		surveyKey := fmt.Sprintf(SurveyKey, "2019-Q2")
+
+		api := makeAPIMock()
+		api.On("KVCompareAndSet", LockKey, []byte(nil), mustMarshalJSON(now)).Return(true, nil)
+		api.On("KVGet", surveyKey).Return(mustMarshalJSON(&surveyState{ID: "2019-Q2"}), nil)
+		api.On("KVDelete", LockKey).Return(nil)
+		defer api.AssertExpectations(t)
+
+		p := &Plugin{
+			configuration: &configuration{
+				EnableSurvey:   true,
+				SurveySchedule: SurveyScheduleQuarterly,
+			},
+			now:           func() time.Time { return now },
+			serverVersion: "5.10.0",
+		}
+		p.SetAPI(api)
+
+		result := p.checkForScheduledSurvey(now)
+
+		assert.False(t, result)
+	})
+
+	t.Run("should not schedule a survey that would start after the quarter ends", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVCompareAndSet", LockKey, []byte(nil), mustMarshalJSON(now)).Return(true, nil)
+		api.On("KVGet", fmt.Sprintf(SurveyKey, "2019-Q2")).Return(nil, nil)
+		api.On("KVDelete", LockKey).Return(nil)
+		defer api.AssertExpectations(t)
+
+		p := &Plugin{
+			configuration: &configuration{
+				EnableSurvey:    true,
+				SurveySchedule:  SurveyScheduleQuarterly,
+				DaysUntilSurvey: 60,
+			},
+			now:           func() time.Time { return now },
+			serverVersion: "5.10.0",
+		}
+		p.SetAPI(api)
+
+		result := p.checkForScheduledSurvey(now)
+
+		assert.False(t, result)
+	})
+}
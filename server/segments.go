@@ -0,0 +1,178 @@
+// Copyright (c) 2019-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+const (
+	// NPSSegmentDetractor, NPSSegmentPassive and NPSSegmentPromoter are the segments that users are divided into based
+	// on the NPS score that they gave.
+	NPSSegmentDetractor = "detractor"
+	NPSSegmentPassive   = "passive"
+	NPSSegmentPromoter  = "promoter"
+
+	// FollowUpReplyWindow is how long after a follow-up is sent that new messages from the user are treated as replies
+	// to it. Replies made in the follow-up's thread are always linked to it.
+	FollowUpReplyWindow = 24 * time.Hour
+)
+
+// scoreFollowUp is the follow-up question sent to a user after they first score a survey. It's stored with the user's
+// survey state so that their reply can be linked to the score that prompted it.
+type scoreFollowUp struct {
+	SurveyID string    `json:"survey_id"`
+	Kind     string    `json:"kind"`
+	Score    int       `json:"score"`
+	Segment  string    `json:"segment,omitempty"`
+	PostID   string    `json:"post_id"`
+	SentAt   time.Time `json:"sent_at"`
+
+	// Anonymous is set when the follow-up was sent for an anonymous survey, in which case the score and segment
+	// aren't recorded so that they can't be linked back to the user.
+	Anonymous bool `json:"anonymous,omitempty"`
+}
+
+// getNPSSegment returns whether an NPS score comes from a detractor (0-6), a passive (7-8) or a promoter (9-10).
+func getNPSSegment(score int) string {
+	switch {
+	case score >= 9:
+		return NPSSegmentPromoter
+	case score >= 7:
+		return NPSSegmentPassive
+	default:
+		return NPSSegmentDetractor
+	}
+}
+
+// getFollowUpSegment returns the segment of the user who gave a score. Only NPS scores are segmented.
+func getFollowUpSegment(kind string, score int) string {
+	if kind != QuestionTypeNPS {
+		return ""
+	}
+
+	return getNPSSegment(score)
+}
+
+// getFollowUpText returns the question asked to a user after they first score a survey.
+func getFollowUpText(segment string) *i18nMessage {
+	switch segment {
+	case NPSSegmentDetractor:
+		return detractorFeedbackRequestBody
+	case NPSSegmentPassive:
+		return passiveFeedbackRequestBody
+	case NPSSegmentPromoter:
+		return promoterFeedbackRequestBody
+	default:
+		return thanksFeedbackRequestBody
+	}
+}
+
+// isRepliedToBy returns whether or not the given feedback post is a reply to the follow-up.
+func (f *scoreFollowUp) isRepliedToBy(post *model.Post) bool {
+	return isReplyToPrompt(post, f.PostID, f.SentAt)
+}
+
+// answerFollowUp is the follow-up sent after a user first answers a question that isn't scored.
+type answerFollowUp struct {
+	PostID string    `json:"post_id"`
+	SentAt time.Time `json:"sent_at"`
+}
+
+// isRepliedToBy returns whether or not the given feedback post is a reply to the follow-up.
+func (f *answerFollowUp) isRepliedToBy(post *model.Post) bool {
+	return isReplyToPrompt(post, f.PostID, f.SentAt)
+}
+
+// getAnswerFollowUpRepliedToBy returns the ID of the question whose follow-up the given feedback post replies to,
+// along with the follow-up itself. If the post could be a reply to more than one of them, the latest one is returned.
+func (s *userSurveyState) getAnswerFollowUpRepliedToBy(post *model.Post) (string, *answerFollowUp) {
+	var questionID string
+	var latest *answerFollowUp
+
+	for id, followUp := range s.AnswerFollowUps {
+		if followUp == nil || !followUp.isRepliedToBy(post) {
+			continue
+		}
+
+		if latest == nil || followUp.SentAt.After(latest.SentAt) {
+			questionID = id
+			latest = followUp
+		}
+	}
+
+	return questionID, latest
+}
+
+// sendAnswerFollowUp sends the question's follow-up to the user and records it in their survey state so that replies
+// to it are attributed to the question.
+func (p *Plugin) sendAnswerFollowUp(userID string, question *surveyQuestion, now time.Time) *model.AppError {
+	post, err := p.CreateBotDMPost(userID, &model.Post{
+		Type:    "custom_nps_feedback",
+		Message: question.FollowUp,
+	})
+	if err != nil {
+		return err
+	}
+
+	var userSurvey *userSurveyState
+	if err = p.KVGet(fmt.Sprintf(UserSurveyKey, userID), &userSurvey); err != nil {
+		return err
+	}
+
+	if userSurvey == nil {
+		return nil
+	}
+
+	if userSurvey.AnswerFollowUps == nil {
+		userSurvey.AnswerFollowUps = map[string]*answerFollowUp{}
+	}
+
+	userSurvey.AnswerFollowUps[question.ID] = &answerFollowUp{
+		PostID: post.Id,
+		SentAt: now,
+	}
+
+	return p.KVSet(fmt.Sprintf(UserSurveyKey, userID), userSurvey)
+}
+
+// sendScoreFollowUp asks the user to explain the score that they gave and records the follow-up in their survey state.
+func (p *Plugin) sendScoreFollowUp(user *model.User, kind string, score int, now time.Time) *model.AppError {
+	userID := user.Id
+	segment := getFollowUpSegment(kind, score)
+
+	post, err := p.CreateBotDMPost(userID, p.buildFeedbackRequestPost(segment, user.Locale))
+	if err != nil {
+		return err
+	}
+
+	var userSurvey *userSurveyState
+	if err = p.KVGet(fmt.Sprintf(UserSurveyKey, userID), &userSurvey); err != nil {
+		return err
+	}
+
+	if userSurvey == nil {
+		return nil
+	}
+
+	userSurvey.FollowUp = &scoreFollowUp{
+		SurveyID: userSurvey.getSurveyID(),
+		Kind:     kind,
+		Score:    score,
+		Segment:  segment,
+		PostID:   post.Id,
+		SentAt:   now,
+	}
+
+	if p.getConfiguration().EnableAnonymousSurveys {
+		userSurvey.FollowUp.Score = 0
+		userSurvey.FollowUp.Segment = ""
+		userSurvey.FollowUp.Anonymous = true
+	}
+
+	return p.KVSet(fmt.Sprintf(UserSurveyKey, userID), userSurvey)
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2019-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetNPSSegment(t *testing.T) {
+	assert.Equal(t, NPSSegmentDetractor, getNPSSegment(0))
+	assert.Equal(t, NPSSegmentDetractor, getNPSSegment(6))
+	assert.Equal(t, NPSSegmentPassive, getNPSSegment(7))
+	assert.Equal(t, NPSSegmentPassive, getNPSSegment(8))
+	assert.Equal(t, NPSSegmentPromoter, getNPSSegment(9))
+	assert.Equal(t, NPSSegmentPromoter, getNPSSegment(10))
+}
+
+func TestGetFollowUpText(t *testing.T) {
+	assert.Equal(t, detractorFeedbackRequestBody, getFollowUpText(getFollowUpSegment(QuestionTypeNPS, 2)))
+	assert.Equal(t, passiveFeedbackRequestBody, getFollowUpText(getFollowUpSegment(QuestionTypeNPS, 8)))
+	assert.Equal(t, promoterFeedbackRequestBody, getFollowUpText(getFollowUpSegment(QuestionTypeNPS, 10)))
+
+	// Only NPS scores are segmented
+	assert.Equal(t, thanksFeedbackRequestBody, getFollowUpText(getFollowUpSegment(QuestionTypeCSAT, 1)))
+}
+
+func TestScoreFollowUpIsRepliedToBy(t *testing.T) {
+	sentAt := toDate(2019, time.May, 10)
+	followUp := &scoreFollowUp{
+		PostID: model.NewId(),
+		SentAt: sentAt,
+	}
+
+	for _, test := range []struct {
+		Name     string
+		Post     *model.Post
+		Expected bool
+	}{
+		{
+			Name:     "reply in the follow-up's thread",
+			Post:     &model.Post{RootId: followUp.PostID, CreateAt: sentAt.Add(72 * time.Hour).UnixMilli()},
+			Expected: true,
+		},
+		{
+			Name:     "reply in another thread",
+			Post:     &model.Post{RootId: model.NewId(), CreateAt: sentAt.Add(time.Minute).UnixMilli()},
+			Expected: false,
+		},
+		{
+			Name:     "new post soon after the follow-up",
+			Post:     &model.Post{CreateAt: sentAt.Add(time.Minute).UnixMilli()},
+			Expected: true,
+		},
+		{
+			Name:     "new post long after the follow-up",
+			Post:     &model.Post{CreateAt: sentAt.Add(FollowUpReplyWindow).UnixMilli()},
+			Expected: false,
+		},
+		{
+			Name:     "new post before the follow-up",
+			Post:     &model.Post{CreateAt: sentAt.Add(-time.Minute).UnixMilli()},
+			Expected: false,
+		},
+	} {
+		t.Run(test.Name, func(t *testing.T) {
+			assert.Equal(t, test.Expected, followUp.isRepliedToBy(test.Post))
+		})
+	}
+}
+
+func TestSendScoreFollowUp(t *testing.T) {
+	botUserID := model.NewId()
+	userID := model.NewId()
+	postID := model.NewId()
+	now := toDate(2019, time.May, 10)
+
+	t.Run("should ask detractors what to fix and record the follow-up", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("GetDirectChannel", userID, botUserID).Return(&model.Channel{}, nil)
+		api.On("CreatePost", &model.Post{
+			UserId:  botUserID,
+			Type:    "custom_nps_feedback",
+			Message: "Danke! Was sollten wir als Erstes verbessern?",
+		}).Return(&model.Post{Id: postID}, nil)
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, userID)).Return(mustMarshalJSON(&userSurveyState{
+			SurveyID:   "2019-Q2",
+			AnsweredAt: now,
+		}), nil)
+		api.On("KVSet", fmt.Sprintf(UserSurveyKey, userID), mustMarshalJSON(&userSurveyState{
+			SurveyID:   "2019-Q2",
+			AnsweredAt: now,
+			FollowUp: &scoreFollowUp{
+				SurveyID: "2019-Q2",
+				Kind:     QuestionTypeNPS,
+				Score:    4,
+				Segment:  NPSSegmentDetractor,
+				PostID:   postID,
+				SentAt:   now,
+			},
+		})).Return(nil)
+		defer api.AssertExpectations(t)
+
+		p := Plugin{
+			botUserID: botUserID,
+			translations: map[string]map[string]string{
+				"de": {detractorFeedbackRequestBody.ID: "Danke! Was sollten wir als Erstes verbessern?"},
+			},
+		}
+		p.SetAPI(api)
+
+		err := p.sendScoreFollowUp(&model.User{Id: userID, Locale: "de"}, QuestionTypeNPS, 4, now)
+
+		assert.Nil(t, err)
+	})
+
+	t.Run("should return an error if unable to send the follow-up", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("GetDirectChannel", userID, botUserID).Return(nil, &model.AppError{})
+		defer api.AssertExpectations(t)
+
+		p := Plugin{
+			botUserID: botUserID,
+		}
+		p.SetAPI(api)
+
+		err := p.sendScoreFollowUp(&model.User{Id: userID}, QuestionTypeNPS, 4, now)
+
+		assert.NotNil(t, err)
+	})
+}
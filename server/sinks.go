@@ -0,0 +1,212 @@
+// Copyright (c) 2019-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	// TelemetrySinkRudder sends events to Mattermost using Rudder. This requires diagnostics to be enabled.
+	TelemetrySinkRudder = "rudder"
+
+	// TelemetrySinkWebhook sends each event as a JSON POST request to TelemetryWebhookURL.
+	TelemetrySinkWebhook = "webhook"
+
+	// TelemetrySinkFile appends each event as a line of JSON to the file at TelemetryFilePath.
+	TelemetrySinkFile = "file"
+
+	// TelemetrySinkKV stores each event in the plugin's KV store.
+	TelemetrySinkKV = "kv"
+
+	// webhookSinkTimeout is how long the webhook sink waits for a response before giving up on an event.
+	webhookSinkTimeout = 10 * time.Second
+)
+
+// eventSink receives the events sent when users answer surveys, send feedback or disable surveys. It matches the
+// TrackUserEvent method of telemetry.Tracker, which rudderSink sends events to.
+type eventSink interface {
+	TrackUserEvent(event string, userID string, properties map[string]interface{}) error
+}
+
+// telemetryEvent is a single event as it is recorded by the webhook, file and KV sinks.
+type telemetryEvent struct {
+	Event      string                 `json:"event"`
+	UserID     string                 `json:"user_id"`
+	Properties map[string]interface{} `json:"properties"`
+	CreateAt   int64                  `json:"create_at"`
+}
+
+// webhookSink sends each event to an HTTP endpoint.
+type webhookSink struct {
+	url    string
+	client *http.Client
+	now    func() time.Time
+}
+
+func (s *webhookSink) TrackUserEvent(event string, userID string, properties map[string]interface{}) error {
+	data, err := json.Marshal(newTelemetryEvent(event, userID, properties, s.now()))
+	if err != nil {
+		return errors.Wrap(err, "failed to serialize event")
+	}
+
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return errors.Wrap(err, "failed to send event to webhook")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// fileSink appends each event to a file with one JSON object per line.
+type fileSink struct {
+	path string
+	lock *sync.Mutex
+	now  func() time.Time
+}
+
+func (s *fileSink) TrackUserEvent(event string, userID string, properties map[string]interface{}) error {
+	data, err := json.Marshal(newTelemetryEvent(event, userID, properties, s.now()))
+	if err != nil {
+		return errors.Wrap(err, "failed to serialize event")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.Wrap(err, "failed to open event file")
+	}
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		_ = f.Close()
+		return errors.Wrap(err, "failed to write to event file")
+	}
+
+	return f.Close()
+}
+
+// rudderSink sends events to Mattermost using the Rudder tracker. The tracker drops events without returning an error
+// when it has no client or diagnostics are disabled, so those are reported as errors here to keep the events in the
+// outbox until they can be sent.
+type rudderSink struct {
+	p *Plugin
+}
+
+func (s *rudderSink) TrackUserEvent(event string, userID string, properties map[string]interface{}) error {
+	// Hold the lock until the event is queued by the client so that the client isn't closed or replaced in between
+	s.p.telemetryLock.RLock()
+	defer s.p.telemetryLock.RUnlock()
+
+	if s.p.telemetryClient == nil {
+		return errors.New("the Rudder client hasn't been created")
+	}
+
+	if !s.p.canSendDiagnostics() {
+		return errors.New("diagnostics are disabled")
+	}
+
+	return s.p.tracker.TrackUserEvent(event, userID, properties)
+}
+
+// discardSink drops every event. It's used in private mode in place of Rudder since scores, answers and feedback are
+// already kept in the KV store.
+type discardSink struct{}
+
+func (s *discardSink) TrackUserEvent(event string, userID string, properties map[string]interface{}) error {
+	return nil
+}
+
+// kvSink stores each event in the KV store under TelemetryEventKey.
+type kvSink struct {
+	p *Plugin
+}
+
+func (s *kvSink) TrackUserEvent(event string, userID string, properties map[string]interface{}) error {
+	telemetryEvent := newTelemetryEvent(event, userID, properties, s.p.now())
+
+	if appErr := s.p.KVSet(fmt.Sprintf(TelemetryEventKey, telemetryEvent.CreateAt, model.NewId()), telemetryEvent); appErr != nil {
+		return appErr
+	}
+
+	return nil
+}
+
+func newTelemetryEvent(event string, userID string, properties map[string]interface{}, now time.Time) *telemetryEvent {
+	return &telemetryEvent{
+		Event:      event,
+		UserID:     userID,
+		Properties: properties,
+		CreateAt:   model.GetMillisForTime(now),
+	}
+}
+
+// getTelemetrySink returns the configured TelemetrySink, defaulting to TelemetrySinkRudder.
+func (c *configuration) getTelemetrySink() string {
+	if c.TelemetrySink == "" {
+		return TelemetrySinkRudder
+	}
+
+	return c.TelemetrySink
+}
+
+// sendsEventsToRudder returns whether or not events are sent to Rudder, which is the case when it's the configured sink
+// and private mode is disabled.
+func (c *configuration) sendsEventsToRudder() bool {
+	return !c.EnablePrivateMode && c.getTelemetrySink() == TelemetrySinkRudder
+}
+
+// getEventSink returns the eventSink that events should be sent to based on the current configuration.
+func (p *Plugin) getEventSink() eventSink {
+	config := p.getConfiguration()
+
+	switch config.getTelemetrySink() {
+	case TelemetrySinkWebhook:
+		return &webhookSink{
+			url:    config.TelemetryWebhookURL,
+			client: &http.Client{Timeout: webhookSinkTimeout},
+			now:    p.now,
+		}
+	case TelemetrySinkFile:
+		return &fileSink{
+			path: config.TelemetryFilePath,
+			lock: &p.telemetryFileLock,
+			now:  p.now,
+		}
+	case TelemetrySinkKV:
+		return &kvSink{p: p}
+	}
+
+	if config.EnablePrivateMode {
+		return &discardSink{}
+	}
+
+	return &rudderSink{p: p}
+}
+
+// canRecordEvents returns whether or not the configured sink is able to record events. Only Rudder depends on
+// diagnostics being enabled, so the other sinks and private mode allow the plugin to run on servers that have them
+// disabled.
+func (p *Plugin) canRecordEvents() bool {
+	if !p.getConfiguration().sendsEventsToRudder() {
+		return true
+	}
+
+	return p.canSendDiagnostics()
+}
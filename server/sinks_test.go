@@ -0,0 +1,403 @@
+// Copyright (c) 2019-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/mattermost/mattermost/server/public/pluginapi/experimental/telemetry"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookSink(t *testing.T) {
+	userID := model.NewId()
+	now := toDate(2019, time.March, 11)
+
+	t.Run("should post the event to the webhook", func(t *testing.T) {
+		var received *telemetryEvent
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, http.MethodPost, r.Method)
+			assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+			received = &telemetryEvent{}
+			assert.Nil(t, json.NewDecoder(r.Body).Decode(received))
+
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+
+		sink := &webhookSink{
+			url:    server.URL,
+			client: server.Client(),
+			now:    func() time.Time { return now },
+		}
+
+		err := sink.TrackUserEvent(NpsScore, userID, map[string]interface{}{"score": 10})
+
+		require.Nil(t, err)
+		assert.Equal(t, &telemetryEvent{
+			Event:      NpsScore,
+			UserID:     userID,
+			Properties: map[string]interface{}{"score": float64(10)},
+			CreateAt:   model.GetMillisForTime(now),
+		}, received)
+	})
+
+	t.Run("should return an error when the webhook fails", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer server.Close()
+
+		sink := &webhookSink{
+			url:    server.URL,
+			client: server.Client(),
+			now:    func() time.Time { return now },
+		}
+
+		err := sink.TrackUserEvent(NpsScore, userID, map[string]interface{}{})
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestFileSink(t *testing.T) {
+	userID := model.NewId()
+	now := toDate(2019, time.March, 11)
+
+	t.Run("should append one line per event", func(t *testing.T) {
+		p := &Plugin{}
+		path := filepath.Join(t.TempDir(), "events.ndjson")
+
+		sink := &fileSink{
+			path: path,
+			lock: &p.telemetryFileLock,
+			now:  func() time.Time { return now },
+		}
+
+		require.Nil(t, sink.TrackUserEvent(NpsScore, userID, map[string]interface{}{"score": 10}))
+		require.Nil(t, sink.TrackUserEvent(NpsFeedback, userID, map[string]interface{}{"feedback": "Great"}))
+
+		f, err := os.Open(path)
+		require.Nil(t, err)
+		defer f.Close()
+
+		var events []*telemetryEvent
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			event := &telemetryEvent{}
+			require.Nil(t, json.Unmarshal(scanner.Bytes(), event))
+			events = append(events, event)
+		}
+
+		require.Len(t, events, 2)
+		assert.Equal(t, NpsScore, events[0].Event)
+		assert.Equal(t, userID, events[0].UserID)
+		assert.Equal(t, float64(10), events[0].Properties["score"])
+		assert.Equal(t, NpsFeedback, events[1].Event)
+		assert.Equal(t, "Great", events[1].Properties["feedback"])
+	})
+
+	t.Run("should return an error when unable to open the file", func(t *testing.T) {
+		p := &Plugin{}
+
+		sink := &fileSink{
+			path: filepath.Join(t.TempDir(), "missing", "events.ndjson"),
+			lock: &p.telemetryFileLock,
+			now:  func() time.Time { return now },
+		}
+
+		err := sink.TrackUserEvent(NpsScore, userID, map[string]interface{}{})
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestKVSink(t *testing.T) {
+	userID := model.NewId()
+	now := toDate(2019, time.March, 11)
+
+	t.Run("should store the event", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVSet", mock.MatchedBy(func(key string) bool {
+			return strings.HasPrefix(key, TelemetryEventPrefix)
+		}), mustMarshalJSON(&telemetryEvent{
+			Event:      NpsDisable,
+			UserID:     userID,
+			Properties: map[string]interface{}{},
+			CreateAt:   model.GetMillisForTime(now),
+		})).Return(nil)
+		defer api.AssertExpectations(t)
+
+		p := &Plugin{
+			now: func() time.Time { return now },
+		}
+		p.SetAPI(api)
+
+		err := (&kvSink{p: p}).TrackUserEvent(NpsDisable, userID, map[string]interface{}{})
+
+		assert.Nil(t, err)
+	})
+
+	t.Run("should return an error when unable to store the event", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVSet", mock.Anything, mock.Anything).Return(&model.AppError{})
+		defer api.AssertExpectations(t)
+
+		p := &Plugin{
+			now: func() time.Time { return now },
+		}
+		p.SetAPI(api)
+
+		err := (&kvSink{p: p}).TrackUserEvent(NpsDisable, userID, map[string]interface{}{})
+
+		assert.NotNil(t, err)
+	})
+}
+
+// testTelemetryClient records the events that it's given instead of sending them to Rudder.
+type testTelemetryClient struct {
+	tracked []telemetry.Track
+	closed  bool
+}
+
+func (c *testTelemetryClient) Enqueue(track telemetry.Track) error {
+	if c.closed {
+		return errors.New("client is closed")
+	}
+
+	c.tracked = append(c.tracked, track)
+	return nil
+}
+
+func (c *testTelemetryClient) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestRudderSink(t *testing.T) {
+	userID := model.NewId()
+
+	makeAPIMock := func(enableDiagnostics bool) *plugintest.API {
+		api := makeAPIMock()
+		api.On("GetConfig").Return(&model.Config{
+			LogSettings: model.LogSettings{
+				EnableDiagnostics: model.NewBool(enableDiagnostics),
+			},
+		})
+
+		return api
+	}
+
+	t.Run("should send the event to Rudder", func(t *testing.T) {
+		client := &testTelemetryClient{}
+
+		api := makeAPIMock(true)
+		defer api.AssertExpectations(t)
+
+		p := &Plugin{
+			telemetryClient: client,
+			tracker:         telemetry.NewTracker(client, "", "", "", "", "nps", telemetry.TrackerConfig{EnabledTracking: true}, nil),
+		}
+		p.SetAPI(api)
+
+		err := (&rudderSink{p: p}).TrackUserEvent(NpsScore, userID, map[string]interface{}{"score": 10})
+
+		require.Nil(t, err)
+		require.Len(t, client.tracked, 1)
+		assert.Equal(t, "nps_"+NpsScore, client.tracked[0].Event)
+		assert.Equal(t, userID, client.tracked[0].Properties["UserActualID"])
+	})
+
+	t.Run("should return an error without a Rudder client", func(t *testing.T) {
+		p := &Plugin{
+			tracker: telemetry.NewTracker(nil, "", "", "", "", "nps", telemetry.TrackerConfig{EnabledTracking: true}, nil),
+		}
+
+		err := (&rudderSink{p: p}).TrackUserEvent(NpsScore, userID, map[string]interface{}{"score": 10})
+
+		assert.NotNil(t, err)
+	})
+
+	t.Run("should return an error when diagnostics are disabled", func(t *testing.T) {
+		client := &testTelemetryClient{}
+
+		api := makeAPIMock(false)
+		defer api.AssertExpectations(t)
+
+		p := &Plugin{
+			telemetryClient: client,
+			tracker:         telemetry.NewTracker(client, "", "", "", "", "nps", telemetry.TrackerConfig{}, nil),
+		}
+		p.SetAPI(api)
+
+		err := (&rudderSink{p: p}).TrackUserEvent(NpsScore, userID, map[string]interface{}{"score": 10})
+
+		assert.NotNil(t, err)
+		assert.Empty(t, client.tracked)
+	})
+
+	t.Run("should not send events with a client while it's being closed", func(t *testing.T) {
+		client := &testTelemetryClient{}
+
+		api := makeAPIMock(true)
+
+		p := &Plugin{
+			telemetryClient: client,
+			tracker:         telemetry.NewTracker(client, "", "", "", "", "nps", telemetry.TrackerConfig{EnabledTracking: true}, nil),
+		}
+		p.SetAPI(api)
+
+		sent := make(chan bool, 50)
+
+		var wg sync.WaitGroup
+		for i := 0; i < cap(sent); i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				err := (&rudderSink{p: p}).TrackUserEvent(NpsScore, userID, map[string]interface{}{"score": 10})
+				sent <- err == nil
+			}()
+		}
+
+		p.closeTelemetryClient()
+		wg.Wait()
+		close(sent)
+
+		count := 0
+		for ok := range sent {
+			if ok {
+				count++
+			}
+		}
+
+		assert.True(t, client.closed)
+		assert.Len(t, client.tracked, count)
+	})
+}
+
+func TestGetEventSink(t *testing.T) {
+	for _, test := range []struct {
+		Name          string
+		Configuration *configuration
+		Expected      interface{}
+	}{
+		{
+			Name:          "defaults to Rudder",
+			Configuration: &configuration{},
+			Expected:      &rudderSink{},
+		},
+		{
+			Name:          "Rudder",
+			Configuration: &configuration{TelemetrySink: TelemetrySinkRudder},
+			Expected:      &rudderSink{},
+		},
+		{
+			Name:          "private mode",
+			Configuration: &configuration{EnablePrivateMode: true},
+			Expected:      &discardSink{},
+		},
+		{
+			Name:          "private mode with the KV store",
+			Configuration: &configuration{EnablePrivateMode: true, TelemetrySink: TelemetrySinkKV},
+			Expected:      &kvSink{},
+		},
+		{
+			Name:          "webhook",
+			Configuration: &configuration{TelemetrySink: TelemetrySinkWebhook, TelemetryWebhookURL: "https://example.com"},
+			Expected:      &webhookSink{},
+		},
+		{
+			Name:          "file",
+			Configuration: &configuration{TelemetrySink: TelemetrySinkFile, TelemetryFilePath: "/tmp/events.ndjson"},
+			Expected:      &fileSink{},
+		},
+		{
+			Name:          "KV store",
+			Configuration: &configuration{TelemetrySink: TelemetrySinkKV},
+			Expected:      &kvSink{},
+		},
+	} {
+		t.Run(test.Name, func(t *testing.T) {
+			p := &Plugin{
+				configuration: test.Configuration,
+			}
+
+			sink := p.getEventSink()
+
+			assert.IsType(t, test.Expected, sink)
+		})
+	}
+}
+
+func TestCanRecordEvents(t *testing.T) {
+	for _, test := range []struct {
+		Name              string
+		TelemetrySink     string
+		EnablePrivateMode bool
+		EnableDiagnostics bool
+		Expected          bool
+	}{
+		{
+			Name:              "Rudder with diagnostics enabled",
+			TelemetrySink:     TelemetrySinkRudder,
+			EnableDiagnostics: true,
+			Expected:          true,
+		},
+		{
+			Name:              "Rudder with diagnostics disabled",
+			TelemetrySink:     TelemetrySinkRudder,
+			EnableDiagnostics: false,
+			Expected:          false,
+		},
+		{
+			Name:              "private mode with diagnostics disabled",
+			TelemetrySink:     TelemetrySinkRudder,
+			EnablePrivateMode: true,
+			EnableDiagnostics: false,
+			Expected:          true,
+		},
+		{
+			Name:              "KV store with diagnostics disabled",
+			TelemetrySink:     TelemetrySinkKV,
+			EnableDiagnostics: false,
+			Expected:          true,
+		},
+	} {
+		t.Run(test.Name, func(t *testing.T) {
+			api := makeAPIMock()
+			api.On("GetConfig").Return(&model.Config{
+				LogSettings: model.LogSettings{
+					EnableDiagnostics: model.NewBool(test.EnableDiagnostics),
+				},
+			}).Maybe()
+
+			p := &Plugin{
+				configuration: &configuration{
+					TelemetrySink:     test.TelemetrySink,
+					EnablePrivateMode: test.EnablePrivateMode,
+				},
+			}
+			p.SetAPI(api)
+
+			assert.Equal(t, test.Expected, p.canRecordEvents())
+		})
+	}
+}
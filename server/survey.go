@@ -6,7 +6,7 @@ package main
 import (
 	"bytes"
 	"fmt"
-	"strconv"
+	"html/template"
 	"strings"
 	"time"
 
@@ -17,48 +17,111 @@ const (
 	// Helper to make code more readable
 	day = 24 * time.Hour
 
-	// How often "survey scheduled" emails can be sent to prevent multiple emails from being sent if multiple server
-	// upgrades occur within a short time
-	MinTimeBetweenSurveyEmails = 7 * day
+	// How often "survey scheduled" emails can be sent by default to prevent multiple emails from being sent if
+	// multiple server upgrades occur within a short time
+	DefaultMinTimeBetweenSurveyEmails = 7 * day
 
-	// How long until the welcome feedback occurs after a user created his account
-	TimeUntilWelcomeFeedback = 7 * day
+	// How long until the welcome feedback occurs after a user created his account by default
+	DefaultTimeUntilWelcomeFeedback = 7 * day
 
-	// How long until a survey occurs after a server upgrade in days (for use in notifications)
-	DaysUntilSurvey = 45
+	// How long until a survey occurs after a server upgrade by default
+	DefaultTimeUntilSurvey = 45 * day
 
-	// How long until a survey occurs after a server upgrade as a time.Duration
-	TimeUntilSurvey = 45 * day
+	// How long a survey is sent to users after it starts by default when surveys are sent on a fixed schedule
+	DefaultSurveyDuration = 30 * day
 
 	// Get admin users up to 100 at a time when sending email notifications
 	AdminUsersPerPage = 100
 
-	// The minimum time before a user can be sent a survey after completing the previous one
-	MinTimeBetweenUserSurveys = 180 * day
+	// The minimum time before a user can be sent a survey after completing the previous one by default
+	DefaultMinTimeBetweenUserSurveys = 180 * day
 )
 
 type adminNotice struct {
 	Sent          bool      `json:"sent"`
+	SurveyID      string    `json:"survey_id"`
 	ServerVersion string    `json:"server_version"`
 	SurveyStartAt time.Time `json:"survey_start_at"`
 }
 
+// getSurveyID returns the ID of the survey that the notice is for. Notices stored before surveys had IDs are
+// identified by their server version.
+func (n *adminNotice) getSurveyID() string {
+	if n.SurveyID == "" {
+		return n.ServerVersion
+	}
+
+	return n.SurveyID
+}
+
 type surveyState struct {
+	// ID is the ID of the surveyCycle that the survey was scheduled for.
+	ID            string    `json:"id"`
 	ServerVersion string    `json:"server_version"`
 	CreateAt      time.Time `json:"create_at"`
 	StartAt       time.Time `json:"start_at"`
+
+	// EndAt is when the survey stops being sent to users. ClosedAt is when the survey posts of users who didn't
+	// answer it were updated to show that it has ended.
+	EndAt    time.Time `json:"end_at"`
+	ClosedAt time.Time `json:"closed_at"`
+}
+
+// getID returns the ID of the survey. Surveys stored before surveys had IDs are identified by their server version.
+func (s *surveyState) getID() string {
+	if s.ID == "" {
+		return s.ServerVersion
+	}
+
+	return s.ID
 }
 
 type userSurveyState struct {
+	SurveyID      string    `json:"survey_id"`
 	ServerVersion string    `json:"server_version"`
 	SentAt        time.Time `json:"sent_at"`
 	AnsweredAt    time.Time `json:"answered_at"`
 	ScorePostID   string    `json:"score_post_id"`
 	Disabled      bool      `json:"disabled"`
+
+	// QuestionPostIDs are the posts asking each of the survey's questions in the order that they were sent, including
+	// the ScorePostID.
+	QuestionPostIDs []string `json:"question_post_ids,omitempty"`
+
+	// ReminderSentAt is when the user was reminded to answer the survey, if they were.
+	ReminderSentAt time.Time `json:"reminder_sent_at"`
+
+	// FollowUp is the follow-up question sent after the user first scored the survey, if any.
+	FollowUp *scoreFollowUp `json:"follow_up,omitempty"`
+
+	// AnswerFollowUps are the follow-up questions sent after the user first answered each of the survey's other
+	// questions, keyed by question ID.
+	AnswerFollowUps map[string]*answerFollowUp `json:"answer_follow_ups,omitempty"`
 }
 
-// checkForNextSurvey schedules a new NPS survey if a major or minor version change has occurred. Returns whether or
-// not a survey was scheduled.
+// getSurveyID returns the ID of the survey that the user was last sent. States stored before surveys had IDs are
+// identified by their server version.
+func (s *userSurveyState) getSurveyID() string {
+	if s.SurveyID == "" {
+		return s.ServerVersion
+	}
+
+	return s.SurveyID
+}
+
+// getQuestionPostIDs returns the posts asking each of the survey's questions. States stored before every question post
+// was recorded only have the ScorePostID.
+func (s *userSurveyState) getQuestionPostIDs() []string {
+	if len(s.QuestionPostIDs) == 0 && s.ScorePostID != "" {
+		return []string{s.ScorePostID}
+	}
+
+	return s.QuestionPostIDs
+}
+
+// checkForNextSurvey schedules a new NPS survey if one hasn't been scheduled yet for the current survey cycle. That is
+// either when a major or minor version change has occurred or, if surveys are sent on a fixed schedule, when a new
+// cycle has started. Returns whether or not a survey was scheduled.
 //
 // Note that this only sends an email to admins to notify them that a survey has been scheduled. The web app plugin is
 // in charge of checking and actually triggering the survey.
@@ -79,8 +142,10 @@ func (p *Plugin) checkForNextSurvey(now time.Time) bool {
 		_ = p.unlock(LockKey)
 	}()
 
+	cycle := p.getSurveyCycle(now)
+
 	var nextSurvey *surveyState
-	if errSurvey := p.KVGet(fmt.Sprintf(SurveyKey, p.serverVersion), &nextSurvey); errSurvey != nil {
+	if errSurvey := p.KVGet(fmt.Sprintf(SurveyKey, cycle.ID), &nextSurvey); errSurvey != nil {
 		p.API.LogError("Failed to get survey state", "err", err)
 		return false
 	}
@@ -91,14 +156,23 @@ func (p *Plugin) checkForNextSurvey(now time.Time) bool {
 	}
 
 	nextSurvey = &surveyState{
+		ID:            cycle.ID,
 		ServerVersion: p.serverVersion,
 		CreateAt:      now,
-		StartAt:       now.Add(TimeUntilSurvey),
+		StartAt:       now.Add(p.getConfiguration().getTimeUntilSurvey()),
+	}
+
+	nextSurvey.EndAt = cycle.getSurveyEndAt(nextSurvey.StartAt, p.getConfiguration().getSurveyDuration())
+
+	if !cycle.EndAt.IsZero() && !nextSurvey.StartAt.Before(cycle.EndAt) {
+		// There isn't enough time left in this cycle to notify admins before the survey starts, so skip it
+		p.API.LogInfo(fmt.Sprintf("Not scheduling survey %s since it would start after the cycle ends", cycle.ID))
+		return false
 	}
 
 	p.API.LogInfo(fmt.Sprintf("Scheduling next survey for %s", nextSurvey.StartAt.Format("Jan 2, 2006")))
 
-	if errSchedule := p.KVSet(fmt.Sprintf(SurveyKey, p.serverVersion), nextSurvey); errSchedule != nil {
+	if errSchedule := p.KVSet(fmt.Sprintf(SurveyKey, cycle.ID), nextSurvey); errSchedule != nil {
 		p.API.LogError("Failed to schedule next survey", "err", err)
 		return false
 	}
@@ -124,7 +198,7 @@ func (p *Plugin) sendAdminNotices(now time.Time, nextSurvey *surveyState) (bool,
 		return false, err
 	}
 
-	if lastSentAt != nil && now.Sub(*lastSentAt) < MinTimeBetweenSurveyEmails {
+	if lastSentAt != nil && now.Sub(*lastSentAt) < p.getConfiguration().getMinTimeBetweenSurveyEmails() {
 		// Not enough time has passed since the last survey notification, so don't send a new one
 		return false, nil
 	}
@@ -145,42 +219,63 @@ func (p *Plugin) sendAdminNotices(now time.Time, nextSurvey *surveyState) (bool,
 }
 
 func (p *Plugin) sendAdminNoticeEmails(admins []*model.User) {
+	subject, body, err := p.buildAdminNoticeEmail(p.getConfiguration().getMessageTemplates())
+	if err != nil {
+		p.API.LogError("Failed to prepare survey notification email", "err", err)
+		return
+	}
+
+	for _, admin := range admins {
+		p.API.LogDebug("Sending survey notification email", "email", admin.Email)
+
+		if err := p.API.SendMail(admin.Email, subject, body); err != nil {
+			p.API.LogError("Failed to send survey notification email", "email", admin.Email, "err", err)
+		}
+	}
+}
+
+// buildAdminNoticeEmail returns the subject and body of the email notifying System Admins that a survey has been
+// scheduled. The email is written in the server's default locale unless an admin has replaced its body.
+func (p *Plugin) buildAdminNoticeEmail(templates *messageTemplates) (string, string, error) {
 	config := p.API.GetConfig()
+	daysUntilSurvey := p.getConfiguration().getDaysUntilSurvey()
+
+	locale := p.getServerLocale()
 
-	subject := fmt.Sprintf(adminEmailSubject, *config.TeamSettings.SiteName, DaysUntilSurvey)
+	subject := p.translate(locale, adminEmailSubject, *config.TeamSettings.SiteName, daysUntilSurvey)
+
+	// The translated parts of the email are trusted HTML from the plugin bundle, and their arguments are escaped
+	body, ok := p.renderAdminEmailBody(templates.AdminEmail)
+	if !ok {
+		body = template.HTML("<p>" + p.translate(locale, adminEmailIntro, daysUntilSurvey) + "</p>\n" + //nolint:gosec
+			"<p>" + p.translate(locale, adminEmailDisable, template.HTMLEscapeString(*config.ServiceSettings.SiteURL), manifest.Id) + "</p>")
+	}
 
 	bodyProps := map[string]interface{}{
-		"PluginID":        manifest.Id,
-		"SiteURL":         *config.ServiceSettings.SiteURL,
-		"DaysUntilSurvey": DaysUntilSurvey,
+		"SiteURL": *config.ServiceSettings.SiteURL,
+		"Title":   template.HTML(p.translate(locale, adminEmailTitle)), //nolint:gosec
+		"Body":    body,
 	}
 	if config.EmailSettings.FeedbackOrganization != nil && *config.EmailSettings.FeedbackOrganization != "" {
-		bodyProps["Organization"] = "Sent by " + *config.EmailSettings.FeedbackOrganization
+		bodyProps["Organization"] = p.translate(locale, adminEmailOrganization, *config.EmailSettings.FeedbackOrganization)
 	} else {
 		bodyProps["Organization"] = ""
 	}
 
 	var buf bytes.Buffer
 	if err := adminEmailBodyTemplate.Execute(&buf, bodyProps); err != nil {
-		p.API.LogError("Failed to prepare survey notification email", "err", err)
-		return
+		return "", "", err
 	}
-	body := buf.String()
 
-	for _, admin := range admins {
-		p.API.LogDebug("Sending survey notification email", "email", admin.Email)
-
-		if err := p.API.SendMail(admin.Email, subject, body); err != nil {
-			p.API.LogError("Failed to send survey notification email", "email", admin.Email, "err", err)
-		}
-	}
+	return subject, buf.String(), nil
 }
 
 func (p *Plugin) sendAdminNoticeDMs(admins []*model.User, nextSurvey *surveyState) {
 	// Actual DMs will be sent when the admins next log in, so just mark that they're scheduled to receive one
 	for _, admin := range admins {
-		err := p.KVSet(fmt.Sprintf(AdminDmNoticeKey, admin.Id, nextSurvey.ServerVersion), &adminNotice{
+		err := p.KVSet(fmt.Sprintf(AdminDmNoticeKey, admin.Id, nextSurvey.getID()), &adminNotice{
 			Sent:          false,
+			SurveyID:      nextSurvey.getID(),
 			ServerVersion: nextSurvey.ServerVersion,
 			SurveyStartAt: nextSurvey.StartAt,
 		})
@@ -221,7 +316,7 @@ func (p *Plugin) getAdminUsers(perPage int) ([]*model.User, *model.AppError) {
 	return admins, nil
 }
 
-func (p *Plugin) checkForAdminNoticeDM(user *model.User) (bool, *model.AppError) {
+func (p *Plugin) checkForAdminNoticeDM(user *model.User, now time.Time) (bool, *model.AppError) {
 	if !p.getConfiguration().EnableSurvey {
 		// Surveys are disabled
 		return false, nil
@@ -232,7 +327,7 @@ func (p *Plugin) checkForAdminNoticeDM(user *model.User) (bool, *model.AppError)
 	}
 
 	var notice *adminNotice
-	if err := p.KVGet(fmt.Sprintf(AdminDmNoticeKey, user.Id, p.serverVersion), &notice); err != nil {
+	if err := p.KVGet(fmt.Sprintf(AdminDmNoticeKey, user.Id, p.getSurveyCycle(now).ID), &notice); err != nil {
 		return false, err
 	}
 
@@ -263,14 +358,14 @@ func (p *Plugin) sendAdminNoticeDM(user *model.User, notice *adminNotice) *model
 	p.API.LogDebug("Sending admin notice DM", "user_id", user.Id)
 
 	// Send the DM
-	if _, err := p.CreateBotDMPost(user.Id, p.buildAdminNoticePost(notice.SurveyStartAt)); err != nil {
+	if _, err := p.CreateBotDMPost(user.Id, p.buildAdminNoticePost(notice.SurveyStartAt, user.Locale)); err != nil {
 		return err
 	}
 
 	// Store that the DM has been sent
 	notice.Sent = true
 
-	if err := p.KVSet(fmt.Sprintf(AdminDmNoticeKey, user.Id, notice.ServerVersion), notice); err != nil {
+	if err := p.KVSet(fmt.Sprintf(AdminDmNoticeKey, user.Id, notice.getSurveyID()), notice); err != nil {
 		p.API.LogError("Failed to save sent admin notice. Admin notice will be resent on next refresh.", "err", err)
 		return err
 	}
@@ -278,26 +373,27 @@ func (p *Plugin) sendAdminNoticeDM(user *model.User, notice *adminNotice) *model
 	return nil
 }
 
-func (p *Plugin) buildAdminNoticePost(surveyStartAt time.Time) *model.Post {
+func (p *Plugin) buildAdminNoticePost(surveyStartAt time.Time, locale string) *model.Post {
 	return &model.Post{
-		Message: fmt.Sprintf(adminDMBody, surveyStartAt.Format("January 2, 2006"), manifest.Id),
+		Message: p.translate(locale, adminDMBody, p.formatDate(locale, surveyStartAt), manifest.Id),
 		Type:    "custom_nps_admin_notice",
 	}
 }
 
 func (p *Plugin) checkForSurveyDM(user *model.User, now time.Time) (bool, *model.AppError) {
-	if !p.getConfiguration().EnableSurvey {
+	config := p.getConfiguration()
+	if !config.EnableSurvey {
 		// Surveys are disabled
 		return false, nil
 	}
 
-	if now.Sub(time.Unix(user.CreateAt/1000, 0)) < TimeUntilSurvey {
+	if now.Sub(time.Unix(user.CreateAt/1000, 0)) < config.getTimeUntilSurvey() {
 		// The user hasn't existed for long enough to receive a survey
 		return false, nil
 	}
 
 	var survey *surveyState
-	if err := p.KVGet(fmt.Sprintf(SurveyKey, p.serverVersion), &survey); err != nil {
+	if err := p.KVGet(fmt.Sprintf(SurveyKey, p.getSurveyCycle(now).ID), &survey); err != nil {
 		return false, err
 	}
 
@@ -311,6 +407,11 @@ func (p *Plugin) checkForSurveyDM(user *model.User, now time.Time) (bool, *model
 		return false, nil
 	}
 
+	if survey.hasEnded(now) {
+		// Survey has already ended
+		return false, nil
+	}
+
 	// And that it has been long enough since the survey last occurred
 	var userSurvey *userSurveyState
 	if err := p.KVGet(fmt.Sprintf(UserSurveyKey, user.Id), &userSurvey); err != nil {
@@ -319,42 +420,101 @@ func (p *Plugin) checkForSurveyDM(user *model.User, now time.Time) (bool, *model
 
 	if userSurvey != nil {
 		if userSurvey.Disabled {
-			// The user explicitly disabled surveys
+			// The user explicitly disabled surveys before preferences existed
 			return false, nil
 		}
 
-		if userSurvey.ServerVersion == p.serverVersion {
+		if userSurvey.getSurveyID() == survey.getID() {
 			// The user has already received this survey
 			return false, nil
 		}
 
-		if now.Sub(userSurvey.SentAt) < MinTimeBetweenUserSurveys {
+		if now.Sub(userSurvey.SentAt) < config.getMinTimeBetweenUserSurveys() {
 			// Not enough time has passed since the user was last sent a survey
 			return false, nil
 		}
 
-		if now.Sub(userSurvey.AnsweredAt) < MinTimeBetweenUserSurveys {
+		if now.Sub(userSurvey.AnsweredAt) < config.getMinTimeBetweenUserSurveys() {
 			// Not enough time has passed since the user last completed a survey
 			return false, nil
 		}
 	}
 
-	return true, p.sendSurveyDM(user, now)
+	preferences, err := p.getUserPreferences(user.Id)
+	if err != nil {
+		return false, err
+	}
+
+	if preferences.DisableSurveys {
+		// The user opted out of surveys
+		return false, nil
+	}
+
+	if !config.isInDeliveryWindow(user, now) {
+		// It's outside of the hours when the user can receive surveys, so try again later
+		return false, nil
+	}
+
+	if !isUserSampled(user.Id, survey.getID(), config.getSurveySamplePercentage()) {
+		// The user wasn't chosen to receive this survey
+		return false, nil
+	}
+
+	targeted, err := p.isUserTargeted(user)
+	if err != nil {
+		return false, err
+	}
+
+	if !targeted {
+		// The user isn't part of the survey's audience
+		return false, nil
+	}
+
+	quotaReached, err := p.isSurveyQuotaReached(survey.getID())
+	if err != nil {
+		return false, err
+	}
+
+	if quotaReached {
+		// The survey has already been sent to enough users
+		return false, nil
+	}
+
+	return true, p.sendSurveyDM(user, survey, preferences, now)
 }
 
-func (p *Plugin) sendSurveyDM(user *model.User, now time.Time) *model.AppError {
+func (p *Plugin) sendSurveyDM(user *model.User, survey *surveyState, preferences *userPreferences, now time.Time) *model.AppError {
 	p.API.LogDebug("Sending survey DM", "user_id", user.Id)
 
-	// Send the DM
-	post, err := p.CreateBotDMPost(user.Id, p.buildSurveyPost(user))
+	definition, err := p.getSurveyDefinition()
 	if err != nil {
 		return err
 	}
 
 	userSurveyState := &userSurveyState{
+		SurveyID:      survey.getID(),
 		ServerVersion: p.serverVersion,
 		SentAt:        now,
-		ScorePostID:   post.Id,
+	}
+
+	// Send each question as a separate DM
+	for i, question := range definition.Questions {
+		post, err := p.CreateBotDMPost(user.Id, p.buildQuestionPost(user, question, i == 0))
+		if err != nil {
+			if i == 0 {
+				// Nothing has been sent yet, so the survey can be safely resent later
+				return err
+			}
+
+			p.API.LogWarn("Failed to send survey question", "question_id", question.ID, "err", err)
+			continue
+		}
+
+		userSurveyState.QuestionPostIDs = append(userSurveyState.QuestionPostIDs, post.Id)
+
+		if question.Type == QuestionTypeNPS {
+			userSurveyState.ScorePostID = post.Id
+		}
 	}
 
 	// Store that the survey has been sent
@@ -364,26 +524,20 @@ func (p *Plugin) sendSurveyDM(user *model.User, now time.Time) *model.AppError {
 		return err
 	}
 
-	return nil
-}
+	// Count the survey as sent for reporting
+	if _, err = p.KVIncrement(fmt.Sprintf(SurveySentCountKey, survey.getID())); err != nil {
+		p.API.LogWarn("Failed to count sent survey", "err", err)
+	}
 
-func (p *Plugin) buildSurveyPost(user *model.User) *model.Post {
-	return &model.Post{
-		Message: fmt.Sprintf(surveyBody, user.Username),
-		Type:    "custom_nps_survey",
-		Props: map[string]interface{}{
-			"attachments": []*model.SlackAttachment{
-				{
-					Title: surveyDropdownTitle,
-					Actions: []*model.PostAction{
-						p.buildSurveyPostAction(),
-						p.buildDisableAction(),
-					},
-				},
-			},
-		},
+	if preferences.getPreferredChannel() == PreferredChannelEmail {
+		if err = p.sendSurveyEmail(user); err != nil {
+			p.API.LogWarn("Failed to email user about survey", "err", err)
+		}
 	}
+
+	return nil
 }
+
 func (p *Plugin) buildDisableAction() *model.PostAction {
 	return &model.PostAction{
 		Name: "Disable",
@@ -394,55 +548,11 @@ func (p *Plugin) buildDisableAction() *model.PostAction {
 	}
 }
 
-func (p *Plugin) buildSurveyPostAction() *model.PostAction {
-	var options []*model.PostActionOptions
-	for i := 10; i >= 0; i-- {
-		text := strconv.Itoa(i)
-		if i == 0 {
-			text = "0 (Not Likely)"
-		} else if i == 10 {
-			text = "10 (Very Likely)"
-		}
-
-		options = append(options, &model.PostActionOptions{
-			Text:  text,
-			Value: strconv.Itoa(i),
-		})
-	}
-
-	return &model.PostAction{
-		Name:    "Select an option...",
-		Type:    model.PostActionTypeSelect,
-		Options: options,
-		Integration: &model.PostActionIntegration{
-			URL: fmt.Sprintf("/plugins/%s/api/v1/score", manifest.Id),
-		},
-	}
-}
-
-func (p *Plugin) buildAnsweredSurveyPost(user *model.User, score int) *model.Post {
-	action := p.buildSurveyPostAction()
-	action.DefaultOption = strconv.Itoa(score)
-
-	return &model.Post{
-		Type:    "custom_nps_survey",
-		Message: fmt.Sprintf(surveyBody, user.Username),
-		Props: map[string]interface{}{
-			"attachments": []*model.SlackAttachment{
-				{
-					Title:   surveyDropdownTitle,
-					Text:    fmt.Sprintf(surveyAnsweredBody, score),
-					Actions: []*model.PostAction{action, p.buildDisableAction()},
-				},
-			},
-		},
-	}
-}
-
-func (p *Plugin) buildFeedbackRequestPost() *model.Post {
+// buildFeedbackRequestPost builds the follow-up post asking a user in the given segment to explain their score.
+func (p *Plugin) buildFeedbackRequestPost(segment, locale string) *model.Post {
 	return &model.Post{
 		Type:    "custom_nps_feedback",
-		Message: thanksFeedbackRequestBody,
+		Message: p.translate(locale, getFollowUpText(segment)),
 	}
 }
 
@@ -452,6 +562,11 @@ func (p *Plugin) markSurveyAnswered(userID string, now time.Time) (bool, *model.
 		return false, err
 	}
 
+	if userSurvey == nil {
+		// The user hasn't been sent a survey
+		return false, nil
+	}
+
 	if !userSurvey.AnsweredAt.IsZero() {
 		// Survey was already answered
 		return false, nil
@@ -7,7 +7,10 @@ import (
 	"html/template"
 )
 
-const adminEmailSubject = "[%s] User Satisfaction Survey scheduled in %d days"
+var adminEmailSubject = &i18nMessage{
+	ID:    "admin_email.subject",
+	Other: "[%s] User Satisfaction Survey scheduled in %d days",
+}
 
 var adminEmailBodyTemplate = template.Must(template.New("emailBody").Parse(`
 <table align="center" border="0" cellpadding="0" cellspacing="0" width="100%" style="margin-top: 20px; line-height: 1.7; color: #555;">
@@ -27,9 +30,8 @@ var adminEmailBodyTemplate = template.Must(template.New("emailBody").Parse(`
                                     <table border="0" cellpadding="0" cellspacing="0" style="padding: 20px 50px 0; text-align: center; margin: 0 auto">
                                         <tr>
                                             <td style="padding: 0 0 20px;">
-                                                <h2 style="font-weight: normal; margin-top: 10px;"><a href="https://mattermost.com/pl/default-nps">User Satisfaction Survey</a> Scheduled</h2>
-                                                <p>Mattermost sends quarterly in-product user satisfaction surveys to gather feedback from users and improve product quality. Surveys will be received by users in <strong>{{.DaysUntilSurvey}} days</strong>.</p>
-                                                <p>Click <a href="{{.SiteURL}}/admin_console/plugins/plugin_{{.PluginID}}">here</a> to disable or learn more about user satisfaction surveys. Please refer to our <a href="https://about.mattermost.com/default-privacy-policy">privacy policy</a> for more information on the collection and use of information received through our services.</p>
+                                                <h2 style="font-weight: normal; margin-top: 10px;">{{.Title}}</h2>
+                                                {{.Body}}
                                             </td>
                                         </tr>
                                         <tr>
@@ -56,17 +58,120 @@ var adminEmailBodyTemplate = template.Must(template.New("emailBody").Parse(`
 </table>
 `))
 
-const adminDMBody = `Mattermost uses feedback surveys to measure user satisfaction and improve product quality. User surveys will start to be sent on %s.
+// The parts of the admin email are HTML so that they can contain links. Their arguments must be escaped.
+var adminEmailTitle = &i18nMessage{
+	ID:    "admin_email.title",
+	Other: `<a href="https://mattermost.com/pl/default-nps">User Satisfaction Survey</a> Scheduled`,
+}
+var adminEmailIntro = &i18nMessage{
+	ID:    "admin_email.intro",
+	Other: "Mattermost sends quarterly in-product user satisfaction surveys to gather feedback from users and improve product quality. Surveys will be received by users in <strong>%d days</strong>.",
+}
+var adminEmailDisable = &i18nMessage{
+	ID:    "admin_email.disable",
+	Other: `Click <a href="%s/admin_console/plugins/plugin_%s">here</a> to disable or learn more about user satisfaction surveys. Please refer to our <a href="https://about.mattermost.com/default-privacy-policy">privacy policy</a> for more information on the collection and use of information received through our services.`,
+}
+var adminEmailOrganization = &i18nMessage{
+	ID:    "admin_email.organization",
+	Other: "Sent by %s",
+}
+
+var adminDMBody = &i18nMessage{
+	ID: "admin_dm.body",
+	Other: `Mattermost uses feedback surveys to measure user satisfaction and improve product quality. User surveys will start to be sent on %s.
 
 [Click here](/admin_console/plugins/plugin_%s) to disable or learn more about user satisfaction surveys.
 
-*This message is only visible to System Admins.*`
+*This message is only visible to System Admins.*`,
+}
+
+// dateFormat formats a date from its month name, day and year, such as "January 2, 2006".
+var dateFormat = &i18nMessage{ID: "date.format", Other: "%[1]s %[2]d, %[3]d"}
+
+// monthNames are the names of the months used by dateFormat, starting with January.
+var monthNames = []*i18nMessage{
+	{ID: "date.month.january", Other: "January"},
+	{ID: "date.month.february", Other: "February"},
+	{ID: "date.month.march", Other: "March"},
+	{ID: "date.month.april", Other: "April"},
+	{ID: "date.month.may", Other: "May"},
+	{ID: "date.month.june", Other: "June"},
+	{ID: "date.month.july", Other: "July"},
+	{ID: "date.month.august", Other: "August"},
+	{ID: "date.month.september", Other: "September"},
+	{ID: "date.month.october", Other: "October"},
+	{ID: "date.month.november", Other: "November"},
+	{ID: "date.month.december", Other: "December"},
+}
+
+var surveyBody = &i18nMessage{
+	ID:    "survey.body",
+	Other: ":wave: Hey @%s! Please take a few moments to help us improve your experience with Mattermost.",
+}
+var surveyDropdownTitle = &i18nMessage{
+	ID:    "survey.nps.question",
+	Other: "How likely are you to recommend Mattermost?",
+}
+var npsMinLabel = &i18nMessage{ID: "survey.nps.min_label", Other: "Not Likely"}
+var npsMaxLabel = &i18nMessage{ID: "survey.nps.max_label", Other: "Very Likely"}
+var csatQuestionText = &i18nMessage{
+	ID:    "survey.csat.question",
+	Other: "How satisfied are you with Mattermost?",
+}
+var csatMinLabel = &i18nMessage{ID: "survey.csat.min_label", Other: "Very Unsatisfied"}
+var csatMaxLabel = &i18nMessage{ID: "survey.csat.max_label", Other: "Very Satisfied"}
+var cesQuestionText = &i18nMessage{
+	ID:    "survey.ces.question",
+	Other: "How easy is it to get your work done in Mattermost?",
+}
+var cesMinLabel = &i18nMessage{ID: "survey.ces.min_label", Other: "Very Difficult"}
+var cesMaxLabel = &i18nMessage{ID: "survey.ces.max_label", Other: "Very Easy"}
+var surveyAnsweredBody = &i18nMessage{ID: "survey.answered", Other: "You selected %s out of %d."}
+var surveyQuestionAnsweredBody = &i18nMessage{ID: "survey.question_answered", Other: "You selected %s."}
+var surveyAnsweredAnonymouslyBody = &i18nMessage{
+	ID:    "survey.answered_anonymously",
+	Other: "Thanks! Your answer was recorded anonymously.",
+}
+var surveyReminderBody = &i18nMessage{
+	ID:    "survey.reminder",
+	Other: "Just a friendly reminder that we'd love to hear what you think of Mattermost. It only takes a moment to choose a score above, and your answer helps us make Mattermost better for everyone.",
+}
+
+var surveyExpiredBody = &i18nMessage{
+	ID:    "survey.expired",
+	Other: "This survey has ended. Thanks for being part of the Mattermost community!",
+}
+
+var welcomeFeedbackRequestBody = &i18nMessage{
+	ID:    "welcome_feedback.body",
+	Other: ":wave: Hey @%s! Can you spare a minute or two to tell me how do you like Mattermost so far? What do you like so far? Is there anything confusing or that you wish was better or different? This feedback will go to the Product team to help make improvements so any feedback is welcome!",
+}
+
+var feedbackRequestBody = &i18nMessage{ID: "feedback.request", Other: "How can we make your experience better?"}
+var thanksFeedbackRequestBody = &i18nMessage{
+	ID:    "feedback.request.thanks",
+	Other: "Thanks! How can we make your experience better?",
+}
+var detractorFeedbackRequestBody = &i18nMessage{
+	ID:    "feedback.request.detractor",
+	Other: "Thanks! What's the one thing we should fix?",
+}
+var passiveFeedbackRequestBody = &i18nMessage{
+	ID:    "feedback.request.passive",
+	Other: "Thanks! What would make you more likely to recommend Mattermost?",
+}
+var promoterFeedbackRequestBody = &i18nMessage{
+	ID:    "feedback.request.promoter",
+	Other: "Thanks! What do you like most about Mattermost?",
+}
 
-const surveyBody = ":wave: Hey @%s! Please take a few moments to help us improve your experience with Mattermost."
-const surveyDropdownTitle = "How likely are you to recommend Mattermost?"
-const surveyAnsweredBody = "You selected %d out of 10."
+var feedbackResponseBody = &i18nMessage{
+	ID:    "feedback.thanks",
+	Other: ":tada: Thanks for helping us make Mattermost better!",
+}
 
-const welcomeFeedbackRequestBody = ":wave: Hey @%s! Can you spare a minute or two to tell me how do you like Mattermost so far? What do you like so far? Is there anything confusing or that you wish was better or different? This feedback will go to the Product team to help make improvements so any feedback is welcome!"
-const feedbackRequestBody = "How can we make your experience better?"
-const thanksFeedbackRequestBody = "Thanks! " + feedbackRequestBody
-const feedbackResponseBody = ":tada: Thanks for helping us make Mattermost better!"
+var surveyEmailSubject = &i18nMessage{ID: "survey_email.subject", Other: "[%s] Feedbackbot sent you a survey"}
+var surveyEmailBody = &i18nMessage{
+	ID:    "survey_email.body",
+	Other: `<p>Feedbackbot sent you a quick survey about Mattermost. Open <a href="%[1]s">%[1]s</a> to answer it in your direct message with Feedbackbot.</p>`,
+}
@@ -28,9 +28,10 @@ func TestCheckForNextSurvey(t *testing.T) {
 		api.On("KVCompareAndSet", LockKey, []byte(nil), mustMarshalJSON(now())).Return(true, nil)
 		api.On("KVGet", surveyKey).Return(nil, nil)
 		api.On("KVSet", surveyKey, mustMarshalJSON(&surveyState{
+			ID:            serverVersion,
 			ServerVersion: serverVersion,
 			CreateAt:      now(),
-			StartAt:       now().Add(TimeUntilSurvey),
+			StartAt:       now().Add(DefaultTimeUntilSurvey),
 		})).Return(nil)
 		api.On("KVGet", LastAdminNoticeKey).Return(nil, nil)
 		api.On("GetUsers", mock.Anything).Return([]*model.User{
@@ -67,6 +68,38 @@ func TestCheckForNextSurvey(t *testing.T) {
 		assert.True(t, result)
 	})
 
+	t.Run("should schedule survey using the configured number of days", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVCompareAndSet", LockKey, []byte(nil), mustMarshalJSON(now())).Return(true, nil)
+		api.On("KVGet", surveyKey).Return(nil, nil)
+		api.On("KVSet", surveyKey, mustMarshalJSON(&surveyState{
+			ID:            serverVersion,
+			ServerVersion: serverVersion,
+			CreateAt:      now(),
+			StartAt:       now().Add(14 * day),
+			EndAt:         now().Add(14 * day).Add(21 * day),
+		})).Return(nil)
+		api.On("KVGet", LastAdminNoticeKey).Return(mustMarshalJSON(now().Add(-2*day)), nil)
+		api.On("KVDelete", LockKey).Return(nil)
+		defer api.AssertExpectations(t)
+
+		p := &Plugin{
+			configuration: &configuration{
+				EnableSurvey:            true,
+				DaysUntilSurvey:         14,
+				DaysBetweenSurveyEmails: 3,
+				SurveyDurationDays:      21,
+			},
+			now:           now,
+			serverVersion: serverVersion,
+		}
+		p.SetAPI(api)
+
+		result := p.checkForNextSurvey(now())
+
+		assert.True(t, result)
+	})
+
 	t.Run("should not send survey or notices if a survey has already been sent for this version", func(t *testing.T) {
 		api := makeAPIMock()
 		api.On("KVCompareAndSet", LockKey, []byte(nil), mustMarshalJSON(now())).Return(true, nil)
@@ -279,11 +312,13 @@ func TestSendAdminNoticeDMs(t *testing.T) {
 	api := &plugintest.API{}
 	api.On("KVSet", fmt.Sprintf(AdminDmNoticeKey, admins[0].Id, survey.ServerVersion), mustMarshalJSON(&adminNotice{
 		Sent:          false,
+		SurveyID:      survey.ServerVersion,
 		ServerVersion: survey.ServerVersion,
 		SurveyStartAt: survey.StartAt,
 	})).Return(nil)
 	api.On("KVSet", fmt.Sprintf(AdminDmNoticeKey, admins[1].Id, survey.ServerVersion), mustMarshalJSON(&adminNotice{
 		Sent:          false,
+		SurveyID:      survey.ServerVersion,
 		ServerVersion: survey.ServerVersion,
 		SurveyStartAt: survey.StartAt,
 	})).Return(nil)
@@ -425,7 +460,7 @@ func TestCheckForAdminNoticeDM(t *testing.T) {
 		defer api.AssertExpectations(t)
 
 		p := makePlugin(api)
-		sent, err := p.checkForAdminNoticeDM(user)
+		sent, err := p.checkForAdminNoticeDM(user, time.Now())
 
 		assert.True(t, sent)
 		assert.Nil(t, err)
@@ -451,7 +486,7 @@ func TestCheckForAdminNoticeDM(t *testing.T) {
 		defer api.AssertExpectations(t)
 
 		p := makePlugin(api)
-		sent, err := p.checkForAdminNoticeDM(user)
+		sent, err := p.checkForAdminNoticeDM(user, time.Now())
 
 		assert.True(t, sent)
 		assert.NotNil(t, err)
@@ -473,7 +508,7 @@ func TestCheckForAdminNoticeDM(t *testing.T) {
 		defer api.AssertExpectations(t)
 
 		p := makePlugin(api)
-		sent, err := p.checkForAdminNoticeDM(user)
+		sent, err := p.checkForAdminNoticeDM(user, time.Now())
 
 		assert.True(t, sent)
 		assert.NotNil(t, err)
@@ -493,7 +528,7 @@ func TestCheckForAdminNoticeDM(t *testing.T) {
 		defer api.AssertExpectations(t)
 
 		p := makePlugin(api)
-		sent, err := p.checkForAdminNoticeDM(user)
+		sent, err := p.checkForAdminNoticeDM(user, time.Now())
 
 		assert.False(t, sent)
 		assert.Nil(t, err)
@@ -510,7 +545,7 @@ func TestCheckForAdminNoticeDM(t *testing.T) {
 		defer api.AssertExpectations(t)
 
 		p := makePlugin(api)
-		sent, err := p.checkForAdminNoticeDM(user)
+		sent, err := p.checkForAdminNoticeDM(user, time.Now())
 
 		assert.False(t, sent)
 		assert.Nil(t, err)
@@ -527,7 +562,7 @@ func TestCheckForAdminNoticeDM(t *testing.T) {
 		defer api.AssertExpectations(t)
 
 		p := makePlugin(api)
-		sent, err := p.checkForAdminNoticeDM(user)
+		sent, err := p.checkForAdminNoticeDM(user, time.Now())
 
 		assert.False(t, sent)
 		assert.NotNil(t, err)
@@ -540,7 +575,7 @@ func TestCheckForAdminNoticeDM(t *testing.T) {
 		}
 
 		p := makePlugin(nil)
-		sent, err := p.checkForAdminNoticeDM(user)
+		sent, err := p.checkForAdminNoticeDM(user, time.Now())
 
 		assert.False(t, sent)
 		assert.Nil(t, err)
@@ -554,7 +589,7 @@ func TestCheckForAdminNoticeDM(t *testing.T) {
 
 		p := makePlugin(nil)
 		p.configuration.EnableSurvey = false
-		sent, err := p.checkForAdminNoticeDM(user)
+		sent, err := p.checkForAdminNoticeDM(user, time.Now())
 
 		assert.False(t, sent)
 		assert.Nil(t, err)
@@ -568,9 +603,11 @@ func TestCheckForSurveyDM(t *testing.T) {
 	serverVersion := "5.12.0"
 
 	newSurveyStateBytes := mustMarshalJSON(&userSurveyState{
-		ScorePostID:   postID,
-		ServerVersion: serverVersion,
-		SentAt:        now,
+		SurveyID:        serverVersion,
+		ScorePostID:     postID,
+		ServerVersion:   serverVersion,
+		SentAt:          now,
+		QuestionPostIDs: []string{postID},
 	})
 
 	makePlugin := func(api *plugintest.API) *Plugin {
@@ -586,10 +623,56 @@ func TestCheckForSurveyDM(t *testing.T) {
 		return p
 	}
 
+	t.Run("should send each question of a custom survey", func(t *testing.T) {
+		searchPostID := model.NewId()
+
+		user := &model.User{
+			Id:       model.NewId(),
+			CreateAt: now.Add(-1*DefaultTimeUntilSurvey).UnixNano() / int64(time.Millisecond),
+		}
+
+		api := makeAPIMock()
+		api.On("KVGet", fmt.Sprintf(SurveyKey, serverVersion)).Return(mustMarshalJSON(&surveyState{
+			ServerVersion: serverVersion,
+			StartAt:       now,
+		}), nil)
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, user.Id)).Return(nil, nil)
+		api.On("KVGet", fmt.Sprintf(UserPreferencesKey, user.Id)).Return(nil, nil)
+		api.On("KVGet", SurveyDefinitionKey).Return(mustMarshalJSON(&surveyDefinition{
+			Questions: []*surveyQuestion{
+				{ID: "search", Type: QuestionTypeScale, Text: "How satisfied are you with search?", Min: 1, Max: 5},
+				defaultNPSQuestion(),
+			},
+		}), nil)
+		api.On("GetDirectChannel", user.Id, botUserID).Return(&model.Channel{}, nil)
+		api.On("CreatePost", mock.MatchedBy(func(post *model.Post) bool {
+			return post.Type == ""
+		})).Return(&model.Post{Id: searchPostID}, nil).Once()
+		api.On("CreatePost", mock.MatchedBy(func(post *model.Post) bool {
+			return post.Type == "custom_nps_survey"
+		})).Return(&model.Post{Id: postID}, nil).Once()
+		api.On("KVSet", fmt.Sprintf(UserSurveyKey, user.Id), mustMarshalJSON(&userSurveyState{
+			SurveyID:        serverVersion,
+			ScorePostID:     postID,
+			ServerVersion:   serverVersion,
+			SentAt:          now,
+			QuestionPostIDs: []string{searchPostID, postID},
+		})).Return(nil)
+		api.On("KVGet", fmt.Sprintf(SurveySentCountKey, serverVersion)).Return(nil, nil)
+		api.On("KVCompareAndSet", fmt.Sprintf(SurveySentCountKey, serverVersion), []byte(nil), []byte("1")).Return(true, nil)
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api)
+		sent, err := p.checkForSurveyDM(user, now)
+
+		assert.True(t, sent)
+		assert.Nil(t, err)
+	})
+
 	t.Run("should send first ever survey DM", func(t *testing.T) {
 		user := &model.User{
 			Id:       model.NewId(),
-			CreateAt: now.Add(-1*TimeUntilSurvey).UnixNano() / int64(time.Millisecond),
+			CreateAt: now.Add(-1*DefaultTimeUntilSurvey).UnixNano() / int64(time.Millisecond),
 		}
 
 		api := makeAPIMock()
@@ -598,9 +681,13 @@ func TestCheckForSurveyDM(t *testing.T) {
 			StartAt:       now,
 		}), nil)
 		api.On("KVGet", fmt.Sprintf(UserSurveyKey, user.Id)).Return(nil, nil)
+		api.On("KVGet", fmt.Sprintf(UserPreferencesKey, user.Id)).Return(nil, nil)
+		api.On("KVGet", SurveyDefinitionKey).Return(nil, nil)
 		api.On("GetDirectChannel", user.Id, botUserID).Return(&model.Channel{}, nil)
 		api.On("CreatePost", mock.Anything).Return(&model.Post{Id: postID}, nil)
 		api.On("KVSet", fmt.Sprintf(UserSurveyKey, user.Id), newSurveyStateBytes).Return(nil)
+		api.On("KVGet", fmt.Sprintf(SurveySentCountKey, serverVersion)).Return(nil, nil)
+		api.On("KVCompareAndSet", fmt.Sprintf(SurveySentCountKey, serverVersion), []byte(nil), []byte("1")).Return(true, nil)
 		defer api.AssertExpectations(t)
 
 		p := makePlugin(api)
@@ -613,7 +700,7 @@ func TestCheckForSurveyDM(t *testing.T) {
 	t.Run("should send first ever survey DM", func(t *testing.T) {
 		user := &model.User{
 			Id:       model.NewId(),
-			CreateAt: now.Add(-1*TimeUntilSurvey).UnixNano() / int64(time.Millisecond),
+			CreateAt: now.Add(-1*DefaultTimeUntilSurvey).UnixNano() / int64(time.Millisecond),
 		}
 
 		api := makeAPIMock()
@@ -622,9 +709,13 @@ func TestCheckForSurveyDM(t *testing.T) {
 			StartAt:       now,
 		}), nil)
 		api.On("KVGet", fmt.Sprintf(UserSurveyKey, user.Id)).Return(nil, nil)
+		api.On("KVGet", fmt.Sprintf(UserPreferencesKey, user.Id)).Return(nil, nil)
+		api.On("KVGet", SurveyDefinitionKey).Return(nil, nil)
 		api.On("GetDirectChannel", user.Id, botUserID).Return(&model.Channel{}, nil)
 		api.On("CreatePost", mock.Anything).Return(&model.Post{Id: postID}, nil)
 		api.On("KVSet", fmt.Sprintf(UserSurveyKey, user.Id), newSurveyStateBytes).Return(nil)
+		api.On("KVGet", fmt.Sprintf(SurveySentCountKey, serverVersion)).Return(nil, nil)
+		api.On("KVCompareAndSet", fmt.Sprintf(SurveySentCountKey, serverVersion), []byte(nil), []byte("1")).Return(true, nil)
 		defer api.AssertExpectations(t)
 
 		p := makePlugin(api)
@@ -637,7 +728,7 @@ func TestCheckForSurveyDM(t *testing.T) {
 	t.Run("should return error if unable to save survey state", func(t *testing.T) {
 		user := &model.User{
 			Id:       model.NewId(),
-			CreateAt: now.Add(-1*TimeUntilSurvey).UnixNano() / int64(time.Millisecond),
+			CreateAt: now.Add(-1*DefaultTimeUntilSurvey).UnixNano() / int64(time.Millisecond),
 		}
 
 		api := makeAPIMock()
@@ -646,6 +737,8 @@ func TestCheckForSurveyDM(t *testing.T) {
 			StartAt:       now,
 		}), nil)
 		api.On("KVGet", fmt.Sprintf(UserSurveyKey, user.Id)).Return(nil, nil)
+		api.On("KVGet", fmt.Sprintf(UserPreferencesKey, user.Id)).Return(nil, nil)
+		api.On("KVGet", SurveyDefinitionKey).Return(nil, nil)
 		api.On("GetDirectChannel", user.Id, botUserID).Return(&model.Channel{}, nil)
 		api.On("CreatePost", mock.Anything).Return(&model.Post{Id: postID}, nil)
 		api.On("KVSet", fmt.Sprintf(UserSurveyKey, user.Id), newSurveyStateBytes).Return(&model.AppError{})
@@ -661,7 +754,7 @@ func TestCheckForSurveyDM(t *testing.T) {
 	t.Run("should return error if unable to send DM", func(t *testing.T) {
 		user := &model.User{
 			Id:       model.NewId(),
-			CreateAt: now.Add(-1*TimeUntilSurvey).UnixNano() / int64(time.Millisecond),
+			CreateAt: now.Add(-1*DefaultTimeUntilSurvey).UnixNano() / int64(time.Millisecond),
 		}
 
 		api := makeAPIMock()
@@ -670,6 +763,8 @@ func TestCheckForSurveyDM(t *testing.T) {
 			StartAt:       now,
 		}), nil)
 		api.On("KVGet", fmt.Sprintf(UserSurveyKey, user.Id)).Return(nil, nil)
+		api.On("KVGet", fmt.Sprintf(UserPreferencesKey, user.Id)).Return(nil, nil)
+		api.On("KVGet", SurveyDefinitionKey).Return(nil, nil)
 		api.On("GetDirectChannel", user.Id, botUserID).Return(&model.Channel{}, nil)
 		api.On("CreatePost", mock.Anything).Return(nil, &model.AppError{})
 		defer api.AssertExpectations(t)
@@ -684,7 +779,7 @@ func TestCheckForSurveyDM(t *testing.T) {
 	t.Run("should send survey DM if it's been long enough since the last survey", func(t *testing.T) {
 		user := &model.User{
 			Id:       model.NewId(),
-			CreateAt: now.Add(-1*TimeUntilSurvey).UnixNano() / int64(time.Millisecond),
+			CreateAt: now.Add(-1*DefaultTimeUntilSurvey).UnixNano() / int64(time.Millisecond),
 		}
 
 		api := makeAPIMock()
@@ -694,12 +789,16 @@ func TestCheckForSurveyDM(t *testing.T) {
 		}), nil)
 		api.On("KVGet", fmt.Sprintf(UserSurveyKey, user.Id)).Return(mustMarshalJSON(&userSurveyState{
 			ServerVersion: "5.11.0",
-			SentAt:        now.Add(-1 * MinTimeBetweenUserSurveys),
-			AnsweredAt:    now.Add(-1 * MinTimeBetweenUserSurveys),
+			SentAt:        now.Add(-1 * DefaultMinTimeBetweenUserSurveys),
+			AnsweredAt:    now.Add(-1 * DefaultMinTimeBetweenUserSurveys),
 		}), nil)
+		api.On("KVGet", fmt.Sprintf(UserPreferencesKey, user.Id)).Return(nil, nil)
+		api.On("KVGet", SurveyDefinitionKey).Return(nil, nil)
 		api.On("GetDirectChannel", user.Id, botUserID).Return(&model.Channel{}, nil)
 		api.On("CreatePost", mock.Anything).Return(&model.Post{Id: postID}, nil)
 		api.On("KVSet", fmt.Sprintf(UserSurveyKey, user.Id), newSurveyStateBytes).Return(nil)
+		api.On("KVGet", fmt.Sprintf(SurveySentCountKey, serverVersion)).Return(nil, nil)
+		api.On("KVCompareAndSet", fmt.Sprintf(SurveySentCountKey, serverVersion), []byte(nil), []byte("1")).Return(true, nil)
 		defer api.AssertExpectations(t)
 
 		p := makePlugin(api)
@@ -712,7 +811,7 @@ func TestCheckForSurveyDM(t *testing.T) {
 	t.Run("should not send survey DM if user disabled it", func(t *testing.T) {
 		user := &model.User{
 			Id:       model.NewId(),
-			CreateAt: now.Add(-1*TimeUntilSurvey).UnixNano() / int64(time.Millisecond),
+			CreateAt: now.Add(-1*DefaultTimeUntilSurvey).UnixNano() / int64(time.Millisecond),
 		}
 
 		api := makeAPIMock()
@@ -722,8 +821,8 @@ func TestCheckForSurveyDM(t *testing.T) {
 		}), nil)
 		api.On("KVGet", fmt.Sprintf(UserSurveyKey, user.Id)).Return(mustMarshalJSON(&userSurveyState{
 			ServerVersion: "5.11.0",
-			SentAt:        now.Add(-1 * MinTimeBetweenUserSurveys),
-			AnsweredAt:    now.Add(-1 * MinTimeBetweenUserSurveys),
+			SentAt:        now.Add(-1 * DefaultMinTimeBetweenUserSurveys),
+			AnsweredAt:    now.Add(-1 * DefaultMinTimeBetweenUserSurveys),
 			Disabled:      true,
 		}), nil)
 		defer api.AssertExpectations(t)
@@ -735,10 +834,113 @@ func TestCheckForSurveyDM(t *testing.T) {
 		assert.Nil(t, err)
 	})
 
+	t.Run("should not send survey DM if user opted out in their preferences", func(t *testing.T) {
+		user := &model.User{
+			Id:       model.NewId(),
+			CreateAt: now.Add(-1*DefaultTimeUntilSurvey).UnixNano() / int64(time.Millisecond),
+		}
+
+		api := makeAPIMock()
+		api.On("KVGet", fmt.Sprintf(SurveyKey, serverVersion)).Return(mustMarshalJSON(&surveyState{
+			ServerVersion: serverVersion,
+			StartAt:       now,
+		}), nil)
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, user.Id)).Return(nil, nil)
+		api.On("KVGet", fmt.Sprintf(UserPreferencesKey, user.Id)).Return(mustMarshalJSON(&userPreferences{DisableSurveys: true}), nil)
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api)
+		sent, err := p.checkForSurveyDM(user, now)
+
+		assert.False(t, sent)
+		assert.Nil(t, err)
+	})
+
+	t.Run("should also email users who prefer email", func(t *testing.T) {
+		user := &model.User{
+			Id:       model.NewId(),
+			Email:    "user@example.com",
+			CreateAt: now.Add(-1*DefaultTimeUntilSurvey).UnixNano() / int64(time.Millisecond),
+		}
+
+		api := makeAPIMock()
+		api.On("KVGet", fmt.Sprintf(SurveyKey, serverVersion)).Return(mustMarshalJSON(&surveyState{
+			ServerVersion: serverVersion,
+			StartAt:       now,
+		}), nil)
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, user.Id)).Return(nil, nil)
+		api.On("KVGet", fmt.Sprintf(UserPreferencesKey, user.Id)).Return(mustMarshalJSON(&userPreferences{PreferredChannel: PreferredChannelEmail}), nil)
+		api.On("KVGet", SurveyDefinitionKey).Return(nil, nil)
+		api.On("GetDirectChannel", user.Id, botUserID).Return(&model.Channel{}, nil)
+		api.On("CreatePost", mock.Anything).Return(&model.Post{Id: postID}, nil)
+		api.On("KVSet", fmt.Sprintf(UserSurveyKey, user.Id), newSurveyStateBytes).Return(nil)
+		api.On("KVGet", fmt.Sprintf(SurveySentCountKey, serverVersion)).Return(nil, nil)
+		api.On("KVCompareAndSet", fmt.Sprintf(SurveySentCountKey, serverVersion), []byte(nil), []byte("1")).Return(true, nil)
+		api.On("GetConfig").Return(&model.Config{})
+		api.On("SendMail", "user@example.com", mock.Anything, mock.Anything).Return(nil)
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api)
+		sent, err := p.checkForSurveyDM(user, now)
+
+		assert.True(t, sent)
+		assert.Nil(t, err)
+	})
+
+	t.Run("should not send survey DM if the user isn't part of the survey's audience", func(t *testing.T) {
+		user := &model.User{
+			Id:       model.NewId(),
+			CreateAt: now.Add(-1*DefaultTimeUntilSurvey).UnixNano() / int64(time.Millisecond),
+		}
+
+		api := makeAPIMock()
+		api.On("KVGet", fmt.Sprintf(SurveyKey, serverVersion)).Return(mustMarshalJSON(&surveyState{
+			ServerVersion: serverVersion,
+			StartAt:       now,
+		}), nil)
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, user.Id)).Return(nil, nil)
+		api.On("KVGet", fmt.Sprintf(UserPreferencesKey, user.Id)).Return(nil, nil)
+		api.On("GetTeamsForUser", user.Id).Return([]*model.Team{{Name: "sales"}}, nil)
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api)
+		p.configuration.SurveyIncludeTeams = "engineering"
+
+		sent, err := p.checkForSurveyDM(user, now)
+
+		assert.False(t, sent)
+		assert.Nil(t, err)
+	})
+
+	t.Run("should not send survey DM once the survey has been sent to enough users", func(t *testing.T) {
+		user := &model.User{
+			Id:       model.NewId(),
+			CreateAt: now.Add(-1*DefaultTimeUntilSurvey).UnixNano() / int64(time.Millisecond),
+		}
+
+		api := makeAPIMock()
+		api.On("KVGet", fmt.Sprintf(SurveyKey, serverVersion)).Return(mustMarshalJSON(&surveyState{
+			ServerVersion: serverVersion,
+			StartAt:       now,
+		}), nil)
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, user.Id)).Return(nil, nil)
+		api.On("KVGet", fmt.Sprintf(UserPreferencesKey, user.Id)).Return(nil, nil)
+		api.On("KVGet", fmt.Sprintf(SurveySentCountKey, serverVersion)).Return([]byte("100"), nil)
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api)
+		p.configuration.SurveyMaxSentPerCycle = 100
+
+		sent, err := p.checkForSurveyDM(user, now)
+
+		assert.False(t, sent)
+		assert.Nil(t, err)
+	})
+
 	t.Run("should not send survey or return error if last survey was answered too recently", func(t *testing.T) {
 		user := &model.User{
 			Id:       model.NewId(),
-			CreateAt: now.Add(-1*TimeUntilSurvey).UnixNano() / int64(time.Millisecond),
+			CreateAt: now.Add(-1*DefaultTimeUntilSurvey).UnixNano() / int64(time.Millisecond),
 		}
 
 		api := makeAPIMock()
@@ -748,8 +950,8 @@ func TestCheckForSurveyDM(t *testing.T) {
 		}), nil)
 		api.On("KVGet", fmt.Sprintf(UserSurveyKey, user.Id)).Return(mustMarshalJSON(&userSurveyState{
 			ServerVersion: "5.11.0",
-			SentAt:        now.Add(-1 * MinTimeBetweenUserSurveys),
-			AnsweredAt:    now.Add(-1 * MinTimeBetweenUserSurveys).Add(time.Millisecond),
+			SentAt:        now.Add(-1 * DefaultMinTimeBetweenUserSurveys),
+			AnsweredAt:    now.Add(-1 * DefaultMinTimeBetweenUserSurveys).Add(time.Millisecond),
 		}), nil)
 		defer api.AssertExpectations(t)
 
@@ -763,7 +965,7 @@ func TestCheckForSurveyDM(t *testing.T) {
 	t.Run("should not send survey or return error if last survey was sent too recently", func(t *testing.T) {
 		user := &model.User{
 			Id:       model.NewId(),
-			CreateAt: now.Add(-1*TimeUntilSurvey).UnixNano() / int64(time.Millisecond),
+			CreateAt: now.Add(-1*DefaultTimeUntilSurvey).UnixNano() / int64(time.Millisecond),
 		}
 
 		api := makeAPIMock()
@@ -773,7 +975,7 @@ func TestCheckForSurveyDM(t *testing.T) {
 		}), nil)
 		api.On("KVGet", fmt.Sprintf(UserSurveyKey, user.Id)).Return(mustMarshalJSON(&userSurveyState{
 			ServerVersion: "5.11.0",
-			SentAt:        now.Add(-1 * MinTimeBetweenUserSurveys).Add(time.Millisecond),
+			SentAt:        now.Add(-1 * DefaultMinTimeBetweenUserSurveys).Add(time.Millisecond),
 		}), nil)
 		defer api.AssertExpectations(t)
 
@@ -787,7 +989,7 @@ func TestCheckForSurveyDM(t *testing.T) {
 	t.Run("should not send survey or return error if survey was already sent", func(t *testing.T) {
 		user := &model.User{
 			Id:       model.NewId(),
-			CreateAt: now.Add(-1*TimeUntilSurvey).UnixNano() / int64(time.Millisecond),
+			CreateAt: now.Add(-1*DefaultTimeUntilSurvey).UnixNano() / int64(time.Millisecond),
 		}
 
 		api := makeAPIMock()
@@ -810,7 +1012,7 @@ func TestCheckForSurveyDM(t *testing.T) {
 	t.Run("should return error if unable to get user survey state", func(t *testing.T) {
 		user := &model.User{
 			Id:       model.NewId(),
-			CreateAt: now.Add(-1*TimeUntilSurvey).UnixNano() / int64(time.Millisecond),
+			CreateAt: now.Add(-1*DefaultTimeUntilSurvey).UnixNano() / int64(time.Millisecond),
 		}
 
 		api := makeAPIMock()
@@ -831,7 +1033,7 @@ func TestCheckForSurveyDM(t *testing.T) {
 	t.Run("should not send survey or return error if survey hasn't started yet", func(t *testing.T) {
 		user := &model.User{
 			Id:       model.NewId(),
-			CreateAt: now.Add(-1*TimeUntilSurvey).UnixNano() / int64(time.Millisecond),
+			CreateAt: now.Add(-1*DefaultTimeUntilSurvey).UnixNano() / int64(time.Millisecond),
 		}
 
 		api := makeAPIMock()
@@ -848,10 +1050,57 @@ func TestCheckForSurveyDM(t *testing.T) {
 		assert.Nil(t, err)
 	})
 
+	t.Run("should not send survey or return error if survey has ended", func(t *testing.T) {
+		user := &model.User{
+			Id:       model.NewId(),
+			CreateAt: now.Add(-1*DefaultTimeUntilSurvey).UnixNano() / int64(time.Millisecond),
+		}
+
+		api := makeAPIMock()
+		api.On("KVGet", fmt.Sprintf(SurveyKey, serverVersion)).Return(mustMarshalJSON(&surveyState{
+			ServerVersion: serverVersion,
+			StartAt:       now.Add(-1 * DefaultSurveyDuration),
+			EndAt:         now,
+		}), nil)
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api)
+		sent, err := p.checkForSurveyDM(user, now)
+
+		assert.False(t, sent)
+		assert.Nil(t, err)
+	})
+
+	t.Run("should not send survey or return error if it's outside of the delivery window", func(t *testing.T) {
+		user := &model.User{
+			Id:       model.NewId(),
+			CreateAt: now.Add(-1*DefaultTimeUntilSurvey).UnixNano() / int64(time.Millisecond),
+			Timezone: model.StringMap{"useAutomaticTimezone": "false", "manualTimezone": "America/Toronto"},
+		}
+
+		api := makeAPIMock()
+		api.On("KVGet", fmt.Sprintf(SurveyKey, serverVersion)).Return(mustMarshalJSON(&surveyState{
+			ServerVersion: serverVersion,
+			StartAt:       now,
+		}), nil)
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, user.Id)).Return(nil, nil)
+		api.On("KVGet", fmt.Sprintf(UserPreferencesKey, user.Id)).Return(nil, nil)
+		defer api.AssertExpectations(t)
+
+		p := makePlugin(api)
+		p.configuration.SurveyDeliveryStartHour = 10
+		p.configuration.SurveyDeliveryEndHour = 16
+
+		sent, err := p.checkForSurveyDM(user, now)
+
+		assert.False(t, sent)
+		assert.Nil(t, err)
+	})
+
 	t.Run("should not send survey or return error if there's no survey scheduled", func(t *testing.T) {
 		user := &model.User{
 			Id:       model.NewId(),
-			CreateAt: now.Add(-1*TimeUntilSurvey).UnixNano() / int64(time.Millisecond),
+			CreateAt: now.Add(-1*DefaultTimeUntilSurvey).UnixNano() / int64(time.Millisecond),
 		}
 
 		api := makeAPIMock()
@@ -868,7 +1117,7 @@ func TestCheckForSurveyDM(t *testing.T) {
 	t.Run("should return error if unable to get the scheduled survey", func(t *testing.T) {
 		user := &model.User{
 			Id:       model.NewId(),
-			CreateAt: now.Add(-1*TimeUntilSurvey).UnixNano() / int64(time.Millisecond),
+			CreateAt: now.Add(-1*DefaultTimeUntilSurvey).UnixNano() / int64(time.Millisecond),
 		}
 
 		api := makeAPIMock()
@@ -885,7 +1134,7 @@ func TestCheckForSurveyDM(t *testing.T) {
 	t.Run("should not send survey or return error if the user hasn't existed for long enough", func(t *testing.T) {
 		user := &model.User{
 			Id:       model.NewId(),
-			CreateAt: now.Add(-1*TimeUntilSurvey).Add(time.Minute).UnixNano() / int64(time.Millisecond),
+			CreateAt: now.Add(-1*DefaultTimeUntilSurvey).Add(time.Minute).UnixNano() / int64(time.Millisecond),
 		}
 
 		api := makeAPIMock()
@@ -901,7 +1150,7 @@ func TestCheckForSurveyDM(t *testing.T) {
 	t.Run("should not send survey or return error if surveys are disabled", func(t *testing.T) {
 		user := &model.User{
 			Id:       model.NewId(),
-			CreateAt: now.Add(-1*TimeUntilSurvey).UnixNano() / int64(time.Millisecond),
+			CreateAt: now.Add(-1*DefaultTimeUntilSurvey).UnixNano() / int64(time.Millisecond),
 		}
 
 		api := makeAPIMock()
@@ -964,4 +1213,20 @@ func TestMarkSurveyAnswered(t *testing.T) {
 		assert.False(t, marked)
 		assert.Nil(t, err)
 	})
+
+	t.Run("should return false if the user hasn't been sent a survey", func(t *testing.T) {
+		userID := model.NewId()
+
+		api := &plugintest.API{}
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, userID)).Return(nil, nil)
+		defer api.AssertExpectations(t)
+
+		p := Plugin{}
+		p.SetAPI(api)
+
+		marked, err := p.markSurveyAnswered(userID, toDate(2019, 3, 2))
+
+		assert.False(t, marked)
+		assert.Nil(t, err)
+	})
 }
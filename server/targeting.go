@@ -0,0 +1,135 @@
+// Copyright (c) 2019-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// surveyTargeting is the parsed form of the targeting settings which limit which users receive surveys.
+type surveyTargeting struct {
+	IncludeTeams        []string
+	ExcludeTeams        []string
+	IncludeRoles        []string
+	ExcludeRoles        []string
+	IncludeGroups       []string
+	ExcludeGroups       []string
+	IncludeAuthServices []string
+	ExcludeAuthServices []string
+	ExcludeGuests       bool
+}
+
+func (c *configuration) getSurveyTargeting() *surveyTargeting {
+	return &surveyTargeting{
+		IncludeTeams:        parseTargetingList(c.SurveyIncludeTeams),
+		ExcludeTeams:        parseTargetingList(c.SurveyExcludeTeams),
+		IncludeRoles:        parseTargetingList(c.SurveyIncludeRoles),
+		ExcludeRoles:        parseTargetingList(c.SurveyExcludeRoles),
+		IncludeGroups:       parseTargetingList(c.SurveyIncludeGroups),
+		ExcludeGroups:       parseTargetingList(c.SurveyExcludeGroups),
+		IncludeAuthServices: parseTargetingList(c.SurveyIncludeAuthServices),
+		ExcludeAuthServices: parseTargetingList(c.SurveyExcludeAuthServices),
+		ExcludeGuests:       c.SurveyExcludeGuests,
+	}
+}
+
+// parseTargetingList splits a comma-separated setting into lowercase names, ignoring empty entries.
+func parseTargetingList(setting string) []string {
+	var names []string
+	for _, name := range strings.Split(setting, ",") {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// matchesTargetingList returns whether or not any of the given names appears in the list. Names are compared without
+// regard to case.
+func matchesTargetingList(list []string, names ...string) bool {
+	for _, name := range names {
+		name = strings.ToLower(name)
+
+		for _, entry := range list {
+			if entry == name {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// checkTargetingList returns whether or not a user with the given names passes an include and an exclude list.
+func checkTargetingList(include, exclude []string, names ...string) bool {
+	if len(include) > 0 && !matchesTargetingList(include, names...) {
+		return false
+	}
+
+	return !matchesTargetingList(exclude, names...)
+}
+
+// isUserTargeted returns whether or not the user should receive surveys according to the targeting settings. The
+// user's teams and groups are only loaded if there are rules that need them.
+func (p *Plugin) isUserTargeted(user *model.User) (bool, *model.AppError) {
+	targeting := p.getConfiguration().getSurveyTargeting()
+
+	if targeting.ExcludeGuests && user.IsGuest() {
+		return false, nil
+	}
+
+	if !checkTargetingList(targeting.IncludeRoles, targeting.ExcludeRoles, user.GetRoles()...) {
+		return false, nil
+	}
+
+	authService := user.AuthService
+	if authService == "" {
+		authService = model.UserAuthServiceEmail
+	}
+
+	if !checkTargetingList(targeting.IncludeAuthServices, targeting.ExcludeAuthServices, authService) {
+		return false, nil
+	}
+
+	if len(targeting.IncludeTeams) > 0 || len(targeting.ExcludeTeams) > 0 {
+		teams, err := p.API.GetTeamsForUser(user.Id)
+		if err != nil {
+			return false, err
+		}
+
+		teamNames := make([]string, 0, len(teams))
+		for _, team := range teams {
+			teamNames = append(teamNames, team.Name)
+		}
+
+		if !checkTargetingList(targeting.IncludeTeams, targeting.ExcludeTeams, teamNames...) {
+			return false, nil
+		}
+	}
+
+	if len(targeting.IncludeGroups) > 0 || len(targeting.ExcludeGroups) > 0 {
+		groups, err := p.API.GetGroupsForUser(user.Id)
+		if err != nil {
+			return false, err
+		}
+
+		// LDAP groups don't always have a name, so groups can be matched using their display name as well
+		groupNames := make([]string, 0, len(groups)*2)
+		for _, group := range groups {
+			groupNames = append(groupNames, group.DisplayName)
+			if group.Name != nil {
+				groupNames = append(groupNames, *group.Name)
+			}
+		}
+
+		if !checkTargetingList(targeting.IncludeGroups, targeting.ExcludeGroups, groupNames...) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
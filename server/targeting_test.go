@@ -0,0 +1,149 @@
+// Copyright (c) 2019-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTargetingList(t *testing.T) {
+	assert.Nil(t, parseTargetingList(""))
+	assert.Nil(t, parseTargetingList(" , "))
+	assert.Equal(t, []string{"engineering", "design"}, parseTargetingList("Engineering, design,"))
+}
+
+func TestIsUserTargeted(t *testing.T) {
+	userID := model.NewId()
+
+	for _, test := range []struct {
+		Name          string
+		Configuration *configuration
+		User          *model.User
+		SetupAPI      func(api *plugintest.API)
+		Expected      bool
+	}{
+		{
+			Name:          "no targeting",
+			Configuration: &configuration{},
+			User:          &model.User{Id: userID, Roles: model.SystemUserRoleId},
+			Expected:      true,
+		},
+		{
+			Name:          "excluded guest",
+			Configuration: &configuration{SurveyExcludeGuests: true},
+			User:          &model.User{Id: userID, Roles: model.SystemGuestRoleId},
+			Expected:      false,
+		},
+		{
+			Name:          "guest when guests aren't excluded",
+			Configuration: &configuration{},
+			User:          &model.User{Id: userID, Roles: model.SystemGuestRoleId},
+			Expected:      true,
+		},
+		{
+			Name:          "included role",
+			Configuration: &configuration{SurveyIncludeRoles: "system_admin"},
+			User:          &model.User{Id: userID, Roles: model.SystemUserRoleId + " " + model.SystemAdminRoleId},
+			Expected:      true,
+		},
+		{
+			Name:          "role that isn't included",
+			Configuration: &configuration{SurveyIncludeRoles: "system_admin"},
+			User:          &model.User{Id: userID, Roles: model.SystemUserRoleId},
+			Expected:      false,
+		},
+		{
+			Name:          "excluded role",
+			Configuration: &configuration{SurveyExcludeRoles: "system_admin"},
+			User:          &model.User{Id: userID, Roles: model.SystemUserRoleId + " " + model.SystemAdminRoleId},
+			Expected:      false,
+		},
+		{
+			Name:          "email user when only email is included",
+			Configuration: &configuration{SurveyIncludeAuthServices: "email"},
+			User:          &model.User{Id: userID},
+			Expected:      true,
+		},
+		{
+			Name:          "excluded auth service",
+			Configuration: &configuration{SurveyExcludeAuthServices: "saml, ldap"},
+			User:          &model.User{Id: userID, AuthService: model.UserAuthServiceSaml},
+			Expected:      false,
+		},
+		{
+			Name:          "member of an included team",
+			Configuration: &configuration{SurveyIncludeTeams: "Engineering"},
+			User:          &model.User{Id: userID},
+			SetupAPI: func(api *plugintest.API) {
+				api.On("GetTeamsForUser", userID).Return([]*model.Team{{Name: "sales"}, {Name: "engineering"}}, nil)
+			},
+			Expected: true,
+		},
+		{
+			Name:          "member of an excluded team",
+			Configuration: &configuration{SurveyExcludeTeams: "contractors"},
+			User:          &model.User{Id: userID},
+			SetupAPI: func(api *plugintest.API) {
+				api.On("GetTeamsForUser", userID).Return([]*model.Team{{Name: "engineering"}, {Name: "contractors"}}, nil)
+			},
+			Expected: false,
+		},
+		{
+			Name:          "member of an included group by display name",
+			Configuration: &configuration{SurveyIncludeGroups: "Platform Engineers"},
+			User:          &model.User{Id: userID},
+			SetupAPI: func(api *plugintest.API) {
+				api.On("GetGroupsForUser", userID).Return([]*model.Group{{DisplayName: "Platform Engineers"}}, nil)
+			},
+			Expected: true,
+		},
+		{
+			Name:          "member of an excluded group by name",
+			Configuration: &configuration{SurveyExcludeGroups: "vendors"},
+			User:          &model.User{Id: userID},
+			SetupAPI: func(api *plugintest.API) {
+				api.On("GetGroupsForUser", userID).Return([]*model.Group{{Name: model.NewString("vendors"), DisplayName: "Vendors"}}, nil)
+			},
+			Expected: false,
+		},
+	} {
+		t.Run(test.Name, func(t *testing.T) {
+			api := makeAPIMock()
+			if test.SetupAPI != nil {
+				test.SetupAPI(api)
+			}
+			defer api.AssertExpectations(t)
+
+			p := Plugin{
+				configuration: test.Configuration,
+			}
+			p.SetAPI(api)
+
+			targeted, err := p.isUserTargeted(test.User)
+
+			assert.Nil(t, err)
+			assert.Equal(t, test.Expected, targeted)
+		})
+	}
+
+	t.Run("should return an error if unable to get the user's teams", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("GetTeamsForUser", userID).Return(nil, &model.AppError{})
+		defer api.AssertExpectations(t)
+
+		p := Plugin{
+			configuration: &configuration{SurveyIncludeTeams: "engineering"},
+		}
+		p.SetAPI(api)
+
+		targeted, err := p.isUserTargeted(&model.User{Id: userID})
+
+		assert.NotNil(t, err)
+		assert.False(t, targeted)
+	})
+}
@@ -4,7 +4,9 @@
 package main
 
 import (
+	"fmt"
 	"strings"
+	"time"
 
 	"github.com/mattermost/mattermost/server/public/model"
 	"github.com/mattermost/mattermost/server/public/pluginapi/experimental/bot/logger"
@@ -15,34 +17,129 @@ const (
 	NpsFeedback = "nps_feedback"
 	NpsScore    = "nps_score"
 	NpsDisable  = "nps_disable"
+	NpsAnswer   = "nps_answer"
+	CsatScore   = "csat_score"
+	CesScore    = "ces_score"
 )
 
-func (p *Plugin) initializeTelemetryClient() error {
-	client, err := telemetry.NewRudderClient()
+// updateTelemetryClient creates the Rudder client when events are sent to Rudder and closes it once they no longer
+// are. Other sinks and private mode keep events on the server, so the client is not needed for them. The tracker is
+// recreated afterwards so that it uses the current client.
+func (p *Plugin) updateTelemetryClient() error {
+	p.telemetryLock.Lock()
+	defer p.telemetryLock.Unlock()
+
+	if !p.getConfiguration().sendsEventsToRudder() {
+		p.closeTelemetryClientLocked()
+	} else if p.telemetryClient == nil {
+		client, err := telemetry.NewRudderClient()
+		if err != nil {
+			return err
+		}
+
+		p.telemetryClient = client
+	}
+
+	p.tracker = p.newTracker()
 
-	p.telemetryClient = client
-	return err
+	return nil
+}
+
+// closeTelemetryClient closes the Rudder client, if there is one, flushing any events that it has queued. It waits
+// for events that are being sent with the client to be queued first so that they aren't lost.
+func (p *Plugin) closeTelemetryClient() {
+	p.telemetryLock.Lock()
+	defer p.telemetryLock.Unlock()
+
+	p.closeTelemetryClientLocked()
+}
+
+// closeTelemetryClientLocked is closeTelemetryClient for callers that already hold the telemetryLock.
+func (p *Plugin) closeTelemetryClientLocked() {
+	if p.telemetryClient == nil {
+		return
+	}
+
+	if err := p.telemetryClient.Close(); err != nil {
+		p.API.LogWarn("Failed to close telemetry client", "err", err.Error())
+	}
+
+	p.telemetryClient = nil
 }
 
 func (p *Plugin) initTracker() {
-	p.tracker = telemetry.NewTracker(p.telemetryClient, p.API.GetDiagnosticId(), p.API.GetServerVersion(), manifest.Id, manifest.Version, "nps", telemetry.NewTrackerConfig(p.API.GetConfig()), logger.New(p.API))
+	p.telemetryLock.Lock()
+	defer p.telemetryLock.Unlock()
+
+	p.tracker = p.newTracker()
 }
 
-func (p *Plugin) sendScore(score int, userID string, timestamp int64) {
-	_ = p.tracker.TrackUserEvent(NpsScore, userID, p.getEventProperties(userID, timestamp, map[string]interface{}{
+// newTracker creates a tracker that sends events with the current telemetryClient. The caller must hold the
+// telemetryLock.
+func (p *Plugin) newTracker() telemetry.Tracker {
+	return telemetry.NewTracker(p.telemetryClient, p.API.GetDiagnosticId(), p.API.GetServerVersion(), manifest.Id, manifest.Version, "nps", telemetry.NewTrackerConfig(p.API.GetConfig()), logger.New(p.API))
+}
+
+func (p *Plugin) sendScore(kind *surveyKind, score int, userID string, timestamp int64) {
+	answeredAt := time.UnixMilli(timestamp).UTC()
+	eventUserID := p.getResponseEventUserID(userID, answeredAt)
+	createAt := p.getResponseTime(answeredAt)
+
+	source := fmt.Sprintf("%s:%d", userID, timestamp)
+
+	p.trackUserEvent(kind.EventName, source, eventUserID, createAt, p.getResponseEventProperties(userID, createAt.UnixMilli(), map[string]interface{}{
 		"score": score,
 	}))
 }
 
-func (p *Plugin) sendFeedback(feedback string, email string, userID string, timestamp int64) {
-	_ = p.tracker.TrackUserEvent(NpsFeedback, userID, p.getEventProperties(userID, timestamp, map[string]interface{}{
+func (p *Plugin) sendAnswer(question *surveyQuestion, answer string, userID string, timestamp int64) {
+	answeredAt := time.UnixMilli(timestamp).UTC()
+	eventUserID := p.getResponseEventUserID(userID, answeredAt)
+	createAt := p.getResponseTime(answeredAt)
+
+	source := fmt.Sprintf("%s:%s:%d", userID, question.ID, timestamp)
+
+	p.trackUserEvent(NpsAnswer, source, eventUserID, createAt, p.getResponseEventProperties(userID, createAt.UnixMilli(), map[string]interface{}{
+		"question_id":   question.ID,
+		"question_type": question.Type,
+		"answer":        answer,
+	}))
+}
+
+func (p *Plugin) sendFeedback(postID string, feedback string, email string, context *feedbackContext, userID string, timestamp int64) {
+	properties := map[string]interface{}{
 		"feedback": feedback,
 		"email":    email,
-	}))
+	}
+
+	if context != nil {
+		properties["source"] = context.Source
+		properties["root_id"] = context.RootID
+
+		if context.Source == FeedbackSourceNPS {
+			properties["survey_id"] = context.SurveyID
+			properties["survey_version"] = context.ServerVersion
+			properties["score_post_id"] = context.ScorePostID
+		}
+
+		if context.QuestionID != "" {
+			properties["question_id"] = context.QuestionID
+		}
+
+		if context.Score != nil {
+			properties["score"] = *context.Score
+			properties["score_kind"] = context.Kind
+			properties["segment"] = context.Segment
+		}
+	}
+
+	p.trackUserEvent(NpsFeedback, postID, userID, time.UnixMilli(timestamp).UTC(), p.getEventProperties(userID, timestamp, properties))
 }
 
 func (p *Plugin) sendUserDisabledEvent(userID string, timestamp int64) {
-	_ = p.tracker.TrackUserEvent(NpsDisable, userID, p.getEventProperties(userID, timestamp, map[string]interface{}{}))
+	source := fmt.Sprintf("%s:%d", userID, timestamp)
+
+	p.trackUserEvent(NpsDisable, source, userID, time.UnixMilli(timestamp).UTC(), p.getEventProperties(userID, timestamp, map[string]interface{}{}))
 }
 
 func (p *Plugin) getEventProperties(userID string, timestamp int64, other map[string]interface{}) map[string]interface{} {
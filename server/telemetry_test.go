@@ -4,11 +4,14 @@
 package main
 
 import (
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/mattermost/mattermost/server/public/model"
 	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 func TestGetEventProperties(t *testing.T) {
@@ -268,3 +271,64 @@ func TestGetUserRole(t *testing.T) {
 		})
 	}
 }
+
+func TestSendScore(t *testing.T) {
+	userID := model.NewId()
+	answeredAt := time.Date(2019, time.March, 11, 13, 25, 0, 0, time.UTC)
+
+	makeAPI := func() (*plugintest.API, *outboxEvent) {
+		queued := &outboxEvent{}
+
+		api := makeAPIMock()
+		api.On("KVGet", fmt.Sprintf(UserSurveyKey, userID)).Return(nil, nil).Maybe()
+		api.On("KVGet", AnonymizationSaltKey).Return(mustMarshalJSON("abc123"), nil)
+		api.On("GetSystemInstallDate").Return(int64(1497898133094), nil)
+		api.On("GetUser", userID).Return(&model.User{Id: userID, Roles: model.SystemAdminRoleId, CreateAt: 1546304461000}, nil)
+		api.On("GetLicense").Return(nil)
+		api.On("KVCompareAndSet", mock.AnythingOfType("string"), []byte(nil), mock.Anything).Return(true, nil).Run(func(args mock.Arguments) {
+			mustUnmarshalJSON(args.Get(2).([]byte), queued)
+		})
+
+		return api, queued
+	}
+
+	t.Run("should send the time that the score was given", func(t *testing.T) {
+		api, queued := makeAPI()
+		defer api.AssertExpectations(t)
+
+		p := &Plugin{
+			configuration: &configuration{},
+			now:           func() time.Time { return answeredAt },
+		}
+		p.SetAPI(api)
+
+		p.sendScore(getSurveyKind(QuestionTypeNPS), 7, userID, answeredAt.UnixMilli())
+
+		assert.Equal(t, userID, queued.UserID)
+		assert.Equal(t, answeredAt, queued.CreateAt)
+		assert.Equal(t, float64(answeredAt.UnixMilli()), queued.Properties["timestamp"])
+		assert.Equal(t, "system_admin", queued.Properties["user_role"])
+	})
+
+	t.Run("should only send the day that an anonymous score was given", func(t *testing.T) {
+		api, queued := makeAPI()
+		defer api.AssertExpectations(t)
+
+		p := &Plugin{
+			configuration: &configuration{EnableAnonymousSurveys: true},
+			now:           func() time.Time { return answeredAt },
+			serverVersion: "5.10.0",
+		}
+		p.SetAPI(api)
+
+		p.sendScore(getSurveyKind(QuestionTypeNPS), 7, userID, answeredAt.UnixMilli())
+
+		day := toDate(2019, time.March, 11)
+
+		assert.Equal(t, hashWithSalt("abc123", "5.10.0:"+userID), queued.UserID)
+		assert.Equal(t, day, queued.CreateAt)
+		assert.Equal(t, float64(day.UnixMilli()), queued.Properties["timestamp"])
+		assert.NotContains(t, queued.Properties, "user_role")
+		assert.NotContains(t, queued.Properties, "user_create_at")
+	})
+}
@@ -12,6 +12,10 @@ import (
 	"github.com/mattermost/mattermost/server/public/model"
 )
 
+// kvIncrementAttempts is how many times KVIncrement and KVDecrement will retry when the value is modified
+// concurrently.
+const kvIncrementAttempts = 10
+
 // getServerVersion returns the current server version with only the major and minor version set. For example, both
 // 5.10.0 and 5.10.1 will be returned as "5.10.0" by this method.
 func getServerVersion(serverVersion string) string {
@@ -44,6 +48,93 @@ func (p *Plugin) KVSet(key string, v interface{}) *model.AppError {
 	return p.API.KVSet(key, data)
 }
 
+// KVIncrement atomically increments the integer stored under the given key and returns its new value. A missing key
+// is treated as containing zero.
+func (p *Plugin) KVIncrement(key string) (int64, *model.AppError) {
+	return p.kvAdd(key, 1)
+}
+
+// KVDecrement atomically decrements the integer stored under the given key and returns its new value. A missing key
+// is treated as containing zero.
+func (p *Plugin) KVDecrement(key string) (int64, *model.AppError) {
+	return p.kvAdd(key, -1)
+}
+
+// kvAdd atomically adds delta to the integer stored under the given key and returns its new value.
+func (p *Plugin) kvAdd(key string, delta int64) (int64, *model.AppError) {
+	for attempt := 0; attempt < kvIncrementAttempts; attempt++ {
+		oldData, appErr := p.API.KVGet(key)
+		if appErr != nil {
+			return 0, appErr
+		}
+
+		var value int64
+		if oldData != nil {
+			if err := json.Unmarshal(oldData, &value); err != nil {
+				return 0, &model.AppError{Message: fmt.Sprintf("Unable to deserialize value %s for key %s, err=%s", oldData, key, err)}
+			}
+		}
+
+		value += delta
+
+		newData, err := json.Marshal(value)
+		if err != nil {
+			return 0, &model.AppError{Message: err.Error()}
+		}
+
+		saved, appErr := p.API.KVCompareAndSet(key, oldData, newData)
+		if appErr != nil {
+			return 0, appErr
+		}
+
+		if saved {
+			return value, nil
+		}
+
+		// Another thread modified the value in the meantime, so try again
+	}
+
+	return 0, &model.AppError{Message: fmt.Sprintf("Unable to update value for key %s due to concurrent modification", key)}
+}
+
+// KVForEach calls f with every key in the KV store that starts with the given prefix. Keys are listed one page at a
+// time so that the whole store never needs to be held in memory. Iteration stops as soon as f returns false or an
+// error.
+func (p *Plugin) KVForEach(prefix string, f func(key string) (bool, *model.AppError)) *model.AppError {
+	page := 0
+	perPage := 100
+
+	for {
+		keys, appErr := p.API.KVList(page, perPage)
+		if appErr != nil {
+			return appErr
+		}
+
+		for _, key := range keys {
+			if !strings.HasPrefix(key, prefix) {
+				continue
+			}
+
+			next, appErr := f(key)
+			if appErr != nil {
+				return appErr
+			}
+
+			if !next {
+				return nil
+			}
+		}
+
+		if len(keys) < perPage {
+			break
+		}
+
+		page++
+	}
+
+	return nil
+}
+
 func (p *Plugin) CreateBotDMPost(userID string, post *model.Post) (*model.Post, *model.AppError) {
 	channel, err := p.API.GetDirectChannel(userID, p.botUserID)
 	if err != nil {
@@ -5,6 +5,8 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -111,6 +113,128 @@ func TestKVGet(t *testing.T) {
 	})
 }
 
+func TestKVIncrement(t *testing.T) {
+	t.Run("should start from zero when the key doesn't exist", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVGet", "key").Return(nil, nil)
+		api.On("KVCompareAndSet", "key", []byte(nil), []byte("1")).Return(true, nil)
+		defer api.AssertExpectations(t)
+
+		p := Plugin{}
+		p.SetAPI(api)
+
+		value, err := p.KVIncrement("key")
+
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), value)
+	})
+
+	t.Run("should retry when the value is modified concurrently", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVGet", "key").Return([]byte("4"), nil).Once()
+		api.On("KVCompareAndSet", "key", []byte("4"), []byte("5")).Return(false, nil).Once()
+		api.On("KVGet", "key").Return([]byte("5"), nil).Once()
+		api.On("KVCompareAndSet", "key", []byte("5"), []byte("6")).Return(true, nil).Once()
+		defer api.AssertExpectations(t)
+
+		p := Plugin{}
+		p.SetAPI(api)
+
+		value, err := p.KVIncrement("key")
+
+		assert.Nil(t, err)
+		assert.Equal(t, int64(6), value)
+	})
+
+	t.Run("should return an error if the value isn't a number", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVGet", "key").Return([]byte(`"value"`), nil)
+		defer api.AssertExpectations(t)
+
+		p := Plugin{}
+		p.SetAPI(api)
+
+		_, err := p.KVIncrement("key")
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestKVDecrement(t *testing.T) {
+	api := makeAPIMock()
+	api.On("KVGet", "key").Return([]byte("4"), nil)
+	api.On("KVCompareAndSet", "key", []byte("4"), []byte("3")).Return(true, nil)
+	defer api.AssertExpectations(t)
+
+	p := Plugin{}
+	p.SetAPI(api)
+
+	value, err := p.KVDecrement("key")
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), value)
+}
+
+func TestKVForEach(t *testing.T) {
+	t.Run("should only visit keys with the prefix across multiple pages", func(t *testing.T) {
+		firstPage := make([]string, 100)
+		for i := range firstPage {
+			firstPage[i] = fmt.Sprintf("Other-%d", i)
+		}
+		firstPage[50] = "Prefix-1"
+
+		api := makeAPIMock()
+		api.On("KVList", 0, 100).Return(firstPage, nil)
+		api.On("KVList", 1, 100).Return([]string{"Prefix-2", "Other"}, nil)
+		defer api.AssertExpectations(t)
+
+		p := Plugin{}
+		p.SetAPI(api)
+
+		var visited []string
+		err := p.KVForEach("Prefix-", func(key string) (bool, *model.AppError) {
+			visited = append(visited, key)
+			return true, nil
+		})
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"Prefix-1", "Prefix-2"}, visited)
+	})
+
+	t.Run("should stop early", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVList", 0, 100).Return([]string{"Prefix-1", "Prefix-2"}, nil)
+		defer api.AssertExpectations(t)
+
+		p := Plugin{}
+		p.SetAPI(api)
+
+		var visited []string
+		err := p.KVForEach("Prefix-", func(key string) (bool, *model.AppError) {
+			visited = append(visited, key)
+			return false, nil
+		})
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"Prefix-1"}, visited)
+	})
+
+	t.Run("should return an error from the callback", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVList", 0, 100).Return([]string{"Prefix-1", "Prefix-2"}, nil)
+		defer api.AssertExpectations(t)
+
+		p := Plugin{}
+		p.SetAPI(api)
+
+		err := p.KVForEach("Prefix-", func(key string) (bool, *model.AppError) {
+			return true, &model.AppError{}
+		})
+
+		assert.NotNil(t, err)
+	})
+}
+
 func TestCreateBotDMPost(t *testing.T) {
 	t.Run("should send bot DM correctly", func(t *testing.T) {
 		api := makeAPIMock()
@@ -236,6 +360,16 @@ func makeAPIMock() *plugintest.API {
 	return api
 }
 
+// mockOutbox expects events to be recorded in the outbox to be sent later.
+func mockOutbox(api *plugintest.API) {
+	isOutboxKey := mock.MatchedBy(func(key string) bool {
+		return strings.HasPrefix(key, OutboxEventPrefix)
+	})
+
+	api.On("KVGet", AnonymizationSaltKey).Return(mustMarshalJSON("abc123"), nil)
+	api.On("KVCompareAndSet", isOutboxKey, []byte(nil), mock.Anything).Return(true, nil)
+}
+
 func mustMarshalJSON(v interface{}) []byte {
 	data, err := json.Marshal(v)
 	if err != nil {
@@ -0,0 +1,262 @@
+// Copyright (c) 2019-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	// WebhookSignatureHeader contains the hex-encoded HMAC-SHA256 of the request body, signed with the webhook's
+	// secret, like "sha256=abc123".
+	WebhookSignatureHeader = "X-Feedbackbot-Signature"
+
+	// WebhookEventHeader contains the type of event that the request was sent for, such as "nps_score".
+	WebhookEventHeader = "X-Feedbackbot-Event"
+
+	webhookSignaturePrefix = "sha256="
+
+	// webhookSecretLength is the length of the secrets generated for outgoing webhooks.
+	webhookSecretLength = 32
+)
+
+// webhookEvents are the events that outgoing webhooks can be filtered to.
+var webhookEvents = []string{NpsScore, CsatScore, CesScore, NpsAnswer, NpsFeedback, NpsDisable}
+
+// outgoingWebhook is an HTTP endpoint that each survey response and piece of feedback is sent to. Webhooks are
+// configured as a JSON array in OutgoingWebhooks. Their secrets are generated by the plugin and kept in the KV store
+// instead so that they aren't stored in the server configuration. See getOutgoingWebhookSecret.
+type outgoingWebhook struct {
+	URL string `json:"url"`
+
+	// Events limits the events that are sent to the webhook. The webhook receives every event when it's empty.
+	Events []string `json:"events"`
+}
+
+// webhookPayload is the body of each request sent to an outgoing webhook.
+type webhookPayload struct {
+	ID         string                 `json:"id"`
+	Event      string                 `json:"event"`
+	UserID     string                 `json:"user_id"`
+	CreateAt   int64                  `json:"create_at"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// IsValid returns an error if the webhook can't be used.
+func (w *outgoingWebhook) IsValid() error {
+	if !model.IsValidHTTPURL(w.URL) {
+		return errors.Errorf("invalid outgoing webhook URL %s", w.URL)
+	}
+
+	for _, event := range w.Events {
+		known := false
+		for _, webhookEvent := range webhookEvents {
+			if event == webhookEvent {
+				known = true
+				break
+			}
+		}
+
+		if !known {
+			return errors.Errorf("unknown event %s for outgoing webhook %s, must be one of %s", event, w.URL, strings.Join(webhookEvents, ", "))
+		}
+	}
+
+	return nil
+}
+
+// wantsEvent returns whether or not the given event should be sent to the webhook.
+func (w *outgoingWebhook) wantsEvent(event string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+
+	for _, wanted := range w.Events {
+		if wanted == event {
+			return true
+		}
+	}
+
+	return false
+}
+
+// send posts the event to the webhook, signing the body with the webhook's secret.
+func (w *outgoingWebhook) send(client *http.Client, secret string, event *outboxEvent) error {
+	eventID, _ := event.Properties["event_id"].(string)
+
+	body, err := json.Marshal(&webhookPayload{
+		ID:         eventID,
+		Event:      event.Event,
+		UserID:     event.UserID,
+		CreateAt:   model.GetMillisForTime(event.CreateAt),
+		Properties: event.Properties,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to serialize webhook payload")
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "failed to create webhook request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, event.Event)
+	req.Header.Set(WebhookSignatureHeader, webhookSignaturePrefix+signWebhookPayload(secret, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed to send event to outgoing webhook")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.Errorf("outgoing webhook responded with status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// signWebhookPayload returns the hex-encoded HMAC-SHA256 of the body using the given secret.
+func signWebhookPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// getWebhookEventID returns the ID of the copy of an event that's queued for the outgoing webhook with the given URL.
+func getWebhookEventID(eventID string, url string) string {
+	hash := sha256.Sum256([]byte(eventID + ":" + url))
+	return hex.EncodeToString(hash[:])
+}
+
+// getOutgoingWebhooks parses OutgoingWebhooks. It returns an error if the setting isn't a JSON array of webhooks.
+func (c *configuration) getOutgoingWebhooks() ([]*outgoingWebhook, error) {
+	if strings.TrimSpace(c.OutgoingWebhooks) == "" {
+		return nil, nil
+	}
+
+	var webhooks []*outgoingWebhook
+	if err := json.Unmarshal([]byte(c.OutgoingWebhooks), &webhooks); err != nil {
+		return nil, errors.Wrap(err, "OutgoingWebhooks must be a JSON array of webhooks")
+	}
+
+	return webhooks, nil
+}
+
+// getOutgoingWebhook returns the configured webhook with the given URL, or nil if there isn't one.
+func (c *configuration) getOutgoingWebhook(url string) *outgoingWebhook {
+	// Invalid webhooks are rejected by IsValid, so the error can be ignored here
+	webhooks, _ := c.getOutgoingWebhooks()
+
+	for _, webhook := range webhooks {
+		if webhook.URL == url {
+			return webhook
+		}
+	}
+
+	return nil
+}
+
+// sendToOutgoingWebhook sends an event that was queued for an outgoing webhook. Events for webhooks that have since
+// been removed from the configuration are dropped.
+func (p *Plugin) sendToOutgoingWebhook(event *outboxEvent) error {
+	webhook := p.getConfiguration().getOutgoingWebhook(event.WebhookURL)
+	if webhook == nil {
+		p.API.LogDebug("Dropping event for removed outgoing webhook", "event_id", event.ID)
+		return nil
+	}
+
+	secret, appErr := p.getOutgoingWebhookSecret(webhook.URL)
+	if appErr != nil {
+		return appErr
+	}
+
+	return webhook.send(&http.Client{Timeout: webhookSinkTimeout}, secret, event)
+}
+
+// getOutgoingWebhookSecretKey returns the key that the secret of the outgoing webhook with the given URL is stored
+// under. URLs can be longer than KV keys, so they're hashed.
+func getOutgoingWebhookSecretKey(url string) string {
+	hash := sha256.Sum256([]byte(url))
+	return fmt.Sprintf(OutgoingWebhookSecretKey, hex.EncodeToString(hash[:]))
+}
+
+// getOutgoingWebhookSecret returns the secret that requests to the outgoing webhook with the given URL are signed
+// with, generating it the first time that it's needed.
+func (p *Plugin) getOutgoingWebhookSecret(url string) (string, *model.AppError) {
+	key := getOutgoingWebhookSecretKey(url)
+
+	var secret string
+	if err := p.KVGet(key, &secret); err != nil {
+		return "", err
+	}
+
+	if secret != "" {
+		return secret, nil
+	}
+
+	data, _ := json.Marshal(model.NewRandomString(webhookSecretLength))
+
+	if _, err := p.API.KVCompareAndSet(key, nil, data); err != nil {
+		return "", err
+	}
+
+	// Read the secret back in case another instance of the plugin generated it first
+	if err := p.KVGet(key, &secret); err != nil {
+		return "", err
+	}
+
+	return secret, nil
+}
+
+// rotateOutgoingWebhookSecret replaces the secret of the outgoing webhook with the given URL with a new one and
+// returns it.
+func (p *Plugin) rotateOutgoingWebhookSecret(url string) (string, *model.AppError) {
+	secret := model.NewRandomString(webhookSecretLength)
+
+	if err := p.KVSet(getOutgoingWebhookSecretKey(url), secret); err != nil {
+		return "", err
+	}
+
+	return secret, nil
+}
+
+// queueOutgoingWebhooks records a copy of the event in the outbox for each outgoing webhook that wants it. They're sent
+// and retried like any other event. Each copy's ID is derived from the event's ID and the webhook's
+// URL so that it's only queued once.
+func (p *Plugin) queueOutgoingWebhooks(queued *outboxEvent) {
+	webhooks, _ := p.getConfiguration().getOutgoingWebhooks()
+
+	for _, webhook := range webhooks {
+		if !webhook.wantsEvent(queued.Event) {
+			continue
+		}
+
+		// Copy the properties since the Rudder tracker adds its own to the map that it's given
+		webhookProperties := make(map[string]interface{}, len(queued.Properties))
+		for key, value := range queued.Properties {
+			webhookProperties[key] = value
+		}
+
+		p.queueOutboxEvent(&outboxEvent{
+			ID:            getWebhookEventID(queued.ID, webhook.URL),
+			Event:         queued.Event,
+			UserID:        queued.UserID,
+			Properties:    webhookProperties,
+			WebhookURL:    webhook.URL,
+			CreateAt:      queued.CreateAt,
+			NextAttemptAt: queued.NextAttemptAt,
+		})
+	}
+}
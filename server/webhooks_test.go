@@ -0,0 +1,234 @@
+// Copyright (c) 2019-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutgoingWebhookIsValid(t *testing.T) {
+	for _, test := range []struct {
+		Name        string
+		Webhook     *outgoingWebhook
+		ExpectError bool
+	}{
+		{
+			Name:    "every event",
+			Webhook: &outgoingWebhook{URL: "https://example.com/nps"},
+		},
+		{
+			Name:    "filtered events",
+			Webhook: &outgoingWebhook{URL: "https://example.com/nps", Events: []string{NpsScore, NpsDisable}},
+		},
+		{
+			Name:        "invalid URL",
+			Webhook:     &outgoingWebhook{URL: "example.com"},
+			ExpectError: true,
+		},
+		{
+			Name:        "unknown event",
+			Webhook:     &outgoingWebhook{URL: "https://example.com/nps", Events: []string{"nps_survey"}},
+			ExpectError: true,
+		},
+	} {
+		t.Run(test.Name, func(t *testing.T) {
+			err := test.Webhook.IsValid()
+
+			if test.ExpectError {
+				assert.NotNil(t, err)
+			} else {
+				assert.Nil(t, err)
+			}
+		})
+	}
+}
+
+func TestOutgoingWebhookWantsEvent(t *testing.T) {
+	assert.True(t, (&outgoingWebhook{}).wantsEvent(NpsFeedback))
+	assert.True(t, (&outgoingWebhook{Events: []string{NpsScore, NpsFeedback}}).wantsEvent(NpsFeedback))
+	assert.False(t, (&outgoingWebhook{Events: []string{NpsScore}}).wantsEvent(NpsFeedback))
+}
+
+func TestOutgoingWebhookSend(t *testing.T) {
+	secret := "abc123"
+	eventID := model.NewId()
+	userID := model.NewId()
+	createAt := toDate(2019, time.March, 11)
+
+	event := &outboxEvent{
+		ID:     model.NewId(),
+		Event:  NpsScore,
+		UserID: userID,
+		Properties: map[string]interface{}{
+			"event_id": eventID,
+			"score":    10,
+		},
+		CreateAt: createAt,
+	}
+
+	t.Run("should send a signed payload", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, err := io.ReadAll(r.Body)
+			require.Nil(t, err)
+
+			assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+			assert.Equal(t, NpsScore, r.Header.Get(WebhookEventHeader))
+			assert.Equal(t, "sha256="+signWebhookPayload(secret, body), r.Header.Get(WebhookSignatureHeader))
+
+			var payload *webhookPayload
+			require.Nil(t, json.Unmarshal(body, &payload))
+			assert.Equal(t, &webhookPayload{
+				ID:       eventID,
+				Event:    NpsScore,
+				UserID:   userID,
+				CreateAt: model.GetMillisForTime(createAt),
+				Properties: map[string]interface{}{
+					"event_id": eventID,
+					"score":    float64(10),
+				},
+			}, payload)
+		}))
+		defer server.Close()
+
+		webhook := &outgoingWebhook{URL: server.URL}
+
+		err := webhook.send(server.Client(), secret, event)
+
+		assert.Nil(t, err)
+	})
+
+	t.Run("should return an error when the webhook fails", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer server.Close()
+
+		webhook := &outgoingWebhook{URL: server.URL}
+
+		err := webhook.send(server.Client(), secret, event)
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestSignWebhookPayload(t *testing.T) {
+	// Generated with: echo -n '{"event":"nps_score"}' | openssl dgst -sha256 -hmac abc123
+	assert.Equal(t, "97da83a865a335e002fc160fe7b73baad95d540301c84e567fb2149722923676", signWebhookPayload("abc123", []byte(`{"event":"nps_score"}`)))
+}
+
+func TestGetOutgoingWebhookSecret(t *testing.T) {
+	url := "https://example.com/nps"
+	key := getOutgoingWebhookSecretKey(url)
+
+	t.Run("should return the stored secret", func(t *testing.T) {
+		api := makeAPIMock()
+		api.On("KVGet", key).Return(mustMarshalJSON("abc123"), nil)
+		defer api.AssertExpectations(t)
+
+		p := &Plugin{}
+		p.SetAPI(api)
+
+		secret, err := p.getOutgoingWebhookSecret(url)
+
+		require.Nil(t, err)
+		assert.Equal(t, "abc123", secret)
+	})
+
+	t.Run("should generate a secret the first time that it's needed", func(t *testing.T) {
+		var generated []byte
+
+		api := makeAPIMock()
+		api.On("KVGet", key).Return(nil, nil).Once()
+		api.On("KVCompareAndSet", key, []byte(nil), mock.Anything).Return(true, nil).Run(func(args mock.Arguments) {
+			generated = args.Get(2).([]byte)
+		})
+		api.On("KVGet", key).Return(func(string) []byte { return generated }, nil).Once()
+		defer api.AssertExpectations(t)
+
+		p := &Plugin{}
+		p.SetAPI(api)
+
+		secret, err := p.getOutgoingWebhookSecret(url)
+
+		require.Nil(t, err)
+		assert.Len(t, secret, webhookSecretLength)
+	})
+
+	t.Run("should use a different key for each webhook", func(t *testing.T) {
+		assert.NotEqual(t, key, getOutgoingWebhookSecretKey("https://example.com/other"))
+	})
+}
+
+func TestQueueOutgoingWebhooks(t *testing.T) {
+	userID := model.NewId()
+	now := toDate(2019, time.March, 11)
+
+	t.Run("should only queue the event for webhooks that want it", func(t *testing.T) {
+		eventID := model.NewId()
+
+		var queued []string
+
+		api := makeAPIMock()
+		api.On("KVCompareAndSet", mock.AnythingOfType("string"), []byte(nil), mock.Anything).Return(true, nil).Twice().Run(func(args mock.Arguments) {
+			var event *outboxEvent
+			mustUnmarshalJSON(args.Get(2).([]byte), &event)
+
+			assert.Equal(t, getWebhookEventID(eventID, event.WebhookURL), event.ID)
+			assert.Equal(t, now, event.NextAttemptAt)
+
+			queued = append(queued, event.WebhookURL)
+		})
+		defer api.AssertExpectations(t)
+
+		p := &Plugin{
+			configuration: &configuration{
+				OutgoingWebhooks: `[
+					{"url": "https://example.com/all"},
+					{"url": "https://example.com/scores", "events": ["nps_score"]},
+					{"url": "https://example.com/feedback", "events": ["nps_feedback"]}
+				]`,
+			},
+		}
+		p.SetAPI(api)
+
+		p.queueOutgoingWebhooks(&outboxEvent{
+			ID:            eventID,
+			Event:         NpsScore,
+			UserID:        userID,
+			Properties:    map[string]interface{}{"score": 10},
+			CreateAt:      now,
+			NextAttemptAt: now,
+		})
+
+		assert.Equal(t, []string{"https://example.com/all", "https://example.com/scores"}, queued)
+	})
+
+	t.Run("should drop queued events for webhooks that were removed", func(t *testing.T) {
+		api := makeAPIMock()
+		defer api.AssertExpectations(t)
+
+		p := &Plugin{
+			configuration: &configuration{},
+		}
+		p.SetAPI(api)
+
+		err := p.sendToOutgoingWebhook(&outboxEvent{
+			ID:         model.NewId(),
+			Event:      NpsScore,
+			WebhookURL: "https://example.com/nps",
+		})
+
+		assert.Nil(t, err)
+	})
+}
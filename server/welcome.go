@@ -33,28 +33,41 @@ func (p *Plugin) setWelcomeFeedbackMigration(now time.Time) {
 		}
 	}
 
-	p.welcomeFeedbackAfter = migration.CreateAt.Add(-TimeUntilWelcomeFeedback)
-	p.API.LogDebug(fmt.Sprintf("Will send welcome feedback to users who joined after %s", p.welcomeFeedbackAfter.String()))
+	p.welcomeFeedbackEnabledAt = migration.CreateAt
+	p.API.LogDebug(fmt.Sprintf("Will send welcome feedback to users who joined after %s", p.getWelcomeFeedbackAfter().String()))
+}
+
+// getWelcomeFeedbackAfter returns the date after which new users can get the welcome feedback post. It depends on the
+// current TimeUntilWelcomeFeedback so that changing it doesn't require the plugin to be restarted.
+func (p *Plugin) getWelcomeFeedbackAfter() time.Time {
+	if p.welcomeFeedbackEnabledAt.IsZero() {
+		return time.Time{}
+	}
+
+	return p.welcomeFeedbackEnabledAt.Add(-p.getConfiguration().getTimeUntilWelcomeFeedback())
 }
 
 func (p *Plugin) checkForWelcomeFeedback(user *model.User, now time.Time) (bool, *model.AppError) {
-	if !p.getConfiguration().EnableSurvey {
+	config := p.getConfiguration()
+	if !config.EnableSurvey {
 		return false, nil
 	}
 
+	welcomeFeedbackAfter := p.getWelcomeFeedbackAfter()
+
 	// There probably was an error during the initialization
-	if p.welcomeFeedbackAfter.IsZero() {
+	if welcomeFeedbackAfter.IsZero() {
 		return false, nil
 	}
 
 	createdAt := time.UnixMilli(user.CreateAt)
 	// User created before welcome feedback time - they should never get the message
-	if p.welcomeFeedbackAfter.After(createdAt) {
+	if welcomeFeedbackAfter.After(createdAt) {
 		return false, nil
 	}
 
 	// User has now reached the required time to get the welcome feedback
-	if now.Before(createdAt.Add(TimeUntilWelcomeFeedback)) {
+	if now.Before(createdAt.Add(config.getTimeUntilWelcomeFeedback())) {
 		return false, nil
 	}
 
@@ -68,6 +81,16 @@ func (p *Plugin) checkForWelcomeFeedback(user *model.User, now time.Time) (bool,
 		return false, nil
 	}
 
+	preferences, err := p.getUserPreferences(user.Id)
+	if err != nil {
+		return false, err
+	}
+
+	// The user doesn't want the welcome message
+	if preferences.DisableWelcomeFeedback {
+		return false, nil
+	}
+
 	return true, p.sendWelcomeFeedbackDM(user, now)
 }
 
@@ -75,10 +98,7 @@ func (p *Plugin) sendWelcomeFeedbackDM(user *model.User, now time.Time) *model.A
 	p.API.LogDebug("Sending welcome feedback DM", "user_id", user.Id)
 
 	// Send the DM
-	_, err := p.CreateBotDMPost(user.Id, &model.Post{
-		Message: fmt.Sprintf(welcomeFeedbackRequestBody, user.Username),
-		Type:    "custom_nps_feedback",
-	})
+	post, err := p.CreateBotDMPost(user.Id, p.buildWelcomeFeedbackPost(user, p.getConfiguration().getMessageTemplates()))
 	if err != nil {
 		return err
 	}
@@ -90,5 +110,20 @@ func (p *Plugin) sendWelcomeFeedbackDM(user *model.User, now time.Time) *model.A
 		return err
 	}
 
+	// Store the post so that the user's reply can be attributed to it
+	if err = p.KVSet(fmt.Sprintf(WelcomeFeedbackPostKey, user.Id), &welcomeFeedbackPost{
+		PostID: post.Id,
+		SentAt: now,
+	}); err != nil {
+		p.API.LogWarn("Failed to save welcome feedback post", "err", err)
+	}
+
 	return nil
 }
+
+func (p *Plugin) buildWelcomeFeedbackPost(user *model.User, templates *messageTemplates) *model.Post {
+	return &model.Post{
+		Message: p.renderUserMessage(user, templates.WelcomeFeedback, welcomeFeedbackRequestBody, user.Username),
+		Type:    "custom_nps_feedback",
+	}
+}
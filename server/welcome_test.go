@@ -35,7 +35,7 @@ func TestSetWelcomeFeedbackMigration(t *testing.T) {
 
 		p.setWelcomeFeedbackMigration(testNow)
 
-		assert.Equal(testGetAlreadySet.Add(-TimeUntilWelcomeFeedback), p.welcomeFeedbackAfter)
+		assert.Equal(testGetAlreadySet.Add(-DefaultTimeUntilWelcomeFeedback), p.getWelcomeFeedbackAfter())
 	})
 
 	t.Run("When the feedback migration key is not found, the value must be stored and set on based the argument", func(t *testing.T) {
@@ -46,7 +46,20 @@ func TestSetWelcomeFeedbackMigration(t *testing.T) {
 
 		p.setWelcomeFeedbackMigration(testNow)
 
-		assert.Equal(testNow.Add(-TimeUntilWelcomeFeedback), p.welcomeFeedbackAfter)
+		assert.Equal(testNow.Add(-DefaultTimeUntilWelcomeFeedback), p.getWelcomeFeedbackAfter())
+	})
+
+	t.Run("changing the delay must take effect without setting the migration again", func(t *testing.T) {
+		p.welcomeFeedbackEnabledAt = testNow
+		p.setConfiguration(&configuration{DaysUntilWelcomeFeedback: 7})
+
+		assert.Equal(testNow.Add(-7*24*time.Hour), p.getWelcomeFeedbackAfter())
+	})
+
+	t.Run("when the migration date isn't set, no users can get the welcome feedback post", func(t *testing.T) {
+		p.welcomeFeedbackEnabledAt = time.Time{}
+
+		assert.True(p.getWelcomeFeedbackAfter().IsZero())
 	})
 }
 
@@ -92,7 +105,7 @@ func TestCheckForWelcomeFeedback(t *testing.T) {
 		{
 			Name:          "When the user was created after the feedback time but less than the minimum time required, no message should be sent",
 			EnableSurvey:  true,
-			UserCreatedAt: testNow.Add(TimeUntilWelcomeFeedback - time.Minute),
+			UserCreatedAt: testNow.Add(DefaultTimeUntilWelcomeFeedback - time.Minute),
 			FeedbackAfter: testNow,
 			MessageSent:   false,
 		},
@@ -100,29 +113,50 @@ func TestCheckForWelcomeFeedback(t *testing.T) {
 			Name:          "When the message has already been sent, don't send it again",
 			EnableSurvey:  true,
 			UserID:        "testAlreadySent",
-			UserCreatedAt: testNow.Add(-TimeUntilWelcomeFeedback - time.Minute),
+			UserCreatedAt: testNow.Add(-DefaultTimeUntilWelcomeFeedback - time.Minute),
 			FeedbackAfter: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
 			SetupMock: func(api *plugintest.API) {
 				api.On("KVGet", "UserWelcomeFeedback-testAlreadySent").Return(mustMarshalJSON(true), nil)
 			},
 			MessageSent: false,
 		},
+		{
+			Name:          "When the user disabled the message, don't send it",
+			EnableSurvey:  true,
+			UserID:        "testDisabled",
+			UserCreatedAt: testNow.Add(-DefaultTimeUntilWelcomeFeedback - time.Minute),
+			FeedbackAfter: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+			SetupMock: func(api *plugintest.API) {
+				api.On("KVGet", "UserWelcomeFeedback-testDisabled").Return(mustMarshalJSON(false), nil)
+				api.On("KVGet", "UserPreferences-testDisabled").Return(mustMarshalJSON(&userPreferences{DisableWelcomeFeedback: true}), nil)
+				api.On("KVGet", "UserSurvey-testDisabled").Return(nil, nil)
+			},
+			MessageSent: false,
+		},
 		{
 			Name:          "When the message has not already been sent, send it!",
 			EnableSurvey:  true,
 			UserID:        "testNotAlreadySent",
-			UserCreatedAt: testNow.Add(-TimeUntilWelcomeFeedback - time.Minute),
+			UserCreatedAt: testNow.Add(-DefaultTimeUntilWelcomeFeedback - time.Minute),
 			FeedbackAfter: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
 			SetupMock: func(api *plugintest.API) {
 				// Check if the message has already been sent
 				api.On("KVGet", "UserWelcomeFeedback-testNotAlreadySent").Return(mustMarshalJSON(false), nil)
+				// Check if the user wants the message
+				api.On("KVGet", "UserPreferences-testNotAlreadySent").Return(nil, nil)
+				api.On("KVGet", "UserSurvey-testNotAlreadySent").Return(nil, nil)
 
 				// Getting the DM channel
 				api.On("GetDirectChannel", "testNotAlreadySent", p.botUserID).Return(&model.Channel{Id: "testChannelID"}, nil)
 				// Create the post
-				api.On("CreatePost", mock.AnythingOfType("*model.Post")).Return(&model.Post{}, nil)
+				api.On("CreatePost", mock.AnythingOfType("*model.Post")).Return(&model.Post{Id: "welcomePostID"}, nil)
 				// Store that the message has been sent
 				api.On("KVSet", "UserWelcomeFeedback-testNotAlreadySent", mustMarshalJSON(true)).Return(nil)
+				// Store the post so that the user's reply can be attributed to it
+				api.On("KVSet", "WelcomeFeedbackPost-testNotAlreadySent", mustMarshalJSON(&welcomeFeedbackPost{
+					PostID: "welcomePostID",
+					SentAt: testNow,
+				})).Return(nil)
 			},
 			MessageSent: true,
 		},
@@ -130,7 +164,7 @@ func TestCheckForWelcomeFeedback(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.Name, func(t *testing.T) {
-			p.welcomeFeedbackAfter = tc.FeedbackAfter
+			p.welcomeFeedbackEnabledAt = tc.FeedbackAfter.Add(DefaultTimeUntilWelcomeFeedback)
 			p.configuration.EnableSurvey = tc.EnableSurvey
 
 			apiMock := makeAPIMock()
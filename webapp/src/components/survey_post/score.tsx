@@ -6,6 +6,7 @@ import React from 'react';
 import {changeOpacity} from 'mattermost-redux/utils/theme_utils';
 
 interface Props {
+    isLast: boolean;
     isSmall: boolean;
     score: number;
     selected: boolean;
@@ -43,7 +44,7 @@ export default class Score extends React.PureComponent<Props, State> {
 
     render() {
         const containerStyle: Record<string, string|number> = {...style.container};
-        if (this.props.score !== 10 && !this.props.isSmall) {
+        if (!this.props.isLast && !this.props.isSmall) {
             containerStyle.marginRight = 8;
         }
 
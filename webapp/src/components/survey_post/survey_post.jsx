@@ -40,6 +40,26 @@ export default class SurveyPost extends React.PureComponent {
         return attachment.actions[index];
     }
 
+    // getScale returns the range of scores and their labels. Posts sent before other kinds of surveys existed don't
+    // include them, so those fall back to the NPS scale.
+    getScale = () => {
+        const props = this.props.post.props || {};
+
+        return {
+            min: typeof props.score_min === 'number' ? props.score_min : 0,
+            max: typeof props.score_max === 'number' ? props.score_max : 10,
+            minLabel: props.min_label || 'Not Likely',
+            maxLabel: props.max_label || 'Very Likely',
+        };
+    }
+
+    getTitle = () => {
+        const {post} = this.props;
+        const attachment = post && post.props && post.props.attachments && post.props.attachments[0];
+
+        return (attachment && attachment.title) || 'How likely are you to recommend Mattermost?';
+    }
+
     getSelectedScore = () => {
         const action = this.getAction();
         if (!action || !action.default_option) {
@@ -55,12 +75,15 @@ export default class SurveyPost extends React.PureComponent {
 
     renderScores = (style) => {
         const selectedScore = this.getSelectedScore();
+        const {min, max, minLabel, maxLabel} = this.getScale();
+        const count = (max - min) + 1;
 
         const scores = [];
-        for (let i = 0; i <= 10; i++) {
+        for (let i = min; i <= max; i++) {
             scores.push(
                 <Score
                     key={i}
+                    isLast={i === max}
                     isSmall={this.props.isSmall}
                     selectScore={this.selectScore}
                     score={i}
@@ -71,10 +94,10 @@ export default class SurveyPost extends React.PureComponent {
         }
 
         return (
-            <div style={this.props.isSmall ? style.scoreContainerSmall : style.scoreContainer}>
+            <div style={this.props.isSmall ? style.scoreContainerSmall(count) : style.scoreContainer(count)}>
                 <div style={style.scoreLabels}>
-                    <span>{'Not Likely'}</span>
-                    <span style={style.scoreLabelRight}>{'Very Likely'}</span>
+                    <span>{minLabel}</span>
+                    <span style={style.scoreLabelRight}>{maxLabel}</span>
                 </div>
                 <div style={this.props.isSmall ? style.scoresSmall : style.scores}>
                     {scores}
@@ -83,8 +106,34 @@ export default class SurveyPost extends React.PureComponent {
         );
     }
 
+    // isExpired returns whether the survey ended before the user answered it. The server removes the scores from these
+    // posts and replaces them with a message saying that the survey has ended.
+    isExpired = () => {
+        const props = this.props.post.props || {};
+
+        return Boolean(props.survey_expired);
+    }
+
+    renderExpired = (style) => {
+        const attachment = this.props.post.props.attachments && this.props.post.props.attachments[0];
+
+        return (
+            <React.Fragment>
+                {window.PostUtils.messageHtmlToComponent(window.PostUtils.formatText(this.props.post.message, {atMentions: true}))}
+                <div style={style.container}>
+                    <h1 style={style.title}>{this.getTitle()}</h1>
+                    <span>{attachment && attachment.text}</span>
+                </div>
+            </React.Fragment>
+        );
+    }
+
     render() {
         const style = getStyle(this.props.theme);
+        if (this.isExpired()) {
+            return this.renderExpired(style);
+        }
+
         const disable = () => {
             const action = this.getAction(1);
             this.props.doPostActionWithCookie(this.props.post.id, action.id, action.cookie).then(() => this.setState({disabled: true}));
@@ -110,7 +159,7 @@ export default class SurveyPost extends React.PureComponent {
             <React.Fragment>
                 {window.PostUtils.messageHtmlToComponent(window.PostUtils.formatText(this.props.post.message, {atMentions: true}))}
                 <div style={style.container}>
-                    <h1 style={style.title}>{'How likely are you to recommend Mattermost?'}</h1>
+                    <h1 style={style.title}>{this.getTitle()}</h1>
                     {this.renderScores(style)}
                 </div>
                 {footer}
@@ -134,19 +183,19 @@ const getStyle = makeStyleFromTheme((theme) => {
             marginTop: 5,
             padding: 12,
         },
-        scoreContainer: {
+        scoreContainer: (count) => ({
             display: 'flex',
             flexDirection: 'column',
             lineHeight: 32,
             marginBottom: 4,
-            width: (32 * 11) + (8 * 10), // The width of all 11 score buttons plus the margins between them
-        },
-        scoreContainerSmall: {
+            width: (32 * count) + (8 * (count - 1)), // The width of all score buttons plus the margins between them
+        }),
+        scoreContainerSmall: (count) => ({
             display: 'flex',
             flexDirection: 'column',
             marginBottom: 4,
-            width: 24 * 11, // The width of all 11 score buttons
-        },
+            width: 24 * count, // The width of all score buttons
+        }),
         scoreLabels: {
             display: 'flex',
             flexGrow: 1,
@@ -2,3 +2,8 @@
 // See LICENSE.txt for license information.
 
 export const POST_NPS_SURVEY = 'custom_nps_survey';
+export const POST_CSAT_SURVEY = 'custom_csat_survey';
+export const POST_CES_SURVEY = 'custom_ces_survey';
+
+// SURVEY_POST_TYPES are the types of posts rendered using SurveyPost
+export const SURVEY_POST_TYPES = [POST_NPS_SURVEY, POST_CSAT_SURVEY, POST_CES_SURVEY];
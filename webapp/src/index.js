@@ -3,7 +3,7 @@
 
 import * as Actions from './actions';
 import {Client} from './client';
-import {POST_NPS_SURVEY} from './constants';
+import {SURVEY_POST_TYPES} from './constants';
 import Hooks from './hooks';
 import manifest from './manifest';
 import reducer from './reducers';
@@ -22,7 +22,7 @@ export default class Plugin {
         this.client = null;
 
         this.overrideSurveyPost = false;
-        this.surveyPostComponentId = '';
+        this.surveyPostComponentIds = [];
     }
 
     onStateChange = () => {
@@ -41,13 +41,13 @@ export default class Plugin {
         if (overrideSurveyPost && !this.overrideSurveyPost) {
             // There's enough space to use the custom survey post, so register it
             this.overrideSurveyPost = true;
-            this.surveyPostComponentId = this.registry.registerPostTypeComponent(POST_NPS_SURVEY, SurveyPost);
+            this.surveyPostComponentIds = SURVEY_POST_TYPES.map((postType) => this.registry.registerPostTypeComponent(postType, SurveyPost));
         } else if (!overrideSurveyPost && this.overrideSurveyPost) {
-            // There's not enough space to use the custom score post, so remove it
+            // There's not enough space to use the custom survey post, so remove it
             this.overrideSurveyPost = false;
 
-            this.registry.unregisterPostTypeComponent(this.surveyPostComponentId);
-            this.surveyPostComponentId = '';
+            this.surveyPostComponentIds.forEach((componentId) => this.registry.unregisterPostTypeComponent(componentId));
+            this.surveyPostComponentIds = [];
         }
     }
 
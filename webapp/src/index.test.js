@@ -1,6 +1,7 @@
 // Copyright (c) 2019-present Mattermost, Inc. All Rights Reserved.
 // See LICENSE.txt for license information.
 
+import {SURVEY_POST_TYPES} from './constants';
 import {useSurveyPost} from './selectors';
 
 import Plugin from './index';
@@ -21,7 +22,7 @@ describe('Plugin', () => {
 
             expect(plugin.registry.registerPostTypeComponent).toHaveBeenCalled();
             expect(plugin.overrideSurveyPost).toBe(true);
-            expect(plugin.surveyPostComponentId).toBe('componentId');
+            expect(plugin.surveyPostComponentIds).toEqual(SURVEY_POST_TYPES.map(() => 'componentId'));
         });
 
         test('should not register score post without enough space available', () => {
@@ -36,7 +37,7 @@ describe('Plugin', () => {
 
             expect(plugin.registry.registerPostTypeComponent).not.toHaveBeenCalled();
             expect(plugin.overrideSurveyPost).toBe(false);
-            expect(plugin.surveyPostComponentId).toBe('');
+            expect(plugin.surveyPostComponentIds).toEqual([]);
         });
 
         test('should register and unregister score post as size changes', () => {
@@ -50,25 +51,25 @@ describe('Plugin', () => {
 
             plugin.registerSurveyPost({});
 
-            expect(plugin.registry.registerPostTypeComponent).toHaveBeenCalledTimes(1);
+            expect(plugin.registry.registerPostTypeComponent).toHaveBeenCalledTimes(SURVEY_POST_TYPES.length);
             expect(plugin.overrideSurveyPost).toBe(true);
-            expect(plugin.surveyPostComponentId).toBe('componentId');
+            expect(plugin.surveyPostComponentIds).toEqual(SURVEY_POST_TYPES.map(() => 'componentId'));
 
             useSurveyPost.mockReturnValue(false);
 
             plugin.registerSurveyPost({});
 
-            expect(plugin.registry.unregisterPostTypeComponent).toHaveBeenCalledTimes(1);
+            expect(plugin.registry.unregisterPostTypeComponent).toHaveBeenCalledTimes(SURVEY_POST_TYPES.length);
             expect(plugin.overrideSurveyPost).toBe(false);
-            expect(plugin.surveyPostComponentId).toBe('');
+            expect(plugin.surveyPostComponentIds).toEqual([]);
 
             useSurveyPost.mockReturnValue(true);
 
             plugin.registerSurveyPost({});
 
-            expect(plugin.registry.registerPostTypeComponent).toHaveBeenCalledTimes(2);
+            expect(plugin.registry.registerPostTypeComponent).toHaveBeenCalledTimes(SURVEY_POST_TYPES.length * 2);
             expect(plugin.overrideSurveyPost).toBe(true);
-            expect(plugin.surveyPostComponentId).toBe('componentId');
+            expect(plugin.surveyPostComponentIds).toEqual(SURVEY_POST_TYPES.map(() => 'componentId'));
         });
     });
 });